@@ -39,7 +39,9 @@ type PollJobsResponse struct {
 	Jobs []Job `json:"jobs"`
 }
 type PollJobsRequest struct {
-	Limit int `json:"limit"`
+	Limit       int    `json:"limit"`
+	MachineID   string `json:"machine_id,omitempty"`   // Registered machine claiming the jobs
+	MachineName string `json:"machine_name,omitempty"`
 }
 
 type UploadCSVResponse struct {
@@ -75,7 +77,8 @@ func (ac *APIClient) PollJobs(limit int) (*PollJobsResponse, error) {
 		return nil, err
 	}
 	url := fmt.Sprintf("%s/functions/v1/poll-jobs", ac.config.Supabase.URL)
-	body, _ := json.Marshal(PollJobsRequest{Limit: limit})
+	machineID, machineName := ac.auth.MachineIdentity()
+	body, _ := json.Marshal(PollJobsRequest{Limit: limit, MachineID: machineID, MachineName: machineName})
 	req, err := http.NewRequest("POST", url, bytes.NewBuffer(body))
 	if err != nil {
 		return nil, fmt.Errorf("create poll request: %w", err)
@@ -194,7 +197,7 @@ func (ac *APIClient) UploadOpt(filePath, jobID, resultType string) (*UploadOptRe
 	defer resp.Body.Close()
 	data, _ := io.ReadAll(resp.Body)
 	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("upload failed: http %d - %s", resp.StatusCode, string(data))
+		return nil, fmt.Errorf("upload failed: http %d - %s", resp.StatusCode, responseSnippet(data))
 	}
 
 	var ur UploadOptResponse
@@ -239,7 +242,7 @@ func (ac *APIClient) UploadDailySummary(filePath, jobID string) (*UploadDailySum
 		return nil, fmt.Errorf("create request: %w", err)
 	}
 	req.Header.Set("Content-Type", mw.FormDataContentType())
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", ac.auth.accessToken))
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", ac.auth.AccessToken()))
 
 	resp, err := ac.httpClient.Do(req)
 	if err != nil {
@@ -248,7 +251,7 @@ func (ac *APIClient) UploadDailySummary(filePath, jobID string) (*UploadDailySum
 	defer resp.Body.Close()
 	data, _ := io.ReadAll(resp.Body)
 	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("upload failed: http %d - %s", resp.StatusCode, string(data))
+		return nil, fmt.Errorf("upload failed: http %d - %s", resp.StatusCode, responseSnippet(data))
 	}
 
 	var ur UploadDailySummaryResponse
@@ -267,13 +270,13 @@ func (ac *APIClient) BacktestExistsForJob(jobID string) (bool, error) {
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil { return false, fmt.Errorf("create request: %w", err) }
 	req.Header.Set("apikey", ac.config.Supabase.AnonKey)
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", ac.auth.accessToken))
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", ac.auth.AccessToken()))
 	resp, err := ac.httpClient.Do(req)
 	if err != nil { return false, fmt.Errorf("do request: %w", err) }
 	defer resp.Body.Close()
 	if resp.StatusCode != 200 {
 		b, _ := io.ReadAll(resp.Body)
-		return false, fmt.Errorf("rest query failed: http %d - %s", resp.StatusCode, string(b))
+		return false, fmt.Errorf("rest query failed: http %d - %s", resp.StatusCode, responseSnippet(b))
 	}
 	b, _ := io.ReadAll(resp.Body)
 	// If empty array, not found
@@ -331,7 +334,8 @@ func extractFilenameFromXML(xmlContent string) (string, error) {
 }
 
 func (ac *APIClient) DownloadFile(url, filePath string) error {
-	fmt.Printf("[DEBUG] Starting XML download from URL: %s\n", url)
+	// Signed storage URLs carry a token in the query
+	fmt.Printf("[DEBUG] Starting XML download from URL: %s\n", redact(url))
 	fmt.Printf("[DEBUG] Target file path: %s\n", filePath)
 	
 	req, err := http.NewRequest("GET", url, nil)
@@ -346,8 +350,8 @@ func (ac *APIClient) DownloadFile(url, filePath string) error {
 
 	if resp.StatusCode != 200 {
 		body, _ := io.ReadAll(resp.Body)
-		fmt.Printf("[ERROR] Download failed with status %d: %s\n", resp.StatusCode, string(body))
-		return fmt.Errorf("download failed: http %d - %s", resp.StatusCode, string(body))
+		fmt.Printf("[ERROR] Download failed with status %d: %s\n", resp.StatusCode, responseSnippet(body))
+		return fmt.Errorf("download failed: http %d - %s", resp.StatusCode, responseSnippet(body))
 	}
 
 	// Read the XML content from the response
@@ -358,7 +362,7 @@ func (ac *APIClient) DownloadFile(url, filePath string) error {
 
 	// Enhanced logging for MM task debugging
 	fmt.Printf("[DEBUG] Raw XML content length: %d bytes\n", len(xmlContent))
-	fmt.Printf("[DEBUG] Raw XML content preview (first 500 chars):\n%s\n", string(xmlContent[:min(500, len(xmlContent))]))
+	fmt.Printf("[DEBUG] Raw XML content preview (first 500 chars):\n%s\n", redact(string(xmlContent[:min(500, len(xmlContent))])))
 	
 	// Count job elements in raw XML
 	jobCount := bytes.Count(xmlContent, []byte("<Job>"))
@@ -378,69 +382,34 @@ func (ac *APIClient) DownloadFile(url, filePath string) error {
 				filepath.Base(filePath[:len(filePath)-len(filepath.Ext(filePath))])))
 	}
 
-	rawOut, err := os.Create(rawFilePath)
-	if err != nil {
-		fmt.Printf("[WARNING] Could not create temp XML file %s: %v\n", rawFilePath, err)
+	// The raw copy is kept on disk, so it is encrypted like the job files when encryption is enabled
+	if err := writeAtRestFile(rawFilePath, xmlContent); err != nil {
+		fmt.Printf("[WARNING] Could not write temp XML file %s: %v\n", rawFilePath, err)
 	} else {
-		defer rawOut.Close()
-		_, err = rawOut.Write(xmlContent)
-		if err != nil {
-			fmt.Printf("[WARNING] Could not write temp XML file: %v\n", err)
-		} else {
-			fmt.Printf("[DEBUG] Saved temp XML to: %s\n", rawFilePath)
-		}
+		fmt.Printf("[DEBUG] Saved temp XML to: %s\n", rawFilePath)
 	}
 
-	// Create output file
-	out, err := os.Create(filePath)
+	// Create output file; it only appears under its name once complete
+	out, err := CreateAtomic(filePath, 0644)
 	if err != nil {
 		return fmt.Errorf("create file %s: %w", filePath, err)
 	}
-	defer out.Close()
-
-	// Check if this is an MM job with symbols, MTF job with timeframes, or WFO job that need expansion
-	symbolsPattern := []byte("<symbols>")
-	timeframesPattern := []byte("<timeframes>")
-	oosRunsPattern := []byte("<oos_runs>")
-	mmJobPattern := []byte("<task_type>MM</task_type>")
-	mtfJobPattern := []byte("<task_type>MTF</task_type>")
-	wfoJobPattern := []byte("<task_type>WFO</task_type>")
-	wfmJobPattern := []byte("<task_type>WFM</task_type>")
-	dwfmJobPattern := []byte("<task_type>DWFM</task_type>")
-
-	isMMJob := bytes.Contains(xmlContent, mmJobPattern)
-	isMTFJob := bytes.Contains(xmlContent, mtfJobPattern)
-	isWFOJob := bytes.Contains(xmlContent, wfoJobPattern) || bytes.Contains(xmlContent, wfmJobPattern) || bytes.Contains(xmlContent, dwfmJobPattern)
-	hasSymbolsTag := bytes.Contains(xmlContent, symbolsPattern)
-	hasTimeframesTag := bytes.Contains(xmlContent, timeframesPattern)
-	hasOOSRunsTag := bytes.Contains(xmlContent, oosRunsPattern)
-
-	fmt.Printf("[DEBUG] MM Job detected: %v, MTF Job detected: %v, WFO Job detected: %v, Has symbols tag: %v, Has timeframes tag: %v, Has OOS runs tag: %v\n",
-		isMMJob, isMTFJob, isWFOJob, hasSymbolsTag, hasTimeframesTag, hasOOSRunsTag)
-
-	var finalContent string
-
-	if isMMJob && hasSymbolsTag {
-		// Process MM job to generate multiple job elements for each symbol
-		finalContent = processMMJob(string(xmlContent))
-		fmt.Printf("[DEBUG] Processed MM job - generated multiple job elements\n")
-	} else if isMTFJob && hasTimeframesTag {
-		// Process MTF job to generate multiple job elements for each timeframe
-		finalContent = processMTFJob(string(xmlContent))
-		fmt.Printf("[DEBUG] Processed MTF job - generated multiple job elements\n")
-	} else if isWFOJob && hasOOSRunsTag {
-		// Process WFO job to generate multiple job elements for each run
-		finalContent = processWFOJob(string(xmlContent))
-		fmt.Printf("[DEBUG] Processed WFO job - generated multiple job elements\n")
-	} else {
-		// Regular single job
-		finalContent = fmt.Sprintf("<root>\n%s\n</root>", string(xmlContent))
+	defer out.Abort()
+
+	// Expand MM symbols, MTF timeframes and WFO runs (in that order) into one <Job> per combination
+	finalContent, expandedCount, err := expandJobXML(string(xmlContent), ac.config.Download.MaxExpandedJobs)
+	if err != nil {
+		return fmt.Errorf("expand job: %w", err)
 	}
-	
+	fmt.Printf("[DEBUG] Expanded job into %d job elements\n", expandedCount)
+
 	_, err = out.WriteString(finalContent)
 	if err != nil {
 		return fmt.Errorf("write file: %w", err)
 	}
+	if err := out.Commit(); err != nil {
+		return fmt.Errorf("write file: %w", err)
+	}
 	
 	// Count job elements in final wrapped XML
 	finalJobCount := bytes.Count([]byte(finalContent), []byte("<Job>"))
@@ -457,8 +426,8 @@ func min(a, b int) int {
 	return b
 }
 
-// processMMJob takes a single MM job XML and generates multiple job elements for each symbol
-func processMMJob(xmlContent string) string {
+// expandMMJob takes a single MM job XML and generates one job element for each symbol
+func expandMMJob(xmlContent string) []string {
 	fmt.Printf("[DEBUG] Processing MM job XML for symbol expansion\n")
 	
 	// Extract symbols from <symbols>tag</symbols>
@@ -467,7 +436,7 @@ func processMMJob(xmlContent string) string {
 	
 	if symbolsStart == -1 || symbolsEnd == -1 {
 		fmt.Printf("[DEBUG] No valid symbols tag found, treating as regular job\n")
-		return fmt.Sprintf("<root>\n%s\n</root>", xmlContent)
+		return []string{xmlContent}
 	}
 	
 	symbolsValue := xmlContent[symbolsStart+9 : symbolsEnd] // +9 for "<symbols>"
@@ -477,7 +446,7 @@ func processMMJob(xmlContent string) string {
 	
 	if len(symbols) <= 1 {
 		fmt.Printf("[DEBUG] Only one symbol found, treating as regular job\n")
-		return fmt.Sprintf("<root>\n%s\n</root>", xmlContent)
+		return []string{xmlContent}
 	}
 	
 	// Generate job elements for each symbol
@@ -497,20 +466,20 @@ func processMMJob(xmlContent string) string {
 		
 		// Remove the <symbols> tag from individual job elements
 		jobXML = removeXMLTag(jobXML, "symbols")
+
+		// Give each element its own filename
+		jobXML = deriveJobFilename(jobXML, jobFilenameSymbol, symbol)
 		
 		fmt.Printf("[DEBUG] Generated job element %d for symbol: %s\n", i+1, symbol)
 		jobElements = append(jobElements, jobXML)
 	}
 	
-	// Wrap all job elements in root
-	finalContent := fmt.Sprintf("<root>\n%s\n</root>", strings.Join(jobElements, "\n"))
-	
 	fmt.Printf("[DEBUG] Generated %d job elements for MM task\n", len(jobElements))
-	return finalContent
+	return jobElements
 }
 
-// processMTFJob takes a single MTF job XML and generates multiple job elements for each timeframe
-func processMTFJob(xmlContent string) string {
+// expandMTFJob takes a single MTF job XML and generates one job element for each timeframe
+func expandMTFJob(xmlContent string) []string {
 	fmt.Printf("[DEBUG] Processing MTF job XML for timeframe expansion\n")
 
 	// Extract timeframes from <timeframes>tf1,tf2,tf3</timeframes>
@@ -519,7 +488,7 @@ func processMTFJob(xmlContent string) string {
 
 	if timeframesStart == -1 || timeframesEnd == -1 {
 		fmt.Printf("[DEBUG] No valid timeframes tag found, treating as regular job\n")
-		return fmt.Sprintf("<root>\n%s\n</root>", xmlContent)
+		return []string{xmlContent}
 	}
 
 	timeframesValue := xmlContent[timeframesStart+12 : timeframesEnd] // +12 for "<timeframes>"
@@ -529,7 +498,7 @@ func processMTFJob(xmlContent string) string {
 
 	if len(timeframes) <= 1 {
 		fmt.Printf("[DEBUG] Only one timeframe found, treating as regular job\n")
-		return fmt.Sprintf("<root>\n%s\n</root>", xmlContent)
+		return []string{xmlContent}
 	}
 
 	// Generate job elements for each timeframe
@@ -550,15 +519,15 @@ func processMTFJob(xmlContent string) string {
 		// Remove the <timeframes> tag from individual job elements
 		jobXML = removeXMLTag(jobXML, "timeframes")
 
+		// Give each element its own filename
+		jobXML = deriveJobFilename(jobXML, jobFilenameTimeframe, timeframe)
+
 		fmt.Printf("[DEBUG] Generated job element %d for timeframe: %s\n", i+1, timeframe)
 		jobElements = append(jobElements, jobXML)
 	}
 
-	// Wrap all job elements in root
-	finalContent := fmt.Sprintf("<root>\n%s\n</root>", strings.Join(jobElements, "\n"))
-
 	fmt.Printf("[DEBUG] Generated %d job elements for MTF task\n", len(jobElements))
-	return finalContent
+	return jobElements
 }
 
 // replaceXMLTag replaces the content of an XML tag
@@ -606,46 +575,46 @@ func removeXMLTag(xml, tagName string) string {
 	return before + "\n" + after
 }
 
-// processWFOJob takes a single WFO job XML and generates multiple job elements for each run
-func processWFOJob(xmlContent string) string {
+// expandWFOJob takes a single WFO job XML and generates one job element for each run
+func expandWFOJob(xmlContent string) []string {
 	fmt.Printf("[DEBUG] Processing WFO job XML for run expansion\n")
 
 	// Extract OOS parameters
 	oosRuns, err := extractXMLTagValue(xmlContent, "oos_runs")
 	if err != nil {
 		fmt.Printf("[DEBUG] Could not extract oos_runs: %v, treating as regular job\n", err)
-		return fmt.Sprintf("<root>\n%s\n</root>", xmlContent)
+		return []string{xmlContent}
 	}
 
 	oosPercent, err := extractXMLTagValue(xmlContent, "oos_percent")
 	if err != nil {
 		fmt.Printf("[DEBUG] Could not extract oos_percent: %v, treating as regular job\n", err)
-		return fmt.Sprintf("<root>\n%s\n</root>", xmlContent)
+		return []string{xmlContent}
 	}
 
 	startDate, err := extractXMLTagValue(xmlContent, "startDate")
 	if err != nil {
 		fmt.Printf("[DEBUG] Could not extract startDate: %v, treating as regular job\n", err)
-		return fmt.Sprintf("<root>\n%s\n</root>", xmlContent)
+		return []string{xmlContent}
 	}
 
 	endDate, err := extractXMLTagValue(xmlContent, "endDate")
 	if err != nil {
 		fmt.Printf("[DEBUG] Could not extract endDate: %v, treating as regular job\n", err)
-		return fmt.Sprintf("<root>\n%s\n</root>", xmlContent)
+		return []string{xmlContent}
 	}
 
 	// Parse OOS parameters
 	runs, err := strconv.Atoi(oosRuns)
 	if err != nil {
 		fmt.Printf("[DEBUG] Invalid oos_runs value: %s, treating as regular job\n", oosRuns)
-		return fmt.Sprintf("<root>\n%s\n</root>", xmlContent)
+		return []string{xmlContent}
 	}
 
 	oosPercentFloat, err := strconv.ParseFloat(oosPercent, 64)
 	if err != nil {
 		fmt.Printf("[DEBUG] Invalid oos_percent value: %s, treating as regular job\n", oosPercent)
-		return fmt.Sprintf("<root>\n%s\n</root>", xmlContent)
+		return []string{xmlContent}
 	}
 
 	fmt.Printf("[DEBUG] WFO Parameters - Runs: %d, OOS Percent: %.1f%%, Start: %s, End: %s\n",
@@ -655,7 +624,7 @@ func processWFOJob(xmlContent string) string {
 	dateRanges, err := calculateWFORuns(startDate, endDate, runs, oosPercentFloat)
 	if err != nil {
 		fmt.Printf("[DEBUG] Error calculating WFO runs: %v, treating as regular job\n", err)
-		return fmt.Sprintf("<root>\n%s\n</root>", xmlContent)
+		return []string{xmlContent}
 	}
 
 	// Generate job elements for each run
@@ -692,6 +661,8 @@ func processWFOJob(xmlContent string) string {
 		// Remove the oos_runs tag from individual job elements (not needed per job)
 		jobXML = removeXMLTag(jobXML, "oos_runs")
 
+		// Runs keep the job's filename (one <job>_<symbol>_<timeframe>_WFO.opt); <run> tells them apart
+
 		fmt.Printf("[DEBUG] Generated WFO job element %d: IS(%s to %s)", runNumber, dateRange.ISStartDate, dateRange.ISEndDate)
 		if runNumber < len(dateRanges) {
 			fmt.Printf(", OS(%s to %s)", dateRange.OSStartDate, dateRange.OSEndDate)
@@ -703,11 +674,8 @@ func processWFOJob(xmlContent string) string {
 		jobElements = append(jobElements, jobXML)
 	}
 
-	// Wrap all job elements in root
-	finalContent := fmt.Sprintf("<root>\n%s\n</root>", strings.Join(jobElements, "\n"))
-
 	fmt.Printf("[DEBUG] Generated %d WFO job elements\n", len(jobElements))
-	return finalContent
+	return jobElements
 }
 
 // DateRange represents the date boundaries for a WFO run
@@ -841,6 +809,14 @@ func addXMLTag(xmlContent, tagName, value string) string {
 	return xmlContent[:insertPoint] + newTag + xmlContent[insertPoint:]
 }
 
+// setXMLTag replaces the content of an XML tag, adding the tag when the job doesn't have it
+func setXMLTag(xmlContent, tagName, value string) string {
+	if _, err := extractXMLTagValue(xmlContent, tagName); err != nil {
+		return addXMLTag(xmlContent, tagName, value)
+	}
+	return replaceXMLTag(xmlContent, tagName, value)
+}
+
 func (ac *APIClient) ForceRegenerateXML(jobID string) error {
 	if err := ac.auth.EnsureValidToken(); err != nil {
 		return err
@@ -862,7 +838,7 @@ func (ac *APIClient) ForceRegenerateXML(jobID string) error {
 
 	if resp.StatusCode != 200 {
 		data, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("force regenerate failed: http %d - %s", resp.StatusCode, string(data))
+		return fmt.Errorf("force regenerate failed: http %d - %s", resp.StatusCode, responseSnippet(data))
 	}
 
 	return nil
@@ -878,6 +854,7 @@ type OPTResult struct {
 	OSEndDate     string                 `json:"os_end_date"`
 	AllNetProfit  float64               `json:"all_net_profit"`
 	Parameters    map[string]interface{} `json:"parsed_parameters"`
+	Selection     *ParameterSelection    `json:"selection,omitempty"` // how the parameters were chosen from the run's tests
 }
 
 // generateCombinedWFOXML creates a secondary XML job with fixed parameters for combined daily summary generation
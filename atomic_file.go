@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+)
+
+// atomicTempSuffix marks files still being written; the startup reconciler removes stale ones
+const atomicTempSuffix = ".partial"
+
+// errorNotSameDevice is ERROR_NOT_SAME_DEVICE, returned by a rename across volumes on Windows
+const errorNotSameDevice = syscall.Errno(17)
+
+// AtomicFile is written under a temporary name in the target directory and only appears under
+// its final name once Commit has flushed it to disk. Readers never see a partial file.
+type AtomicFile struct {
+	*os.File
+	path string
+	done bool
+}
+
+// CreateAtomic starts writing path. The caller must call Commit or Abort.
+func CreateAtomic(path string, perm os.FileMode) (*AtomicFile, error) {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*"+atomicTempSuffix)
+	if err != nil {
+		return nil, fmt.Errorf("create temp file for %s: %w", filepath.Base(path), err)
+	}
+	if err := f.Chmod(perm); err != nil && runtime.GOOS != "windows" {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, fmt.Errorf("set mode of %s: %w", filepath.Base(path), err)
+	}
+	return &AtomicFile{File: f, path: path}, nil
+}
+
+// Commit flushes the file, renames it to its final name and flushes the directory entry
+func (a *AtomicFile) Commit() error {
+	if a.done {
+		return fmt.Errorf("%s already committed or aborted", filepath.Base(a.path))
+	}
+	a.done = true
+	tmp := a.File.Name()
+	if err := a.File.Sync(); err != nil {
+		a.File.Close()
+		os.Remove(tmp)
+		return fmt.Errorf("sync %s: %w", filepath.Base(a.path), err)
+	}
+	if err := a.File.Close(); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("close %s: %w", filepath.Base(a.path), err)
+	}
+	if err := os.Rename(tmp, a.path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("rename %s: %w", filepath.Base(a.path), err)
+	}
+	return syncDir(filepath.Dir(a.path))
+}
+
+// Abort discards the file; it does nothing after Commit, so it can be deferred
+func (a *AtomicFile) Abort() {
+	if a.done {
+		return
+	}
+	a.done = true
+	a.File.Close()
+	os.Remove(a.File.Name())
+}
+
+// writeFileAtomic writes data to path with CreateAtomic
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	f, err := CreateAtomic(path, perm)
+	if err != nil {
+		return err
+	}
+	defer f.Abort()
+	if _, err := f.Write(data); err != nil {
+		return fmt.Errorf("write %s: %w", filepath.Base(path), err)
+	}
+	return f.Commit()
+}
+
+// syncDir flushes a directory so a rename into it survives a crash. Windows cannot open
+// directories for syncing and persists renames itself.
+func syncDir(dir string) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+	d, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("open directory %s: %w", dir, err)
+	}
+	defer d.Close()
+	if err := d.Sync(); err != nil && !errors.Is(err, syscall.EINVAL) {
+		return fmt.Errorf("sync directory %s: %w", dir, err)
+	}
+	return nil
+}
+
+// isCrossDeviceError reports whether a rename failed because source and target are on different volumes
+func isCrossDeviceError(err error) bool {
+	var errno syscall.Errno
+	if !errors.As(err, &errno) {
+		return false
+	}
+	return errno == syscall.EXDEV || (runtime.GOOS == "windows" && errno == errorNotSameDevice)
+}
+
+// moveFile moves a file, replacing an existing target. Across volumes, where a rename is not
+// possible, the file is copied, verified against the source and only then is the source removed.
+func moveFile(from, to string) error {
+	err := os.Rename(from, to)
+	if err == nil {
+		if err := syncDir(filepath.Dir(to)); err != nil {
+			return err
+		}
+		if filepath.Dir(from) != filepath.Dir(to) {
+			return syncDir(filepath.Dir(from))
+		}
+		return nil
+	}
+	if !isCrossDeviceError(err) {
+		return err
+	}
+
+	if err := copyFileVerified(from, to); err != nil {
+		return fmt.Errorf("move %s across volumes: %w", filepath.Base(from), err)
+	}
+	if err := os.Remove(from); err != nil {
+		return fmt.Errorf("remove %s after copying it: %w", filepath.Base(from), err)
+	}
+	return syncDir(filepath.Dir(from))
+}
+
+// copyFileVerified copies from to to atomically and checks the copy against the source checksum
+func copyFileVerified(from, to string) error {
+	src, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+
+	dst, err := CreateAtomic(to, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	defer dst.Abort()
+	want := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(dst, want), src); err != nil {
+		return fmt.Errorf("copy: %w", err)
+	}
+	if err := dst.Commit(); err != nil {
+		return err
+	}
+
+	// Read the copy back from disk, the write path may have silently dropped data
+	copied, err := os.Open(to)
+	if err != nil {
+		return fmt.Errorf("reopen copy: %w", err)
+	}
+	defer copied.Close()
+	got := sha256.New()
+	if _, err := io.Copy(got, copied); err != nil {
+		return fmt.Errorf("read back copy: %w", err)
+	}
+	if !bytes.Equal(got.Sum(nil), want.Sum(nil)) {
+		copied.Close()
+		os.Remove(to)
+		return fmt.Errorf("copy of %s does not match the source", filepath.Base(from))
+	}
+	return nil
+}
+
+// isAtomicTempFile reports whether name is a temporary file of CreateAtomic
+func isAtomicTempFile(name string) bool {
+	return strings.HasPrefix(name, ".") && strings.HasSuffix(name, atomicTempSuffix)
+}
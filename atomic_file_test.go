@@ -0,0 +1,158 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testJobFolders points all job, result and OPT folders into a temp directory
+func testJobFolders(t *testing.T) *Config {
+	dir := t.TempDir()
+	cfg := DefaultConfig()
+	files := &cfg.Folders.Files
+	folders := map[string]*string{
+		"jobs_to_do": &files.Jobs.ToDo, "jobs_in_progress": &files.Jobs.InProgress, "jobs_done": &files.Jobs.Done,
+		"jobs_error": &files.Jobs.Error, "jobs_manifests": &files.Jobs.Manifests,
+		"results_temp": &files.Results.Temp, "results_csv": &files.Results.CSV, "results_to_do": &files.Results.ToDo,
+		"results_done": &files.Results.Done, "results_trades": &files.Results.Trades,
+		"results_portfolio": &files.Results.Portfolio, "results_consolidated": &files.Results.Consolidated,
+		"opt_in": &files.Opt.In, "opt_done": &files.Opt.Done, "opt_error": &files.Opt.Error, "opt_summary": &files.Opt.Summary,
+	}
+	for name, folder := range folders {
+		*folder = filepath.Join(dir, name)
+		if err := os.Mkdir(*folder, 0755); err != nil {
+			t.Fatalf("create %s: %v", name, err)
+		}
+	}
+	return cfg
+}
+
+// writeStaleFile writes a file last modified before the reconciler's cutoff
+func writeStaleFile(t *testing.T, path, content string) {
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("write %s: %v", filepath.Base(path), err)
+	}
+	old := time.Now().Add(-2 * staleTempAge)
+	if err := os.Chtimes(path, old, old); err != nil {
+		t.Fatalf("age %s: %v", filepath.Base(path), err)
+	}
+}
+
+func dirNames(t *testing.T, dir string) []string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("read %s: %v", dir, err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	return names
+}
+
+func TestAtomicFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "report.json")
+	if err := os.WriteFile(path, []byte("old"), 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	f, err := CreateAtomic(path, 0644)
+	if err != nil {
+		t.Fatalf("CreateAtomic failed: %v", err)
+	}
+	f.WriteString("half")
+	if got, _ := os.ReadFile(path); string(got) != "old" {
+		t.Fatalf("Target changed before Commit: %q", got)
+	}
+	f.Abort()
+	if names := dirNames(t, dir); len(names) != 1 {
+		t.Fatalf("Abort left files behind: %v", names)
+	}
+
+	if err := writeFileAtomic(path, []byte("new"), 0644); err != nil {
+		t.Fatalf("writeFileAtomic failed: %v", err)
+	}
+	if got, _ := os.ReadFile(path); string(got) != "new" {
+		t.Fatalf("Expected new content, got %q", got)
+	}
+	if names := dirNames(t, dir); len(names) != 1 {
+		t.Fatalf("writeFileAtomic left files behind: %v", names)
+	}
+}
+
+func TestMoveFile(t *testing.T) {
+	dir := t.TempDir()
+	from := filepath.Join(dir, "job.job")
+	if err := os.WriteFile(from, []byte("payload"), 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	to := filepath.Join(dir, "sub", "job.job")
+	os.Mkdir(filepath.Dir(to), 0755)
+	os.WriteFile(to, []byte("replaced"), 0644)
+
+	if err := moveFile(from, to); err != nil {
+		t.Fatalf("moveFile failed: %v", err)
+	}
+	if _, err := os.Stat(from); !os.IsNotExist(err) {
+		t.Fatalf("Source still exists: %v", err)
+	}
+	if got, _ := os.ReadFile(to); string(got) != "payload" {
+		t.Fatalf("Expected moved content, got %q", got)
+	}
+
+	// The fallback used across volumes
+	copyPath := filepath.Join(dir, "copy.job")
+	if err := copyFileVerified(to, copyPath); err != nil {
+		t.Fatalf("copyFileVerified failed: %v", err)
+	}
+	if got, _ := os.ReadFile(copyPath); string(got) != "payload" {
+		t.Fatalf("Expected copied content, got %q", got)
+	}
+	if err := copyFileVerified(filepath.Join(dir, "missing"), copyPath); err == nil {
+		t.Fatalf("Expected an error copying a missing file")
+	}
+}
+
+func TestReconcile(t *testing.T) {
+	cfg := testJobFolders(t)
+	todo, errDir := cfg.Folders.Files.Jobs.ToDo, cfg.Folders.Files.Jobs.Error
+	job := "<Jobs><Job><Symbol>@ES</Symbol><filename>job1_@ES_60_OPT.job</filename></Job></Jobs>"
+
+	writeStaleFile(t, filepath.Join(todo, ".job2_@NQ_60_OPT.job.123"+atomicTempSuffix), "half")
+	writeStaleFile(t, filepath.Join(cfg.Folders.Files.Opt.In, ".job3.opt.456"+atomicTempSuffix), "half")
+	writeStaleFile(t, filepath.Join(todo, "job1_temp.xml"), job)            // Download stopped before compression
+	writeStaleFile(t, filepath.Join(todo, "job1_@ES_60_OPT_temp.xml"), job) // Raw copy, kept
+	writeStaleFile(t, filepath.Join(todo, "job4_temp.xml"), job[:40])       // Cut off mid-download
+	writeStaleFile(t, filepath.Join(todo, "job5_@ES_60_OPT.job"), "\x78\xdatruncated")
+	if err := os.WriteFile(filepath.Join(todo, ".job6.job.789"+atomicTempSuffix), []byte("in use"), 0644); err != nil {
+		t.Fatalf("write fresh temp: %v", err)
+	}
+
+	dm := NewDownloadManager(cfg, nil)
+	summary := dm.Reconcile()
+	want := ReconcileSummary{RemovedPartials: 2, ResumedJobs: 1, QuarantinedJobs: 2}
+	if summary != want {
+		t.Fatalf("Reconcile = %+v, want %+v", summary, want)
+	}
+
+	wantToDo := []string{".job6.job.789" + atomicTempSuffix, "job1_@ES_60_OPT.job", "job1_@ES_60_OPT_temp.xml"}
+	if got := dirNames(t, todo); strings.Join(got, ",") != strings.Join(wantToDo, ",") {
+		t.Fatalf("Jobs.ToDo = %v, want %v", got, wantToDo)
+	}
+	if got, err := decompressJobFile(filepath.Join(todo, "job1_@ES_60_OPT.job")); err != nil || got != job {
+		t.Fatalf("Resumed job decompresses to %q (err %v)", got, err)
+	}
+	wantError := []string{"job4_temp.xml", "job5_@ES_60_OPT.job"}
+	if got := dirNames(t, errDir); strings.Join(got, ",") != strings.Join(wantError, ",") {
+		t.Fatalf("Jobs.Error = %v, want %v", got, wantError)
+	}
+
+	// A second run finds nothing left to do
+	if summary := dm.Reconcile(); summary != (ReconcileSummary{}) {
+		t.Fatalf("Second Reconcile = %+v", summary)
+	}
+}
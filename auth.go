@@ -3,20 +3,50 @@ package main
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"sync"
 	"time"
 )
 
+// tokenExpiryMargin is how long before expiry an access token is no longer handed out
+const tokenExpiryMargin = 5 * time.Minute
+
+// AuthManager holds the session tokens. It is safe for concurrent use: the tokens are guarded by
+// mu, and concurrent refreshes share one request (see refresh).
 type AuthManager struct {
-	config       *Config
-	httpClient   *http.Client
+	config     *Config
+	httpClient *http.Client
+	store      sessionStore // nil when sessions are not persisted
+	machines   sessionStore // holds the API key of a registered machine
+
+	mu           sync.RWMutex
 	accessToken  string
 	refreshToken string
 	tokenExpiry  time.Time
+	email        string
+	machine      *StoredSession // set when signed in as a registered machine; refreshes use its API key
+	generation   uint64         // bumped on sign-in and sign-out so a late refresh cannot resurrect a session
+	inflight     *refreshCall   // the refresh in progress, nil when none
+
+	subscribers  map[int]func(AuthEvent)
+	nextSubID    int
+	changed      chan struct{} // wakes the background refresher when the tokens change
+	stopRefresh  chan struct{}
+	refreshGroup sync.WaitGroup
 }
 
+// refreshCall is one refresh request shared by every caller that needs it
+type refreshCall struct {
+	done chan struct{}
+	err  error
+}
+
+// errSessionRejected marks a refresh token the server no longer accepts
+var errSessionRejected = errors.New("session rejected by server")
+
 type authResponse struct {
 	AccessToken  string `json:"access_token"`
 	RefreshToken string `json:"refresh_token"`
@@ -30,12 +60,17 @@ type authRequest struct {
 
 func NewAuthManager(cfg *Config) *AuthManager {
 	return &AuthManager{
-		config:     cfg,
-		httpClient: &http.Client{Timeout: 30 * time.Second},
+		config:      cfg,
+		httpClient:  &http.Client{Timeout: 30 * time.Second},
+		store:       newSessionStore(cfg),
+		machines:    newCredentialStore(cfg.Auth.UseKeyring, cfg.Supabase.ProjectID+"/machine", cfg.Auth.MachineCredentialFile),
+		subscribers: make(map[int]func(AuthEvent)),
+		changed:     make(chan struct{}, 1),
 	}
 }
 
 func (am *AuthManager) Authenticate(email, password string) error {
+	logRedactor.AddSecret(password)
 	url := fmt.Sprintf("%s/auth/v1/token?grant_type=password", am.config.Supabase.URL)
 	body, _ := json.Marshal(authRequest{Email: email, Password: password})
 	req, err := http.NewRequest("POST", url, bytes.NewBuffer(body))
@@ -61,21 +96,100 @@ func (am *AuthManager) Authenticate(email, password string) error {
 	if err := json.Unmarshal(data, &ar); err != nil {
 		return fmt.Errorf("parse auth response: %w", err)
 	}
-	am.accessToken = ar.AccessToken
-	am.refreshToken = ar.RefreshToken
-	am.tokenExpiry = time.Now().Add(time.Duration(ar.ExpiresIn) * time.Second)
+	am.mu.Lock()
+	am.generation++
+	am.setTokensLocked(ar)
+	am.email = email
+	am.mu.Unlock()
+
+	am.persistSession()
+	am.notify(AuthEvent{Type: AuthSignedIn})
 	return nil
 }
 
+// RefreshToken exchanges the refresh token for new tokens. Concurrent callers share one request.
 func (am *AuthManager) RefreshToken() error {
-	if am.refreshToken == "" {
+	return am.refresh(true)
+}
+
+// refresh runs the single-flight refresh. Without force it returns early when another caller has
+// already refreshed the token in the meantime.
+func (am *AuthManager) refresh(force bool) error {
+	am.mu.Lock()
+	if call := am.inflight; call != nil {
+		am.mu.Unlock()
+		<-call.done
+		return call.err
+	}
+	if !force && am.tokenValidLocked() {
+		am.mu.Unlock()
+		return nil
+	}
+	if !am.canRefreshLocked() {
+		am.mu.Unlock()
 		return fmt.Errorf("no refresh token")
 	}
+	call := &refreshCall{done: make(chan struct{})}
+	am.inflight = call
+	refreshToken, machine, generation := am.refreshToken, am.machine, am.generation
+	am.mu.Unlock()
+
+	var ar authResponse
+	var err error
+	if machine != nil {
+		ar, err = am.requestMachineToken(machine)
+	} else {
+		ar, err = am.requestRefresh(refreshToken)
+	}
+
+	am.mu.Lock()
+	current := am.generation == generation
+	switch {
+	case !current:
+		// Signed out or in again while the request was running; its result belongs to the old session
+		if err == nil {
+			err = fmt.Errorf("session changed during refresh")
+		}
+	case err == nil:
+		am.setTokensLocked(ar)
+	case errors.Is(err, errSessionRejected):
+		am.generation++
+		am.clearTokensLocked()
+	}
+	am.inflight = nil
+	call.err = err
+	am.mu.Unlock()
+	close(call.done)
+
+	if !current {
+		return err
+	}
+	if err == nil {
+		// Refresh tokens are single use, so the stored one must follow every refresh. Machine
+		// sessions are never stored there: they resume from the machine credential.
+		if machine == nil {
+			am.persistSession()
+		}
+		am.notify(AuthEvent{Type: AuthRefreshed})
+		return nil
+	}
+	if errors.Is(err, errSessionRejected) {
+		if machine == nil {
+			am.deleteStoredSession()
+		}
+		am.notify(AuthEvent{Type: AuthLost, Err: err})
+	}
+	return err
+}
+
+// requestRefresh calls the token endpoint; it does not touch the manager's state
+func (am *AuthManager) requestRefresh(refreshToken string) (authResponse, error) {
+	var ar authResponse
 	url := fmt.Sprintf("%s/auth/v1/token?grant_type=refresh_token", am.config.Supabase.URL)
-	body, _ := json.Marshal(map[string]string{"refresh_token": am.refreshToken})
+	body, _ := json.Marshal(map[string]string{"refresh_token": refreshToken})
 	req, err := http.NewRequest("POST", url, bytes.NewBuffer(body))
 	if err != nil {
-		return fmt.Errorf("create refresh request: %w", err)
+		return ar, fmt.Errorf("create refresh request: %w", err)
 	}
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("apikey", am.config.Supabase.AnonKey)
@@ -84,51 +198,201 @@ func (am *AuthManager) RefreshToken() error {
 
 	resp, err := am.httpClient.Do(req)
 	if err != nil {
-		return fmt.Errorf("refresh request failed: %w", err)
+		return ar, fmt.Errorf("refresh request failed: %w", err)
 	}
 	defer resp.Body.Close()
 	data, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode == 400 || resp.StatusCode == 401 || resp.StatusCode == 403 {
+		return ar, fmt.Errorf("refresh failed: http %d: %w", resp.StatusCode, errSessionRejected)
+	}
 	if resp.StatusCode != 200 {
-		return fmt.Errorf("refresh failed: http %d", resp.StatusCode)
+		return ar, fmt.Errorf("refresh failed: http %d", resp.StatusCode)
 	}
 
-	var ar authResponse
 	if err := json.Unmarshal(data, &ar); err != nil {
-		return fmt.Errorf("parse refresh response: %w", err)
+		return ar, fmt.Errorf("parse refresh response: %w", err)
 	}
+	return ar, nil
+}
+
+// setTokensLocked stores new tokens and wakes the background refresher; mu must be held
+func (am *AuthManager) setTokensLocked(ar authResponse) {
+	logRedactor.AddSecret(ar.AccessToken)
+	logRedactor.AddSecret(ar.RefreshToken)
 	am.accessToken = ar.AccessToken
 	am.refreshToken = ar.RefreshToken
 	am.tokenExpiry = time.Now().Add(time.Duration(ar.ExpiresIn) * time.Second)
-	return nil
+	am.signalChanged()
+}
+
+// clearTokensLocked drops the tokens and the machine identity; mu must be held
+func (am *AuthManager) clearTokensLocked() {
+	am.accessToken = ""
+	am.refreshToken = ""
+	am.machine = nil
+	am.tokenExpiry = time.Time{}
+	am.signalChanged()
+}
+
+// tokenValidLocked reports whether the access token is usable; mu must be held (read or write)
+func (am *AuthManager) tokenValidLocked() bool {
+	return am.accessToken != "" && am.tokenExpiry.After(time.Now().Add(tokenExpiryMargin))
+}
+
+// canRefreshLocked reports whether new tokens can be obtained without the user; mu must be held
+func (am *AuthManager) canRefreshLocked() bool {
+	return am.refreshToken != "" || am.machine != nil
 }
 
 func (am *AuthManager) IsTokenValid() bool {
-	if am.accessToken == "" {
-		return false
-	}
-	return am.tokenExpiry.After(time.Now().Add(5 * time.Minute))
+	am.mu.RLock()
+	defer am.mu.RUnlock()
+	return am.tokenValidLocked()
 }
 
 func (am *AuthManager) EnsureValidToken() error {
-	if am.IsTokenValid() {
+	am.mu.RLock()
+	valid, canRefresh := am.tokenValidLocked(), am.canRefreshLocked() || am.inflight != nil
+	am.mu.RUnlock()
+	if valid {
 		return nil
 	}
-	if am.refreshToken != "" {
-		return am.RefreshToken()
+	if canRefresh {
+		return am.refresh(false)
 	}
 	return fmt.Errorf("no valid token available")
 }
 
+// AccessToken returns the current access token ("" when signed out)
+func (am *AuthManager) AccessToken() string {
+	am.mu.RLock()
+	defer am.mu.RUnlock()
+	return am.accessToken
+}
+
 func (am *AuthManager) GetAuthHeaders() map[string]string {
-	return map[string]string{
-		"Authorization": "Bearer " + am.accessToken,
+	headers := map[string]string{
+		"Authorization": "Bearer " + am.AccessToken(),
 		"apikey":        am.config.Supabase.AnonKey,
 		"Content-Type":  "application/json",
 	}
+	// Lets the server attribute jobs and uploads to the machine
+	if id, name := am.MachineIdentity(); id != "" {
+		headers[machineIDHeader] = id
+		headers[machineNameHeader] = name
+	}
+	return headers
 }
 
+// Logout ends the session locally; the stored session is removed so the next start does not resume it
 func (am *AuthManager) Logout() {
-	am.accessToken = ""
-	am.refreshToken = ""
-	am.tokenExpiry = time.Time{}
+	if err := am.clearSession(); err != nil {
+		fmt.Printf("Warning: Could not remove stored session: %v\n", err)
+	}
+}
+
+// clearSession drops the tokens and the stored session
+func (am *AuthManager) clearSession() error {
+	am.signOut()
+	if am.store == nil {
+		return nil
+	}
+	return am.store.Delete()
+}
+
+// signOut drops the tokens in memory only
+func (am *AuthManager) signOut() {
+	am.mu.Lock()
+	am.generation++
+	am.clearTokensLocked()
+	am.mu.Unlock()
+
+	am.notify(AuthEvent{Type: AuthSignedOut})
+}
+
+// deleteStoredSession removes the stored session, logging failures
+func (am *AuthManager) deleteStoredSession() {
+	if am.store == nil {
+		return
+	}
+	if err := am.store.Delete(); err != nil {
+		fmt.Printf("Warning: Could not remove stored session: %v\n", err)
+	}
+}
+
+// Email returns the account of the current session ("" when unknown)
+func (am *AuthManager) Email() string {
+	am.mu.RLock()
+	defer am.mu.RUnlock()
+	return am.email
+}
+
+// persistSession saves the refresh token so the session survives a restart
+func (am *AuthManager) persistSession() {
+	am.mu.RLock()
+	s := &StoredSession{Email: am.email, RefreshToken: am.refreshToken, SavedAt: time.Now().UTC()}
+	am.mu.RUnlock()
+	if am.store == nil || s.RefreshToken == "" {
+		return
+	}
+	if err := am.store.Save(s); err != nil {
+		fmt.Printf("Warning: Could not persist session: %v\n", err)
+	}
+}
+
+// ResumeSession restores the stored session and exchanges its refresh token for a new access token.
+// A token the server rejects is removed; network errors keep it for the next attempt.
+func (am *AuthManager) ResumeSession() error {
+	if am.store == nil {
+		return fmt.Errorf("session persistence is disabled")
+	}
+	s, err := am.store.Load()
+	if err != nil {
+		return err
+	}
+	am.mu.Lock()
+	am.generation++
+	am.email = s.Email
+	am.refreshToken = s.RefreshToken
+	logRedactor.AddSecret(s.RefreshToken)
+	am.mu.Unlock()
+
+	if err := am.RefreshToken(); err != nil {
+		return fmt.Errorf("resume session: %w", err)
+	}
+	return nil
+}
+
+// ForgetDevice signs this device out: the session is revoked on the server when possible and every
+// stored copy is removed, so the password is needed again
+func (am *AuthManager) ForgetDevice() error {
+	var revokeErr error
+	if token := am.AccessToken(); token != "" {
+		revokeErr = am.revokeSession(token)
+	}
+	am.mu.Lock()
+	am.email = ""
+	am.mu.Unlock()
+	return errors.Join(revokeErr, am.clearSession())
+}
+
+// revokeSession invalidates the refresh token on the server
+func (am *AuthManager) revokeSession(accessToken string) error {
+	url := fmt.Sprintf("%s/auth/v1/logout", am.config.Supabase.URL)
+	req, err := http.NewRequest("POST", url, nil)
+	if err != nil {
+		return fmt.Errorf("create logout request: %w", err)
+	}
+	req.Header.Set("apikey", am.config.Supabase.AnonKey)
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+
+	resp, err := am.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("logout request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 && resp.StatusCode != 204 {
+		return fmt.Errorf("logout failed: http %d", resp.StatusCode)
+	}
+	return nil
 }
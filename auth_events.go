@@ -0,0 +1,174 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Background refresh timing: tokens are refreshed this long before they expire, and failed
+// attempts are retried with a doubling delay
+const (
+	backgroundRefreshLead     = 10 * time.Minute
+	backgroundRefreshRetry    = 30 * time.Second
+	backgroundRefreshMaxRetry = 5 * time.Minute
+)
+
+// AuthEventType identifies what happened to the session
+type AuthEventType int
+
+const (
+	AuthSignedIn  AuthEventType = iota // a password, resumed or machine sign-in succeeded
+	AuthRefreshed                      // the tokens were rotated
+	AuthLost                           // the server rejected the session; the user has to sign in again
+	AuthSignedOut                      // Logout or ForgetDevice
+)
+
+func (t AuthEventType) String() string {
+	switch t {
+	case AuthSignedIn:
+		return "signed in"
+	case AuthRefreshed:
+		return "refreshed"
+	case AuthLost:
+		return "lost"
+	case AuthSignedOut:
+		return "signed out"
+	}
+	return fmt.Sprintf("AuthEventType(%d)", int(t))
+}
+
+// AuthEvent is delivered to subscribers; Err is set for AuthLost
+type AuthEvent struct {
+	Type AuthEventType
+	Err  error
+}
+
+// Subscribe registers fn for session events and returns a function that removes it. Listeners run
+// on the goroutine that caused the event, without any AuthManager lock held, so they may call
+// back into the manager but should not block.
+func (am *AuthManager) Subscribe(fn func(AuthEvent)) (unsubscribe func()) {
+	am.mu.Lock()
+	id := am.nextSubID
+	am.nextSubID++
+	am.subscribers[id] = fn
+	am.mu.Unlock()
+	return func() {
+		am.mu.Lock()
+		delete(am.subscribers, id)
+		am.mu.Unlock()
+	}
+}
+
+// notify calls every subscriber; mu must not be held
+func (am *AuthManager) notify(ev AuthEvent) {
+	am.mu.RLock()
+	listeners := make([]func(AuthEvent), 0, len(am.subscribers))
+	for _, fn := range am.subscribers {
+		listeners = append(listeners, fn)
+	}
+	am.mu.RUnlock()
+	for _, fn := range listeners {
+		fn(ev)
+	}
+}
+
+// signalChanged wakes the background refresher without blocking; mu must be held
+func (am *AuthManager) signalChanged() {
+	select {
+	case am.changed <- struct{}{}:
+	default:
+	}
+}
+
+// StartBackgroundRefresh refreshes the tokens shortly before they expire, so requests do not
+// stall on a refresh. Calling it again while it runs does nothing.
+func (am *AuthManager) StartBackgroundRefresh() {
+	am.mu.Lock()
+	defer am.mu.Unlock()
+	if am.stopRefresh != nil {
+		return
+	}
+	stop := make(chan struct{})
+	am.stopRefresh = stop
+	am.refreshGroup.Add(1)
+	go am.backgroundRefreshLoop(stop)
+}
+
+// StopBackgroundRefresh stops the refresher and waits for it to exit
+func (am *AuthManager) StopBackgroundRefresh() {
+	am.mu.Lock()
+	stop := am.stopRefresh
+	am.stopRefresh = nil
+	am.mu.Unlock()
+	if stop == nil {
+		return
+	}
+	close(stop)
+	am.refreshGroup.Wait()
+}
+
+func (am *AuthManager) backgroundRefreshLoop(stop chan struct{}) {
+	defer am.refreshGroup.Done()
+	retry := time.Duration(0)
+	for {
+		wait, ok := am.nextRefreshIn()
+		if retry > 0 {
+			wait = retry
+		}
+		var timer *time.Timer
+		var fire <-chan time.Time
+		if ok {
+			timer = time.NewTimer(wait)
+			fire = timer.C
+		}
+
+		select {
+		case <-stop:
+			stopTimer(timer)
+			return
+		case <-am.changed:
+			// New tokens or signed out: recompute the schedule
+			stopTimer(timer)
+			retry = 0
+			continue
+		case <-fire:
+		}
+
+		err := am.RefreshToken()
+		switch {
+		case err == nil:
+			retry = 0
+		case errors.Is(err, errSessionRejected):
+			// refresh cleared the session and notified AuthLost; wait for the next sign-in
+			retry = 0
+		default:
+			if retry == 0 {
+				retry = backgroundRefreshRetry
+			} else if retry *= 2; retry > backgroundRefreshMaxRetry {
+				retry = backgroundRefreshMaxRetry
+			}
+			fmt.Printf("Warning: Background token refresh failed, retrying in %v: %v\n", retry, err)
+		}
+	}
+}
+
+func stopTimer(t *time.Timer) {
+	if t != nil {
+		t.Stop()
+	}
+}
+
+// nextRefreshIn returns how long until the tokens should be refreshed; false when signed out
+func (am *AuthManager) nextRefreshIn() (time.Duration, bool) {
+	am.mu.RLock()
+	defer am.mu.RUnlock()
+	if !am.canRefreshLocked() {
+		return 0, false
+	}
+	wait := time.Until(am.tokenExpiry.Add(-backgroundRefreshLead))
+	if wait < 0 {
+		wait = 0
+	}
+	return wait, true
+}
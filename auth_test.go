@@ -0,0 +1,198 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// rotatingTokenServer is a concurrency-safe token endpoint with single-use refresh tokens.
+// Each refresh is held until release is closed, if set.
+type rotatingTokenServer struct {
+	mu        sync.Mutex
+	valid     map[string]bool
+	refreshes int
+	rejected  int
+	started   chan struct{}
+	release   chan struct{}
+}
+
+func (s *rotatingTokenServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var body map[string]string
+	json.NewDecoder(r.Body).Decode(&body)
+	if s.started != nil {
+		s.started <- struct{}{}
+	}
+	if s.release != nil {
+		<-s.release
+	}
+	// Widen the window for concurrent callers
+	time.Sleep(20 * time.Millisecond)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.valid[body["refresh_token"]] {
+		s.rejected++
+		http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+		return
+	}
+	delete(s.valid, body["refresh_token"])
+	s.refreshes++
+	next := fmt.Sprintf("refresh-%d", s.refreshes+1)
+	s.valid[next] = true
+	fmt.Fprintf(w, `{"access_token":"access-%d","refresh_token":"%s","expires_in":3600}`, s.refreshes, next)
+}
+
+func (s *rotatingTokenServer) counts() (int, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.refreshes, s.rejected
+}
+
+func newTestAuthManager(url, refreshToken string) *AuthManager {
+	cfg := &Config{}
+	cfg.Supabase.URL = url
+	am := NewAuthManager(cfg)
+	am.refreshToken = refreshToken
+	return am
+}
+
+func TestAuthManagerConcurrentRefresh(t *testing.T) {
+	ts := &rotatingTokenServer{valid: map[string]bool{"refresh-1": true}}
+	server := httptest.NewServer(ts)
+	defer server.Close()
+	am := newTestAuthManager(server.URL, "refresh-1")
+
+	// Everyone finds the token expired at once; only one refresh may reach the server
+	var wg sync.WaitGroup
+	errs := make(chan error, 100)
+	for i := 0; i < 50; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			errs <- am.EnsureValidToken()
+		}()
+		go func() {
+			defer wg.Done()
+			am.IsTokenValid()
+			am.GetAuthHeaders()
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("EnsureValidToken failed: %v", err)
+		}
+	}
+	if refreshes, _ := ts.counts(); refreshes != 1 || am.AccessToken() != "access-1" {
+		t.Fatalf("Expected exactly one refresh, got %d (token %q)", refreshes, am.AccessToken())
+	}
+
+	// Forced refreshes in overlapping bursts must never present an already rotated token
+	errs = make(chan error, 100)
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if i%2 == 0 {
+				errs <- am.RefreshToken()
+			} else {
+				errs <- am.EnsureValidToken()
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("Concurrent refresh failed: %v", err)
+		}
+	}
+	refreshes, rejected := ts.counts()
+	if rejected != 0 || refreshes < 2 || refreshes > 51 {
+		t.Fatalf("Unexpected refresh counts: %d refreshes, %d rejected", refreshes, rejected)
+	}
+	if want := fmt.Sprintf("access-%d", refreshes); am.AccessToken() != want {
+		t.Fatalf("Expected the latest token %s, got %s", want, am.AccessToken())
+	}
+}
+
+func TestAuthManagerLogoutDuringRefresh(t *testing.T) {
+	ts := &rotatingTokenServer{
+		valid:   map[string]bool{"refresh-1": true},
+		started: make(chan struct{}, 1),
+		release: make(chan struct{}),
+	}
+	server := httptest.NewServer(ts)
+	defer server.Close()
+	am := newTestAuthManager(server.URL, "refresh-1")
+
+	done := make(chan error, 1)
+	go func() { done <- am.RefreshToken() }()
+	<-ts.started
+	am.Logout()
+	close(ts.release)
+
+	if err := <-done; err == nil {
+		t.Fatalf("Expected the refresh of a signed out session to fail")
+	}
+	if am.AccessToken() != "" || am.IsTokenValid() {
+		t.Fatalf("A refresh finishing after Logout must not restore the session")
+	}
+}
+
+func TestAuthManagerBackgroundRefresh(t *testing.T) {
+	ts := &rotatingTokenServer{valid: map[string]bool{"refresh-1": true}}
+	server := httptest.NewServer(ts)
+	defer server.Close()
+	am := newTestAuthManager(server.URL, "refresh-1")
+
+	events := make(chan AuthEvent, 10)
+	unsubscribe := am.Subscribe(func(ev AuthEvent) { events <- ev })
+	defer unsubscribe()
+
+	waitFor := func(want AuthEventType) AuthEvent {
+		t.Helper()
+		for {
+			select {
+			case ev := <-events:
+				if ev.Type == want {
+					return ev
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("Timed out waiting for %v", want)
+			}
+		}
+	}
+
+	// An expired token is refreshed without any request asking for it
+	am.StartBackgroundRefresh()
+	defer am.StopBackgroundRefresh()
+	waitFor(AuthRefreshed)
+	if !am.IsTokenValid() {
+		t.Fatalf("Expected a valid token after the background refresh")
+	}
+
+	// Revoke the session on the server and let the token run out: subscribers learn it is lost
+	ts.mu.Lock()
+	ts.valid = map[string]bool{}
+	ts.mu.Unlock()
+	am.mu.Lock()
+	am.tokenExpiry = time.Now()
+	am.signalChanged()
+	am.mu.Unlock()
+
+	ev := waitFor(AuthLost)
+	if !errors.Is(ev.Err, errSessionRejected) {
+		t.Fatalf("Expected errSessionRejected, got %v", ev.Err)
+	}
+	if am.IsTokenValid() || am.EnsureValidToken() == nil {
+		t.Fatalf("Expected no usable token after the session was lost")
+	}
+}
@@ -0,0 +1,650 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// cliCommand is a command-line subcommand that runs without the GUI
+type cliCommand struct {
+	name  string
+	usage string
+	run   func(args []string) int
+}
+
+// cliCommands lists the available subcommands in the order they are shown in the usage text
+var cliCommands = []cliCommand{
+	{"returns", "returns [-capital N] [-test-type IS|OS] [-json] [trades.csv]  Monthly/yearly returns table", runReturnsCommand},
+	{"trades", "trades [-stop-percentile P] [-test-type IS|OS] [-json] [trades.csv]  MAE/MFE, efficiency and R-multiple analysis", runTradesCommand},
+	{"resim", "resim [-sizing original|fixed|fractional|atr] [cost/sizing options] [-json] [trades.csv]  Re-simulate with other sizing/costs", runResimCommand},
+	{"opt", "opt [-top N] [-by metric] [-min-trades N] [-pareto] [-heatmap x,y] [-json|-csv] [file.opt]  Query optimization results", runOptCommand},
+	{"robust", "robust [-params JSON] [-mode steps|lhs] [-samples N] [-seed N] [-task RETEST] job-file  Generate a parameter neighborhood robustness job", runRobustCommand},
+	{"robust-report", "robust-report [-by metric] [-json] plan.json file.opt  Sensitivity report of a robustness job", runRobustReportCommand},
+	{"register", "register [-name NAME] [-machine-id ID < key]  Register this machine for unattended sign-in (device code or API key)", runRegisterCommand},
+	{"unregister", "unregister  Revoke and remove this machine's credential", runUnregisterCommand},
+	{"daemon", "daemon [-limit N]  Poll and process jobs without the GUI, signed in as the registered machine", runDaemonCommand},
+	{"verify", "verify [-json] [dir...]  Check job and OPT files for truncation and checksum errors", runVerifyCommand},
+	{"encrypt", "encrypt [-decrypt] [-init-key] [-dry-run] [dir...]  Encrypt existing job and OPT folders at rest (or decrypt them)", runEncryptCommand},
+}
+
+// runCLI dispatches a subcommand and returns the process exit code
+func runCLI(args []string) int {
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		printCLIUsage(os.Stdout)
+		return 0
+	}
+
+	for _, cmd := range cliCommands {
+		if cmd.name == args[0] {
+			return cmd.run(args[1:])
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "unknown command: %s\n\n", args[0])
+	printCLIUsage(os.Stderr)
+	return 2
+}
+
+// printCLIUsage writes the list of subcommands
+func printCLIUsage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: alpha-weaver-gui [command] [options]")
+	fmt.Fprintln(w, "Without a command the GUI is started.")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	for _, cmd := range cliCommands {
+		fmt.Fprintf(w, "  %s\n", cmd.usage)
+	}
+}
+
+// resolveTradesCSVPath returns the path as given if it exists, otherwise looks it up in Results.Trades
+func resolveTradesCSVPath(cfg *Config, name string) (string, error) {
+	if _, err := os.Stat(name); err == nil {
+		return name, nil
+	}
+	candidate := filepath.Join(cfg.Folders.Files.Results.Trades, name)
+	if _, err := os.Stat(candidate); err != nil {
+		return "", fmt.Errorf("trades CSV not found: %s", name)
+	}
+	return candidate, nil
+}
+
+// listTradesCSVFiles returns the trades CSV file names in Results.Trades
+func listTradesCSVFiles(cfg *Config) ([]string, error) {
+	matches, err := filepath.Glob(filepath.Join(cfg.Folders.Files.Results.Trades, "*_trades.csv"))
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(matches))
+	for _, m := range matches {
+		names = append(names, filepath.Base(m))
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// loadTradesForCLI resolves and parses a trades CSV quietly, optionally keeping only IS or OS trades
+func loadTradesForCLI(cfg *Config, name, testType string) ([]TradeRecord, error) {
+	path, err := resolveTradesCSVPath(cfg, name)
+	if err != nil {
+		return nil, err
+	}
+
+	trades, err := readTradesCSVFile(path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if testType == "" {
+		return trades, nil
+	}
+	var filtered []TradeRecord
+	for _, trade := range trades {
+		if strings.EqualFold(trade.TestType, testType) {
+			filtered = append(filtered, trade)
+		}
+	}
+	return filtered, nil
+}
+
+// printTradesCSVList prints the available trades CSV files when no file argument is given
+func printTradesCSVList(cfg *Config) int {
+	names, err := listTradesCSVFiles(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "list trades CSV files: %v\n", err)
+		return 1
+	}
+	fmt.Printf("Trades CSV files in %s:\n", cfg.Folders.Files.Results.Trades)
+	for _, name := range names {
+		fmt.Printf("  %s\n", name)
+	}
+	if len(names) == 0 {
+		fmt.Println("  (none)")
+	}
+	return 0
+}
+
+// writeJSON prints v as indented JSON to stdout
+func writeJSON(v interface{}) int {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		fmt.Fprintf(os.Stderr, "encode JSON: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// runReturnsCommand prints the monthly/yearly returns grid for a trades CSV
+func runReturnsCommand(args []string) int {
+	fs := flag.NewFlagSet("returns", flag.ContinueOnError)
+	capital := fs.Float64("capital", defaultInitialCapital, "starting capital for percent returns")
+	testType := fs.String("test-type", "", "only include IS or OS trades")
+	asJSON := fs.Bool("json", false, "print the tables as JSON")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	cfg := DefaultConfig()
+	if fs.NArg() == 0 {
+		return printTradesCSVList(cfg)
+	}
+
+	trades, err := loadTradesForCLI(cfg, fs.Arg(0), *testType)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+
+	cal := buildReturnsCalendarFromTrades(trades, *capital)
+	if *asJSON {
+		return writeJSON(cal)
+	}
+	printReturnsCalendar(os.Stdout, cal)
+	return 0
+}
+
+// printReturnsCalendar writes the calendar as a Year x Month grid of percent returns
+func printReturnsCalendar(w io.Writer, cal ReturnsCalendar) {
+	if len(cal.Monthly) == 0 {
+		fmt.Fprintln(w, "No trades.")
+		return
+	}
+
+	months := []string{"Jan", "Feb", "Mar", "Apr", "May", "Jun", "Jul", "Aug", "Sep", "Oct", "Nov", "Dec"}
+	fmt.Fprintf(w, "%-6s", "Year")
+	for _, m := range months {
+		fmt.Fprintf(w, "%8s", m)
+	}
+	fmt.Fprintf(w, "%9s\n", "Year")
+
+	cells := make(map[[2]int]MonthlyReturn)
+	for _, m := range cal.Monthly {
+		cells[[2]int{m.Year, m.Month}] = m
+	}
+	for _, y := range cal.Yearly {
+		fmt.Fprintf(w, "%-6d", y.Year)
+		for month := 1; month <= 12; month++ {
+			if m, ok := cells[[2]int{y.Year, month}]; ok {
+				fmt.Fprintf(w, "%7.1f%%", m.ReturnPct*100)
+			} else {
+				fmt.Fprintf(w, "%8s", "")
+			}
+		}
+		fmt.Fprintf(w, "%8.1f%%\n", y.ReturnPct*100)
+	}
+
+	fmt.Fprintln(w)
+	if cal.BestMonth != nil {
+		fmt.Fprintf(w, "Best month:      %s  %.2f (%.1f%%)\n", cal.BestMonth.Label, cal.BestMonth.PnL, cal.BestMonth.ReturnPct*100)
+	}
+	if cal.WorstMonth != nil {
+		fmt.Fprintf(w, "Worst month:     %s  %.2f (%.1f%%)\n", cal.WorstMonth.Label, cal.WorstMonth.PnL, cal.WorstMonth.ReturnPct*100)
+	}
+	fmt.Fprintf(w, "Positive months: %d of %d (%.0f%%)\n", cal.PositiveMonths, cal.TotalMonths, cal.PositiveMonthsShare*100)
+}
+
+// runTradesCommand prints the excursion/efficiency analysis for a trades CSV
+func runTradesCommand(args []string) int {
+	fs := flag.NewFlagSet("trades", flag.ContinueOnError)
+	stopPercentile := fs.Float64("stop-percentile", defaultStopPercentile, "winners' MAE percentile for the stop suggestion")
+	testType := fs.String("test-type", "", "only include IS or OS trades")
+	asJSON := fs.Bool("json", false, "print the analysis as JSON")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	cfg := DefaultConfig()
+	if fs.NArg() == 0 {
+		return printTradesCSVList(cfg)
+	}
+
+	trades, err := loadTradesForCLI(cfg, fs.Arg(0), *testType)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+
+	report := analyzeTradeExcursions(trades, *stopPercentile)
+	if *asJSON {
+		return writeJSON(report)
+	}
+	printTradeExcursionReport(os.Stdout, report)
+	return 0
+}
+
+// printTradeExcursionReport writes a human-readable summary of the excursion analysis
+func printTradeExcursionReport(w io.Writer, r TradeExcursionReport) {
+	median := func(d DistributionSummary) float64 {
+		for _, p := range d.Percentiles {
+			if p.Percentile == 50 {
+				return p.Value
+			}
+		}
+		return 0
+	}
+
+	fmt.Fprintf(w, "Trades: %d (%d winners, %d losers)\n\n", r.Trades, r.Winners, r.Losers)
+	fmt.Fprintf(w, "%-10s %12s %12s %12s\n", "", "All", "Winners", "Losers")
+	fmt.Fprintf(w, "%-10s %12.2f %12.2f %12.2f\n", "MAE med", median(r.MAE.All), median(r.MAE.Winners), median(r.MAE.Losers))
+	fmt.Fprintf(w, "%-10s %12.2f %12.2f %12.2f\n", "MAE max", r.MAE.All.Max, r.MAE.Winners.Max, r.MAE.Losers.Max)
+	fmt.Fprintf(w, "%-10s %12.2f %12.2f %12.2f\n", "MFE med", median(r.MFE.All), median(r.MFE.Winners), median(r.MFE.Losers))
+	fmt.Fprintf(w, "%-10s %12.2f %12.2f %12.2f\n", "MFE max", r.MFE.All.Max, r.MFE.Winners.Max, r.MFE.Losers.Max)
+
+	fmt.Fprintf(w, "\nEfficiency: entry %.1f%%, exit %.1f%%, total %.1f%%\n",
+		r.EntryEfficiency*100, r.ExitEfficiency*100, r.TotalEfficiency*100)
+
+	s := r.Stop
+	fmt.Fprintf(w, "\nStop suggestion (P%.0f of winners' MAE): %.2f per trade, %.2f per contract", s.Percentile, s.StopDistance, s.StopPerContract)
+	if s.StopATRMultiple > 0 {
+		fmt.Fprintf(w, ", %.2f ATR", s.StopATRMultiple)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "  cuts %d losers (saves %.2f), stops out %d winners (gives up %.2f), net %.2f\n",
+		s.LosersCut, s.LossReduction, s.WinnersStoppedOut, s.ProfitGivenUp, s.NetImpact)
+
+	rm := r.RMultiples
+	if rm.Trades == 0 {
+		fmt.Fprintln(w, "\nR-multiples: no trades with a risk value")
+		return
+	}
+	fmt.Fprintf(w, "\nR-multiples (%d trades): expectancy %.2fR, std %.2fR, SQN %.2f, median %.2fR, best %.2fR, worst %.2fR\n",
+		rm.Trades, rm.Mean, rm.StdDev, rm.SQN, median(rm.Distribution), rm.Distribution.Max, rm.Distribution.Min)
+	fmt.Fprintf(w, "  >= +1R: %.0f%%, <= -1R: %.0f%%\n", rm.WinsAbove1R*100, rm.LossesBelow1R*100)
+}
+
+// runResimCommand re-simulates a trades CSV under a different sizing/cost model and compares it to the original
+func runResimCommand(args []string) int {
+	fs := flag.NewFlagSet("resim", flag.ContinueOnError)
+	var model ResimulationModel
+	sizing := fs.String("sizing", SizingOriginal, "sizing model: original, fixed, fractional or atr")
+	fs.Float64Var(&model.Contracts, "contracts", 1, "contracts per trade for fixed sizing")
+	fs.Float64Var(&model.RiskFraction, "fraction", 0.01, "fraction of equity risked per trade (fractional/atr)")
+	fs.BoolVar(&model.UseOriginalCosts, "original-costs", false, "keep the CSV commission and slippage per contract")
+	fs.Float64Var(&model.CommissionPerSide, "commission", 0, "commission per contract per side")
+	fs.Float64Var(&model.SlippageTicks, "slippage-ticks", 0, "slippage ticks per contract per side")
+	fs.Float64Var(&model.TickSize, "tick-size", 0, "tick size in price units")
+	fs.Float64Var(&model.PointValue, "point-value", 0, "currency per point (default: derived from the trades)")
+	capital := fs.Float64("capital", defaultInitialCapital, "starting capital")
+	testType := fs.String("test-type", "", "only include IS or OS trades")
+	asJSON := fs.Bool("json", false, "print both curves as JSON")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	model.Sizing = strings.ToLower(strings.TrimSpace(*sizing))
+
+	cfg := DefaultConfig()
+	if fs.NArg() == 0 {
+		return printTradesCSVList(cfg)
+	}
+
+	trades, err := loadTradesForCLI(cfg, fs.Arg(0), *testType)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	if len(trades) == 0 {
+		fmt.Fprintln(os.Stderr, "no trades to re-simulate")
+		return 1
+	}
+
+	ac := NewAPIClient(cfg, nil)
+	original := EquityCurveData{
+		StrategyName:   trades[0].StrategyName,
+		TaskType:       "TRADES",
+		TestType:       *testType,
+		Symbol:         trades[0].Symbol,
+		Run:            "Combined",
+		InitialCapital: *capital,
+	}
+	if err := ac.calculateEquityProgression(&original, trades); err != nil {
+		fmt.Fprintf(os.Stderr, "calculate original equity: %v\n", err)
+		return 1
+	}
+	resim, err := ac.resimulateEquityCurve(trades, model, original)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+
+	if *asJSON {
+		return writeJSON(map[string]EquityCurveData{"original": original, "resimulated": resim})
+	}
+	printResimComparison(os.Stdout, original, resim)
+	return 0
+}
+
+// printResimComparison writes original vs re-simulated headline metrics side by side
+func printResimComparison(w io.Writer, original, resim EquityCurveData) {
+	s := resim.Resimulation
+	fmt.Fprintf(w, "Model: sizing=%s", s.Model.Sizing)
+	if s.Model.UseOriginalCosts {
+		fmt.Fprintf(w, ", original costs")
+	} else {
+		fmt.Fprintf(w, ", commission %.2f/side, slippage %.1f ticks/side", s.Model.CommissionPerSide, s.Model.SlippageTicks)
+	}
+	fmt.Fprintf(w, "\nTrades: %d simulated, %d skipped, avg %.2f contracts\n", s.Trades, s.SkippedTrades, s.AverageContracts)
+	for symbol, pv := range s.PointValues {
+		fmt.Fprintf(w, "Point value %s: %.4g\n", symbol, pv)
+	}
+	fmt.Fprintln(w)
+
+	o, r := original.Metrics, resim.Metrics
+	if o == nil || r == nil {
+		return
+	}
+	rows := []struct {
+		name   string
+		format string
+		a, b   float64
+	}{
+		{"Net profit", "%14.2f", o.EndingEquity - o.InitialCapital, r.EndingEquity - r.InitialCapital},
+		{"Max drawdown", "%14.2f", o.MaxDrawdown, r.MaxDrawdown},
+		{"Max DD %", "%13.1f%%", o.MaxDrawdownPct * 100, r.MaxDrawdownPct * 100},
+		{"CAGR", "%13.1f%%", o.CAGR * 100, r.CAGR * 100},
+		{"Sharpe", "%14.2f", o.Sharpe, r.Sharpe},
+		{"Sortino", "%14.2f", o.Sortino, r.Sortino},
+		{"Profit factor", "%14.2f", o.ProfitFactor, r.ProfitFactor},
+		{"Win rate", "%13.1f%%", o.WinRate * 100, r.WinRate * 100},
+	}
+	fmt.Fprintf(w, "%-14s %14s %14s\n", "", "Original", "Re-simulated")
+	for _, row := range rows {
+		fmt.Fprintf(w, "%-14s "+row.format+" "+row.format+"\n", row.name, row.a, row.b)
+	}
+}
+
+// resolveOPTPath returns the path as given if it exists, otherwise looks it up in Opt.Done and Opt.In
+func resolveOPTPath(cfg *Config, name string) (string, error) {
+	if _, err := os.Stat(name); err == nil {
+		return name, nil
+	}
+	for _, dir := range []string{cfg.Folders.Files.Opt.Done, cfg.Folders.Files.Opt.In} {
+		candidate := filepath.Join(dir, name)
+		if _, err := os.Stat(candidate); err == nil {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("OPT file not found: %s", name)
+}
+
+// printOPTFileList prints the OPT files in Opt.Done and Opt.In when no file argument is given
+func printOPTFileList(cfg *Config) int {
+	for _, dir := range []string{cfg.Folders.Files.Opt.Done, cfg.Folders.Files.Opt.In} {
+		matches, err := filepath.Glob(filepath.Join(dir, "*.opt"))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "list OPT files: %v\n", err)
+			return 1
+		}
+		fmt.Printf("OPT files in %s:\n", dir)
+		sort.Strings(matches)
+		for _, m := range matches {
+			fmt.Printf("  %s\n", filepath.Base(m))
+		}
+		if len(matches) == 0 {
+			fmt.Println("  (none)")
+		}
+	}
+	return 0
+}
+
+// runOptCommand loads an OPT file and prints the top tests, the Pareto front or a parameter heatmap
+func runOptCommand(args []string) int {
+	fs := flag.NewFlagSet("opt", flag.ContinueOnError)
+	top := fs.Int("top", 20, "number of tests to show (0 for all)")
+	by := fs.String("by", "", "metric to rank by (default: fitness, else all_net_profit)")
+	minTrades := fs.Int("min-trades", 0, "drop tests with fewer trades")
+	pareto := fs.Bool("pareto", false, "show the net profit vs max drawdown Pareto front")
+	heatmap := fs.String("heatmap", "", "two parameters x,y: print the surface of the -by metric")
+	asJSON := fs.Bool("json", false, "print as JSON")
+	asCSV := fs.Bool("csv", false, "print the selected tests as CSV")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	cfg := DefaultConfig()
+	if fs.NArg() == 0 {
+		return printOPTFileList(cfg)
+	}
+	path, err := resolveOPTPath(cfg, fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+
+	results, err := loadOptimizationResults(path)
+	if err == nil {
+		results, err = results.FilterMinTrades(*minTrades)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+
+	if *heatmap != "" {
+		params := strings.Split(*heatmap, ",")
+		if len(params) != 2 {
+			fmt.Fprintln(os.Stderr, "-heatmap needs two parameters: x,y")
+			return 2
+		}
+		data, err := results.Heatmap(strings.TrimSpace(params[0]), strings.TrimSpace(params[1]), *by)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			return 1
+		}
+		if *asJSON {
+			return writeJSON(data)
+		}
+		printHeatmap(os.Stdout, data)
+		return 0
+	}
+
+	var tests []OptimizationTest
+	metric := *by
+	if *pareto {
+		tests, err = results.ParetoFront()
+		metric = ""
+	} else {
+		tests, err = results.TopN(*top, *by)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+
+	switch {
+	case *asJSON:
+		if err := results.WriteJSON(os.Stdout, tests); err != nil {
+			fmt.Fprintf(os.Stderr, "encode JSON: %v\n", err)
+			return 1
+		}
+	case *asCSV:
+		if err := results.WriteCSV(os.Stdout, tests); err != nil {
+			fmt.Fprintf(os.Stderr, "write CSV: %v\n", err)
+			return 1
+		}
+	default:
+		printOptimizationTests(os.Stdout, results, tests, metric)
+	}
+	return 0
+}
+
+// printOptimizationTests writes a table of tests with the headline metrics and their parameters
+func printOptimizationTests(w io.Writer, results *OptimizationResults, tests []OptimizationTest, metric string) {
+	fmt.Fprintf(w, "%s: %d tests, %d metrics, parameters: %s\n\n", filepath.Base(results.Source),
+		len(results.Tests), len(results.Metrics), strings.Join(results.Parameters, ", "))
+
+	var columns []string
+	shown := make(map[string]bool)
+	for i, candidates := range [][]string{optFitnessColumns, optNetProfitColumns, optDrawdownColumns, optTradesColumns} {
+		requested := ""
+		if i == 0 {
+			requested = metric
+		}
+		if name, err := results.resolveMetric(requested, candidates); err == nil && !shown[name] {
+			columns = append(columns, name)
+			shown[name] = true
+		}
+	}
+
+	fmt.Fprintf(w, "%6s", "Run")
+	for _, c := range columns {
+		fmt.Fprintf(w, " %16s", c)
+	}
+	fmt.Fprintln(w, "  Parameters")
+	for _, test := range tests {
+		fmt.Fprintf(w, "%6d", test.Run)
+		for _, c := range columns {
+			fmt.Fprintf(w, " %16.2f", test.Metrics[c])
+		}
+		params := make([]string, 0, len(results.Parameters))
+		for _, name := range results.Parameters {
+			if v, ok := test.Parameters[name]; ok {
+				params = append(params, name+"="+formatParameterValue(v))
+			}
+		}
+		fmt.Fprintf(w, "  %s\n", strings.Join(params, " "))
+	}
+}
+
+// printHeatmap writes the surface as a grid with y values down and x values across
+func printHeatmap(w io.Writer, h *HeatmapData) {
+	fmt.Fprintf(w, "%s by %s (across) and %s (down), best value per cell\n\n", h.Metric, h.XParameter, h.YParameter)
+	fmt.Fprintf(w, "%10s", "")
+	for _, x := range h.XValues {
+		fmt.Fprintf(w, " %10g", x)
+	}
+	fmt.Fprintln(w)
+	for yi, y := range h.YValues {
+		fmt.Fprintf(w, "%10g", y)
+		for _, cell := range h.Z[yi] {
+			if cell == nil {
+				fmt.Fprintf(w, " %10s", "-")
+			} else {
+				fmt.Fprintf(w, " %10.2f", *cell)
+			}
+		}
+		fmt.Fprintln(w)
+	}
+}
+
+// runRobustCommand generates the perturbed variants of a job around its optimized parameters
+func runRobustCommand(args []string) int {
+	fs := flag.NewFlagSet("robust", flag.ContinueOnError)
+	params := fs.String("params", "", "optimized parameters as JSON (default: the OptRange <value>s)")
+	mode := fs.String("mode", NeighborhoodSteps, "steps (±1 and ±2 steps per parameter) or lhs (Latin hypercube)")
+	samples := fs.Int("samples", defaultLHSSamples, "number of Latin hypercube samples")
+	seed := fs.Int64("seed", 1, "Latin hypercube random seed")
+	taskType := fs.String("task", FollowUpRetest, "task type of the generated jobs")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "robust needs a .job or .xml file")
+		return 2
+	}
+
+	var center map[string]interface{}
+	if *params != "" {
+		if err := json.Unmarshal([]byte(*params), &center); err != nil {
+			fmt.Fprintf(os.Stderr, "parse -params: %v\n", err)
+			return 2
+		}
+	}
+
+	cfg := DefaultConfig()
+	plan, err := generateRobustnessJob(cfg, NewAPIClient(cfg, nil), fs.Arg(0), center, strings.ToLower(*mode), *samples, *seed, *taskType)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	fmt.Printf("Generated %s with %d variants of %s\n", plan.JobFile, len(plan.Variants), strings.Join(plan.ParameterNames(), ", "))
+	fmt.Printf("Plan: %s\n", robustnessPlanPath(cfg, plan.JobFile))
+	return 0
+}
+
+// runRobustReportCommand aggregates the results of a robustness job into a sensitivity report
+func runRobustReportCommand(args []string) int {
+	fs := flag.NewFlagSet("robust-report", flag.ContinueOnError)
+	by := fs.String("by", "", "metric to compare (default: fitness, else all_net_profit)")
+	asJSON := fs.Bool("json", false, "print as JSON")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 2 {
+		fmt.Fprintln(os.Stderr, "robust-report needs the plan and the OPT file of the robustness job")
+		return 2
+	}
+
+	cfg := DefaultConfig()
+	plan, err := loadRobustnessPlan(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	path, err := resolveOPTPath(cfg, fs.Arg(1))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	results, err := loadOptimizationResults(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	report, err := buildRobustnessReport(plan, results, *by)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+
+	if *asJSON {
+		return writeJSON(report)
+	}
+	printRobustnessReport(os.Stdout, report)
+	return 0
+}
+
+// printRobustnessReport writes the overall score, the per-parameter sensitivity and the surface
+func printRobustnessReport(w io.Writer, r *RobustnessReport) {
+	fmt.Fprintf(w, "Job %s (%s): %d of %d variants matched, %s at center %.2f\n", r.JobID, r.Mode, r.Matched, r.Variants, r.Metric, r.CenterMetric)
+	fmt.Fprintf(w, "Robustness score %.1f, worst retention %.0f%%, profitable %.0f%%\n\n", r.Score, r.WorstRetention*100, r.ProfitableShare*100)
+
+	fmt.Fprintf(w, "%-20s %12s %10s %14s %8s\n", "Parameter", "Center", "Step", "Loss/step", "Score")
+	for _, p := range r.Parameters {
+		fmt.Fprintf(w, "%-20s %12g %10g %13.1f%% %8.1f\n", p.Name, p.Center, p.Step, p.Sensitivity*100, p.Score)
+	}
+
+	fmt.Fprintf(w, "\n%6s %16s  Offsets\n", "Run", r.Metric)
+	for _, v := range r.Surface {
+		value := "-"
+		if v.Metric != nil {
+			value = fmt.Sprintf("%.2f", *v.Metric)
+		}
+		fmt.Fprintf(w, "%6d %16s  %s\n", v.Run, value, describeOffsets(v.Offsets))
+	}
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Codec names; zlib is what TSClient reads and writes, gzip and zstd are for archived files
+const (
+	CodecZlib = "zlib"
+	CodecGzip = "gzip"
+	CodecZstd = "zstd"
+)
+
+// codecDetectSize is the number of leading bytes a codec needs to recognise its stream
+const codecDetectSize = 4
+
+// errUnknownCodec is returned when data does not start with the header of any registered codec
+var errUnknownCodec = errors.New("not compressed with a known codec")
+
+// Codec is a compression format with streaming reader and writer constructors
+type Codec struct {
+	Name string
+	// Detect reports whether a stream starts with this codec's header (up to codecDetectSize bytes)
+	Detect    func(header []byte) bool
+	NewReader func(r io.Reader) (io.ReadCloser, error)
+	NewWriter func(w io.Writer) (io.WriteCloser, error)
+}
+
+var (
+	codecMu sync.RWMutex
+	codecs  []*Codec // In registration order, which is the order headers are tried in
+)
+
+func init() {
+	RegisterCodec(&Codec{
+		Name:   CodecZlib,
+		Detect: isZlibHeader,
+		NewReader: func(r io.Reader) (io.ReadCloser, error) {
+			return zlib.NewReader(r)
+		},
+		// Best compression matches the DLL: boost::iostreams::zlib_compressor(boost::iostreams::zlib::best_compression)
+		NewWriter: func(w io.Writer) (io.WriteCloser, error) {
+			return zlib.NewWriterLevel(w, zlib.BestCompression)
+		},
+	})
+	RegisterCodec(&Codec{
+		Name:   CodecGzip,
+		Detect: func(h []byte) bool { return len(h) >= 2 && h[0] == 0x1f && h[1] == 0x8b },
+		NewReader: func(r io.Reader) (io.ReadCloser, error) {
+			return gzip.NewReader(r)
+		},
+		NewWriter: func(w io.Writer) (io.WriteCloser, error) {
+			return gzip.NewWriterLevel(w, gzip.BestCompression)
+		},
+	})
+	RegisterCodec(&Codec{
+		Name:   CodecZstd,
+		Detect: func(h []byte) bool { return bytes.HasPrefix(h, []byte{0x28, 0xb5, 0x2f, 0xfd}) },
+		NewReader: func(r io.Reader) (io.ReadCloser, error) {
+			zr, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+			if err != nil {
+				return nil, err
+			}
+			return zr.IOReadCloser(), nil
+		},
+		NewWriter: func(w io.Writer) (io.WriteCloser, error) {
+			return zstd.NewWriter(w, zstd.WithEncoderLevel(zstd.SpeedBetterCompression))
+		},
+	})
+}
+
+// RegisterCodec adds a codec, replacing a registered one with the same name
+func RegisterCodec(c *Codec) {
+	codecMu.Lock()
+	defer codecMu.Unlock()
+	for i, existing := range codecs {
+		if existing.Name == c.Name {
+			codecs[i] = c
+			return
+		}
+	}
+	codecs = append(codecs, c)
+}
+
+// CodecByName returns a registered codec
+func CodecByName(name string) (*Codec, error) {
+	codecMu.RLock()
+	defer codecMu.RUnlock()
+	for _, c := range codecs {
+		if c.Name == name {
+			return c, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown compression codec %q (available: %s)", name, strings.Join(codecNamesLocked(), ", "))
+}
+
+// CodecNames returns the registered codec names in registration order
+func CodecNames() []string {
+	codecMu.RLock()
+	defer codecMu.RUnlock()
+	return codecNamesLocked()
+}
+
+func codecNamesLocked() []string {
+	names := make([]string, 0, len(codecs))
+	for _, c := range codecs {
+		names = append(names, c.Name)
+	}
+	return names
+}
+
+// detectCodec returns the codec whose header starts the data, or nil
+func detectCodec(header []byte) *Codec {
+	codecMu.RLock()
+	defer codecMu.RUnlock()
+	for _, c := range codecs {
+		if c.Detect(header) {
+			return c
+		}
+	}
+	return nil
+}
+
+// NewCompressWriter returns a writer that compresses to w with the named codec. Close flushes the
+// compressed stream but does not close w.
+func NewCompressWriter(w io.Writer, codec string) (io.WriteCloser, error) {
+	c, err := CodecByName(codec)
+	if err != nil {
+		return nil, err
+	}
+	cw, err := c.NewWriter(w)
+	if err != nil {
+		return nil, fmt.Errorf("create %s writer: %w", c.Name, err)
+	}
+	return cw, nil
+}
+
+// NewDecompressReader returns a reader that decompresses r, detecting the codec from its header.
+// Data in no known format fails with errUnknownCodec. Close releases the decoder but not r.
+func NewDecompressReader(r *bufio.Reader) (io.ReadCloser, *Codec, error) {
+	header, _ := r.Peek(codecDetectSize)
+	c := detectCodec(header)
+	if c == nil {
+		if len(header) == 0 {
+			return nil, nil, fmt.Errorf("%w: empty input", errUnknownCodec)
+		}
+		return nil, nil, errUnknownCodec
+	}
+	cr, err := c.NewReader(r)
+	if err != nil {
+		return nil, nil, fmt.Errorf("create %s reader: %w", c.Name, err)
+	}
+	return cr, c, nil
+}
+
+// compressStream copies input to output through the named codec
+func compressStream(output io.Writer, input io.Reader, codec string) error {
+	writer, err := NewCompressWriter(output, codec)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(writer, input); err != nil {
+		writer.Close()
+		return fmt.Errorf("failed to compress file: %w", err)
+	}
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("failed to compress file: %w", err)
+	}
+	return nil
+}
+
+// recompressFile rewrites a compressed file with another codec; files already using it are left
+// alone. Returns whether the file was rewritten. Encrypted files and containers are not handled.
+func recompressFile(path, codec string) (bool, error) {
+	if _, err := CodecByName(codec); err != nil {
+		return false, err
+	}
+	input, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer input.Close()
+
+	reader, current, err := NewDecompressReader(bufio.NewReader(input))
+	if err != nil {
+		return false, fmt.Errorf("read %s: %w", filepath.Base(path), err)
+	}
+	defer reader.Close()
+	if current.Name == codec {
+		return false, nil
+	}
+
+	info, err := input.Stat()
+	if err != nil {
+		return false, err
+	}
+	output, err := CreateAtomic(path, info.Mode().Perm())
+	if err != nil {
+		return false, err
+	}
+	defer output.Abort()
+	if err := compressStream(output, reader, codec); err != nil {
+		return false, err
+	}
+	input.Close()
+	if err := output.Commit(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
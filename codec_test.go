@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+// codecFixtures are real artifacts, uncompressed: a WFO retest job, a downloaded optimization job
+// and an OPT file derived from the retest job's runs
+var codecFixtures = []string{"wfo_retest.xml", "downloaded.job", "wfo_runs.opt"}
+
+const (
+	codecRetestXML   = "f2ccd6f0-bfde-4409-908e-2d9b56d7d1d2_@ES_60_WFO_RETEST_RUN-11_OS-20.xml"
+	codecDownloadJob = "files/jobs/to_do/6b0bd887-4068-4c8d-9593-cccbad7c0f6a_@ES_60.job"
+)
+
+func readCodecFixture(tb testing.TB, name string) []byte {
+	switch name {
+	case "downloaded.job":
+		file, err := os.Open(codecDownloadJob)
+		if err != nil {
+			tb.Fatalf("open fixture: %v", err)
+		}
+		defer file.Close()
+		reader, _, err := NewDecompressReader(bufio.NewReader(file))
+		if err != nil {
+			tb.Fatalf("decompress fixture: %v", err)
+		}
+		defer reader.Close()
+		data, err := io.ReadAll(reader)
+		if err != nil {
+			tb.Fatalf("decompress fixture: %v", err)
+		}
+		return data
+	case "wfo_runs.opt":
+		return retestRunsOPT(tb, readCodecFixture(tb, "wfo_retest.xml"))
+	}
+	data, err := os.ReadFile(codecRetestXML)
+	if err != nil {
+		tb.Fatalf("read fixture: %v", err)
+	}
+	return data
+}
+
+// retestRunsOPT writes one OPT row per job of a WFO retest: its run, fixed parameters and IS/OS dates
+func retestRunsOPT(tb testing.TB, retestXML []byte) []byte {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	dateTags := []string{"is_start_date", "is_end_date", "os_start_date", "os_end_date"}
+	w.Write(append([]string{"run", "parameters_json"}, dateTags...))
+	for _, job := range jobElementPattern.FindAllString(string(retestXML), -1) {
+		defs, err := parameterDefinitionsFromJobXML(job)
+		if err != nil {
+			tb.Fatalf("parse retest parameters: %v", err)
+		}
+		params := make(map[string]interface{}, len(defs))
+		for _, def := range defs {
+			if v, err := strconv.ParseFloat(def.Value, 64); err == nil {
+				params[def.Name] = v
+			} else {
+				params[def.Name] = def.Value
+			}
+		}
+		paramsJSON, _ := json.Marshal(params)
+		run, err := extractXMLTagValue(job, "run")
+		if err != nil {
+			tb.Fatalf("retest job without a run: %v", err)
+		}
+		record := []string{run, string(paramsJSON)}
+		for _, tag := range dateTags {
+			value, _ := extractXMLTagValue(job, tag) // The last run has no out-of-sample period
+			record = append(record, value)
+		}
+		w.Write(record)
+	}
+	w.Flush()
+	return buf.Bytes()
+}
+
+func compressWith(tb testing.TB, codec string, data []byte) []byte {
+	var buf bytes.Buffer
+	if err := compressStream(&buf, bytes.NewReader(data), codec); err != nil {
+		tb.Fatalf("compress with %s: %v", codec, err)
+	}
+	return buf.Bytes()
+}
+
+func TestCodecRoundTrip(t *testing.T) {
+	for _, fixture := range codecFixtures {
+		data := readCodecFixture(t, fixture)
+		for _, codec := range CodecNames() {
+			compressed := compressWith(t, codec, data)
+			reader, detected, err := NewDecompressReader(bufio.NewReader(bytes.NewReader(compressed)))
+			if err != nil {
+				t.Fatalf("%s/%s: NewDecompressReader failed: %v", fixture, codec, err)
+			}
+			got, err := io.ReadAll(reader)
+			reader.Close()
+			if err != nil || detected.Name != codec || !bytes.Equal(got, data) {
+				t.Fatalf("%s/%s: detected %s, %d of %d bytes back (err %v)", fixture, codec, detected.Name, len(got), len(data), err)
+			}
+			t.Logf("%s/%s: %d -> %d bytes", fixture, codec, len(data), len(compressed))
+		}
+	}
+
+	if _, _, err := NewDecompressReader(bufio.NewReader(bytes.NewReader([]byte("run,parameters_json\n")))); !errors.Is(err, errUnknownCodec) {
+		t.Fatalf("Expected errUnknownCodec for plain text, got %v", err)
+	}
+	if _, err := NewCompressWriter(io.Discard, "lz4"); err == nil {
+		t.Fatalf("Expected an error for an unknown codec")
+	}
+}
+
+func TestRecompressArchivedOPT(t *testing.T) {
+	data := readCodecFixture(t, "wfo_runs.opt")
+	wantRuns := len(jobElementPattern.FindAllString(string(readCodecFixture(t, "wfo_retest.xml")), -1))
+	path := filepath.Join(t.TempDir(), "job1_@ES_60_WFO.opt")
+	if err := os.WriteFile(path, compressWith(t, CodecZlib, data), 0644); err != nil {
+		t.Fatalf("write OPT file: %v", err)
+	}
+
+	for _, want := range []bool{true, false} {
+		changed, err := recompressFile(path, CodecZstd)
+		if err != nil || changed != want {
+			t.Fatalf("recompressFile = %v (err %v), want %v", changed, err, want)
+		}
+	}
+
+	// The OPT reader detects the codec, so archived files stay queryable
+	reader, closer, err := openOPTFile(path, nil)
+	if err != nil {
+		t.Fatalf("openOPTFile failed: %v", err)
+	}
+	defer closer.Close()
+	rows := 0
+	for {
+		row, err := reader.Next()
+		if err != nil {
+			if err != io.EOF {
+				t.Fatalf("Next failed: %v", err)
+			}
+			break
+		}
+		rows++
+		if row.Run != rows || row.ParametersJSON == "" || row.ISEndDate == "" {
+			t.Fatalf("Unexpected row %d: %+v", rows, row)
+		}
+	}
+	if rows != wantRuns {
+		t.Fatalf("Expected %d rows, got %d", wantRuns, rows)
+	}
+}
+
+// BenchmarkCodecs compares compression and decompression of the fixtures per codec.
+// Run with: go test -run=NONE -bench=Codecs
+func BenchmarkCodecs(b *testing.B) {
+	for _, fixture := range codecFixtures {
+		data := readCodecFixture(b, fixture)
+		for _, codec := range CodecNames() {
+			compressed := compressWith(b, codec, data)
+			ratio := float64(len(compressed)) / float64(len(data)) * 100
+
+			b.Run(fixture+"/"+codec+"/compress", func(b *testing.B) {
+				b.SetBytes(int64(len(data)))
+				b.ReportMetric(ratio, "%size")
+				for i := 0; i < b.N; i++ {
+					if err := compressStream(io.Discard, bytes.NewReader(data), codec); err != nil {
+						b.Fatalf("compress: %v", err)
+					}
+				}
+			})
+			b.Run(fixture+"/"+codec+"/decompress", func(b *testing.B) {
+				b.SetBytes(int64(len(data)))
+				for i := 0; i < b.N; i++ {
+					reader, _, err := NewDecompressReader(bufio.NewReader(bytes.NewReader(compressed)))
+					if err != nil {
+						b.Fatalf("decompress: %v", err)
+					}
+					if _, err := io.Copy(io.Discard, reader); err != nil {
+						b.Fatalf("decompress: %v", err)
+					}
+					reader.Close()
+				}
+			})
+		}
+	}
+}
@@ -1,16 +1,24 @@
 package main
 
 import (
-	"compress/zlib"
+	"bufio"
+	"bytes"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"time"
 )
 
-// CompressFile compresses a file using zlib with best compression level
-// This matches the compression used in the DLL: boost::iostreams::zlib_compressor(boost::iostreams::zlib::best_compression)
+// CompressFile compresses a file using zlib with best compression level, the codec TSClient reads.
+// When job containers are enabled the output is a job XML container; when file encryption is enabled
+// the result is sealed before it is written.
 func CompressFile(inputFile, outputFile string) error {
+	return compressFileAs(inputFile, outputFile, ContentJobXML, ContainerMeta{})
+}
+
+// compressFileAs compresses a file, wrapped in a container of the given type when containers are enabled
+func compressFileAs(inputFile, outputFile string, contentType ContentType, meta ContainerMeta) error {
 	// Open input file
 	input, err := os.Open(inputFile)
 	if err != nil {
@@ -18,51 +26,69 @@ func CompressFile(inputFile, outputFile string) error {
 	}
 	defer input.Close()
 
-	// Create output file
-	output, err := os.Create(outputFile)
-	if err != nil {
-		return fmt.Errorf("failed to create output file %s: %w", outputFile, err)
+	// The container header holds the length and checksum, so the input is hashed in a first pass
+	var header []byte
+	if jobContainersEnabled() {
+		length, checksum, err := hashPayload(input)
+		if err != nil {
+			return fmt.Errorf("failed to hash input file %s: %w", inputFile, err)
+		}
+		if _, err := input.Seek(0, io.SeekStart); err != nil {
+			return fmt.Errorf("failed to rewind input file %s: %w", inputFile, err)
+		}
+		if meta.CreatedAt.IsZero() {
+			meta.CreatedAt = time.Now().UTC()
+		}
+		header, err = encodeContainerHeader(ContainerHeader{ContentType: contentType, Length: length, Checksum: checksum, Meta: meta})
+		if err != nil {
+			return err
+		}
 	}
-	defer output.Close()
 
-	// Create zlib writer with best compression level (9)
-	writer, err := zlib.NewWriterLevel(output, zlib.BestCompression)
-	if err != nil {
-		return fmt.Errorf("failed to create zlib writer: %w", err)
+	// Encrypted output is compressed in memory, then sealed as a whole
+	if fileEncryption.Enabled() {
+		compressed := bytes.NewBuffer(header)
+		if err := compressStream(compressed, input, CodecZlib); err != nil {
+			return err
+		}
+		if err := writeAtRestFile(outputFile, compressed.Bytes()); err != nil {
+			return fmt.Errorf("failed to write encrypted file %s: %w", outputFile, err)
+		}
+		return nil
 	}
-	defer writer.Close()
 
-	// Copy data from input to compressed output
-	_, err = io.Copy(writer, input)
+	// Create output file; it only appears under its name once complete
+	output, err := CreateAtomic(outputFile, 0644)
 	if err != nil {
-		return fmt.Errorf("failed to compress file: %w", err)
+		return fmt.Errorf("failed to create output file %s: %w", outputFile, err)
 	}
+	defer output.Abort()
 
-	return nil
+	if _, err := output.Write(header); err != nil {
+		return fmt.Errorf("failed to write container header: %w", err)
+	}
+	if err := compressStream(output, input, CodecZlib); err != nil {
+		return err
+	}
+	return output.Commit()
 }
 
-// DecompressFile decompresses a zlib compressed file
+// DecompressFile decompresses a file in any registered codec, plain or encrypted, raw or in a container.
+// Container payloads are checked against their length and checksum; a damaged one leaves no output.
 func DecompressFile(inputFile, outputFile string) error {
-	// Open input file
-	input, err := os.Open(inputFile)
+	// Open and decompress input file
+	reader, err := openCompressedFile(inputFile)
 	if err != nil {
-		return fmt.Errorf("failed to open input file %s: %w", inputFile, err)
+		return err
 	}
-	defer input.Close()
+	defer reader.Close()
 
 	// Create output file
-	output, err := os.Create(outputFile)
+	output, err := CreateAtomic(outputFile, 0644)
 	if err != nil {
 		return fmt.Errorf("failed to create output file %s: %w", outputFile, err)
 	}
-	defer output.Close()
-
-	// Create zlib reader
-	reader, err := zlib.NewReader(input)
-	if err != nil {
-		return fmt.Errorf("failed to create zlib reader: %w", err)
-	}
-	defer reader.Close()
+	defer output.Abort()
 
 	// Copy data from compressed input to output
 	_, err = io.Copy(output, reader)
@@ -70,19 +96,68 @@ func DecompressFile(inputFile, outputFile string) error {
 		return fmt.Errorf("failed to decompress file: %w", err)
 	}
 
-	return nil
+	return output.Commit()
+}
+
+// openCompressedFile opens a compressed file for reading, see openArtifact
+func openCompressedFile(path string) (io.ReadCloser, error) {
+	reader, _, err := openArtifact(path)
+	return reader, err
+}
+
+// artifactInfo describes how an artifact was stored
+type artifactInfo struct {
+	Container *ContainerHeader // nil for files written before containers existed
+	Codec     *Codec
+}
+
+// openArtifact opens a compressed artifact for reading. The versioned encryption header tells
+// encrypted files from plain ones, the container magic tells containers from raw files, and the
+// codec is detected from the stream header. Container payloads are verified against their header
+// while they are read.
+func openArtifact(path string) (io.ReadCloser, artifactInfo, error) {
+	var info artifactInfo
+	input, err := openAtRestFile(path)
+	if err != nil {
+		return nil, info, fmt.Errorf("failed to open input file %s: %w", path, err)
+	}
+	buffered := bufio.NewReader(input)
+
+	var reader io.ReadCloser
+	if magic, _ := buffered.Peek(len(containerMagic)); isContainerHeader(magic) {
+		info.Container, info.Codec, reader, err = openContainerPayload(buffered)
+		if err != nil {
+			input.Close()
+			return nil, info, fmt.Errorf("failed to read container %s: %w", path, err)
+		}
+	} else {
+		reader, info.Codec, err = NewDecompressReader(buffered)
+		if err != nil {
+			input.Close()
+			return nil, info, fmt.Errorf("failed to decompress %s: %w", path, err)
+		}
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{reader, multiCloser{reader, input}}, info, nil
 }
 
 // CompressXMLFile compresses an XML file and optionally deletes the original
 // Returns the path to the compressed file
 func CompressXMLFile(xmlPath string, deleteOriginal bool) (string, error) {
+	return CompressJobXMLFile(xmlPath, deleteOriginal, ContainerMeta{})
+}
+
+// CompressJobXMLFile is CompressXMLFile with metadata for the container header
+func CompressJobXMLFile(xmlPath string, deleteOriginal bool, meta ContainerMeta) (string, error) {
 	// Create compressed file path with .job extension
 	dir := filepath.Dir(xmlPath)
 	baseName := filepath.Base(xmlPath)
 	jobName := filepath.Join(dir, baseName[:len(baseName)-len(filepath.Ext(baseName))]+".job")
 
 	// Compress the file
-	err := CompressFile(xmlPath, jobName)
+	err := compressFileAs(xmlPath, jobName, ContentJobXML, meta)
 	if err != nil {
 		return "", fmt.Errorf("failed to compress XML file: %w", err)
 	}
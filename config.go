@@ -6,6 +6,7 @@ import (
 	"path/filepath"
 	"runtime"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -18,6 +19,9 @@ type Config struct {
 	BurstPolling BurstPollingConfig `json:"burst_polling"`
 	Logging      LoggingConfig      `json:"logging"`
 	Folders      FolderConfig       `json:"folders"`
+	Analysis     AnalysisConfig     `json:"analysis"`
+	Encryption   EncryptionConfig   `json:"encryption"`
+	Compression  CompressionConfig  `json:"compression"`
 }
 
 // SupabaseConfig holds Supabase connection settings
@@ -29,17 +33,26 @@ type SupabaseConfig struct {
 
 // AuthConfig holds authentication settings
 type AuthConfig struct {
-	Email    string `json:"email"`
-	Password string `json:"password"`
+	Email          string `json:"email"`
+	Password       string `json:"password"`
+	PersistSession bool   `json:"persist_session"` // Keep the session across restarts
+	UseKeyring     bool   `json:"use_keyring"`     // Prefer the OS keyring over the encrypted session file
+	SessionFile    string `json:"session_file"`    // Encrypted fallback when no keyring is available
+	// Unattended machines register once and sign in with a per-machine API key
+	MachineName           string `json:"machine_name"`            // Shown in job status reports (default: hostname)
+	MachineCredentialFile string `json:"machine_credential_file"` // Encrypted fallback for the machine API key
 }
 
 // DownloadConfig holds download settings
 type DownloadConfig struct {
-	Folder        string `json:"folder"`
-	MaxConcurrent int    `json:"max_concurrent"`
-	RetryAttempts int    `json:"retry_attempts"`
-	RetryDelay    int    `json:"retry_delay"`
-	UploadFolder  string `json:"upload_folder"`
+	Folder          string `json:"folder"`
+	MaxConcurrent   int    `json:"max_concurrent"`
+	RetryAttempts   int    `json:"retry_attempts"`
+	RetryDelay      int    `json:"retry_delay"`
+	UploadFolder    string `json:"upload_folder"`
+	MaxExpandedJobs int    `json:"max_expanded_jobs"` // Cap on <Job> elements generated from one downloaded job
+	// Write .job files in the checksummed container format; TSClient must be able to read it first
+	JobContainer bool `json:"job_container"`
 }
 
 // PollConfig holds polling settings
@@ -75,6 +88,45 @@ type BurstPollingConfig struct {
 type LoggingConfig struct {
 	Level string `json:"level"`
 	File  string `json:"file"`
+	// Tokens, keys, passwords and emails are always redacted; strategy parameters only when set
+	RedactParameters bool `json:"redact_parameters"`
+	// Decompressed OPT CSVs and job XML are written to DebugDumpDir only when enabled
+	DebugDumps         bool          `json:"debug_dumps"`
+	DebugDumpDir       string        `json:"debug_dump_dir"`
+	DebugDumpRetention time.Duration `json:"debug_dump_retention"` // Older dumps are deleted
+}
+
+// EncryptionConfig holds at-rest encryption settings for .job files, downloaded temp XML and
+// archived OPT results. TSClient must be able to read encrypted job files before this is enabled.
+type EncryptionConfig struct {
+	Enabled bool   `json:"enabled"` // Encrypt newly written files; encrypted files are always readable
+	Key     string `json:"key"`     // Base64 AES-256 key; when empty the key is read from the OS keyring
+}
+
+// CompressionConfig holds codec settings. Job files stay zlib, the only codec TSClient reads.
+type CompressionConfig struct {
+	ArchiveCodec string `json:"archive_codec"` // Codec OPT files are recompressed with when moved to Opt.Done (zlib, gzip, zstd)
+}
+
+// AnalysisConfig holds settings for post-processing analysis of results
+type AnalysisConfig struct {
+	MonteCarlo     MonteCarloConfig `json:"monte_carlo"`
+	DrawdownTopN   int              `json:"drawdown_top_n"`  // Drawdown episodes kept per equity curve
+	StopPercentile float64          `json:"stop_percentile"` // Winners' MAE percentile for stop suggestions
+
+	ParameterSelection ParameterSelectionConfig `json:"parameter_selection"` // How WFO_RETEST parameters are picked per run
+	FollowUp           FollowUpConfig           `json:"follow_up"`           // OOS/RETEST jobs for top OPTIMIZATION results
+}
+
+// MonteCarloConfig holds Monte Carlo simulation settings for WFO_RETEST trades
+type MonteCarloConfig struct {
+	Enabled         bool    `json:"enabled"`
+	Iterations      int     `json:"iterations"`
+	Seed            int64   `json:"seed"`
+	Mode            string  `json:"mode"`              // "resample" (with replacement) or "shuffle" (reorder)
+	SkipProbability float64 `json:"skip_probability"`  // Chance each trade is dropped (0-1)
+	SlippageJitter  float64 `json:"slippage_jitter"`   // Max extra slippage per contract per trade (currency)
+	RuinDrawdownPct float64 `json:"ruin_drawdown_pct"` // Drawdown from peak (0-1) that counts as ruin
 }
 
 // FolderConfig holds the new folder structure settings
@@ -95,15 +147,18 @@ type JobsConfig struct {
 	InProgress string `json:"in_progress"`
 	Done       string `json:"done"`
 	Error      string `json:"error"`
+	Manifests  string `json:"manifests"` // Fan-out manifests of expanded MM/MTF jobs
 }
 
 // ResultsConfig holds result-related folder paths
 type ResultsConfig struct {
-	Temp   string `json:"temp"`
-	CSV    string `json:"csv"`
-	ToDo   string `json:"to_do"`
-	Done   string `json:"done"`
-	Trades string `json:"trades"`
+	Temp         string `json:"temp"`
+	CSV          string `json:"csv"`
+	ToDo         string `json:"to_do"`
+	Done         string `json:"done"`
+	Trades       string `json:"trades"`
+	Portfolio    string `json:"portfolio"`    // Combined MM portfolio summaries
+	Consolidated string `json:"consolidated"` // Consolidated MTF timeframe reports
 }
 
 // OptConfig holds optimization artifact folder paths (.opt files)
@@ -125,6 +180,13 @@ func DefaultConfig() *Config {
 		baseRoot = `C:\\AlphaWeaver\\Files`
 	}
 
+	// Session file in the per-user config directory, next to the executable if there is none
+	sessionDir := filepath.Join(exeDir, "session")
+	if dir, err := os.UserConfigDir(); err == nil {
+		sessionDir = filepath.Join(dir, "AlphaWeaver")
+	}
+	hostname, _ := os.Hostname()
+
 	return &Config{
 		Supabase: SupabaseConfig{
 			URL:       "https://rnatsdjhwquhavnnybck.supabase.co",
@@ -132,15 +194,22 @@ func DefaultConfig() *Config {
 			ProjectID: "rnatsdjhwquhavnnybck",
 		},
 		Auth: AuthConfig{
-			Email:    "",
-			Password: "",
+			Email:                 "",
+			Password:              "",
+			PersistSession:        true,
+			UseKeyring:            true,
+			SessionFile:           filepath.Join(sessionDir, "session.dat"),
+			MachineName:           hostname,
+			MachineCredentialFile: filepath.Join(sessionDir, "machine.dat"),
 		},
 		Download: DownloadConfig{
-			Folder:        filepath.Join(baseRoot, "jobs", "to_do"),
-			MaxConcurrent: 3,
-			RetryAttempts: 3,
-			RetryDelay:    1000,
-			UploadFolder:  filepath.Join(baseRoot, "results", "to_do"),
+			Folder:          filepath.Join(baseRoot, "jobs", "to_do"),
+			MaxConcurrent:   3,
+			RetryAttempts:   3,
+			RetryDelay:      1000,
+			UploadFolder:    filepath.Join(baseRoot, "results", "to_do"),
+			MaxExpandedJobs: 500,
+			JobContainer:    false,
 		},
 		Poll: PollConfig{
 			Limit:                  10,
@@ -165,8 +234,12 @@ func DefaultConfig() *Config {
 			EnableSummaryTrigger: true,
 		},
 		Logging: LoggingConfig{
-			Level: "info",
-			File:  filepath.Join(exeDir, "logs", "client.log"),
+			Level:              "info",
+			File:               filepath.Join(exeDir, "logs", "client.log"),
+			RedactParameters:   true,
+			DebugDumps:         false,
+			DebugDumpDir:       filepath.Join(filepath.Dir(baseRoot), "debug"),
+			DebugDumpRetention: 72 * time.Hour,
 		},
 		Folders: FolderConfig{
 			Files: FilesConfig{
@@ -175,13 +248,16 @@ func DefaultConfig() *Config {
 					InProgress: filepath.Join(baseRoot, "jobs", "in_progress"),
 					Done:       filepath.Join(baseRoot, "jobs", "done"),
 					Error:      filepath.Join(baseRoot, "jobs", "error"),
+					Manifests:  filepath.Join(baseRoot, "jobs", "manifests"),
 				},
 				Results: ResultsConfig{
-					Temp:   filepath.Join(baseRoot, "results", "temp"),
-					CSV:    filepath.Join(baseRoot, "results", "csv"),
-					ToDo:   filepath.Join(baseRoot, "results", "to_do"),
-					Done:   filepath.Join(baseRoot, "results", "done"),
-					Trades: filepath.Join(baseRoot, "results", "trades"),
+					Temp:         filepath.Join(baseRoot, "results", "temp"),
+					CSV:          filepath.Join(baseRoot, "results", "csv"),
+					ToDo:         filepath.Join(baseRoot, "results", "to_do"),
+					Done:         filepath.Join(baseRoot, "results", "done"),
+					Trades:       filepath.Join(baseRoot, "results", "trades"),
+					Portfolio:    filepath.Join(baseRoot, "results", "portfolio"),
+					Consolidated: filepath.Join(baseRoot, "results", "consolidated"),
 				},
 				Opt: OptConfig{
 					In:      filepath.Join(baseRoot, "opt", "in"),
@@ -191,6 +267,34 @@ func DefaultConfig() *Config {
 				},
 			},
 		},
+		Analysis: AnalysisConfig{
+			MonteCarlo: MonteCarloConfig{
+				Enabled:         true,
+				Iterations:      1000,
+				Seed:            42,
+				Mode:            "resample",
+				SkipProbability: 0,
+				SlippageJitter:  0,
+				RuinDrawdownPct: 0.5,
+			},
+			DrawdownTopN:   5,
+			StopPercentile: 90,
+			ParameterSelection: ParameterSelectionConfig{
+				Strategy: SelectionBest,
+				TopK:     defaultSelectionTopK,
+			},
+			FollowUp: FollowUpConfig{
+				Enabled:  false,
+				TaskType: FollowUpOOS,
+				TopN:     defaultFollowUpTopN,
+			},
+		},
+		Encryption: EncryptionConfig{
+			Enabled: false,
+		},
+		Compression: CompressionConfig{
+			ArchiveCodec: CodecZlib,
+		},
 	}
 }
 
@@ -219,11 +323,14 @@ func (c *Config) EnsureDirectories() error {
 		c.Folders.Files.Jobs.InProgress,
 		c.Folders.Files.Jobs.Done,
 		c.Folders.Files.Jobs.Error,
+		c.Folders.Files.Jobs.Manifests,
 		c.Folders.Files.Results.Temp,
 		c.Folders.Files.Results.CSV,
 		c.Folders.Files.Results.ToDo,
 		c.Folders.Files.Results.Done,
 		c.Folders.Files.Results.Trades,
+		c.Folders.Files.Results.Portfolio,
+		c.Folders.Files.Results.Consolidated,
 		c.Folders.Files.Opt.In,
 		c.Folders.Files.Opt.Done,
 		c.Folders.Files.Opt.Error,
@@ -236,6 +343,39 @@ func (c *Config) EnsureDirectories() error {
 	return nil
 }
 
+// DataFolders returns all job, result and OPT folders
+func (c *Config) DataFolders() []string {
+	files := c.Folders.Files
+	return []string{
+		files.Jobs.ToDo, files.Jobs.InProgress, files.Jobs.Done, files.Jobs.Error, files.Jobs.Manifests,
+		files.Results.Temp, files.Results.CSV, files.Results.ToDo, files.Results.Done, files.Results.Trades,
+		files.Results.Portfolio, files.Results.Consolidated,
+		files.Opt.In, files.Opt.Done, files.Opt.Error, files.Opt.Summary,
+	}
+}
+
+// FilesRoot returns the deepest folder containing all data folders (the Files root)
+func (c *Config) FilesRoot() string {
+	folders := c.DataFolders()
+	root := filepath.Dir(filepath.Clean(folders[0]))
+	for _, folder := range folders {
+		for !isWithinDir(root, folder) {
+			parent := filepath.Dir(root)
+			if parent == root {
+				break
+			}
+			root = parent
+		}
+	}
+	return root
+}
+
+// isWithinDir reports whether path is dir or inside it
+func isWithinDir(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
 // GetPollInterval returns the current polling interval
 func (c *Config) GetPollInterval() time.Duration {
 	return time.Duration(c.Poll.Interval) * time.Millisecond
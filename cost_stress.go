@@ -0,0 +1,602 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// StressTestSpec is the cost stress test requested by a job's <stressTestSize> and related tags.
+// Slippage step i (0-based) runs with marketOrderSlippage + i * stressTestIncrement * slippageMultiplier
+// (a multiplier of 0 counts as 1). When the job includes commission and carries a <commission>
+// amount, every slippage step is also run with 1x, 2x, ... stressTestSize x that commission.
+type StressTestSpec struct {
+	Steps              int     `json:"steps"`
+	Increment          float64 `json:"increment"`
+	SlippageMultiplier float64 `json:"slippage_multiplier"`
+	BaseSlippage       float64 `json:"base_slippage"`
+	SlippageType       string  `json:"slippage_type,omitempty"`
+	CommissionType     string  `json:"commission_type,omitempty"`
+	BaseCommission     float64 `json:"base_commission"` // 0 when the commission is not varied
+}
+
+// stressFilenamePattern matches the _STRESS-<n> part appended to expanded element filenames
+var stressFilenamePattern = regexp.MustCompile(`_STRESS-(\d+)$`)
+
+// parseStressTestSpec reads the stress test tags; ok is false unless more than one step is requested
+func parseStressTestSpec(jobXML string) (StressTestSpec, bool) {
+	number := func(tag string) float64 { return stressTagNumber(jobXML, tag) }
+	spec := StressTestSpec{
+		Steps:              int(number("stressTestSize")),
+		Increment:          number("stressTestIncrement"),
+		SlippageMultiplier: number("slippageMultiplier"),
+		BaseSlippage:       number("marketOrderSlippage"),
+	}
+	if spec.Steps <= 1 || spec.Increment <= 0 {
+		return spec, false
+	}
+	spec.SlippageType, _ = extractXMLTagValue(jobXML, "slippageType")
+	spec.CommissionType, _ = extractXMLTagValue(jobXML, "commissionType")
+	include, _ := extractXMLTagValue(jobXML, "includeCommission")
+	switch strings.ToLower(strings.TrimSpace(include)) {
+	case "yes", "true", "1":
+		spec.BaseCommission = number("commission")
+	}
+	return spec, true
+}
+
+// stressTagNumber returns a numeric tag value, 0 when it is missing or not a number
+func stressTagNumber(jobXML, tag string) float64 {
+	value, err := extractXMLTagValue(jobXML, tag)
+	if err != nil {
+		return 0
+	}
+	f, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil {
+		return 0
+	}
+	return f
+}
+
+// isStressTestJob reports whether a job asks for a cost stress test
+func isStressTestJob(jobXML string) bool {
+	_, ok := parseStressTestSpec(jobXML)
+	return ok
+}
+
+// slippage returns the slippage of step i
+func (s StressTestSpec) slippage(i int) float64 {
+	multiplier := s.SlippageMultiplier
+	if multiplier <= 0 {
+		multiplier = 1
+	}
+	return s.BaseSlippage + float64(i)*s.Increment*multiplier
+}
+
+// commissionMultiples returns how many commission levels each slippage step runs with
+func (s StressTestSpec) commissionMultiples() int {
+	if s.BaseCommission > 0 {
+		return s.Steps
+	}
+	return 1
+}
+
+// expandStressTestJob takes a job requesting a stress test and generates one job element per
+// slippage and commission increment. Elements are numbered from 1 (the job's own costs) in
+// <stress_variant> and get _STRESS-<n> appended to their filename.
+func expandStressTestJob(xmlContent string) []string {
+	spec, ok := parseStressTestSpec(xmlContent)
+	if !ok {
+		return []string{xmlContent}
+	}
+
+	var jobElements []string
+	variant := 0
+	for c := 1; c <= spec.commissionMultiples(); c++ {
+		for i := 0; i < spec.Steps; i++ {
+			variant++
+			jobXML := replaceXMLTag(xmlContent, "stressTestSize", "1")
+			jobXML = setXMLTag(jobXML, "marketOrderSlippage", strconv.FormatFloat(spec.slippage(i), 'f', -1, 64))
+			if spec.BaseCommission > 0 {
+				jobXML = setXMLTag(jobXML, "commission", strconv.FormatFloat(spec.BaseCommission*float64(c), 'f', -1, 64))
+			}
+			jobXML = addXMLTag(jobXML, "stress_variant", strconv.Itoa(variant))
+			jobXML = deriveJobFilename(jobXML, jobFilenameStress, strconv.Itoa(variant))
+			jobElements = append(jobElements, jobXML)
+		}
+	}
+	return jobElements
+}
+
+// StressVariant is one expanded element of a stress test and, once aggregated, its result
+type StressVariant struct {
+	Variant            int     `json:"variant"`
+	Group              string  `json:"group"`    // element filename without _STRESS-<n>
+	Filename           string  `json:"filename"` // element filename without extension
+	Symbol             string  `json:"symbol"`
+	Timeframe          string  `json:"timeframe"`
+	Slippage           float64 `json:"slippage"`
+	Commission         float64 `json:"commission,omitempty"`
+	CommissionMultiple int     `json:"commission_multiple"`
+}
+
+// StressTestManifest records the variants of a stress-tested job so their results can be aggregated
+type StressTestManifest struct {
+	JobID          string          `json:"job_id"`
+	Spec           StressTestSpec  `json:"spec"`
+	InitialCapital float64         `json:"initial_capital"`
+	Variants       []StressVariant `json:"variants"`
+	CreatedAt      string          `json:"created_at"`
+	Status         string          `json:"status"`
+	CompletedAt    string          `json:"completed_at,omitempty"`
+	OutputFile     string          `json:"output_file,omitempty"`
+}
+
+// newStressTestManifest lists the stress variants in expanded (root-wrapped) job XML, or returns nil
+// when the job was not stress tested
+func newStressTestManifest(jobID, expandedXML string) *StressTestManifest {
+	elements := jobElementPattern.FindAllStringSubmatch(expandedXML, -1)
+	var m *StressTestManifest
+	for _, element := range elements {
+		value, err := extractXMLTagValue(element[1], "stress_variant")
+		if err != nil {
+			continue
+		}
+		filename, _ := extractXMLTagValue(element[1], "filename")
+		base := strings.TrimSuffix(filename, filepath.Ext(filename))
+		variant := StressVariant{Filename: base, Group: stressFilenamePattern.ReplaceAllString(base, "")}
+		variant.Variant, _ = strconv.Atoi(value)
+		variant.Symbol, _ = extractXMLTagValue(element[1], "Symbol")
+		variant.Timeframe, _ = extractXMLTagValue(element[1], "Timeframe")
+		if v, err := extractXMLTagValue(element[1], "marketOrderSlippage"); err == nil {
+			variant.Slippage, _ = strconv.ParseFloat(v, 64)
+		}
+		if v, err := extractXMLTagValue(element[1], "commission"); err == nil {
+			variant.Commission, _ = strconv.ParseFloat(v, 64)
+		}
+
+		if m == nil {
+			m = &StressTestManifest{
+				JobID:          jobID,
+				InitialCapital: initialCapitalFromJobXML(element[1]),
+				CreatedAt:      time.Now().UTC().Format(time.RFC3339),
+				Status:         ManifestPending,
+			}
+			m.Spec.Increment = stressTagNumber(element[1], "stressTestIncrement")
+			m.Spec.SlippageMultiplier = stressTagNumber(element[1], "slippageMultiplier")
+			m.Spec.SlippageType, _ = extractXMLTagValue(element[1], "slippageType")
+			m.Spec.CommissionType, _ = extractXMLTagValue(element[1], "commissionType")
+		}
+		m.Variants = append(m.Variants, variant)
+	}
+	if m == nil {
+		return nil
+	}
+
+	// The elements carry their own costs; the base costs are the lowest ones
+	slippages := make(map[float64]bool)
+	commissions := make(map[float64]bool)
+	for _, v := range m.Variants {
+		slippages[v.Slippage] = true
+		commissions[v.Commission] = true
+	}
+	m.Spec.Steps = len(slippages)
+	m.Spec.BaseSlippage = sortedKeys(slippages)[0]
+	m.Spec.BaseCommission = sortedKeys(commissions)[0]
+	for i := range m.Variants {
+		m.Variants[i].CommissionMultiple = 1
+		if m.Spec.BaseCommission > 0 {
+			m.Variants[i].CommissionMultiple = int(math.Round(m.Variants[i].Commission / m.Spec.BaseCommission))
+		}
+	}
+	return m
+}
+
+// stressManifestPath returns the stress manifest location for a job. The name does not end in
+// _manifest.json so the MM/MTF manifest scans ignore it.
+func stressManifestPath(dir, jobID string) string {
+	return filepath.Join(dir, fmt.Sprintf("%s_stress.json", jobID))
+}
+
+// saveStressTestManifest writes the manifest as indented JSON
+func saveStressTestManifest(dir string, m *StressTestManifest) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal stress manifest: %w", err)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("create manifest directory: %w", err)
+	}
+	if err := writeFileAtomic(stressManifestPath(dir, m.JobID), data, 0644); err != nil {
+		return fmt.Errorf("write stress manifest: %w", err)
+	}
+	return nil
+}
+
+// loadStressTestManifests reads all stress manifests in dir, sorted by job ID. Unreadable files are skipped.
+func loadStressTestManifests(dir string) ([]*StressTestManifest, error) {
+	matches, err := filepath.Glob(filepath.Join(dir, "*_stress.json"))
+	if err != nil {
+		return nil, fmt.Errorf("search stress manifests: %w", err)
+	}
+	sort.Strings(matches)
+
+	var manifests []*StressTestManifest
+	for _, path := range matches {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		var m StressTestManifest
+		if err := json.Unmarshal(data, &m); err != nil || m.JobID == "" || len(m.Variants) == 0 {
+			continue
+		}
+		manifests = append(manifests, &m)
+	}
+	return manifests, nil
+}
+
+// recordStressTestManifest writes a stress manifest when the downloaded job was expanded into stress variants
+func (dm *DownloadManager) recordStressTestManifest(job Job, expandedXML string) {
+	m := newStressTestManifest(job.ID, expandedXML)
+	if m == nil {
+		return
+	}
+	if err := saveStressTestManifest(dm.config.Folders.Files.Jobs.Manifests, m); err != nil {
+		fmt.Printf("Warning: Could not save stress manifest for job %s: %v\n", job.ID, err)
+		return
+	}
+	fmt.Printf("📋 Recorded stress test manifest for job %s (%d variants)\n", job.ID, len(m.Variants))
+}
+
+// CostCurvePoint is the result of one stress variant
+type CostCurvePoint struct {
+	Variant            int     `json:"variant"`
+	Slippage           float64 `json:"slippage"`
+	Commission         float64 `json:"commission,omitempty"`
+	CommissionMultiple int     `json:"commission_multiple"`
+	Source             string  `json:"source"`
+	Trades             int     `json:"trades"` // 0 when built from a daily summary
+	NetProfit          float64 `json:"net_profit"`
+	MaxDrawdown        float64 `json:"max_drawdown"` // currency (>= 0)
+}
+
+// CostSensitivityCurve is the cost curve of one element (symbol, timeframe, run) of a stress-tested job
+type CostSensitivityCurve struct {
+	Group     string           `json:"group"`
+	Symbol    string           `json:"symbol"`
+	Timeframe string           `json:"timeframe"`
+	Points    []CostCurvePoint `json:"points"` // by commission multiple, then slippage
+	// Net profit change per unit of slippage at the base commission (least squares slope)
+	NetProfitPerSlippage float64 `json:"net_profit_per_slippage"`
+	// Slippage at which net profit reaches zero at the base commission, interpolated between
+	// tested steps or extrapolated along the slope; nil when net profit does not fall with slippage
+	BreakEvenSlippage     *float64 `json:"break_even_slippage,omitempty"`
+	BreakEvenExtrapolated bool     `json:"break_even_extrapolated"`
+}
+
+// StressTestReport is the single cost-sensitivity report uploaded per stress-tested job
+type StressTestReport struct {
+	JobID          string                 `json:"job_id"`
+	GeneratedAt    string                 `json:"generated_at"`
+	InitialCapital float64                `json:"initial_capital"`
+	Spec           StressTestSpec         `json:"spec"`
+	Curves         []CostSensitivityCurve `json:"curves"`
+}
+
+// buildCostSensitivityCurve sorts the points and computes the slope and break-even slippage
+func buildCostSensitivityCurve(group, symbol, timeframe string, points []CostCurvePoint) CostSensitivityCurve {
+	sort.Slice(points, func(i, j int) bool {
+		if points[i].CommissionMultiple != points[j].CommissionMultiple {
+			return points[i].CommissionMultiple < points[j].CommissionMultiple
+		}
+		return points[i].Slippage < points[j].Slippage
+	})
+	curve := CostSensitivityCurve{Group: group, Symbol: symbol, Timeframe: timeframe, Points: points}
+
+	var base []CostCurvePoint
+	for _, p := range points {
+		if p.CommissionMultiple == points[0].CommissionMultiple {
+			base = append(base, p)
+		}
+	}
+	if len(base) < 2 {
+		return curve
+	}
+
+	var sx, sy, sxx, sxy float64
+	n := float64(len(base))
+	for _, p := range base {
+		sx += p.Slippage
+		sy += p.NetProfit
+		sxx += p.Slippage * p.Slippage
+		sxy += p.Slippage * p.NetProfit
+	}
+	if d := n*sxx - sx*sx; d != 0 {
+		curve.NetProfitPerSlippage = (n*sxy - sx*sy) / d
+	}
+
+	// First crossing from profit to loss between tested steps
+	for i := 1; i < len(base); i++ {
+		a, b := base[i-1], base[i]
+		if a.NetProfit > 0 && b.NetProfit <= 0 {
+			be := a.Slippage + a.NetProfit/(a.NetProfit-b.NetProfit)*(b.Slippage-a.Slippage)
+			curve.BreakEvenSlippage = &be
+			return curve
+		}
+	}
+	if base[0].NetProfit <= 0 {
+		be := base[0].Slippage
+		curve.BreakEvenSlippage = &be
+		return curve
+	}
+	if curve.NetProfitPerSlippage < 0 {
+		last := base[len(base)-1]
+		be := last.Slippage - last.NetProfit/curve.NetProfitPerSlippage
+		curve.BreakEvenSlippage = &be
+		curve.BreakEvenExtrapolated = true
+	}
+	return curve
+}
+
+// dailyNetProfitAndDrawdown sums daily P&L in date order and returns the net profit and the
+// largest peak-to-trough decline of the cumulative P&L
+func dailyNetProfitAndDrawdown(daily map[string]float64) (float64, float64) {
+	dates := make([]string, 0, len(daily))
+	for date := range daily {
+		dates = append(dates, date)
+	}
+	sort.Strings(dates)
+
+	var cumulative, peak, maxDrawdown float64
+	for _, date := range dates {
+		cumulative += daily[date]
+		peak = math.Max(peak, cumulative)
+		maxDrawdown = math.Max(maxDrawdown, peak-cumulative)
+	}
+	return cumulative, maxDrawdown
+}
+
+// findStressResultFile returns the newest file in dir named <variant filename>_...<suffix> or
+// <variant filename><suffix>, or "". The "@" of the symbol may be missing from the file name.
+func findStressResultFile(dir, filename, suffix string) string {
+	matches, err := filepath.Glob(filepath.Join(dir, "*"+suffix))
+	if err != nil {
+		return ""
+	}
+	want := strings.ReplaceAll(filename, "@", "")
+
+	newest := ""
+	var newestTime time.Time
+	for _, path := range matches {
+		name := strings.ReplaceAll(strings.TrimSuffix(filepath.Base(path), suffix), "@", "")
+		if name != want && !strings.HasPrefix(name, want+"_") {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		if newest == "" || info.ModTime().After(newestTime) {
+			newest = path
+			newestTime = info.ModTime()
+		}
+	}
+	return newest
+}
+
+// loadStressVariantResult reads a variant's trades CSV, or its daily summary
+func loadStressVariantResult(cfg *Config, v StressVariant, logf func(string)) (CostCurvePoint, bool) {
+	point := CostCurvePoint{Variant: v.Variant, Slippage: v.Slippage, Commission: v.Commission, CommissionMultiple: v.CommissionMultiple}
+
+	if path := findStressResultFile(cfg.Folders.Files.Results.Trades, v.Filename, "_trades.csv"); path != "" {
+		trades, err := readTradesCSVFile(path, nil) // Polled, so no per-record output
+		if err == nil {
+			point.Source = filepath.Base(path)
+			point.Trades = len(trades)
+			point.NetProfit, point.MaxDrawdown = dailyNetProfitAndDrawdown(dailyPnLFromTrades(trades))
+			return point, true
+		}
+		logf(fmt.Sprintf("Could not read trades for stress variant %s: %v", v.Filename, err))
+	}
+
+	for _, dir := range []string{cfg.Folders.Files.Opt.Summary, cfg.Folders.Files.Opt.Done} {
+		path := findStressResultFile(dir, v.Filename, "_Daily.rep")
+		if path == "" {
+			continue
+		}
+		daily, err := dailyPnLFromSummary(path, v.Symbol)
+		if err != nil {
+			logf(fmt.Sprintf("Could not read daily summary for stress variant %s: %v", v.Filename, err))
+			continue
+		}
+		point.Source = filepath.Base(path)
+		point.NetProfit, point.MaxDrawdown = dailyNetProfitAndDrawdown(daily)
+		return point, true
+	}
+	return point, false
+}
+
+// buildStressTestReport groups the variant results into one cost curve per expanded element
+func buildStressTestReport(m *StressTestManifest, points map[int]CostCurvePoint) *StressTestReport {
+	report := &StressTestReport{
+		JobID:          m.JobID,
+		GeneratedAt:    time.Now().UTC().Format(time.RFC3339),
+		InitialCapital: m.InitialCapital,
+		Spec:           m.Spec,
+	}
+
+	var groups []string
+	byGroup := make(map[string][]StressVariant)
+	for _, v := range m.Variants {
+		if _, seen := byGroup[v.Group]; !seen {
+			groups = append(groups, v.Group)
+		}
+		byGroup[v.Group] = append(byGroup[v.Group], v)
+	}
+	for _, group := range groups {
+		variants := byGroup[group]
+		curvePoints := make([]CostCurvePoint, 0, len(variants))
+		for _, v := range variants {
+			curvePoints = append(curvePoints, points[v.Variant])
+		}
+		report.Curves = append(report.Curves, buildCostSensitivityCurve(group, variants[0].Symbol, variants[0].Timeframe, curvePoints))
+	}
+	return report
+}
+
+// StressTestAggregator waits for all variants of stress-tested jobs to report back and uploads one
+// cost-sensitivity report with the parent job's results
+type StressTestAggregator struct {
+	config    *Config
+	api       *APIClient
+	mutex     sync.Mutex
+	isRunning bool
+	stopCh    chan struct{}
+	logf      func(string)
+}
+
+// NewStressTestAggregator creates a new StressTestAggregator
+func NewStressTestAggregator(config *Config, api *APIClient) *StressTestAggregator {
+	return &StressTestAggregator{
+		config: config,
+		api:    api,
+		logf:   func(s string) {}, // default no-op logger
+	}
+}
+
+// SetLogger sets the logging function
+func (sa *StressTestAggregator) SetLogger(fn func(string)) {
+	if fn != nil {
+		sa.logf = fn
+	}
+}
+
+// Start begins checking pending stress manifests
+func (sa *StressTestAggregator) Start() error {
+	sa.mutex.Lock()
+	defer sa.mutex.Unlock()
+
+	if sa.isRunning {
+		return nil
+	}
+
+	sa.isRunning = true
+	sa.stopCh = make(chan struct{})
+	sa.logf("Stress test aggregation started")
+
+	go sa.monitorManifests()
+	return nil
+}
+
+// Stop stops checking manifests
+func (sa *StressTestAggregator) Stop() {
+	sa.mutex.Lock()
+	defer sa.mutex.Unlock()
+
+	if !sa.isRunning {
+		return
+	}
+	sa.isRunning = false
+	close(sa.stopCh)
+	sa.logf("Stress test aggregation stopped")
+}
+
+// monitorManifests periodically aggregates stress tests whose variants have all reported
+func (sa *StressTestAggregator) monitorManifests() {
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-sa.stopCh:
+			return
+		case <-ticker.C:
+			if err := sa.processManifests(); err != nil {
+				sa.logf(fmt.Sprintf("Error processing stress manifests: %v", err))
+			}
+		}
+	}
+}
+
+// processManifests aggregates every pending stress manifest that is complete
+func (sa *StressTestAggregator) processManifests() error {
+	manifests, err := loadStressTestManifests(sa.config.Folders.Files.Jobs.Manifests)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range manifests {
+		if m.Status != ManifestPending {
+			continue
+		}
+		points, complete := sa.collectVariantResults(m)
+		if !complete {
+			continue // still waiting for results
+		}
+		if err := sa.aggregate(m, points); err != nil {
+			sa.logf(fmt.Sprintf("Stress test aggregation failed for job %s: %v", m.JobID, err))
+		}
+	}
+	return nil
+}
+
+// collectVariantResults reads each variant's result; complete is false while any is missing
+func (sa *StressTestAggregator) collectVariantResults(m *StressTestManifest) (map[int]CostCurvePoint, bool) {
+	points := make(map[int]CostCurvePoint, len(m.Variants))
+	for _, v := range m.Variants {
+		point, ok := loadStressVariantResult(sa.config, v, sa.logf)
+		if !ok {
+			return nil, false
+		}
+		points[v.Variant] = point
+	}
+	return points, true
+}
+
+// aggregate builds, saves and uploads the report for a complete manifest, then marks it done
+func (sa *StressTestAggregator) aggregate(m *StressTestManifest, points map[int]CostCurvePoint) error {
+	report := buildStressTestReport(m, points)
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal stress report: %w", err)
+	}
+	fileName := fmt.Sprintf("%s_STRESS_COST_CURVE_Daily.rep", m.JobID)
+	path := filepath.Join(sa.config.Folders.Files.Results.Consolidated, fileName)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("create consolidated directory: %w", err)
+	}
+	if err := writeFileAtomic(path, data, 0644); err != nil {
+		return fmt.Errorf("write stress report: %w", err)
+	}
+
+	sa.logf(fmt.Sprintf("Uploading stress test report for job %s (%d variants)", m.JobID, len(m.Variants)))
+	if _, err := sa.api.UploadDailySummary(path, m.JobID); err != nil {
+		return fmt.Errorf("upload stress report: %w", err)
+	}
+
+	m.Status = ManifestAggregated
+	m.CompletedAt = time.Now().UTC().Format(time.RFC3339)
+	m.OutputFile = fileName
+	if err := saveStressTestManifest(sa.config.Folders.Files.Jobs.Manifests, m); err != nil {
+		return fmt.Errorf("update stress manifest: %w", err)
+	}
+	for _, curve := range report.Curves {
+		breakEven := "not reached"
+		if curve.BreakEvenSlippage != nil {
+			breakEven = fmt.Sprintf("%.2f", *curve.BreakEvenSlippage)
+		}
+		sa.logf(fmt.Sprintf("Stress test %s: net profit %.2f per unit of slippage, break-even slippage %s",
+			curve.Group, curve.NetProfitPerSlippage, breakEven))
+	}
+	return nil
+}
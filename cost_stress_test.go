@@ -0,0 +1,138 @@
+package main
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExpandStressTestJob(t *testing.T) {
+	job := "<Job>\n  <Symbol>@ES</Symbol>\n  <Timeframe>60</Timeframe>\n  <filename>job1_@ES_60_OPT.job</filename>\n" +
+		"  <initialCapital>50000</initialCapital>\n  <marketOrderSlippage>5.0</marketOrderSlippage>\n" +
+		"  <slippageMultiplier>0</slippageMultiplier>\n  <stressTestSize>3</stressTestSize>\n" +
+		"  <stressTestIncrement>10</stressTestIncrement>\n  <includeCommission>Yes</includeCommission>\n" +
+		"  <commission>2.5</commission>\n</Job>"
+
+	content, count, err := expandJobXML(job, 0)
+	if err != nil {
+		t.Fatalf("expandJobXML failed: %v", err)
+	}
+	// 3 slippage steps x 3 commission multiples
+	if count != 9 {
+		t.Fatalf("Expected 9 job elements, got %d", count)
+	}
+	for _, want := range []string{
+		"<filename>job1_@ES_60_OPT_STRESS-1.job</filename>",
+		"<filename>job1_@ES_60_OPT_STRESS-9.job</filename>",
+		"<marketOrderSlippage>25</marketOrderSlippage>",
+		"<commission>7.5</commission>",
+	} {
+		if !strings.Contains(content, want) {
+			t.Fatalf("Expected %s in expanded XML:\n%s", want, content)
+		}
+	}
+	if strings.Count(content, "<stressTestSize>1</stressTestSize>") != 9 {
+		t.Fatalf("Expected every element to run a single stress step")
+	}
+
+	m := newStressTestManifest("job1", content)
+	if m == nil || len(m.Variants) != 9 || m.InitialCapital != 50000 {
+		t.Fatalf("Unexpected stress manifest: %+v", m)
+	}
+	if m.Spec.Steps != 3 || m.Spec.BaseSlippage != 5 || m.Spec.BaseCommission != 2.5 || m.Spec.Increment != 10 {
+		t.Fatalf("Unexpected recovered spec: %+v", m.Spec)
+	}
+	last := m.Variants[8]
+	if last.Group != "job1_@ES_60_OPT" || last.Slippage != 25 || last.CommissionMultiple != 3 {
+		t.Fatalf("Unexpected last variant: %+v", last)
+	}
+
+	// Without commission and with a single step nothing is expanded
+	if isStressTestJob(strings.Replace(job, "<stressTestSize>3", "<stressTestSize>1", 1)) {
+		t.Fatalf("A single stress step should not be expanded")
+	}
+	noCommission := strings.Replace(job, "<includeCommission>Yes", "<includeCommission>No", 1)
+	if elements := expandStressTestJob(noCommission); len(elements) != 3 {
+		t.Fatalf("Expected 3 slippage-only elements, got %d", len(elements))
+	}
+	if newStressTestManifest("job1", "<root><Job><Symbol>@ES</Symbol></Job></root>") != nil {
+		t.Fatalf("Expected no manifest for a job without stress variants")
+	}
+}
+
+func TestBuildCostSensitivityCurve(t *testing.T) {
+	points := func(profits ...float64) []CostCurvePoint {
+		var ps []CostCurvePoint
+		for i, p := range profits {
+			ps = append(ps, CostCurvePoint{Variant: i + 1, Slippage: float64(i) * 10, CommissionMultiple: 1, NetProfit: p})
+		}
+		// A doubled commission row must not affect the base commission curve
+		return append(ps, CostCurvePoint{Variant: len(ps) + 1, Slippage: 0, CommissionMultiple: 2, NetProfit: -1e6})
+	}
+	tests := []struct {
+		name         string
+		profits      []float64
+		breakEven    float64 // NaN when not reached
+		extrapolated bool
+	}{
+		{"crosses between steps", []float64{1000, 400, -200}, 16.666666666666668, false},
+		{"extrapolated", []float64{1000, 800, 600}, 50, true},
+		{"losing at base costs", []float64{-100, -300, -500}, 0, false},
+		{"not falling", []float64{1000, 1000, 1100}, math.NaN(), false},
+	}
+	for _, tt := range tests {
+		curve := buildCostSensitivityCurve("g", "@ES", "60", points(tt.profits...))
+		if math.IsNaN(tt.breakEven) {
+			if curve.BreakEvenSlippage != nil {
+				t.Fatalf("%s: expected no break-even, got %v", tt.name, *curve.BreakEvenSlippage)
+			}
+			continue
+		}
+		if curve.BreakEvenSlippage == nil || math.Abs(*curve.BreakEvenSlippage-tt.breakEven) > 1e-9 || curve.BreakEvenExtrapolated != tt.extrapolated {
+			t.Fatalf("%s: expected break-even %v (extrapolated %v), got %+v", tt.name, tt.breakEven, tt.extrapolated, curve)
+		}
+	}
+}
+
+func TestStressVariantResults(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &Config{}
+	cfg.Folders.Files.Opt.Summary = dir
+	cfg.Folders.Files.Opt.Done = dir
+	cfg.Folders.Files.Results.Trades = filepath.Join(dir, "missing")
+
+	// STRESS-1 must not pick up the STRESS-10 summary
+	files := map[string]string{
+		"job1_ES_60_OPT_STRESS-1_Daily.rep":  `{"dates":["20200102","20200103","20200106"],"cumulative_pnl":[100,-50,30]}`,
+		"job1_ES_60_OPT_STRESS-10_Daily.rep": `{"dates":["20200102"],"cumulative_pnl":[999]}`,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+
+	logf := func(string) {}
+	v := StressVariant{Variant: 1, Filename: "job1_@ES_60_OPT_STRESS-1", Symbol: "@ES", Slippage: 5, CommissionMultiple: 1}
+	point, ok := loadStressVariantResult(cfg, v, logf)
+	if !ok || point.NetProfit != 30 || point.MaxDrawdown != 150 {
+		t.Fatalf("Expected net profit 30 and drawdown 150, got %+v (ok %v)", point, ok)
+	}
+	if _, ok := loadStressVariantResult(cfg, StressVariant{Variant: 2, Filename: "job1_@ES_60_OPT_STRESS-2", Symbol: "@ES"}, logf); ok {
+		t.Fatalf("Expected no result for a variant that has not reported")
+	}
+
+	m := &StressTestManifest{JobID: "job1", Status: ManifestPending, Variants: []StressVariant{v}}
+	if err := saveStressTestManifest(dir, m); err != nil {
+		t.Fatalf("saveStressTestManifest failed: %v", err)
+	}
+	loaded, err := loadStressTestManifests(dir)
+	if err != nil || len(loaded) != 1 || loaded[0].Variants[0].Filename != v.Filename {
+		t.Fatalf("Expected the saved stress manifest, got %v (err %v)", loaded, err)
+	}
+	if manifests, _ := loadJobManifests(dir); len(manifests) != 0 {
+		t.Fatalf("Stress manifests must not be picked up as MM/MTF manifests")
+	}
+}
@@ -1,12 +1,10 @@
 package main
 
 import (
-	"compress/zlib"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
-	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -331,6 +329,13 @@ func (oum *OptUploadManager) uploadOptFile(fileName string) error {
 	} else {
 		// Regular OPT file - skip WFO processing
 		oum.logf(fmt.Sprintf("Non-WFO OPT file detected: %s - skipping WFO processing", fileName))
+
+		// Optionally follow up the best parameter sets of a plain optimization on a holdout period
+		if oum.config.Analysis.FollowUp.Enabled && oum.extractTaskTypeFromFilename(fileName) == "OPT" {
+			if err := oum.generateFollowUpJobs(fileName, jobID); err != nil {
+				oum.logf(fmt.Sprintf("Warning: Follow-up job generation failed for job %s: %v", jobID, err))
+			}
+		}
 	}
 
 	// After successful OPT upload, trigger daily summary folder scan after 30 seconds
@@ -583,8 +588,8 @@ func (oum *OptUploadManager) checkAndTriggerCombinedWFO(fileName, jobID string)
 
 		for i := 0; i < maxRunsToLog; i++ {
 			result := optResults[i]
-			fmt.Printf("[INFO] WFO_RETEST Generation:   Run %d: Parameters JSON = %.80s...\n", i+1, result.ParametersJSON)
-			oum.logf(fmt.Sprintf("WFO_RETEST Generation: Run %d: Parameters JSON = %.80s...", i+1, result.ParametersJSON))
+			fmt.Printf("[INFO] WFO_RETEST Generation:   Run %d: Parameters JSON = %.80s...\n", i+1, logRedactor.RedactParameters(result.ParametersJSON))
+			oum.logf(fmt.Sprintf("WFO_RETEST Generation: Run %d: Parameters JSON = %.80s...", i+1, logRedactor.RedactParameters(result.ParametersJSON)))
 		}
 
 		if len(optResults) > maxRunsToLog {
@@ -707,307 +712,71 @@ func (oum *OptUploadManager) triggerWFORetestGeneration(jobID string, optResults
 	return nil
 }
 
-// parseOPTFile reads and parses an OPT file to extract WFO run information
+// parseOPTFile streams an OPT file to extract WFO run information
 func (oum *OptUploadManager) parseOPTFile(filePath string, jobTaskType string) ([]OPTResult, bool, error) {
 	fmt.Printf("[INFO] Parsing OPT file: %s\n", filePath)
 	oum.logf(fmt.Sprintf("Parsing OPT file: %s", filePath))
 
-	// Step 1: Decompress the zlib-compressed OPT file
-	csvContent, err := oum.decompressOPTFile(filePath)
-	if err != nil {
-		fmt.Printf("[ERROR] Failed to decompress OPT file - %v\n", err)
-		return nil, false, fmt.Errorf("decompress OPT file: %w", err)
-	}
-
-	// Step 2: Parse CSV content to extract WFO run information
-	optResults, isWFO, err := oum.parseCSVContent(csvContent, jobTaskType)
-	if err != nil {
-		fmt.Printf("[ERROR] Failed to parse CSV content - %v\n", err)
-		return nil, false, fmt.Errorf("parse CSV content: %w", err)
-	}
-
-	if !isWFO {
-		fmt.Printf("[INFO] No WFO pattern found - not a WFO job\n")
-		return nil, false, nil
-	}
-
-	fmt.Printf("[INFO] Successfully parsed %d WFO runs\n", len(optResults))
-	return optResults, true, nil
-}
-
-// decompressOPTFile decompresses a zlib-compressed OPT file and returns CSV content
-func (oum *OptUploadManager) decompressOPTFile(filePath string) (string, error) {
-	fmt.Printf("[DEBUG] OPT Decompression: Starting zlib decompression of file: %s\n", filePath)
-
-	// Open the compressed file
-	file, err := os.Open(filePath)
-	if err != nil {
-		fmt.Printf("[ERROR] OPT Decompression: Failed to open compressed file - %v\n", err)
-		return "", fmt.Errorf("open compressed file: %w", err)
-	}
-	defer file.Close()
-
-	fmt.Printf("[DEBUG] OPT Decompression: Creating zlib reader\n")
-
-	// Create zlib reader (same as decompress-rep.go script)
-	reader, err := zlib.NewReader(file)
-	if err != nil {
-		fmt.Printf("[ERROR] OPT Decompression: Failed to create zlib reader - %v\n", err)
-		return "", fmt.Errorf("create zlib reader (file may not be zlib compressed): %w", err)
-	}
-	defer reader.Close()
-
-	// Read decompressed content into memory
-	fmt.Printf("[DEBUG] OPT Decompression: Reading decompressed CSV content\n")
-	var csvBuffer strings.Builder
-	bytesRead, err := io.Copy(&csvBuffer, reader)
-	if err != nil {
-		fmt.Printf("[ERROR] OPT Decompression: Failed to read decompressed data - %v\n", err)
-		return "", fmt.Errorf("decompress data: %w", err)
-	}
-
-	csvContent := csvBuffer.String()
-	fmt.Printf("[DEBUG] OPT Decompression: Successfully decompressed %d bytes to %d bytes of CSV content\n", bytesRead, len(csvContent))
-
-	// Save decompressed content to a fixed debug location for easy access
-	debugDir := "C:\\AlphaWeaver\\debug"
-	if err := os.MkdirAll(debugDir, 0755); err != nil {
-		fmt.Printf("[WARN] OPT Decompression: Failed to create debug directory: %v\n", err)
-	}
-
-	baseFileName := filepath.Base(filePath)
-	debugFileName := strings.TrimSuffix(baseFileName, ".opt") + "_decompressed.csv"
-	debugFilePath := filepath.Join(debugDir, debugFileName)
-
-	fmt.Printf("[DEBUG] OPT Decompression: Temp dir location: %s\n", os.TempDir())
-	fmt.Printf("[DEBUG] OPT Decompression: Attempting to save debug file to: %s\n", debugFilePath)
-
-	if err := os.WriteFile(debugFilePath, []byte(csvContent), 0644); err != nil {
-		fmt.Printf("[ERROR] OPT Decompression: Failed to save debug file: %v\n", err)
-	} else {
-		fmt.Printf("[INFO] OPT Decompression: Successfully saved decompressed content to: %s\n", debugFilePath)
-	}
-
-	fmt.Printf("[DEBUG] OPT Decompression: First 500 characters of decompressed content:\n%.500s\n", csvContent)
-
-	return csvContent, nil
-}
-
-// parseCSVContent parses CSV content to extract WFO run information and parameters
-func (oum *OptUploadManager) parseCSVContent(csvContent string, jobTaskType string) ([]OPTResult, bool, error) {
 	// CRITICAL FIX: Validate job task_type BEFORE checking CSV structure
 	if jobTaskType != "WFO" && jobTaskType != "WFM" {
 		fmt.Printf("[INFO] Job task_type '%s' is not WFO/WFM - skipping WFO processing\n", jobTaskType)
 		return nil, false, nil
 	}
 
-	// Handle CSV content with JSON parameters that contain commas
-	records, err := oum.parseCSVWithJSONFields(csvContent)
-	if err != nil {
-		fmt.Printf("[ERROR] Failed to parse CSV with JSON handling - %v\n", err)
-		return nil, false, fmt.Errorf("parse CSV: %w", err)
-	}
-
-	if len(records) < 2 { // Need header + at least one data row
-		return nil, false, nil
-	}
-
-	// Analyze header to determine if this is a WFO file
-	header := records[0]
-
-	// Look for WFO-specific columns
-	hasRunColumn := false
-	hasParametersJSONColumn := false
-	runIndex := -1
-	parametersJSONIndex := -1
-	isStartIndex, isEndIndex, osStartIndex, osEndIndex := -1, -1, -1, -1
-
-	for i, col := range header {
-		colLower := strings.ToLower(strings.TrimSpace(col))
-		if colLower == "run" || colLower == "run_number" {
-			hasRunColumn = true
-			runIndex = i
-		}
-		if colLower == "parameters_json" || colLower == "parameters json" {
-			hasParametersJSONColumn = true
-			parametersJSONIndex = i
-		}
-		// Look for IS/OS date range columns (based on actual CSV headers)
-		if colLower == "is_start_date" {
-			isStartIndex = i
-		}
-		if colLower == "is_end_date" {
-			isEndIndex = i
-		}
-		if colLower == "os_start_date" {
-			osStartIndex = i
-		}
-		if colLower == "os_end_date" {
-			osEndIndex = i
-		}
+	// Keep a decompressed copy for troubleshooting when debug dumps are enabled
+	var dump io.Writer
+	if debugFile, err := debugDumps.Create(debugDumpName(filePath, "_decompressed.csv")); err != nil {
+		fmt.Printf("[WARN] OPT Parsing: Failed to create debug dump: %v\n", err)
+	} else if debugFile != nil {
+		defer debugFile.Close()
+		dump = debugFile
 	}
 
-	// Check if this appears to be a WFO file
-	if !hasRunColumn || !hasParametersJSONColumn {
-		return nil, false, nil
+	// Step 1: Open the zlib-compressed OPT file as a stream of rows
+	reader, closer, err := openOPTFile(filePath, dump)
+	if err != nil {
+		fmt.Printf("[ERROR] Failed to open OPT file - %v\n", err)
+		return nil, false, fmt.Errorf("open OPT file: %w", err)
 	}
+	defer closer.Close()
 
-	// Parse WFO runs
-	var optResults []OPTResult
-
-	for i, record := range records[1:] { // Skip header
-		if len(record) <= runIndex || len(record) <= parametersJSONIndex {
-			fmt.Printf("[WARN] CSV Content Parsing: Skipping invalid record %d (insufficient columns)\n", i+1)
-			continue
-		}
-
-		// Parse run number
-		runStr := strings.TrimSpace(record[runIndex])
-		run, err := strconv.Atoi(runStr)
-		if err != nil {
-			fmt.Printf("[WARN] CSV Content Parsing: Skipping record %d - invalid run number: %s\n", i+1, runStr)
-			continue
-		}
-
-		// Extract parameters JSON
-		parametersJSON := strings.TrimSpace(record[parametersJSONIndex])
-		if parametersJSON == "" {
-			fmt.Printf("[WARN] CSV Content Parsing: Skipping record %d - empty parameters JSON\n", i+1)
-			continue
-		}
-
-		// Extract date ranges if available
-		var isStartDate, isEndDate, osStartDate, osEndDate string
-
-		if isStartIndex >= 0 && isStartIndex < len(record) {
-			isStartDate = strings.TrimSpace(record[isStartIndex])
-		}
-		if isEndIndex >= 0 && isEndIndex < len(record) {
-			isEndDate = strings.TrimSpace(record[isEndIndex])
-		}
-		if osStartIndex >= 0 && osStartIndex < len(record) {
-			osStartDate = strings.TrimSpace(record[osStartIndex])
-		}
-		if osEndIndex >= 0 && osEndIndex < len(record) {
-			osEndDate = strings.TrimSpace(record[osEndIndex])
-		}
-
-		// Create OPTResult with complete data
-		result := OPTResult{
-			Run:            run,
-			ParametersJSON: parametersJSON,
-			ISStartDate:    isStartDate,
-			ISEndDate:      isEndDate,
-			OSStartDate:    osStartDate,
-			OSEndDate:      osEndDate,
-		}
-
-		fmt.Printf("[DEBUG] CSV Content Parsing: Extracted WFO run %d with parameters: %.100s...\n", run, parametersJSON)
-		fmt.Printf("[DEBUG] CSV Content Parsing:   Run %d dates - IS: %s to %s, OS: %s to %s\n", run, isStartDate, isEndDate, osStartDate, osEndDate)
-		optResults = append(optResults, result)
+	// Step 2: Extract WFO run information
+	optResults, err := readWFOResults(reader, oum.config.Analysis.ParameterSelection)
+	if err != nil {
+		fmt.Printf("[ERROR] Failed to parse OPT content - %v\n", err)
+		return nil, false, fmt.Errorf("parse OPT content: %w", err)
 	}
 
 	if len(optResults) == 0 {
-		fmt.Printf("[DEBUG] CSV Content Parsing: No valid WFO runs found\n")
+		fmt.Printf("[INFO] No WFO pattern found - not a WFO job\n")
 		return nil, false, nil
 	}
 
-	fmt.Printf("[DEBUG] CSV Content Parsing: Successfully extracted %d WFO runs\n", len(optResults))
-
-	// Clear CSV content from memory after successful processing
-	// This ensures sensitive data doesn't persist longer than necessary
-	defer func() {
-		csvContent = "" // Clear the string content
-		fmt.Printf("[DEBUG] CSV Content Parsing: Cleared CSV content from memory after processing\n")
-	}()
-
+	fmt.Printf("[INFO] Successfully parsed %d WFO runs\n", len(optResults))
 	return optResults, true, nil
 }
 
-// parseCSVWithJSONFields parses CSV content that may contain unquoted JSON fields with commas
-func (oum *OptUploadManager) parseCSVWithJSONFields(csvContent string) ([][]string, error) {
-	fmt.Printf("[DEBUG] JSON-aware CSV Parsing: Starting specialized parsing for JSON fields\n")
-
-	lines := strings.Split(csvContent, "\n")
-	var records [][]string
-
-	for i, line := range lines {
-		if strings.TrimSpace(line) == "" {
-			continue // Skip empty lines
-		}
-
-		// Parse each line handling JSON fields that contain commas
-		fields, err := oum.parseCSVLineWithJSON(line)
-		if err != nil {
-			fmt.Printf("[ERROR] JSON-aware CSV Parsing: Failed to parse line %d: %v\n", i+1, err)
-			fmt.Printf("[ERROR] JSON-aware CSV Parsing: Problematic line: %q\n", line)
-			return nil, fmt.Errorf("parse line %d: %w", i+1, err)
-		}
-
-		records = append(records, fields)
-
-		// Log first few records for debugging with field content
-		if i < 3 {
-			fmt.Printf("[DEBUG] JSON-aware CSV Parsing: Line %d parsed into %d fields\n", i+1, len(fields))
-			for j, field := range fields {
-				if strings.Contains(field, "{") {
-					fmt.Printf("[DEBUG] JSON-aware CSV Parsing:   Field %d (JSON): %.100s...\n", j, field)
-				} else if j < 5 { // Show first 5 non-JSON fields
-					fmt.Printf("[DEBUG] JSON-aware CSV Parsing:   Field %d: %s\n", j, field)
-				}
-			}
-		}
+// readWFOResults selects one parameter set per run from the OPT rows using the configured strategy.
+// Files without the run and parameters_json columns yield no results.
+func readWFOResults(reader *OPTReader, selection ParameterSelectionConfig) ([]OPTResult, error) {
+	if !reader.Schema().IsWFO() {
+		return nil, nil
 	}
 
-	fmt.Printf("[DEBUG] JSON-aware CSV Parsing: Successfully parsed %d lines\n", len(records))
-	return records, nil
-}
-
-// parseCSVLineWithJSON parses a single CSV line handling JSON fields and parameter fields with commas
-func (oum *OptUploadManager) parseCSVLineWithJSON(line string) ([]string, error) {
-	// Use a simple approach: split by commas, then merge back fields that were split incorrectly
-
-	// First, do a simple comma split
-	parts := strings.Split(line, ",")
-
-	var fields []string
-	i := 0
-
-	for i < len(parts) {
-		currentField := parts[i]
-
-		// Check if this part starts a JSON field
-		if strings.Contains(currentField, "{") && !strings.Contains(currentField, "}") {
-			// This is the start of a JSON field that got split - merge until we find the end
-			for i+1 < len(parts) && !strings.Contains(currentField, "}") {
-				i++
-				currentField += "," + parts[i]
-			}
-		} else if strings.Contains(currentField, "=") && !strings.Contains(currentField, "{") {
-			// This might be a parameter field (key=value format)
-			// Look ahead to see if the next parts also look like key=value pairs
-			originalField := currentField
-			tempI := i
-
-			// Check if next few parts also contain '=' (indicating they're part of the same parameter field)
-			for tempI+1 < len(parts) && strings.Contains(parts[tempI+1], "=") && !strings.Contains(parts[tempI+1], "{") {
-				tempI++
-				currentField += "," + parts[tempI]
-			}
-
-			// Only merge if we found additional parameter pairs
-			if tempI > i {
-				i = tempI
-			} else {
-				currentField = originalField
-			}
-		}
-
-		fields = append(fields, strings.TrimSpace(currentField))
-		i++
+	results, err := readOptimizationResults(reader)
+	if err != nil {
+		return nil, err
 	}
 
-	return fields, nil
+	optResults, err := selectWFOParameters(results, selection)
+	if err != nil {
+		return nil, err
+	}
+	for _, result := range optResults {
+		fmt.Printf("[DEBUG] OPT Parsing: Selected WFO run %d parameters (%s): %.100s...\n", result.Run, result.Selection.Rationale, logRedactor.RedactParameters(result.ParametersJSON))
+		fmt.Printf("[DEBUG] OPT Parsing:   Run %d dates - IS: %s to %s, OS: %s to %s\n", result.Run, result.ISStartDate, result.ISEndDate, result.OSStartDate, result.OSEndDate)
+	}
+	return optResults, nil
 }
 
 // DailySummaryUploadManager manages uploading daily summary JSON files
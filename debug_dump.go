@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// debugDumpCleanupInterval limits how often old dumps are looked for
+const debugDumpCleanupInterval = time.Hour
+
+// DebugDumper writes troubleshooting copies of decompressed OPT and job files. It does nothing
+// unless enabled, since the copies contain strategy parameters and results.
+type DebugDumper struct {
+	mu          sync.Mutex
+	enabled     bool
+	dir         string
+	retention   time.Duration
+	lastCleanup time.Time
+}
+
+// debugDumps is shared by the OPT parser and the WFO job lookup; configureLogPrivacy sets it up
+var debugDumps = &DebugDumper{}
+
+// Configure enables or disables dumps and removes dumps older than retention
+func (d *DebugDumper) Configure(enabled bool, dir string, retention time.Duration) {
+	d.mu.Lock()
+	d.enabled, d.dir, d.retention = enabled, dir, retention
+	d.lastCleanup = time.Time{}
+	d.mu.Unlock()
+	d.Cleanup()
+}
+
+// Create opens a new private dump file; it returns nil without error when dumps are disabled.
+// The caller closes the file.
+func (d *DebugDumper) Create(name string) (*os.File, error) {
+	d.mu.Lock()
+	enabled, dir := d.enabled, d.dir
+	d.mu.Unlock()
+	if !enabled || dir == "" {
+		return nil, nil
+	}
+	d.Cleanup()
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("create debug dump directory: %w", err)
+	}
+	path := filepath.Join(dir, filepath.Base(name))
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("create debug dump: %w", err)
+	}
+	// OpenFile keeps the mode of an existing file
+	f.Chmod(0600)
+	return f, nil
+}
+
+// Write dumps data to a new file; nothing is written when dumps are disabled. Returns the path.
+func (d *DebugDumper) Write(name string, data []byte) (string, error) {
+	f, err := d.Create(name)
+	if f == nil || err != nil {
+		return "", err
+	}
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return "", fmt.Errorf("write debug dump: %w", err)
+	}
+	return f.Name(), nil
+}
+
+// Cleanup deletes dump files older than the retention period. It runs at most once an hour.
+func (d *DebugDumper) Cleanup() {
+	d.mu.Lock()
+	if d.dir == "" || d.retention <= 0 || time.Since(d.lastCleanup) < debugDumpCleanupInterval {
+		d.mu.Unlock()
+		return
+	}
+	d.lastCleanup = time.Now()
+	dir, cutoff := d.dir, time.Now().Add(-d.retention)
+	d.mu.Unlock()
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || !info.Mode().IsRegular() || !info.ModTime().Before(cutoff) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, entry.Name())); err != nil {
+			fmt.Printf("[WARN] Debug dumps: could not remove %s: %v\n", entry.Name(), err)
+		}
+	}
+}
+
+// debugDumpName builds a dump file name from a source file and a suffix
+func debugDumpName(sourcePath, suffix string) string {
+	base := filepath.Base(sourcePath)
+	return strings.TrimSuffix(base, filepath.Ext(base)) + suffix
+}
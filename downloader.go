@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -77,10 +78,13 @@ func (dm *DownloadManager) DownloadJobs(jobs []Job) *DownloadStats {
 	return stats
 }
 
-// extractFilenameFromXML extracts the filename element from XML content and converts .job to .xml
+// extractFilenameFromXML extracts the filename element from XML content and converts .job to .xml.
+// Expanded jobs carry the downloaded job's filename in <parent_filename>, which takes precedence.
 func (dm *DownloadManager) extractFilenameFromXML(xmlContent string) (string, error) {
-	re := regexp.MustCompile(`<filename>([^<]+)</filename>`)
-	matches := re.FindStringSubmatch(xmlContent)
+	matches := regexp.MustCompile(`<parent_filename>([^<]+)</parent_filename>`).FindStringSubmatch(xmlContent)
+	if len(matches) < 2 {
+		matches = regexp.MustCompile(`<filename>([^<]+)</filename>`).FindStringSubmatch(xmlContent)
+	}
 
 	if len(matches) < 2 {
 		return "", fmt.Errorf("filename element not found in XML")
@@ -110,7 +114,6 @@ func (dm *DownloadManager) downloadJob(job Job) DownloadResult {
 	tempPath := filepath.Join(dm.config.Folders.Files.Jobs.ToDo, tempName)
 
 	var lastErr error
-	var finalPath string
 
 	for attempt := 1; attempt <= dm.config.Download.RetryAttempts; attempt++ {
 		if err := dm.api.DownloadFile(job.XMLURL, tempPath); err != nil {
@@ -122,53 +125,13 @@ func (dm *DownloadManager) downloadJob(job Job) DownloadResult {
 				continue
 			}
 		} else {
-			// Read the XML content to extract the filename
-			xmlContent, err := os.ReadFile(tempPath)
-			if err != nil {
-				lastErr = fmt.Errorf("failed to read downloaded XML: %w", err)
-				break
-			}
-
-			// Extract filename from XML content
-			correctFilename, err := dm.extractFilenameFromXML(string(xmlContent))
+			compressedPath, err := dm.completeDownload(job, tempPath)
 			if err != nil {
-				// Fallback to old naming if filename extraction fails
-				fmt.Printf("Warning: Could not extract filename from XML for job %s, using fallback naming: %v\n", job.ID, err)
-				safeSymbol := strings.ReplaceAll(job.Symbol, ",", "-")
-				safeTimeframe := strings.ReplaceAll(job.Timeframe, ",", "-")
-				correctFilename = fmt.Sprintf("%s_%s_%s_%s.xml", job.ID, safeSymbol, safeTimeframe, job.TaskType)
-			}
-
-			// Move temp file to correct filename
-			finalPath = filepath.Join(dm.config.Folders.Files.Jobs.ToDo, correctFilename)
-
-			// Remove existing file if it exists
-			if _, err := os.Stat(finalPath); err == nil {
-				os.Remove(finalPath)
-			}
-
-			if err := os.Rename(tempPath, finalPath); err != nil {
-				lastErr = fmt.Errorf("failed to rename temp file to correct filename: %w", err)
-				// Clean up temp file
-				os.Remove(tempPath)
-				break
-			}
-
-			fmt.Printf("✅ Downloaded job %s with correct filename: %s\n", job.ID, correctFilename)
-
-			// Check and fix XML file if it has empty data streams
-			if err := dm.CheckAndFixXMLFile(finalPath, job.ID); err != nil {
-				fmt.Printf("Warning: Failed to check/fix XML file for job %s: %v\n", job.ID, err)
-				// Continue with the download even if fix fails
-			}
-
-			// Compress the downloaded XML file to .job format
-			compressedPath, err := CompressXMLFile(finalPath, true) // Delete original XML after compression
-			if err != nil {
-				lastErr = fmt.Errorf("download successful but compression failed: %w", err)
+				lastErr = err
+				if !errors.Is(err, errJobCompression) {
+					break
+				}
 				fmt.Printf("Compression failed for job %s: %v\n", job.ID, err)
-				// Clean up the uncompressed file
-				os.Remove(finalPath)
 				if attempt < dm.config.Download.RetryAttempts {
 					time.Sleep(dm.config.GetRetryDelay())
 					continue
@@ -281,7 +244,7 @@ func (fm *FileManager) MoveJobFile(fileName, fromStatus, toStatus string) error
 	fromPath := filepath.Join(fromFolder, fileName)
 	toPath := filepath.Join(toFolder, fileName)
 
-	if err := os.Rename(fromPath, toPath); err != nil {
+	if err := moveFile(fromPath, toPath); err != nil {
 		return fmt.Errorf("failed to move file %s: %w", fileName, err)
 	}
 
@@ -342,7 +305,7 @@ func (fm *FileManager) MoveCSVFile(fileName string) error {
 	fromPath := filepath.Join(fm.config.Folders.Files.Results.ToDo, fileName)
 	toPath := filepath.Join(fm.config.Folders.Files.Results.Done, fileName)
 
-	if err := os.Rename(fromPath, toPath); err != nil {
+	if err := moveFile(fromPath, toPath); err != nil {
 		return fmt.Errorf("failed to move CSV file %s: %w", fileName, err)
 	}
 
@@ -388,7 +351,7 @@ func (fm *FileManager) MoveDailySummaryFile(fileName string) error {
 	fromPath := filepath.Join(fm.config.Folders.Files.Opt.Summary, fileName)
 	toPath := filepath.Join(fm.config.Folders.Files.Opt.Done, fileName)
 
-	if err := os.Rename(fromPath, toPath); err != nil {
+	if err := moveFile(fromPath, toPath); err != nil {
 		return fmt.Errorf("failed to move daily summary file %s: %w", fileName, err)
 	}
 
@@ -400,7 +363,7 @@ func (fm *FileManager) MoveDailySummaryFileToError(fileName string) error {
 	fromPath := filepath.Join(fm.config.Folders.Files.Opt.Summary, fileName)
 	toPath := filepath.Join(fm.config.Folders.Files.Opt.Error, fileName)
 
-	if err := os.Rename(fromPath, toPath); err != nil {
+	if err := moveFile(fromPath, toPath); err != nil {
 		return fmt.Errorf("failed to move daily summary file to error folder %s: %w", fileName, err)
 	}
 
@@ -412,10 +375,24 @@ func (fm *FileManager) MoveOptFile(fileName string) error {
 	fromPath := filepath.Join(fm.config.Folders.Files.Opt.In, fileName)
 	toPath := filepath.Join(fm.config.Folders.Files.Opt.Done, fileName)
 
-	if err := os.Rename(fromPath, toPath); err != nil {
+	if err := moveFile(fromPath, toPath); err != nil {
 		return fmt.Errorf("failed to move OPT file %s: %w", fileName, err)
 	}
 
+	// Archived results may use a denser codec than the zlib TSClient writes; plain CSV is left as is
+	if codec := fm.config.Compression.ArchiveCodec; codec != "" && codec != CodecZlib {
+		if _, err := recompressFile(toPath, codec); err != nil && !errors.Is(err, errUnknownCodec) {
+			fmt.Printf("[WARN] Could not recompress archived OPT file %s with %s: %v\n", fileName, codec, err)
+		}
+	}
+
+	// Archived results are encrypted at rest; a failure leaves the file readable in plain form
+	if fileEncryption.Enabled() {
+		if _, err := encryptFileInPlace(toPath, false); err != nil {
+			fmt.Printf("[WARN] Could not encrypt archived OPT file %s: %v\n", fileName, err)
+		}
+	}
+
 	return nil
 }
 
@@ -472,6 +449,60 @@ func (fm *FileManager) DecompressJobFile(jobFileName, status string) (string, er
 	return xmlPath, nil
 }
 
+// errJobCompression marks a failed compression of a downloaded job, which is worth a new download
+var errJobCompression = errors.New("download successful but compression failed")
+
+// completeDownload turns a downloaded temp XML into the final .job in Jobs.ToDo: it renames the file
+// after the filename in the XML, records fan-out manifests, fixes empty data streams and compresses it.
+// Returns the compressed file path. Also used to resume a download interrupted by a restart.
+func (dm *DownloadManager) completeDownload(job Job, tempPath string) (string, error) {
+	// Read the XML content to extract the filename
+	xmlContent, err := os.ReadFile(tempPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read downloaded XML: %w", err)
+	}
+
+	// Extract filename from XML content
+	correctFilename, err := dm.extractFilenameFromXML(string(xmlContent))
+	if err != nil {
+		// Fallback to old naming if filename extraction fails
+		fmt.Printf("Warning: Could not extract filename from XML for job %s, using fallback naming: %v\n", job.ID, err)
+		safeSymbol := strings.ReplaceAll(job.Symbol, ",", "-")
+		safeTimeframe := strings.ReplaceAll(job.Timeframe, ",", "-")
+		correctFilename = fmt.Sprintf("%s_%s_%s_%s.xml", job.ID, safeSymbol, safeTimeframe, job.TaskType)
+	}
+
+	// Move temp file to correct filename, replacing an existing file
+	finalPath := filepath.Join(dm.config.Folders.Files.Jobs.ToDo, correctFilename)
+	if err := moveFile(tempPath, finalPath); err != nil {
+		// Clean up temp file
+		os.Remove(tempPath)
+		return "", fmt.Errorf("failed to rename temp file to correct filename: %w", err)
+	}
+
+	fmt.Printf("✅ Downloaded job %s with correct filename: %s\n", job.ID, correctFilename)
+
+	// Remember how MM/MTF and stress-tested jobs were fanned out so their results can be recombined
+	dm.recordJobManifest(job, string(xmlContent))
+	dm.recordStressTestManifest(job, string(xmlContent))
+
+	// Check and fix XML file if it has empty data streams
+	if err := dm.CheckAndFixXMLFile(finalPath, job.ID); err != nil {
+		fmt.Printf("Warning: Failed to check/fix XML file for job %s: %v\n", job.ID, err)
+		// Continue with the download even if fix fails
+	}
+
+	// Compress the downloaded XML file to .job format
+	meta := ContainerMeta{JobID: job.ID, SourceURL: sourceURLForMeta(job.XMLURL)}
+	compressedPath, err := CompressJobXMLFile(finalPath, true, meta) // Delete original XML after compression
+	if err != nil {
+		// Clean up the uncompressed file
+		os.Remove(finalPath)
+		return "", fmt.Errorf("%w: %v", errJobCompression, err)
+	}
+	return compressedPath, nil
+}
+
 // CompressJobFile compresses an XML file to .job format
 func (fm *FileManager) CompressJobFile(xmlFileName, status string, deleteOriginal bool) (string, error) {
 	var folder string
@@ -0,0 +1,121 @@
+package main
+
+import "sort"
+
+// defaultDrawdownTopN is the number of drawdown episodes kept on an equity curve
+const defaultDrawdownTopN = 5
+
+// DrawdownEpisode describes one peak-to-recovery drawdown of an equity curve
+type DrawdownEpisode struct {
+	PeakDate     string  `json:"peak_date"`
+	TroughDate   string  `json:"trough_date"`
+	RecoveryDate string  `json:"recovery_date"` // "unrecovered" if equity never regained the peak
+	Recovered    bool    `json:"recovered"`
+	PeakEquity   float64 `json:"peak_equity"`
+	TroughEquity float64 `json:"trough_equity"`
+	Depth        float64 `json:"depth"`         // currency
+	DepthPct     float64 `json:"depth_pct"`     // fraction of the peak
+	LengthDays   int     `json:"length_days"`   // peak to recovery (or to the last date if unrecovered)
+	DeclineDays  int     `json:"decline_days"`  // peak to trough
+	RecoveryDays int     `json:"recovery_days"` // trough to recovery (0 if unrecovered)
+	peakIndex    int
+	troughIndex  int
+}
+
+// analyzeDrawdowns splits an equity curve into drawdown episodes and builds the underwater curve.
+// Episodes are returned in chronological order. The underwater curve holds the drawdown from the
+// running peak as a non-positive fraction for each date. The initial capital is the first peak;
+// a drawdown starting before the first date is attributed to the first date.
+func analyzeDrawdowns(dates []string, equity []float64, initialCapital float64) ([]DrawdownEpisode, []float64) {
+	parsed := parseEquityDates(dates)
+	daysBetween := func(from, to int) int {
+		if from < 0 {
+			from = 0
+		}
+		if from >= len(parsed) || to >= len(parsed) || parsed[from].IsZero() || parsed[to].IsZero() {
+			return to - from
+		}
+		return int(parsed[to].Sub(parsed[from]).Hours() / 24)
+	}
+	dateAt := func(i int) string {
+		if i < 0 {
+			i = 0
+		}
+		if i < len(dates) {
+			return dates[i]
+		}
+		return ""
+	}
+
+	var episodes []DrawdownEpisode
+	underwater := make([]float64, len(equity))
+	peak := initialCapital
+	peakIndex := -1
+	var current *DrawdownEpisode
+
+	closeEpisode := func(recoveryIndex int) {
+		ep := current
+		ep.TroughDate = dateAt(ep.troughIndex)
+		ep.DeclineDays = daysBetween(ep.peakIndex, ep.troughIndex)
+		if recoveryIndex >= 0 {
+			ep.Recovered = true
+			ep.RecoveryDate = dateAt(recoveryIndex)
+			ep.LengthDays = daysBetween(ep.peakIndex, recoveryIndex)
+			ep.RecoveryDays = daysBetween(ep.troughIndex, recoveryIndex)
+		} else {
+			ep.RecoveryDate = "unrecovered"
+			ep.LengthDays = daysBetween(ep.peakIndex, len(equity)-1)
+		}
+		episodes = append(episodes, *ep)
+		current = nil
+	}
+
+	for i, e := range equity {
+		if e >= peak {
+			if current != nil {
+				closeEpisode(i)
+			}
+			peak = e
+			peakIndex = i
+			continue
+		}
+
+		depth := peak - e
+		depthPct := 0.0
+		if peak > 0 {
+			depthPct = depth / peak
+		}
+		underwater[i] = -depthPct
+
+		if current == nil {
+			current = &DrawdownEpisode{
+				PeakDate:    dateAt(peakIndex),
+				PeakEquity:  peak,
+				peakIndex:   peakIndex,
+				troughIndex: i,
+			}
+		}
+		if depth > current.Depth {
+			current.Depth = depth
+			current.DepthPct = depthPct
+			current.TroughEquity = e
+			current.troughIndex = i
+		}
+	}
+	if current != nil {
+		closeEpisode(-1)
+	}
+
+	return episodes, underwater
+}
+
+// topDrawdownEpisodes returns the n deepest episodes (by currency depth), deepest first
+func topDrawdownEpisodes(episodes []DrawdownEpisode, n int) []DrawdownEpisode {
+	sorted := make([]DrawdownEpisode, len(episodes))
+	copy(sorted, episodes)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Depth > sorted[j].Depth })
+	if n > 0 && len(sorted) > n {
+		sorted = sorted[:n]
+	}
+	return sorted
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestAnalyzeDrawdowns(t *testing.T) {
+	dates := []string{"2020-01-01", "2020-01-02", "2020-01-03", "2020-01-04", "2020-01-05", "2020-01-06", "2020-01-07"}
+	tests := []struct {
+		name       string
+		equity     []float64
+		want       []DrawdownEpisode
+		underwater []float64
+	}{
+		{
+			name:   "recovered then unrecovered",
+			equity: []float64{10000, 11000, 10500, 10000, 11200, 10800, 10900},
+			want: []DrawdownEpisode{
+				{PeakDate: "2020-01-02", TroughDate: "2020-01-04", RecoveryDate: "2020-01-05", Recovered: true,
+					PeakEquity: 11000, TroughEquity: 10000, Depth: 1000, DepthPct: 1000.0 / 11000,
+					LengthDays: 3, DeclineDays: 2, RecoveryDays: 1},
+				{PeakDate: "2020-01-05", TroughDate: "2020-01-06", RecoveryDate: "unrecovered",
+					PeakEquity: 11200, TroughEquity: 10800, Depth: 400, DepthPct: 400.0 / 11200,
+					LengthDays: 2, DeclineDays: 1},
+			},
+			underwater: []float64{0, 0, -500.0 / 11000, -1000.0 / 11000, 0, -400.0 / 11200, -300.0 / 11200},
+		},
+		{
+			name:   "drawdown from the initial capital",
+			equity: []float64{9500, 9000, 10100},
+			want: []DrawdownEpisode{
+				{PeakDate: "2020-01-01", TroughDate: "2020-01-02", RecoveryDate: "2020-01-03", Recovered: true,
+					PeakEquity: 10000, TroughEquity: 9000, Depth: 1000, DepthPct: 0.1,
+					LengthDays: 2, DeclineDays: 1, RecoveryDays: 1},
+			},
+			underwater: []float64{-0.05, -0.1, 0},
+		},
+		{
+			name:       "no drawdown",
+			equity:     []float64{10000, 10100, 10100, 10300},
+			underwater: []float64{0, 0, 0, 0},
+		},
+	}
+
+	for _, tt := range tests {
+		episodes, underwater := analyzeDrawdowns(dates[:len(tt.equity)], tt.equity, 10000)
+		if len(episodes) != len(tt.want) {
+			t.Fatalf("%s: expected %d episodes, got %+v", tt.name, len(tt.want), episodes)
+		}
+		for i, got := range episodes {
+			want := tt.want[i]
+			got.peakIndex, got.troughIndex = 0, 0
+			if math.Abs(got.DepthPct-want.DepthPct) > 1e-12 {
+				t.Fatalf("%s: episode %d depth pct %v, want %v", tt.name, i, got.DepthPct, want.DepthPct)
+			}
+			got.DepthPct = want.DepthPct
+			if got != want {
+				t.Fatalf("%s: episode %d\n got %+v\nwant %+v", tt.name, i, got, want)
+			}
+		}
+		for i := range underwater {
+			if math.Abs(underwater[i]-tt.underwater[i]) > 1e-12 {
+				t.Fatalf("%s: underwater %v, want %v", tt.name, underwater, tt.underwater)
+			}
+		}
+	}
+}
+
+func TestTopDrawdownEpisodes(t *testing.T) {
+	episodes := []DrawdownEpisode{
+		{PeakDate: "a", Depth: 300},
+		{PeakDate: "b", Depth: 1000},
+		{PeakDate: "c", Depth: 1000},
+		{PeakDate: "d", Depth: 500},
+	}
+	tests := []struct {
+		n    int
+		want string
+	}{
+		{2, "bc"},   // Deepest first, ties in chronological order
+		{0, "bcda"}, // No limit
+		{10, "bcda"},
+	}
+	for _, tt := range tests {
+		got := ""
+		for _, ep := range topDrawdownEpisodes(episodes, tt.n) {
+			got += ep.PeakDate
+		}
+		if got != tt.want {
+			t.Fatalf("top %d: expected %s, got %s", tt.n, tt.want, got)
+		}
+	}
+	if episodes[0].PeakDate != "a" {
+		t.Fatalf("topDrawdownEpisodes reordered its input")
+	}
+}
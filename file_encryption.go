@@ -0,0 +1,360 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/zalando/go-keyring"
+)
+
+// Encrypted files start with encryptedFileMagic and a version byte, followed by the AES-GCM nonce
+// and the sealed content. The header is the additional data, so it cannot be altered either.
+var encryptedFileMagic = []byte("AWENC")
+
+const encryptedFileVersion = 1
+
+// encryptedHeaderSize is the magic plus the version byte
+var encryptedHeaderSize = len(encryptedFileMagic) + 1
+
+// errNoFileKey is returned when an encrypted file is read without a key
+var errNoFileKey = errors.New("no file encryption key configured (set encryption.key or run: encrypt -init-key)")
+
+// fileKeyAccount is the keyring account of the file encryption key
+func fileKeyAccount(cfg *Config) string {
+	return cfg.Supabase.ProjectID + "/file-key"
+}
+
+// FileEncryption seals job files, downloaded XML and archived OPT results when enabled. Reading
+// encrypted files works whenever a key is available, so turning encryption off keeps old files readable.
+type FileEncryption struct {
+	mu     sync.Mutex
+	cfg    *Config // nil until configured; DefaultConfig is used then
+	aead   cipher.AEAD
+	keyErr error
+	loaded bool
+}
+
+// fileEncryption is used by the compression helpers; configureFileEncryption sets it up
+var fileEncryption = &FileEncryption{}
+
+// configureFileEncryption applies the encryption settings. The key is loaded on first use.
+func configureFileEncryption(cfg *Config) {
+	fileEncryption.mu.Lock()
+	defer fileEncryption.mu.Unlock()
+	fileEncryption.cfg = cfg
+	fileEncryption.aead, fileEncryption.keyErr, fileEncryption.loaded = nil, nil, false
+}
+
+// Enabled reports whether new files are written encrypted
+func (fe *FileEncryption) Enabled() bool {
+	fe.mu.Lock()
+	defer fe.mu.Unlock()
+	return fe.configLocked().Encryption.Enabled
+}
+
+// configLocked returns the applied config, or the defaults for commands that never configured one
+func (fe *FileEncryption) configLocked() *Config {
+	if fe.cfg == nil {
+		fe.cfg = DefaultConfig()
+	}
+	return fe.cfg
+}
+
+// cipher loads the key once
+func (fe *FileEncryption) cipher() (cipher.AEAD, error) {
+	fe.mu.Lock()
+	defer fe.mu.Unlock()
+	if !fe.loaded {
+		key, err := loadFileEncryptionKey(fe.configLocked())
+		if err == nil {
+			fe.aead, err = newFileAEAD(key)
+		}
+		fe.keyErr, fe.loaded = err, true
+	}
+	return fe.aead, fe.keyErr
+}
+
+// Seal encrypts data into the versioned file format
+func (fe *FileEncryption) Seal(data []byte) ([]byte, error) {
+	aead, err := fe.cipher()
+	if err != nil {
+		return nil, err
+	}
+	return sealFileData(aead, data)
+}
+
+// Open decrypts a file in the versioned format
+func (fe *FileEncryption) Open(data []byte) ([]byte, error) {
+	aead, err := fe.cipher()
+	if err != nil {
+		return nil, err
+	}
+	return openFileData(aead, data)
+}
+
+func newFileAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("create file cipher: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+func sealFileData(aead cipher.AEAD, data []byte) ([]byte, error) {
+	header := append(append([]byte{}, encryptedFileMagic...), encryptedFileVersion)
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, fmt.Errorf("generate nonce: %w", err)
+	}
+	out := append(append(header, nonce...), make([]byte, 0, len(data)+aead.Overhead())...)
+	return aead.Seal(out, nonce, data, header), nil
+}
+
+func openFileData(aead cipher.AEAD, data []byte) ([]byte, error) {
+	if !isEncryptedData(data) {
+		return nil, fmt.Errorf("not an encrypted file")
+	}
+	if version := data[len(encryptedFileMagic)]; version != encryptedFileVersion {
+		return nil, fmt.Errorf("unsupported encrypted file version %d", version)
+	}
+	if len(data) < encryptedHeaderSize+aead.NonceSize()+aead.Overhead() {
+		return nil, fmt.Errorf("encrypted file is truncated")
+	}
+	header := data[:encryptedHeaderSize]
+	nonce := data[encryptedHeaderSize : encryptedHeaderSize+aead.NonceSize()]
+	plain, err := aead.Open(nil, nonce, data[encryptedHeaderSize+aead.NonceSize():], header)
+	if err != nil {
+		return nil, fmt.Errorf("decrypt file (wrong key or modified file): %w", err)
+	}
+	return plain, nil
+}
+
+// isEncryptedData reports whether data starts with the encrypted file header
+func isEncryptedData(data []byte) bool {
+	return len(data) >= encryptedHeaderSize && bytes.HasPrefix(data, encryptedFileMagic)
+}
+
+// loadFileEncryptionKey returns the key from the config or, failing that, from the OS keyring
+func loadFileEncryptionKey(cfg *Config) ([]byte, error) {
+	encoded := cfg.Encryption.Key
+	if encoded == "" && cfg.Auth.UseKeyring {
+		stored, err := keyring.Get(keyringService, fileKeyAccount(cfg))
+		if err != nil && !errors.Is(err, keyring.ErrNotFound) {
+			return nil, fmt.Errorf("read file key from keyring: %w", err)
+		}
+		encoded = stored
+	}
+	if encoded == "" {
+		return nil, errNoFileKey
+	}
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(key) != 32 {
+		return nil, fmt.Errorf("file encryption key must be 32 bytes, base64 encoded")
+	}
+	return key, nil
+}
+
+// initFileEncryptionKey generates a key and stores it in the OS keyring. An existing key is kept,
+// since replacing it would make every encrypted file unreadable.
+func initFileEncryptionKey(cfg *Config) (created bool, err error) {
+	if _, err := loadFileEncryptionKey(cfg); err == nil {
+		return false, nil
+	} else if !errors.Is(err, errNoFileKey) {
+		return false, err
+	}
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return false, fmt.Errorf("generate file key: %w", err)
+	}
+	if err := keyring.Set(keyringService, fileKeyAccount(cfg), base64.StdEncoding.EncodeToString(key)); err != nil {
+		return false, fmt.Errorf("store file key in keyring: %w", err)
+	}
+	return true, nil
+}
+
+// writeAtRestFile writes data, encrypted when file encryption is enabled
+func writeAtRestFile(path string, data []byte) error {
+	if fileEncryption.Enabled() {
+		sealed, err := fileEncryption.Seal(data)
+		if err != nil {
+			return err
+		}
+		data = sealed
+	}
+	return writeFileAtomic(path, data, 0644)
+}
+
+// readAtRestFile reads a file written by writeAtRestFile, decrypting it if needed
+func readAtRestFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil || !isEncryptedData(data) {
+		return data, err
+	}
+	return fileEncryption.Open(data)
+}
+
+// openAtRestFile opens a file for reading. Encrypted files are checked and decrypted in memory,
+// since GCM only authenticates the content once all of it has been read.
+func openAtRestFile(path string) (io.ReadCloser, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	buffered := bufio.NewReader(file)
+	if header, _ := buffered.Peek(encryptedHeaderSize); !isEncryptedData(header) {
+		return struct {
+			io.Reader
+			io.Closer
+		}{buffered, file}, nil
+	}
+
+	data, err := io.ReadAll(buffered)
+	file.Close()
+	if err != nil {
+		return nil, fmt.Errorf("read encrypted file: %w", err)
+	}
+	plain, err := fileEncryption.Open(data)
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(plain)), nil
+}
+
+// encryptFileInPlace encrypts a plain file (false if it already was encrypted) or, with decrypt,
+// turns an encrypted file back into plain form. The file is replaced atomically.
+func encryptFileInPlace(path string, decrypt bool) (bool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false, err
+	}
+	if isEncryptedData(data) != decrypt {
+		return false, nil
+	}
+	if decrypt {
+		data, err = fileEncryption.Open(data)
+	} else {
+		data, err = fileEncryption.Seal(data)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if err := writeFileAtomic(path, data, 0644); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// isAtRestFile reports whether a file is one of the kinds covered by at-rest encryption
+func isAtRestFile(name string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	return ext == ".job" || ext == ".opt" || strings.HasSuffix(strings.ToLower(name), "_temp.xml")
+}
+
+// migrateAtRestFiles encrypts (or with decrypt, decrypts) the job, OPT and temp XML files in dirs.
+// Files already in the wanted form are skipped, so the migration can be run again after a failure.
+func migrateAtRestFiles(dirs []string, decrypt, dryRun bool, logf func(format string, args ...interface{})) (changed int, err error) {
+	for _, dir := range dirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return changed, fmt.Errorf("read %s: %w", dir, err)
+		}
+		for _, entry := range entries {
+			if !entry.Type().IsRegular() || !isAtRestFile(entry.Name()) {
+				continue
+			}
+			path := filepath.Join(dir, entry.Name())
+			if dryRun {
+				data, err := os.ReadFile(path)
+				if err != nil {
+					return changed, err
+				}
+				if isEncryptedData(data) == decrypt {
+					logf("would convert %s", path)
+					changed++
+				}
+				continue
+			}
+			converted, err := encryptFileInPlace(path, decrypt)
+			if err != nil {
+				return changed, fmt.Errorf("%s: %w", path, err)
+			}
+			if converted {
+				logf("converted %s", path)
+				changed++
+			}
+		}
+	}
+	return changed, nil
+}
+
+// runEncryptCommand encrypts existing job and result folders, or decrypts them again
+func runEncryptCommand(args []string) int {
+	fs := flag.NewFlagSet("encrypt", flag.ContinueOnError)
+	decrypt := fs.Bool("decrypt", false, "decrypt encrypted files back to plain form")
+	initKey := fs.Bool("init-key", false, "generate a file key in the OS keyring if none is configured")
+	dryRun := fs.Bool("dry-run", false, "list the files that would be converted")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	cfg := DefaultConfig()
+	configureFileEncryption(cfg)
+
+	if *initKey {
+		if cfg.Encryption.Key == "" && !cfg.Auth.UseKeyring {
+			fmt.Fprintln(os.Stderr, "the OS keyring is disabled, set encryption.key instead")
+			return 1
+		}
+		created, err := initFileEncryptionKey(cfg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			return 1
+		}
+		if created {
+			fmt.Println("Generated a file encryption key in the OS keyring; back it up, encrypted files cannot be read without it")
+			configureFileEncryption(cfg)
+		} else {
+			fmt.Println("A file encryption key is already configured")
+		}
+	}
+	if _, err := fileEncryption.cipher(); err != nil && !*dryRun {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+
+	dirs := fs.Args()
+	if len(dirs) == 0 {
+		jobs := cfg.Folders.Files.Jobs
+		dirs = []string{jobs.ToDo, jobs.InProgress, jobs.Done, jobs.Error, cfg.Folders.Files.Opt.Done}
+	}
+	logf := func(format string, args ...interface{}) { fmt.Printf(format+"\n", args...) }
+	changed, err := migrateAtRestFiles(dirs, *decrypt, *dryRun, logf)
+	if *dryRun {
+		fmt.Printf("%d file(s) to convert\n", changed)
+	} else {
+		fmt.Printf("%d file(s) converted\n", changed)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	if !*decrypt && !cfg.Encryption.Enabled {
+		fmt.Println("Note: encryption.enabled is off, new files will still be written in plain form")
+	}
+	return 0
+}
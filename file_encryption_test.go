@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// useTestFileKey configures file encryption with a fixed key for the duration of the test
+func useTestFileKey(t *testing.T, enabled bool) {
+	cfg := DefaultConfig()
+	cfg.Auth.UseKeyring = false
+	cfg.Encryption.Enabled = enabled
+	cfg.Encryption.Key = base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{7}, 32))
+	configureFileEncryption(cfg)
+	t.Cleanup(func() {
+		fileEncryption.mu.Lock()
+		fileEncryption.cfg, fileEncryption.aead, fileEncryption.keyErr, fileEncryption.loaded = nil, nil, nil, false
+		fileEncryption.mu.Unlock()
+	})
+}
+
+func TestEncryptedJobFileRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	xml := "<Jobs><Job><parameters><Len><value>14</value></Len></parameters></Job></Jobs>"
+	xmlPath := filepath.Join(dir, "job1_@ES_60_OPT.xml")
+	if err := os.WriteFile(xmlPath, []byte(xml), 0644); err != nil {
+		t.Fatalf("write XML: %v", err)
+	}
+
+	// A plain zlib job written before encryption was enabled stays readable
+	useTestFileKey(t, false)
+	plainPath, err := CompressXMLFile(xmlPath, false)
+	if err != nil {
+		t.Fatalf("compress plain job: %v", err)
+	}
+	os.Rename(plainPath, filepath.Join(dir, "plain.job"))
+
+	useTestFileKey(t, true)
+	jobPath, err := CompressXMLFile(xmlPath, false)
+	if err != nil {
+		t.Fatalf("compress encrypted job: %v", err)
+	}
+	data, _ := os.ReadFile(jobPath)
+	if !isEncryptedData(data) || bytes.Contains(data, []byte("parameters")) {
+		t.Fatalf("Expected an encrypted job file, got header %q", data[:8])
+	}
+
+	for _, path := range []string{jobPath, filepath.Join(dir, "plain.job")} {
+		got, err := decompressJobFile(path)
+		if err != nil || got != xml {
+			t.Fatalf("decompressJobFile(%s) = %q (err %v), want the original XML", filepath.Base(path), got, err)
+		}
+	}
+	outPath, err := DecompressJobFile(jobPath)
+	if err != nil {
+		t.Fatalf("DecompressJobFile failed: %v", err)
+	}
+	if got, _ := os.ReadFile(outPath); string(got) != xml {
+		t.Fatalf("Expected the original XML, got %q", got)
+	}
+}
+
+func TestEncryptedFileTampering(t *testing.T) {
+	useTestFileKey(t, true)
+	sealed, err := fileEncryption.Seal([]byte("result data"))
+	if err != nil {
+		t.Fatalf("Seal failed: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		modify func([]byte) []byte
+		want   string
+	}{
+		{"flipped content bit", func(b []byte) []byte { b[len(b)-1] ^= 1; return b }, "wrong key or modified"},
+		{"changed version", func(b []byte) []byte { b[len(encryptedFileMagic)] = 9; return b }, "unsupported encrypted file version 9"},
+		{"truncated", func(b []byte) []byte { return b[:encryptedHeaderSize+4] }, "truncated"},
+	}
+	for _, tt := range tests {
+		data := tt.modify(append([]byte{}, sealed...))
+		if _, err := fileEncryption.Open(data); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Fatalf("%s: expected an error containing %q, got %v", tt.name, tt.want, err)
+		}
+	}
+
+	// Without a key encrypted files are refused instead of being misread as zlib
+	cfg := DefaultConfig()
+	cfg.Auth.UseKeyring = false
+	configureFileEncryption(cfg)
+	path := filepath.Join(t.TempDir(), "job.job")
+	os.WriteFile(path, sealed, 0644)
+	if _, err := readAtRestFile(path); !errors.Is(err, errNoFileKey) {
+		t.Fatalf("Expected errNoFileKey, got %v", err)
+	}
+}
+
+func TestOpenOPTFileEncrypted(t *testing.T) {
+	useTestFileKey(t, true)
+	content := "run,parameters_json\n1,{\"a\":1}\n"
+	path := filepath.Join(t.TempDir(), "job.opt")
+	if err := writeAtRestFile(path, zlibCompress(t, []byte(content))); err != nil {
+		t.Fatalf("write OPT file: %v", err)
+	}
+
+	reader, closer, err := openOPTFile(path, nil)
+	if err != nil {
+		t.Fatalf("openOPTFile failed: %v", err)
+	}
+	defer closer.Close()
+	row, err := reader.Next()
+	if err != nil || row.ParametersJSON != `{"a":1}` {
+		t.Fatalf("Unexpected row %+v (err %v)", row, err)
+	}
+	if _, err := reader.Next(); err != io.EOF {
+		t.Fatalf("Expected EOF, got %v", err)
+	}
+}
+
+func TestMigrateAtRestFiles(t *testing.T) {
+	useTestFileKey(t, false)
+	dir := t.TempDir()
+	files := map[string]string{
+		"job1_@ES_60_OPT.job": "job",
+		"job1.opt":            "opt",
+		"job1_temp.xml":       "<Job/>",
+		"notes.txt":           "left alone",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+	quiet := func(string, ...interface{}) {}
+
+	if n, err := migrateAtRestFiles([]string{dir}, false, true, quiet); err != nil || n != 3 {
+		t.Fatalf("Dry run: expected 3 files to convert, got %d (err %v)", n, err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "job1.opt")); isEncryptedData(data) {
+		t.Fatalf("Dry run must not change files")
+	}
+
+	if n, err := migrateAtRestFiles([]string{dir, filepath.Join(dir, "missing")}, false, false, quiet); err != nil || n != 3 {
+		t.Fatalf("Expected 3 files encrypted, got %d (err %v)", n, err)
+	}
+	if n, err := migrateAtRestFiles([]string{dir}, false, false, quiet); err != nil || n != 0 {
+		t.Fatalf("Expected a second run to change nothing, got %d (err %v)", n, err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "notes.txt")); string(data) != "left alone" {
+		t.Fatalf("Expected other files to be left alone, got %q", data)
+	}
+	if data, err := readAtRestFile(filepath.Join(dir, "job1_temp.xml")); err != nil || string(data) != "<Job/>" {
+		t.Fatalf("Expected the temp XML to decrypt, got %q (err %v)", data, err)
+	}
+
+	if n, err := migrateAtRestFiles([]string{dir}, true, false, quiet); err != nil || n != 3 {
+		t.Fatalf("Expected 3 files decrypted, got %d (err %v)", n, err)
+	}
+	for name, content := range files {
+		if data, _ := os.ReadFile(filepath.Join(dir, name)); string(data) != content {
+			t.Fatalf("%s: expected %q after decrypting, got %q", name, content, data)
+		}
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != len(files) {
+		t.Fatalf("Expected no leftover temp files, got %d entries", len(entries))
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Task types that can be generated as follow-ups of a plain optimization
+const (
+	FollowUpOOS    = "OOS"
+	FollowUpRetest = "RETEST"
+)
+
+// FollowUpConfig controls automatic follow-up jobs for regular OPTIMIZATION results: the top-N
+// parameter sets are re-run with fixed parameters on a holdout period
+type FollowUpConfig struct {
+	Enabled      bool   `json:"enabled"`
+	TaskType     string `json:"task_type"`     // OOS or RETEST
+	TopN         int    `json:"top_n"`         // parameter sets to follow up
+	Metric       string `json:"metric"`        // ranking metric, empty for fitness/all_net_profit
+	MinTrades    int    `json:"min_trades"`    // skip tests with fewer trades
+	HoldoutStart string `json:"holdout_start"` // YYYY-MM-DD
+	HoldoutEnd   string `json:"holdout_end"`   // YYYY-MM-DD, empty for today
+}
+
+// defaultFollowUpTopN is used when TopN is not set
+const defaultFollowUpTopN = 5
+
+// followUpParametersPattern matches the parameters section replaced with fixed values
+var followUpParametersPattern = regexp.MustCompile(`(?s)<parameters>(.*?)</parameters>`)
+
+// validate checks the configuration and returns the holdout period
+func (c FollowUpConfig) validate(now time.Time) (string, string, error) {
+	switch c.TaskType {
+	case FollowUpOOS, FollowUpRetest:
+	default:
+		return "", "", fmt.Errorf("follow-up task type must be %s or %s, got %q", FollowUpOOS, FollowUpRetest, c.TaskType)
+	}
+	if err := validateDateFormat(c.HoldoutStart); err != nil {
+		return "", "", fmt.Errorf("holdout start: %w", err)
+	}
+	end := c.HoldoutEnd
+	if end == "" {
+		end = now.Format("2006-01-02")
+	}
+	if err := validateDateFormat(end); err != nil {
+		return "", "", fmt.Errorf("holdout end: %w", err)
+	}
+	if end <= c.HoldoutStart {
+		return "", "", fmt.Errorf("holdout end %s is not after start %s", end, c.HoldoutStart)
+	}
+	return c.HoldoutStart, end, nil
+}
+
+// buildFollowUpJobXML creates one job element per test from the original optimization job:
+// fixed parameters, the follow-up task type and the holdout dates. Elements share the container
+// filename and carry their rank in <run>.
+func buildFollowUpJobXML(originalXML string, tests []OptimizationTest, cfg FollowUpConfig, metric, holdoutStart, holdoutEnd, fileName string) (string, error) {
+	match := jobElementPattern.FindStringSubmatch(originalXML)
+	if match == nil {
+		return "", fmt.Errorf("no <Job> element in original job XML")
+	}
+	template := fmt.Sprintf("<Job>%s</Job>", match[1])
+
+	elements := make([]string, 0, len(tests))
+	for i, test := range tests {
+		rank := i + 1
+		jobXML, err := fixedJobElement(template, cfg.TaskType, fileName, holdoutStart, holdoutEnd, rank, test.Parameters)
+		if err != nil {
+			return "", fmt.Errorf("rank %d: %w", rank, err)
+		}
+		rationale := fmt.Sprintf("rank %d of the optimization by %s (%.4g)", rank, metric, test.Metrics[metric])
+		jobXML = addXMLTag(jobXML, "parameter_selection", "top_n")
+		jobXML = addXMLTag(jobXML, "parameter_selection_rationale", escapeXMLText(rationale))
+		elements = append(elements, jobXML)
+	}
+	return fmt.Sprintf("<root>\n%s\n</root>", strings.Join(elements, "\n")), nil
+}
+
+// fixedJobElement derives one job element from a template: task type, container filename, run
+// number, optionally new start/end dates, and the OptRange parameters fixed to values
+func fixedJobElement(template, taskType, fileName, startDate, endDate string, run int, values map[string]interface{}) (string, error) {
+	jobXML := setXMLTag(template, "task_type", taskType)
+	if startDate != "" {
+		jobXML = setXMLTag(jobXML, "startDate", startDate)
+	}
+	if endDate != "" {
+		jobXML = setXMLTag(jobXML, "endDate", endDate)
+	}
+	jobXML = setXMLTag(jobXML, "filename", fileName)
+	jobXML = setXMLTag(jobXML, "run", strconv.Itoa(run))
+
+	section := followUpParametersPattern.FindStringSubmatch(jobXML)
+	if section == nil {
+		return "", fmt.Errorf("parameters section not found in XML")
+	}
+	fixed, err := transformParametersToFixed(section[1], values)
+	if err != nil {
+		return "", fmt.Errorf("fix parameters: %w", err)
+	}
+	return strings.Replace(jobXML, section[0], "<parameters>"+fixed+"</parameters>", 1), nil
+}
+
+// generateFollowUpJobs writes OOS/RETEST jobs for the top-N tests of an optimization OPT file to
+// Jobs.ToDo and submits them like WFO_RETEST jobs. An existing follow-up file is left untouched.
+func (oum *OptUploadManager) generateFollowUpJobs(fileName, jobID string) error {
+	cfg := oum.config.Analysis.FollowUp
+	holdoutStart, holdoutEnd, err := cfg.validate(time.Now())
+	if err != nil {
+		return fmt.Errorf("follow-up config: %w", err)
+	}
+	_, symbol, timeframe, err := oum.extractMetadata(fileName)
+	if err != nil {
+		return err
+	}
+
+	baseName := fmt.Sprintf("%s_%s_%s_%s_TOP-%d", jobID, symbol, timeframe, cfg.TaskType, followUpTopN(cfg))
+	targetDir := oum.config.Folders.Files.Jobs.ToDo
+	if _, err := os.Stat(filepath.Join(targetDir, baseName+".job")); err == nil {
+		oum.logf(fmt.Sprintf("Follow-up jobs for %s already generated, skipping", jobID))
+		return nil
+	}
+
+	optPath := filepath.Join(oum.config.Folders.Files.Opt.In, fileName)
+	if _, err := os.Stat(optPath); err != nil {
+		optPath = filepath.Join(oum.config.Folders.Files.Opt.Done, fileName)
+	}
+	results, err := loadOptimizationResults(optPath)
+	if err == nil {
+		results, err = results.FilterMinTrades(cfg.MinTrades)
+	}
+	if err != nil {
+		return fmt.Errorf("load optimization results: %w", err)
+	}
+	metric, err := results.resolveMetric(cfg.Metric, optFitnessColumns)
+	if err != nil {
+		return err
+	}
+	tests, err := results.TopN(followUpTopN(cfg), metric)
+	if err != nil {
+		return err
+	}
+	if len(tests) == 0 {
+		return fmt.Errorf("no tests left after filtering (min trades %d)", cfg.MinTrades)
+	}
+
+	originalXML, err := locateWFOJobFile(jobID, symbol, timeframe, oum.extractTaskTypeFromFilename(fileName))
+	if err != nil {
+		return fmt.Errorf("locate optimization job file: %w", err)
+	}
+	xmlContent, err := buildFollowUpJobXML(originalXML, tests, cfg, metric, holdoutStart, holdoutEnd, baseName+".job")
+	if err != nil {
+		return fmt.Errorf("build follow-up XML: %w", err)
+	}
+
+	jobPath, err := saveDerivedJobXML(targetDir, baseName, xmlContent)
+	if err != nil {
+		return fmt.Errorf("save follow-up job: %w", err)
+	}
+	if err := oum.api.submitDerivedJob(jobPath, jobID, cfg.TaskType); err != nil {
+		return fmt.Errorf("submit follow-up job: %w", err)
+	}
+	oum.logf(fmt.Sprintf("Generated %d %s follow-up jobs for %s on %s to %s: %s",
+		len(tests), cfg.TaskType, jobID, holdoutStart, holdoutEnd, filepath.Base(jobPath)))
+	return nil
+}
+
+// followUpTopN returns the configured number of parameter sets or the default
+func followUpTopN(cfg FollowUpConfig) int {
+	if cfg.TopN > 0 {
+		return cfg.TopN
+	}
+	return defaultFollowUpTopN
+}
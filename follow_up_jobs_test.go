@@ -0,0 +1,82 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFollowUpConfigValidate(t *testing.T) {
+	now := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		cfg     FollowUpConfig
+		wantEnd string
+		wantErr bool
+	}{
+		{FollowUpConfig{TaskType: FollowUpOOS, HoldoutStart: "2023-01-01"}, "2024-03-01", false},
+		{FollowUpConfig{TaskType: FollowUpRetest, HoldoutStart: "2023-01-01", HoldoutEnd: "2023-06-30"}, "2023-06-30", false},
+		{FollowUpConfig{TaskType: "WFO", HoldoutStart: "2023-01-01"}, "", true},
+		{FollowUpConfig{TaskType: FollowUpOOS, HoldoutStart: "01/01/2023"}, "", true},
+		{FollowUpConfig{TaskType: FollowUpOOS, HoldoutStart: "2023-06-30", HoldoutEnd: "2023-01-01"}, "", true},
+	}
+	for _, tt := range tests {
+		_, end, err := tt.cfg.validate(now)
+		if (err != nil) != tt.wantErr || end != tt.wantEnd {
+			t.Fatalf("validate(%+v) = %q, %v; want %q, error %v", tt.cfg, end, err, tt.wantEnd, tt.wantErr)
+		}
+	}
+}
+
+func TestBuildFollowUpJobXML(t *testing.T) {
+	originalXML := `<root><Job>
+  <Id>opt-job</Id>
+  <task_type>OPT</task_type>
+  <filename>opt-job_@ES_60_OPT.job</filename>
+  <startDate>2015-01-01</startDate>
+  <endDate>2022-12-31</endDate>
+  <parameters>
+  <iFast>
+    <start>5</start>
+    <end>20</end>
+    <step>5</step>
+    <value>10</value>
+    <param_type>OptRange</param_type>
+    <optimizable_ind>true</optimizable_ind>
+  </iFast>
+  </parameters>
+</Job></root>`
+	tests := []OptimizationTest{
+		{Parameters: map[string]interface{}{"iFast": 15.0}, Metrics: map[string]float64{"fitness": 2.5}},
+		{Parameters: map[string]interface{}{"iFast": 5.0}, Metrics: map[string]float64{"fitness": 1.5}},
+	}
+	cfg := FollowUpConfig{TaskType: FollowUpRetest}
+
+	xmlContent, err := buildFollowUpJobXML(originalXML, tests, cfg, "fitness", "2023-01-01", "2023-12-31", "opt-job_@ES_60_RETEST_TOP-2.job")
+	if err != nil {
+		t.Fatalf("buildFollowUpJobXML failed: %v", err)
+	}
+
+	jobs := jobElementPattern.FindAllString(xmlContent, -1)
+	if len(jobs) != 2 {
+		t.Fatalf("Expected 2 job elements, got %d:\n%s", len(jobs), xmlContent)
+	}
+	for i, want := range []string{"15", "5"} {
+		job := jobs[i]
+		for _, tag := range []struct{ name, value string }{
+			{"task_type", "RETEST"},
+			{"startDate", "2023-01-01"},
+			{"endDate", "2023-12-31"},
+			{"filename", "opt-job_@ES_60_RETEST_TOP-2.job"},
+			{"param_type", "Fixed"},
+			{"value", want},
+			{"parameter_selection", "top_n"},
+		} {
+			if got, err := extractXMLTagValue(job, tag.name); err != nil || got != tag.value {
+				t.Fatalf("Job %d: expected <%s> %q, got %q (%v)\n%s", i+1, tag.name, tag.value, got, err, job)
+			}
+		}
+		if !strings.Contains(job, "<run>"+string(rune('1'+i))+"</run>") {
+			t.Fatalf("Job %d: expected its rank in <run>:\n%s", i+1, job)
+		}
+	}
+}
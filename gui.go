@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -49,11 +50,15 @@ type GUI struct {
 	optUploader *OptUploadManager
 	dailySummaryUploader *DailySummaryUploadManager
 	wfoCompletionHandler *WFOCompletionHandler
+	portfolioAggregator  *PortfolioAggregator
+	mtfConsolidator      *MTFConsolidator
+	stressAggregator     *StressTestAggregator
 
 	emailEntry    *widget.Entry
 	passwordEntry *widget.Entry
 	loginButton   *widget.Button
 	logoutButton  *widget.Button
+	forgetButton  *widget.Button
 	statusLabel   *widget.Label
 	logText       *widget.TextGrid
 	logBuffer     string
@@ -68,12 +73,16 @@ type GUI struct {
 	isPolling      bool
 	stopCh         chan bool
 	wfoStarted     bool
+	instanceLock   *InstanceLock // Held while monitoring, keeps a second client off the same Files root
 }
 
 func NewGUI() *GUI {
 	g := &GUI{app: app.New()}
 	cfg, _ := LoadConfig("") // No config file needed
 	g.config = cfg
+	configureLogPrivacy(cfg)
+	configureFileEncryption(cfg)
+	configureJobContainers(cfg)
 	g.auth = NewAuthManager(cfg)
 	g.api = NewAPIClient(cfg, g.auth)
 	g.downloader = NewDownloadManager(cfg, g.api)
@@ -83,6 +92,9 @@ func NewGUI() *GUI {
 	g.optUploader = NewOptUploadManager(cfg, g.api)
 	g.dailySummaryUploader = NewDailySummaryUploadManager(g.api, g.fileMgr, cfg)
 	g.wfoCompletionHandler = NewWFOCompletionHandler(cfg, g.api)
+	g.portfolioAggregator = NewPortfolioAggregator(cfg, g.api)
+	g.mtfConsolidator = NewMTFConsolidator(cfg, g.api)
+	g.stressAggregator = NewStressTestAggregator(cfg, g.api)
 	// Bridge downloader logs into GUI log
 	g.downloader.SetLogger(func(msg string) { g.log(msg) })
 	// Bridge opt uploader logs into GUI log
@@ -95,6 +107,16 @@ func NewGUI() *GUI {
 	g.polling.SetLogger(func(msg string) { g.log(msg) })
 	// Bridge WFO completion handler logs into GUI log
 	g.wfoCompletionHandler.SetLogger(func(msg string) { g.log(msg) })
+	// Bridge MM portfolio aggregator logs into GUI log
+	g.portfolioAggregator.SetLogger(func(msg string) { g.log(msg) })
+	// Bridge MTF consolidator logs into GUI log
+	g.mtfConsolidator.SetLogger(func(msg string) { g.log(msg) })
+	// Bridge stress test aggregator logs into GUI log
+	g.stressAggregator.SetLogger(func(msg string) { g.log(msg) })
+	// Stop monitoring and ask for the password when the server rejects the session
+	g.auth.Subscribe(g.onAuthEvent)
+	// Refresh tokens ahead of expiry instead of on the next request
+	g.auth.StartBackgroundRefresh()
 
 	// Start upload event monitoring for burst polling
 	go g.monitorUploadEvents()
@@ -108,7 +130,10 @@ func NewGUI() *GUI {
 	g.buildUI()
 
 	// Note: WFO completion monitoring will start after successful login
-	// See onLogin() method for WFO monitoring initialization
+	// See onAuthenticated() method for WFO monitoring initialization
+
+	// Sign in with the session saved by a previous run, if any
+	go g.resumeSession()
 
 	return g
 }
@@ -141,6 +166,8 @@ func (g *GUI) authSection() fyne.CanvasObject {
 	g.loginButton = widget.NewButton("Sign In", g.onLogin)
 	g.logoutButton = widget.NewButton("Sign Out", g.onLogout)
 	g.logoutButton.Disable()
+	g.forgetButton = widget.NewButton("Forget This Device", g.onForgetDevice)
+	g.forgetButton.Disable()
 	g.statusLabel = widget.NewLabel("Not authenticated")
 
 	// Add Enter key support for login
@@ -160,7 +187,7 @@ func (g *GUI) authSection() fyne.CanvasObject {
 		widget.NewLabel("Password:"), g.passwordEntry,
 	)
 
-	buttonRow := container.NewHBox(g.loginButton, g.logoutButton)
+	buttonRow := container.NewHBox(g.loginButton, g.logoutButton, g.forgetButton)
 
 	return container.NewVBox(
 		title,
@@ -252,29 +279,107 @@ func (g *GUI) onLogin() {
 			g.enableButton(g.loginButton)
 			return
 		}
-		g.setLabel(g.statusLabel, "✅ Authenticated - Ready to monitor")
-		g.disableButton(g.loginButton)
-		g.enableButton(g.logoutButton)
-		g.enableButton(g.daemonButton)
-		g.log("Authentication successful - monitoring features enabled")
-
-		// Start WFO completion monitoring now that user is authenticated (only once)
-		if !g.wfoStarted {
-			g.wfoStarted = true
-			go g.wfoCompletionHandler.StartWFOCompletionMonitoring()
-		}
+		g.onAuthenticated("✅ Authenticated - Ready to monitor")
 	}()
 }
 
+// onAuthenticated enables the monitoring features after a sign-in or a resumed session
+func (g *GUI) onAuthenticated(status string) {
+	g.setLabel(g.statusLabel, status)
+	g.disableButton(g.loginButton)
+	g.enableButton(g.logoutButton)
+	g.enableButton(g.forgetButton)
+	g.enableButton(g.daemonButton)
+	g.log("Authentication successful - monitoring features enabled")
+
+	// Start WFO completion monitoring now that user is authenticated (only once)
+	if !g.wfoStarted {
+		g.wfoStarted = true
+		go g.wfoCompletionHandler.StartWFOCompletionMonitoring()
+	}
+}
+
+// resumeSession signs in with the stored session at startup. Network errors are retried so an
+// unattended box that boots before its network is up still resumes.
+func (g *GUI) resumeSession() {
+	delay := 10 * time.Second
+	for attempt := 1; ; attempt++ {
+		err := g.auth.ResumeSession()
+		if errors.Is(err, errNoStoredSession) {
+			// A machine registered for unattended use signs in with its own credential
+			err = g.auth.ResumeMachine()
+		}
+		if err == nil {
+			err = g.api.TestConnection()
+		}
+		if err == nil {
+			if email := g.auth.Email(); email != "" {
+				g.onMain(func() { g.emailEntry.SetText(email) })
+			}
+			if id, name := g.auth.MachineIdentity(); id != "" {
+				g.log(fmt.Sprintf("Signed in as registered machine %s (%s)", name, id))
+			} else {
+				g.log(fmt.Sprintf("Resumed saved session for %s", g.auth.Email()))
+			}
+			g.onAuthenticated("✅ Session resumed - Ready to monitor")
+			return
+		}
+		if errors.Is(err, errNoStoredSession) || errors.Is(err, errSessionRejected) || attempt == 5 {
+			if !errors.Is(err, errNoStoredSession) {
+				g.log(fmt.Sprintf("Could not resume saved session: %v", err))
+			}
+			return
+		}
+		g.log(fmt.Sprintf("Could not resume saved session (attempt %d), retrying in %v: %v", attempt, delay, err))
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
 func (g *GUI) onLogout() {
 	g.auth.Logout()
+	g.onSignedOut()
+	g.log("Logged out")
+}
+
+// onForgetDevice revokes the session and removes every stored copy from this machine
+func (g *GUI) onForgetDevice() {
+	dialog.ShowConfirm("Forget This Device",
+		"Sign out and remove the saved session from this computer? The password will be needed on the next start.",
+		func(ok bool) {
+			if !ok {
+				return
+			}
+			if err := g.auth.ForgetDevice(); err != nil {
+				g.log(fmt.Sprintf("Forget device: %v", err))
+			}
+			g.onSignedOut()
+			g.log("Saved session removed - this device has been forgotten")
+		}, g.mainWindow)
+}
+
+// onAuthEvent reacts to session changes made outside the UI, such as a rejected background refresh
+func (g *GUI) onAuthEvent(ev AuthEvent) {
+	if ev.Type != AuthLost {
+		return
+	}
+	g.log(fmt.Sprintf("Session expired: %v", ev.Err))
+	g.onMain(func() {
+		g.onStopDaemon()
+		g.onSignedOut()
+		g.statusLabel.SetText("Session expired - sign in again")
+	})
+}
+
+// onSignedOut resets the UI to the signed-out state
+func (g *GUI) onSignedOut() {
 	g.statusLabel.SetText("Not authenticated")
 	g.loginButton.Enable()
 	g.logoutButton.Disable()
+	g.forgetButton.Disable()
 	g.daemonButton.Disable()
 	g.stopButton.Disable()
 	g.isPolling = false
-	g.log("Logged out")
 }
 
 func (g *GUI) onStartDaemon() {
@@ -286,10 +391,19 @@ func (g *GUI) onStartDaemon() {
 		g.log(fmt.Sprintf("Error: authentication failed - %v", err))
 		return
 	}
+	// Refuse to start next to another client polling and uploading from the same folders
+	lock, err := AcquireInstanceLock(g.config, "gui")
+	if err != nil {
+		g.log(fmt.Sprintf("Error: %v", err))
+		dialog.ShowError(err, g.mainWindow)
+		return
+	}
+	g.instanceLock = lock
 	// Use default limit from config (server-controlled)
 	limit := g.config.Poll.Limit
 	g.isPolling = true
 	g.stopCh = make(chan bool)
+	go g.watchInstanceLock(lock, g.stopCh)
 	g.disableButton(g.daemonButton)
 	g.enableButton(g.stopButton)
 	g.log("Starting job and CSV monitoring...")
@@ -298,6 +412,9 @@ func (g *GUI) onStartDaemon() {
 	go g.runDaemon(limit)
 	go g.startCSVMonitoring()
 	go g.startOptMonitoring()
+	go g.startPortfolioAggregation()
+	go g.startMTFConsolidation()
+	go g.startStressAggregation()
 	// Daily summary uploads for RETEST are now coupled to OPT upload; independent monitoring disabled
 }
 
@@ -316,10 +433,31 @@ func (g *GUI) onStopDaemon() {
 	g.optUploader.Stop()
 	// Stop daily summary upload monitoring
 	g.dailySummaryUploader.Stop()
-
+	// Stop MM portfolio aggregation
+	g.portfolioAggregator.Stop()
+	// Stop MTF consolidation
+	g.mtfConsolidator.Stop()
+	// Stop stress test aggregation
+	g.stressAggregator.Stop()
+
+	if g.instanceLock != nil {
+		g.instanceLock.Release()
+		g.instanceLock = nil
+	}
 	g.log("Monitoring stopped")
 }
 
+// watchInstanceLock stops monitoring when another client takes the instance lock over
+func (g *GUI) watchInstanceLock(lock *InstanceLock, stopCh chan bool) {
+	select {
+	case <-lock.Lost():
+		holder := lock.LostTo()
+		g.log(fmt.Sprintf("Instance lock taken over by %s (PID %d on %s), stopping monitoring", holder.Mode, holder.PID, holder.Host))
+		g.onStopDaemon()
+	case <-stopCh:
+	}
+}
+
 func (g *GUI) startCSVMonitoring() {
 	if err := g.csvUploader.Start(); err != nil {
 		g.log(fmt.Sprintf("Failed to start CSV monitoring: %v", err))
@@ -336,6 +474,30 @@ func (g *GUI) startOptMonitoring() {
 	g.log("OPT monitoring started")
 }
 
+func (g *GUI) startPortfolioAggregation() {
+	if err := g.portfolioAggregator.Start(); err != nil {
+		g.log(fmt.Sprintf("Failed to start portfolio aggregation: %v", err))
+		return
+	}
+	g.log("Portfolio aggregation started")
+}
+
+func (g *GUI) startMTFConsolidation() {
+	if err := g.mtfConsolidator.Start(); err != nil {
+		g.log(fmt.Sprintf("Failed to start MTF consolidation: %v", err))
+		return
+	}
+	g.log("MTF consolidation started")
+}
+
+func (g *GUI) startStressAggregation() {
+	if err := g.stressAggregator.Start(); err != nil {
+		g.log(fmt.Sprintf("Failed to start stress test aggregation: %v", err))
+		return
+	}
+	g.log("Stress test aggregation started")
+}
+
 func (g *GUI) startDailySummaryMonitoring() {
 	if err := g.dailySummaryUploader.Start(); err != nil {
 		g.log(fmt.Sprintf("Failed to start daily summary monitoring: %v", err))
@@ -345,6 +507,8 @@ func (g *GUI) startDailySummaryMonitoring() {
 }
 
 func (g *GUI) runDaemon(limit int) {
+	// Finish or clean up what an interrupted run left behind before downloading new jobs
+	g.downloader.Reconcile()
 	iter := 0
 	remaining := 0
 	for g.isPolling {
@@ -511,6 +675,7 @@ func (g *GUI) updateFolderStats() {
 }
 
 func (g *GUI) log(msg string) {
+	msg = redact(msg)
 	ts := time.Now().Format("15:04:05")
 	line := fmt.Sprintf("[%s] %s\n", ts, msg)
 	cur := g.logBuffer
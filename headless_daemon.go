@@ -0,0 +1,305 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// headlessDaemon runs the same polling and upload monitoring as the GUI without a window,
+// signed in as a registered machine
+type headlessDaemon struct {
+	config   *Config
+	auth     *AuthManager
+	api      *APIClient
+	logger   *Logger
+	stopCh   chan struct{}
+	stopOnce sync.Once
+	lostErr  error
+	lock     *InstanceLock // Held while running, keeps a second client off the same Files root
+	managers []daemonManager
+
+	downloader           *DownloadManager
+	polling              *PollingOptimizer
+	wfoCompletionHandler *WFOCompletionHandler
+}
+
+// daemonManager is an upload or aggregation manager started with the daemon
+type daemonManager struct {
+	name  string
+	start func() error
+	stop  func()
+}
+
+func newHeadlessDaemon(cfg *Config, am *AuthManager) *headlessDaemon {
+	d := &headlessDaemon{config: cfg, auth: am, api: NewAPIClient(cfg, am), stopCh: make(chan struct{})}
+	exePath, _ := os.Executable()
+	d.logger = NewLogger(filepath.Join(filepath.Dir(exePath), "logs"))
+
+	d.downloader = NewDownloadManager(cfg, d.api)
+	d.polling = NewPollingOptimizer(cfg)
+	d.wfoCompletionHandler = NewWFOCompletionHandler(cfg, d.api)
+	csvUploader := NewCSVUploadManager(cfg, d.api)
+	optUploader := NewOptUploadManager(cfg, d.api)
+	portfolioAggregator := NewPortfolioAggregator(cfg, d.api)
+	mtfConsolidator := NewMTFConsolidator(cfg, d.api)
+	stressAggregator := NewStressTestAggregator(cfg, d.api)
+
+	d.downloader.SetLogger(d.log)
+	d.polling.SetLogger(d.log)
+	d.wfoCompletionHandler.SetLogger(d.log)
+	csvUploader.SetLogger(d.log)
+	optUploader.SetLogger(d.log)
+	portfolioAggregator.SetLogger(d.log)
+	mtfConsolidator.SetLogger(d.log)
+	stressAggregator.SetLogger(d.log)
+
+	d.managers = []daemonManager{
+		{"CSV monitoring", csvUploader.Start, csvUploader.Stop},
+		{"OPT monitoring", optUploader.Start, optUploader.Stop},
+		{"Portfolio aggregation", portfolioAggregator.Start, portfolioAggregator.Stop},
+		{"MTF consolidation", mtfConsolidator.Start, mtfConsolidator.Stop},
+		{"Stress test aggregation", stressAggregator.Start, stressAggregator.Stop},
+	}
+	return d
+}
+
+// log prints a redacted, timestamped line and appends it to the daily log file
+func (d *headlessDaemon) log(msg string) {
+	msg = redact(msg)
+	fmt.Printf("[%s] %s\n", time.Now().Format("15:04:05"), msg)
+	if d.logger != nil {
+		d.logger.Info(msg)
+	}
+}
+
+// run polls for jobs until stop is closed or the machine credential is revoked
+func (d *headlessDaemon) run(limit int, stop <-chan struct{}) error {
+	unsubscribe := d.auth.Subscribe(func(ev AuthEvent) {
+		if ev.Type == AuthLost {
+			d.lostErr = ev.Err
+			d.log(fmt.Sprintf("Machine credential rejected: %v", ev.Err))
+			d.stop()
+		}
+	})
+	defer unsubscribe()
+	d.auth.StartBackgroundRefresh()
+	defer d.auth.StopBackgroundRefresh()
+
+	go func() {
+		select {
+		case <-stop:
+			d.stop()
+		case <-d.stopCh:
+		}
+	}()
+	if d.lock != nil {
+		go func() {
+			select {
+			case <-d.lock.Lost():
+				holder := d.lock.LostTo()
+				d.log(fmt.Sprintf("Instance lock taken over by %s (PID %d on %s), stopping", holder.Mode, holder.PID, holder.Host))
+				d.stop()
+			case <-d.stopCh:
+			}
+		}()
+	}
+	go func() {
+		for event := range UploadEventChan {
+			go d.polling.HandleUploadEvent(event)
+		}
+	}()
+
+	// Finish or clean up what an interrupted run left behind before the monitors pick files up
+	d.downloader.Reconcile()
+	for _, m := range d.managers {
+		if err := m.start(); err != nil {
+			d.log(fmt.Sprintf("Failed to start %s: %v", m.name, err))
+			continue
+		}
+		defer m.stop()
+		d.log(m.name + " started")
+	}
+	go d.wfoCompletionHandler.StartWFOCompletionMonitoring()
+
+	d.pollLoop(limit)
+	d.log("Monitoring stopped")
+	if d.lostErr != nil {
+		return fmt.Errorf("machine credential no longer accepted, run register again: %w", d.lostErr)
+	}
+	if d.lock != nil {
+		select {
+		case <-d.lock.Lost():
+			return fmt.Errorf("stopped because another client took over %s", d.config.FilesRoot())
+		default:
+		}
+	}
+	return nil
+}
+
+func (d *headlessDaemon) stop() {
+	d.stopOnce.Do(func() { close(d.stopCh) })
+}
+
+// pollLoop is the headless counterpart of GUI.runDaemon
+func (d *headlessDaemon) pollLoop(limit int) {
+	iter := 0
+	remaining := 0
+	for {
+		select {
+		case <-d.stopCh:
+			return
+		default:
+		}
+		iter++
+		d.log(fmt.Sprintf("Daemon iteration %d", iter))
+		next := 30 * time.Second
+		if err := d.auth.EnsureValidToken(); err != nil {
+			d.log(fmt.Sprintf("Token refresh failed: %v", err))
+		} else if resp, err := d.api.PollJobs(limit); err != nil {
+			d.log(fmt.Sprintf("Poll failed: %v", err))
+		} else {
+			if len(resp.Jobs) > 0 {
+				remaining = max(0, remaining-len(resp.Jobs))
+				d.log(fmt.Sprintf("Downloading %d jobs...", len(resp.Jobs)))
+				stats := d.downloader.DownloadJobs(resp.Jobs)
+				d.log(fmt.Sprintf("Download complete: %d successful, %d failed", stats.Successful, stats.Failed))
+			} else {
+				remaining = 0
+			}
+			d.polling.UpdateMetrics(len(resp.Jobs))
+			next = d.polling.CalculateOptimalInterval(len(resp.Jobs) > 0, remaining, d.config.Folders.Files.Jobs.ToDo)
+			d.log(d.polling.LogPollingDecision(len(resp.Jobs) > 0, next, remaining))
+			if next == 0 {
+				// Too many jobs waiting locally; check again later
+				next = 30 * time.Second
+			}
+		}
+
+		select {
+		case <-d.stopCh:
+			return
+		case <-time.After(next):
+		case <-d.polling.GetBurstPollChannel():
+			d.log("Burst poll triggered - checking for jobs immediately")
+		}
+	}
+}
+
+// runDaemonCommand runs the monitoring without the GUI, signed in with the machine credential
+func runDaemonCommand(args []string) int {
+	fs := flag.NewFlagSet("daemon", flag.ContinueOnError)
+	cfg := DefaultConfig()
+	limit := fs.Int("limit", cfg.Poll.Limit, "maximum number of jobs per poll")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	configureLogPrivacy(cfg)
+	configureFileEncryption(cfg)
+	configureJobContainers(cfg)
+
+	// Refuse to run next to another client polling and uploading from the same folders
+	lock, err := AcquireInstanceLock(cfg, "daemon")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	defer lock.Release()
+
+	am := NewAuthManager(cfg)
+	if err := am.ResumeMachine(); err != nil {
+		if errors.Is(err, errNoStoredSession) {
+			fmt.Fprintln(os.Stderr, "this machine is not registered, run register first")
+			return 1
+		}
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	id, name := am.MachineIdentity()
+
+	stop := make(chan struct{})
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		close(stop)
+	}()
+
+	d := newHeadlessDaemon(cfg, am)
+	d.lock = lock
+	d.log(fmt.Sprintf("Signed in as machine %s (%s)", name, id))
+	if err := d.run(*limit, stop); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// runRegisterCommand registers this machine once, with a device code approved in the browser or
+// with an API key created in the web app
+func runRegisterCommand(args []string) int {
+	fs := flag.NewFlagSet("register", flag.ContinueOnError)
+	cfg := DefaultConfig()
+	name := fs.String("name", cfg.Auth.MachineName, "machine name shown in job status")
+	machineID := fs.String("machine-id", "", "register with an existing machine ID and read its API key from stdin")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	am := NewAuthManager(cfg)
+
+	if *machineID != "" {
+		// The key is read from stdin so it does not end up in the shell history or process list
+		fmt.Fprintln(os.Stderr, "API key:")
+		key, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		if key = strings.TrimSpace(key); key == "" {
+			fmt.Fprintln(os.Stderr, "no API key given")
+			return 2
+		}
+		if err := am.RegisterMachineKey(*machineID, key, *name); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			return 1
+		}
+	} else {
+		dc, err := am.RequestDeviceCode(*name)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			return 1
+		}
+		uri := dc.VerificationURI
+		if dc.VerificationURIComplete != "" {
+			uri = dc.VerificationURIComplete
+		}
+		fmt.Printf("To register %s, open %s and enter the code %s\n", *name, uri, dc.UserCode)
+		fmt.Println("Waiting for approval...")
+		if err := am.CompleteDeviceCode(dc, nil); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			return 1
+		}
+	}
+
+	id, registered := am.MachineIdentity()
+	fmt.Printf("Registered machine %s (%s); start it with: daemon\n", registered, id)
+	return 0
+}
+
+// runUnregisterCommand revokes and removes the machine credential
+func runUnregisterCommand(args []string) int {
+	fs := flag.NewFlagSet("unregister", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if err := NewAuthManager(DefaultConfig()).UnregisterMachine(); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	fmt.Println("Machine credential revoked and removed")
+	return 0
+}
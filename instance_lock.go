@@ -0,0 +1,291 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	// instanceLockName is the lock file in the Files root
+	instanceLockName = ".alphaweaver.lock"
+	// instanceLockHeartbeat is how often the holder refreshes the lock
+	instanceLockHeartbeat = 30 * time.Second
+	// instanceLockStaleAge is how long a lock may go without a heartbeat before another instance takes it over
+	instanceLockStaleAge = 2 * time.Minute
+)
+
+// heldLockTokens are the tokens of the locks this process holds, to tell them from a lock a
+// previous process with the same PID left behind
+var (
+	heldLockMu     sync.Mutex
+	heldLockTokens = map[string]bool{}
+)
+
+// LockInfo is the content of the lock file
+type LockInfo struct {
+	PID         int       `json:"pid"`
+	Host        string    `json:"host"`
+	Mode        string    `json:"mode"` // "gui" or "daemon"
+	Token       string    `json:"token"`
+	StartedAt   time.Time `json:"started_at"`
+	HeartbeatAt time.Time `json:"heartbeat_at"`
+}
+
+// LockHeldError is returned when another live instance holds the lock
+type LockHeldError struct {
+	Path   string
+	Holder LockInfo
+}
+
+func (e *LockHeldError) Error() string {
+	if e.Holder.PID == 0 {
+		return fmt.Sprintf("another AlphaWeaver client is already using %s (lock %s is being written or unreadable); try again in %s",
+			filepath.Dir(e.Path), e.Path, instanceLockStaleAge)
+	}
+	return fmt.Sprintf("another AlphaWeaver client (%s, PID %d on %s, started %s) is already using %s; stop it first, or remove %s if it is no longer running",
+		e.Holder.Mode, e.Holder.PID, e.Holder.Host, e.Holder.StartedAt.Local().Format("2006-01-02 15:04"),
+		filepath.Dir(e.Path), e.Path)
+}
+
+// InstanceLock is an advisory lock that keeps two clients from polling and uploading from the same
+// Files root. It is refreshed by a heartbeat; a lock whose heartbeat stopped, or whose process is
+// gone on this host, is taken over by the next instance.
+type InstanceLock struct {
+	path string
+	info LockInfo
+
+	mu       sync.Mutex
+	stopCh   chan struct{}
+	lostCh   chan struct{}
+	stopOnce sync.Once
+	lostOnce sync.Once
+	holder   LockInfo // Who took the lock over, once lost
+}
+
+// AcquireInstanceLock takes the lock of the configured Files root and starts its heartbeat
+func AcquireInstanceLock(cfg *Config, mode string) (*InstanceLock, error) {
+	root := cfg.FilesRoot()
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create directory %s: %w", root, err)
+	}
+	token := make([]byte, 8)
+	if _, err := rand.Read(token); err != nil {
+		return nil, fmt.Errorf("generate lock token: %w", err)
+	}
+	host, _ := os.Hostname()
+	now := time.Now().UTC()
+	l := &InstanceLock{
+		path:   filepath.Join(root, instanceLockName),
+		info:   LockInfo{PID: os.Getpid(), Host: host, Mode: mode, Token: hex.EncodeToString(token), StartedAt: now, HeartbeatAt: now},
+		stopCh: make(chan struct{}),
+		lostCh: make(chan struct{}),
+	}
+	if err := l.acquire(); err != nil {
+		return nil, err
+	}
+	heldLockMu.Lock()
+	heldLockTokens[l.info.Token] = true
+	heldLockMu.Unlock()
+	go l.heartbeat()
+	return l, nil
+}
+
+// acquire creates the lock file, taking over a stale one once
+func (l *InstanceLock) acquire() error {
+	for attempt := 0; ; attempt++ {
+		err := l.create()
+		if err == nil || !errors.Is(err, os.ErrExist) {
+			return err
+		}
+		holder, readErr := readLockInfo(l.path)
+		stale, reason := lockIsStale(l.path, holder, readErr)
+		if !stale || attempt > 0 {
+			return &LockHeldError{Path: l.path, Holder: holder}
+		}
+		fmt.Printf("Taking over stale instance lock %s (%s)\n", l.path, reason)
+		if err := os.Remove(l.path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("remove stale lock %s: %w", l.path, err)
+		}
+	}
+}
+
+// create writes the lock file if none exists
+func (l *InstanceLock) create() error {
+	data, err := json.MarshalIndent(l.info, "", "  ")
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(l.path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(l.path)
+		return fmt.Errorf("write lock %s: %w", l.path, err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(l.path)
+		return fmt.Errorf("sync lock %s: %w", l.path, err)
+	}
+	return f.Close()
+}
+
+// heartbeat refreshes the lock until Release, and gives up when another instance has taken it over
+func (l *InstanceLock) heartbeat() {
+	ticker := time.NewTicker(instanceLockHeartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.stopCh:
+			return
+		case <-ticker.C:
+			if err := l.refresh(); err != nil {
+				fmt.Printf("Warning: failed to refresh instance lock: %v\n", err)
+			}
+		}
+	}
+}
+
+// refresh updates the heartbeat in the lock file if the lock is still ours
+func (l *InstanceLock) refresh() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	holder, err := readLockInfo(l.path)
+	switch {
+	case os.IsNotExist(err):
+		// Removed by hand: take it again unless another instance got there first
+		if err := l.create(); err != nil {
+			if errors.Is(err, os.ErrExist) {
+				holder, _ = readLockInfo(l.path)
+				l.markLost(holder)
+				return nil
+			}
+			return err
+		}
+		return nil
+	case err != nil:
+		return err
+	case holder.Token != l.info.Token:
+		l.markLost(holder)
+		return nil
+	}
+	l.info.HeartbeatAt = time.Now().UTC()
+	data, err := json.MarshalIndent(l.info, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(l.path, data, 0644)
+}
+
+func (l *InstanceLock) markLost(holder LockInfo) {
+	l.lostOnce.Do(func() {
+		l.holder = holder
+		close(l.lostCh)
+		l.stop()
+	})
+}
+
+// Lost is closed when another instance has taken the lock over; the holder should stop monitoring
+func (l *InstanceLock) Lost() <-chan struct{} {
+	return l.lostCh
+}
+
+// LostTo returns the instance that took the lock over
+func (l *InstanceLock) LostTo() LockInfo {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.holder
+}
+
+// Release stops the heartbeat and removes the lock file if it is still ours
+func (l *InstanceLock) Release() {
+	l.stop()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if holder, err := readLockInfo(l.path); err == nil && holder.Token == l.info.Token {
+		os.Remove(l.path)
+	}
+}
+
+func (l *InstanceLock) stop() {
+	l.stopOnce.Do(func() {
+		close(l.stopCh)
+		heldLockMu.Lock()
+		delete(heldLockTokens, l.info.Token)
+		heldLockMu.Unlock()
+	})
+}
+
+func readLockInfo(path string) (LockInfo, error) {
+	var info LockInfo
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return info, err
+	}
+	if err := json.Unmarshal(data, &info); err != nil {
+		return info, fmt.Errorf("parse lock %s: %w", path, err)
+	}
+	return info, nil
+}
+
+// lockIsStale decides whether a lock can be taken over and says why
+func lockIsStale(path string, holder LockInfo, readErr error) (bool, string) {
+	if readErr != nil {
+		if os.IsNotExist(readErr) {
+			return true, "released"
+		}
+		// Unreadable: only take it over once it is old enough not to be still being written
+		info, err := os.Stat(path)
+		if err == nil && time.Since(info.ModTime()) > instanceLockStaleAge {
+			return true, "unreadable"
+		}
+		return false, ""
+	}
+	if age := time.Since(holder.HeartbeatAt); age > instanceLockStaleAge {
+		return true, fmt.Sprintf("no heartbeat for %s", age.Round(time.Second))
+	}
+	host, _ := os.Hostname()
+	if holder.Host == host {
+		if holder.PID == os.Getpid() {
+			heldLockMu.Lock()
+			defer heldLockMu.Unlock()
+			if heldLockTokens[holder.Token] {
+				return false, ""
+			}
+			return true, "left by an earlier process with this PID"
+		}
+		if !processRunning(holder.PID) {
+			return true, fmt.Sprintf("process %d is not running", holder.PID)
+		}
+	}
+	return false, ""
+}
+
+// processRunning reports whether a process with the PID exists on this host
+func processRunning(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	if runtime.GOOS == "windows" {
+		// FindProcess opens the process on Windows, so it only succeeds for a running one
+		p.Release()
+		return true
+	}
+	err = p.Signal(syscall.Signal(0))
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
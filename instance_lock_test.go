@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeLockInfo replaces the lock file content, as another instance would
+func writeLockInfo(t *testing.T, path string, info LockInfo) {
+	data, _ := json.Marshal(info)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("write lock: %v", err)
+	}
+}
+
+// exitedPID returns the PID of a process that has already exited
+func exitedPID(t *testing.T) int {
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("run helper process: %v", err)
+	}
+	return cmd.Process.Pid
+}
+
+func TestFilesRoot(t *testing.T) {
+	cfg := DefaultConfig()
+	want := filepath.Dir(filepath.Dir(cfg.Folders.Files.Jobs.ToDo))
+	if got := cfg.FilesRoot(); got != want {
+		t.Fatalf("FilesRoot = %s, want %s", got, want)
+	}
+	cfg = testJobFolders(t)
+	if got, want := cfg.FilesRoot(), filepath.Dir(cfg.Folders.Files.Opt.In); got != want {
+		t.Fatalf("FilesRoot = %s, want %s", got, want)
+	}
+}
+
+func TestInstanceLock(t *testing.T) {
+	cfg := testJobFolders(t)
+	lock, err := AcquireInstanceLock(cfg, "daemon")
+	if err != nil {
+		t.Fatalf("AcquireInstanceLock failed: %v", err)
+	}
+	var held *LockHeldError
+	if _, err := AcquireInstanceLock(cfg, "gui"); !errors.As(err, &held) || held.Holder.Mode != "daemon" || held.Holder.PID != os.Getpid() {
+		t.Fatalf("Expected LockHeldError for the daemon, got %v", err)
+	}
+
+	lock.Release()
+	if _, err := os.Stat(lock.path); !os.IsNotExist(err) {
+		t.Fatalf("Release left the lock file: %v", err)
+	}
+	lock, err = AcquireInstanceLock(cfg, "gui")
+	if err != nil {
+		t.Fatalf("AcquireInstanceLock after Release failed: %v", err)
+	}
+	defer lock.Release()
+
+	// Another instance takes the lock over: the next heartbeat notices
+	other := LockInfo{PID: 1, Host: "other-host", Mode: "daemon", Token: "other", HeartbeatAt: time.Now()}
+	writeLockInfo(t, lock.path, other)
+	if err := lock.refresh(); err != nil {
+		t.Fatalf("refresh failed: %v", err)
+	}
+	select {
+	case <-lock.Lost():
+	default:
+		t.Fatalf("Expected the lock to be lost")
+	}
+	if got := lock.LostTo(); got.Host != "other-host" {
+		t.Fatalf("Expected the lock lost to other-host, got %+v", got)
+	}
+	lock.Release()
+	if holder, err := readLockInfo(lock.path); err != nil || holder.Token != "other" {
+		t.Fatalf("Release removed a lock it no longer holds: %+v (err %v)", holder, err)
+	}
+}
+
+func TestInstanceLockStale(t *testing.T) {
+	cfg := testJobFolders(t)
+	path := filepath.Join(cfg.FilesRoot(), instanceLockName)
+	host, _ := os.Hostname()
+
+	tests := []struct {
+		name      string
+		holder    LockInfo
+		takenOver bool
+	}{
+		{"live remote", LockInfo{PID: 1, Host: "other-host", HeartbeatAt: time.Now()}, false},
+		{"remote without heartbeat", LockInfo{PID: 1, Host: "other-host", HeartbeatAt: time.Now().Add(-2 * instanceLockStaleAge)}, true},
+		{"exited local process", LockInfo{PID: exitedPID(t), Host: host, HeartbeatAt: time.Now()}, true},
+	}
+	for _, tt := range tests {
+		writeLockInfo(t, path, tt.holder)
+		lock, err := AcquireInstanceLock(cfg, "daemon")
+		if (err == nil) != tt.takenOver {
+			t.Fatalf("%s: AcquireInstanceLock err = %v, want takeover %v", tt.name, err, tt.takenOver)
+		}
+		if lock != nil {
+			lock.Release()
+		}
+	}
+
+	// A lock file that cannot be parsed is only taken over once it is old
+	if err := os.WriteFile(path, []byte("{"), 0644); err != nil {
+		t.Fatalf("write lock: %v", err)
+	}
+	if _, err := AcquireInstanceLock(cfg, "daemon"); err == nil {
+		t.Fatalf("Expected a fresh unreadable lock to be respected")
+	}
+	old := time.Now().Add(-2 * instanceLockStaleAge)
+	os.Chtimes(path, old, old)
+	lock, err := AcquireInstanceLock(cfg, "daemon")
+	if err != nil {
+		t.Fatalf("Expected an old unreadable lock to be taken over, got %v", err)
+	}
+	lock.Release()
+}
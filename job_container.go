@@ -0,0 +1,326 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"hash"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Container files start with containerMagic and a version byte, followed by the content type, the
+// uncompressed length (uint64, big endian), the SHA-256 of the uncompressed payload, the length of
+// the JSON metadata (uint16, big endian), the metadata and finally the compressed payload, whose codec is detected
+// from its header. Files without the magic are raw compressed streams, as written before containers.
+var containerMagic = []byte("AWJOB")
+
+const containerVersion = 1
+
+// containerFixedSize is the header size without the metadata
+var containerFixedSize = len(containerMagic) + 1 + 1 + 8 + sha256.Size + 2
+
+// errCorruptContainer is wrapped by every integrity failure of a container file
+var errCorruptContainer = errors.New("corrupt container")
+
+// ContentType tells what a container holds
+type ContentType byte
+
+const (
+	ContentJobXML ContentType = 1
+	ContentOPTCSV ContentType = 2
+	ContentReport ContentType = 3
+)
+
+func (c ContentType) String() string {
+	switch c {
+	case ContentJobXML:
+		return "job XML"
+	case ContentOPTCSV:
+		return "OPT CSV"
+	case ContentReport:
+		return "report"
+	default:
+		return fmt.Sprintf("unknown (%d)", byte(c))
+	}
+}
+
+// ContainerMeta is optional information stored in the container header
+type ContainerMeta struct {
+	JobID     string    `json:"job_id,omitempty"`
+	SourceURL string    `json:"source_url,omitempty"` // Without query string, signed URLs carry tokens
+	CreatedAt time.Time `json:"created_at,omitempty"`
+}
+
+// ContainerHeader describes the payload of a container file
+type ContainerHeader struct {
+	Version     byte
+	ContentType ContentType
+	Length      uint64
+	Checksum    [sha256.Size]byte
+	Meta        ContainerMeta
+}
+
+var (
+	jobContainerMu      sync.RWMutex
+	jobContainerEnabled bool // Off until configured, like Download.JobContainer in DefaultConfig
+)
+
+// configureJobContainers applies whether new .job files are written in the container format
+func configureJobContainers(cfg *Config) {
+	jobContainerMu.Lock()
+	jobContainerEnabled = cfg.Download.JobContainer
+	jobContainerMu.Unlock()
+}
+
+// jobContainersEnabled reports whether new .job files are written in the container format
+func jobContainersEnabled() bool {
+	jobContainerMu.RLock()
+	defer jobContainerMu.RUnlock()
+	return jobContainerEnabled
+}
+
+// sourceURLForMeta strips the query and fragment from a download URL before it is stored
+func sourceURLForMeta(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	u.RawQuery, u.Fragment = "", ""
+	return u.String()
+}
+
+// encodeContainerHeader serialises the header; the metadata must fit in 64 KiB
+func encodeContainerHeader(h ContainerHeader) ([]byte, error) {
+	meta, err := json.Marshal(h.Meta)
+	if err != nil {
+		return nil, fmt.Errorf("encode container metadata: %w", err)
+	}
+	if len(meta) > 0xFFFF {
+		return nil, fmt.Errorf("container metadata too large: %d bytes", len(meta))
+	}
+
+	var buf bytes.Buffer
+	buf.Write(containerMagic)
+	buf.WriteByte(containerVersion)
+	buf.WriteByte(byte(h.ContentType))
+	binary.Write(&buf, binary.BigEndian, h.Length)
+	buf.Write(h.Checksum[:])
+	binary.Write(&buf, binary.BigEndian, uint16(len(meta)))
+	buf.Write(meta)
+	return buf.Bytes(), nil
+}
+
+// isContainerHeader reports whether b starts with the container magic
+func isContainerHeader(b []byte) bool {
+	return len(b) >= len(containerMagic) && bytes.Equal(b[:len(containerMagic)], containerMagic)
+}
+
+// readContainerHeader reads and checks the header at the start of r
+func readContainerHeader(r io.Reader) (*ContainerHeader, error) {
+	fixed := make([]byte, containerFixedSize)
+	if _, err := io.ReadFull(r, fixed); err != nil {
+		return nil, fmt.Errorf("%w: truncated header: %v", errCorruptContainer, err)
+	}
+	if !isContainerHeader(fixed) {
+		return nil, fmt.Errorf("%w: missing magic", errCorruptContainer)
+	}
+	pos := len(containerMagic)
+	h := &ContainerHeader{Version: fixed[pos], ContentType: ContentType(fixed[pos+1])}
+	if h.Version != containerVersion {
+		return nil, fmt.Errorf("unsupported container version %d", h.Version)
+	}
+	pos += 2
+	h.Length = binary.BigEndian.Uint64(fixed[pos:])
+	pos += 8
+	copy(h.Checksum[:], fixed[pos:pos+sha256.Size])
+	pos += sha256.Size
+
+	meta := make([]byte, binary.BigEndian.Uint16(fixed[pos:]))
+	if _, err := io.ReadFull(r, meta); err != nil {
+		return nil, fmt.Errorf("%w: truncated metadata: %v", errCorruptContainer, err)
+	}
+	if len(meta) > 0 {
+		if err := json.Unmarshal(meta, &h.Meta); err != nil {
+			return nil, fmt.Errorf("%w: invalid metadata: %v", errCorruptContainer, err)
+		}
+	}
+	return h, nil
+}
+
+// verifyingReader checks the length and checksum of a container payload once it has been read.
+// A mismatch is returned instead of io.EOF, so readers never mistake a damaged payload for a complete one.
+type verifyingReader struct {
+	r      io.Reader
+	header *ContainerHeader
+	hash   hash.Hash
+	n      uint64
+}
+
+func (v *verifyingReader) Read(p []byte) (int, error) {
+	n, err := v.r.Read(p)
+	v.hash.Write(p[:n])
+	v.n += uint64(n)
+	if v.n > v.header.Length {
+		return n, fmt.Errorf("%w: payload is longer than the %d bytes in the header", errCorruptContainer, v.header.Length)
+	}
+	if err == io.EOF {
+		if v.n != v.header.Length {
+			return n, fmt.Errorf("%w: payload is %d bytes, header says %d", errCorruptContainer, v.n, v.header.Length)
+		}
+		if !bytes.Equal(v.hash.Sum(nil), v.header.Checksum[:]) {
+			return n, fmt.Errorf("%w: SHA-256 mismatch", errCorruptContainer)
+		}
+	} else if errors.Is(err, io.ErrUnexpectedEOF) {
+		err = fmt.Errorf("%w: payload is truncated", errCorruptContainer)
+	}
+	return n, err
+}
+
+// openContainerPayload reads the container header from r and returns the decompressed payload,
+// which is verified against the header as it is read. Closing it releases the decompressor only.
+func openContainerPayload(r *bufio.Reader) (*ContainerHeader, *Codec, io.ReadCloser, error) {
+	header, err := readContainerHeader(r)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	cr, codec, err := NewDecompressReader(r)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("%w: %v", errCorruptContainer, err)
+	}
+	return header, codec, struct {
+		io.Reader
+		io.Closer
+	}{&verifyingReader{r: cr, header: header, hash: sha256.New()}, cr}, nil
+}
+
+// hashPayload returns the length and SHA-256 of everything r yields
+func hashPayload(r io.Reader) (uint64, [sha256.Size]byte, error) {
+	h := sha256.New()
+	n, err := io.Copy(h, r)
+	var sum [sha256.Size]byte
+	copy(sum[:], h.Sum(nil))
+	return uint64(n), sum, err
+}
+
+// ArtifactCheck is the result of verifying one .job or .opt file
+type ArtifactCheck struct {
+	Path        string `json:"path"`
+	Format      string `json:"format,omitempty"` // "container v1", the codec of a raw file, or "plain"
+	Codec       string `json:"codec,omitempty"`
+	ContentType string `json:"content_type,omitempty"`
+	JobID       string `json:"job_id,omitempty"`
+	Encrypted   bool   `json:"encrypted"`
+	Error       string `json:"error,omitempty"`
+}
+
+// verifyArtifact reads a file completely, checking encryption, container checksum and compressed stream
+func verifyArtifact(path string) ArtifactCheck {
+	check := ArtifactCheck{Path: path}
+	if f, err := os.Open(path); err == nil {
+		head := make([]byte, encryptedHeaderSize)
+		n, _ := io.ReadFull(f, head)
+		f.Close()
+		check.Encrypted = isEncryptedData(head[:n])
+	}
+
+	reader, info, err := openArtifact(path)
+	if err != nil {
+		// OPT files may be plain CSV; job files are always compressed
+		if errors.Is(err, errUnknownCodec) && strings.EqualFold(filepath.Ext(path), ".opt") {
+			check.Format = "plain"
+			return check
+		}
+		check.Error = err.Error()
+		return check
+	}
+	defer reader.Close()
+
+	check.Format, check.Codec = info.Codec.Name, info.Codec.Name
+	if header := info.Container; header != nil {
+		check.Format = fmt.Sprintf("container v%d", header.Version)
+		check.ContentType = header.ContentType.String()
+		check.JobID = header.Meta.JobID
+	}
+	if _, err := io.Copy(io.Discard, reader); err != nil {
+		check.Error = err.Error()
+	}
+	return check
+}
+
+// verifyArtifacts checks every .job and .opt file in dirs; missing folders are skipped
+func verifyArtifacts(dirs []string) ([]ArtifactCheck, error) {
+	var checks []ArtifactCheck
+	for _, dir := range dirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return checks, fmt.Errorf("read %s: %w", dir, err)
+		}
+		for _, entry := range entries {
+			ext := strings.ToLower(filepath.Ext(entry.Name()))
+			if !entry.Type().IsRegular() || (ext != ".job" && ext != ".opt") {
+				continue
+			}
+			checks = append(checks, verifyArtifact(filepath.Join(dir, entry.Name())))
+		}
+	}
+	return checks, nil
+}
+
+// runVerifyCommand scans the job and OPT folders and reports corrupt artifacts
+func runVerifyCommand(args []string) int {
+	fs := flag.NewFlagSet("verify", flag.ContinueOnError)
+	asJSON := fs.Bool("json", false, "print every check as JSON")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	cfg := DefaultConfig()
+	configureFileEncryption(cfg)
+
+	dirs := fs.Args()
+	if len(dirs) == 0 {
+		jobs, opt := cfg.Folders.Files.Jobs, cfg.Folders.Files.Opt
+		dirs = []string{jobs.ToDo, jobs.InProgress, jobs.Done, jobs.Error, opt.In, opt.Done, opt.Error}
+	}
+	checks, err := verifyArtifacts(dirs)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+
+	corrupt := 0
+	for _, check := range checks {
+		if check.Error != "" {
+			corrupt++
+		}
+	}
+	if *asJSON {
+		if code := writeJSON(checks); code != 0 {
+			return code
+		}
+	} else {
+		for _, check := range checks {
+			if check.Error != "" {
+				fmt.Printf("CORRUPT %s: %s\n", check.Path, check.Error)
+			}
+		}
+		fmt.Printf("Checked %d file(s): %d ok, %d corrupt\n", len(checks), len(checks)-corrupt, corrupt)
+	}
+	if corrupt > 0 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// useJobContainers switches the container format on for the duration of the test
+func useJobContainers(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Download.JobContainer = true
+	configureJobContainers(cfg)
+	t.Cleanup(func() { configureJobContainers(DefaultConfig()) })
+}
+
+// writeTestJobXML writes an XML file large enough to compress into several deflate blocks
+func writeTestJobXML(t *testing.T, dir, name string) (string, string) {
+	var sb strings.Builder
+	sb.WriteString("<Jobs>")
+	for i := 0; i < 2000; i++ {
+		sb.WriteString("<Job><symbol>@ES</symbol><value>" + strings.Repeat("x", i%37) + "</value></Job>")
+	}
+	sb.WriteString("</Jobs>")
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(sb.String()), 0644); err != nil {
+		t.Fatalf("write XML: %v", err)
+	}
+	return path, sb.String()
+}
+
+func TestJobContainerRoundTrip(t *testing.T) {
+	useJobContainers(t)
+	dir := t.TempDir()
+	xmlPath, xml := writeTestJobXML(t, dir, "job1_@ES_60_OPT.xml")
+
+	meta := ContainerMeta{JobID: "job1", SourceURL: sourceURLForMeta("https://x.co/storage/job1.xml?token=secret#top")}
+	jobPath, err := CompressJobXMLFile(xmlPath, true, meta)
+	if err != nil {
+		t.Fatalf("CompressJobXMLFile failed: %v", err)
+	}
+
+	reader, info, err := openArtifact(jobPath)
+	if err != nil {
+		t.Fatalf("openArtifact failed: %v", err)
+	}
+	reader.Close()
+	header := info.Container
+	if header == nil || header.ContentType != ContentJobXML || header.Length != uint64(len(xml)) {
+		t.Fatalf("Unexpected header %+v", header)
+	}
+	if header.Meta.JobID != "job1" || header.Meta.SourceURL != "https://x.co/storage/job1.xml" || header.Meta.CreatedAt.IsZero() {
+		t.Fatalf("Unexpected metadata %+v", header.Meta)
+	}
+
+	if got, err := decompressJobFile(jobPath); err != nil || got != xml {
+		t.Fatalf("decompressJobFile returned %d bytes (err %v), want the original XML", len(got), err)
+	}
+
+	// Containers can be encrypted like raw zlib files
+	useTestFileKey(t, true)
+	if _, err := encryptFileInPlace(jobPath, false); err != nil {
+		t.Fatalf("encrypt container: %v", err)
+	}
+	if check := verifyArtifact(jobPath); check.Error != "" || !check.Encrypted || check.Format != "container v1" {
+		t.Fatalf("Unexpected check of the encrypted container: %+v", check)
+	}
+}
+
+func TestJobContainerCorruption(t *testing.T) {
+	useJobContainers(t)
+	dir := t.TempDir()
+	xmlPath, _ := writeTestJobXML(t, dir, "job.xml")
+	jobPath, err := CompressXMLFile(xmlPath, true)
+	if err != nil {
+		t.Fatalf("CompressXMLFile failed: %v", err)
+	}
+	good, _ := os.ReadFile(jobPath)
+	header, err := encodeContainerHeader(ContainerHeader{})
+	if err != nil {
+		t.Fatalf("encode header: %v", err)
+	}
+	checksumAt := len(containerMagic) + 2 + 8
+
+	tests := []struct {
+		name   string
+		modify func([]byte) []byte
+	}{
+		{"truncated payload", func(b []byte) []byte { return b[:len(b)/2] }},
+		{"truncated header", func(b []byte) []byte { return b[:len(header)-4] }},
+		{"wrong checksum", func(b []byte) []byte { b[checksumAt] ^= 0xFF; return b }},
+		{"wrong length", func(b []byte) []byte { b[checksumAt-1]++; return b }},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(dir, "broken.job")
+		if err := os.WriteFile(path, tt.modify(append([]byte{}, good...)), 0644); err != nil {
+			t.Fatalf("write %s: %v", tt.name, err)
+		}
+		out := filepath.Join(dir, "broken.xml")
+		if err := DecompressFile(path, out); !errors.Is(err, errCorruptContainer) {
+			t.Fatalf("%s: expected errCorruptContainer, got %v", tt.name, err)
+		}
+		if _, err := os.Stat(out); !os.IsNotExist(err) {
+			t.Fatalf("%s: expected no output file, got %v", tt.name, err)
+		}
+	}
+}
+
+func TestVerifyArtifacts(t *testing.T) {
+	dir := t.TempDir()
+	xmlPath, _ := writeTestJobXML(t, dir, "legacy.xml")
+	if _, err := CompressXMLFile(xmlPath, true); err != nil {
+		t.Fatalf("compress legacy job: %v", err)
+	}
+	useJobContainers(t)
+	xmlPath, _ = writeTestJobXML(t, dir, "container.xml")
+	if _, err := CompressXMLFile(xmlPath, true); err != nil {
+		t.Fatalf("compress container job: %v", err)
+	}
+	legacy, _ := os.ReadFile(filepath.Join(dir, "legacy.job"))
+	files := map[string][]byte{
+		"truncated.job": legacy[:len(legacy)-10],
+		"plain.opt":     []byte("run,parameters_json\n1,{}\n"),
+		"notes.txt":     []byte("not checked"),
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+
+	checks, err := verifyArtifacts([]string{dir, filepath.Join(dir, "missing")})
+	if err != nil {
+		t.Fatalf("verifyArtifacts failed: %v", err)
+	}
+	want := map[string]string{
+		"container.job": "container v1",
+		"legacy.job":    "zlib",
+		"plain.opt":     "plain",
+		"truncated.job": "zlib",
+	}
+	if len(checks) != len(want) {
+		t.Fatalf("Expected %d checks, got %+v", len(want), checks)
+	}
+	for _, check := range checks {
+		name := filepath.Base(check.Path)
+		if check.Format != want[name] || (check.Error != "") != (name == "truncated.job") {
+			t.Fatalf("Unexpected check for %s: %+v", name, check)
+		}
+	}
+}
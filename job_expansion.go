@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// defaultMaxExpandedJobs caps the number of <Job> elements one downloaded job may expand into
+const defaultMaxExpandedJobs = 500
+
+// Filename parts replaced when deriving per-element filenames (<job>_<symbol>_<timeframe>_<task>.job).
+// WFO runs are not renamed: they share the job's filename and are told apart by <run>.
+const (
+	jobFilenameSymbol    = 1
+	jobFilenameTimeframe = 2
+	jobFilenameStress    = -2 // appended as _STRESS-<n>
+)
+
+// jobExpander fans one job element out into several along one dimension
+type jobExpander struct {
+	name    string
+	applies func(jobXML string) bool
+	expand  func(jobXML string) []string
+}
+
+// jobExpanders run in this order, so a job listing symbols, timeframes and OOS runs expands into
+// every symbol x timeframe x run combination, each stress tested when requested
+var jobExpanders = []jobExpander{
+	{"MM", func(jobXML string) bool { return listTagCount(jobXML, "symbols") > 1 }, expandMMJob},
+	{"MTF", func(jobXML string) bool { return listTagCount(jobXML, "timeframes") > 1 }, expandMTFJob},
+	{"WFO", isExpandableWFOJob, expandWFOJob},
+	{"STRESS", isStressTestJob, expandStressTestJob},
+}
+
+// listTagCount returns the number of distinct non-empty comma separated values in a tag, 0 if it is missing
+func listTagCount(jobXML, tagName string) int {
+	value, err := extractXMLTagValue(jobXML, tagName)
+	if err != nil {
+		return 0
+	}
+	seen := make(map[string]bool)
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			seen[item] = true
+		}
+	}
+	return len(seen)
+}
+
+// isExpandableWFOJob reports whether a job is a walk-forward job with an <oos_runs> count
+func isExpandableWFOJob(jobXML string) bool {
+	if !strings.Contains(jobXML, "<oos_runs>") {
+		return false
+	}
+	for _, taskType := range []string{"WFO", "WFM", "DWFM"} {
+		if strings.Contains(jobXML, fmt.Sprintf("<task_type>%s</task_type>", taskType)) {
+			return true
+		}
+	}
+	return false
+}
+
+// expandJobXML runs the downloaded job through all expanders and wraps the resulting elements in <root>.
+// It fails instead of writing more than maxJobs elements (maxJobs <= 0 uses defaultMaxExpandedJobs).
+func expandJobXML(xmlContent string, maxJobs int) (string, int, error) {
+	if maxJobs <= 0 {
+		maxJobs = defaultMaxExpandedJobs
+	}
+	originalFilename, _ := extractXMLTagValue(xmlContent, "filename")
+
+	elements := []string{xmlContent}
+	for _, expander := range jobExpanders {
+		var next []string
+		for _, element := range elements {
+			if !expander.applies(element) {
+				next = append(next, element)
+				continue
+			}
+			next = append(next, expander.expand(element)...)
+			if len(next) > maxJobs {
+				return "", 0, fmt.Errorf("%s expansion exceeds the limit of %d jobs", expander.name, maxJobs)
+			}
+		}
+		if len(next) != len(elements) {
+			fmt.Printf("[DEBUG] %s expansion: %d -> %d job elements\n", expander.name, len(elements), len(next))
+		}
+		elements = next
+	}
+
+	// Keep the downloaded job's filename for the container file when elements were renamed
+	renamed := false
+	for _, element := range elements {
+		if filename, _ := extractXMLTagValue(element, "filename"); filename != originalFilename {
+			renamed = true
+			break
+		}
+	}
+	if renamed && originalFilename != "" {
+		for i, element := range elements {
+			elements[i] = addXMLTag(element, "parent_filename", originalFilename)
+		}
+	}
+
+	return fmt.Sprintf("<root>\n%s\n</root>", strings.Join(elements, "\n")), len(elements), nil
+}
+
+// deriveJobFilename rewrites the <filename> of an expanded element: the symbol or timeframe part is
+// replaced, or _STRESS-<n> is appended for stress variants. Filenames that don't follow the
+// <job>_<symbol>_<timeframe>_... pattern get the value appended instead.
+func deriveJobFilename(jobXML string, part int, value string) string {
+	filename, err := extractXMLTagValue(jobXML, "filename")
+	if err != nil || filename == "" {
+		return jobXML
+	}
+	ext := filepath.Ext(filename)
+	base := strings.TrimSuffix(filename, ext)
+	safeValue := strings.NewReplacer(",", "-", "_", "-", " ", "").Replace(value)
+
+	parts := strings.Split(base, "_")
+	switch {
+	case part == jobFilenameStress:
+		base = fmt.Sprintf("%s_STRESS-%s", base, safeValue)
+	case part > 0 && part < len(parts):
+		parts[part] = safeValue
+		base = strings.Join(parts, "_")
+	default:
+		base = fmt.Sprintf("%s_%s", base, safeValue)
+	}
+	return replaceXMLTag(jobXML, "filename", base+ext)
+}
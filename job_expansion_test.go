@@ -0,0 +1,115 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestExpandJobXMLMatrix(t *testing.T) {
+	job := "<Job>\n  <Id>job1</Id>\n  <Symbol>@ES</Symbol>\n  <Timeframe>60</Timeframe>\n" +
+		"  <filename>job1_@ES-@NQ_60-120_MM.job</filename>\n  <task_type>MM</task_type>\n" +
+		"  <symbols>@ES,@NQ</symbols>\n  <timeframes>60,120</timeframes>\n</Job>"
+
+	content, count, err := expandJobXML(job, 10)
+	if err != nil {
+		t.Fatalf("expandJobXML failed: %v", err)
+	}
+	if count != 4 {
+		t.Fatalf("Expected 4 job elements, got %d", count)
+	}
+
+	elements := jobElementPattern.FindAllStringSubmatch(content, -1)
+	seen := make(map[string]bool)
+	for _, element := range elements {
+		symbol, _ := extractXMLTagValue(element[1], "Symbol")
+		timeframe, _ := extractXMLTagValue(element[1], "Timeframe")
+		filename, _ := extractXMLTagValue(element[1], "filename")
+		parent, _ := extractXMLTagValue(element[1], "parent_filename")
+
+		want := "job1_" + symbol + "_" + timeframe + "_MM.job"
+		if filename != want {
+			t.Fatalf("Expected filename %s, got %s", want, filename)
+		}
+		if parent != "job1_@ES-@NQ_60-120_MM.job" {
+			t.Fatalf("Expected the original filename as parent, got %q", parent)
+		}
+		if strings.Contains(element[1], "<symbols>") || strings.Contains(element[1], "<timeframes>") {
+			t.Fatalf("List tags should be removed from expanded elements: %s", element[1])
+		}
+		seen[symbol+"/"+timeframe] = true
+	}
+	for _, combo := range []string{"@ES/60", "@ES/120", "@NQ/60", "@NQ/120"} {
+		if !seen[combo] {
+			t.Fatalf("Missing combination %s in %v", combo, seen)
+		}
+	}
+
+	dm := &DownloadManager{}
+	if name, err := dm.extractFilenameFromXML(content); err != nil || name != "job1_@ES-@NQ_60-120_MM.xml" {
+		t.Fatalf("Expected the container to keep the original filename, got %q (err %v)", name, err)
+	}
+}
+
+func TestExpandJobXMLMultiMarketWFO(t *testing.T) {
+	job := "<Job>\n  <Symbol>@ES</Symbol>\n  <Timeframe>60</Timeframe>\n  <filename>job1_@ES-@NQ_60_WFO.job</filename>\n" +
+		"  <task_type>WFO</task_type>\n  <symbols>@ES,@NQ</symbols>\n  <oos_runs>3</oos_runs>\n  <oos_percent>20</oos_percent>\n" +
+		"  <startDate>2010-01-01</startDate>\n  <endDate>2015-01-01</endDate>\n</Job>"
+
+	content, count, err := expandJobXML(job, 0)
+	if err != nil {
+		t.Fatalf("expandJobXML failed: %v", err)
+	}
+	// 2 symbols x (3 runs + final IS-only run)
+	if count != 8 {
+		t.Fatalf("Expected 8 job elements, got %d", count)
+	}
+	// Symbols get their own filename, runs of a symbol share it
+	for _, want := range []string{"job1_@NQ_60_WFO.job", "job1_@ES_60_WFO.job"} {
+		if strings.Count(content, "<filename>"+want+"</filename>") != 4 {
+			t.Fatalf("Expected derived filename %s on all 4 runs", want)
+		}
+	}
+	if strings.Count(content, "<run>1</run>") != 2 {
+		t.Fatalf("Expected run 1 once per symbol")
+	}
+}
+
+func TestExpandJobXMLPlainWFO(t *testing.T) {
+	job := "<Job>\n  <Symbol>@ES</Symbol>\n  <Timeframe>60</Timeframe>\n  <filename>job1_@ES_60_WFO.job</filename>\n" +
+		"  <task_type>WFO</task_type>\n  <symbols>@ES,@ES</symbols>\n  <oos_runs>3</oos_runs>\n  <oos_percent>20</oos_percent>\n" +
+		"  <startDate>2010-01-01</startDate>\n  <endDate>2015-01-01</endDate>\n</Job>"
+
+	content, count, err := expandJobXML(job, 0)
+	if err != nil {
+		t.Fatalf("expandJobXML failed: %v", err)
+	}
+	// A repeated symbol is not a second market: 3 runs + the final IS-only run
+	if count != 4 {
+		t.Fatalf("Expected 4 job elements, got %d", count)
+	}
+	elements := jobElementPattern.FindAllStringSubmatch(content, -1)
+	for i, element := range elements {
+		filename, _ := extractXMLTagValue(element[1], "filename")
+		run, _ := extractXMLTagValue(element[1], "run")
+		if filename != "job1_@ES_60_WFO.job" || run != strconv.Itoa(i+1) {
+			t.Fatalf("Element %d: expected the original filename and run %d, got %s run %s", i, i+1, filename, run)
+		}
+	}
+	if strings.Contains(content, "parent_filename") {
+		t.Fatalf("Expected no parent filename when no element was renamed")
+	}
+}
+
+func TestExpandJobXMLLimit(t *testing.T) {
+	job := "<Job><Symbol>@ES</Symbol><symbols>@ES,@NQ,@YM</symbols><timeframes>5,15,60</timeframes></Job>"
+	if _, _, err := expandJobXML(job, 8); err == nil {
+		t.Fatalf("Expected the 9-job expansion to exceed a limit of 8")
+	}
+
+	single := "<Job><Symbol>@ES</Symbol><filename>job1_@ES_60_OPT.job</filename></Job>"
+	content, count, err := expandJobXML(single, 8)
+	if err != nil || count != 1 || strings.Contains(content, "parent_filename") {
+		t.Fatalf("Expected a single unchanged job, got %d elements (err %v)", count, err)
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Manifest statuses
+const (
+	ManifestPending    = "pending"
+	ManifestAggregated = "aggregated"
+)
+
+// JobManifest records how a downloaded job was fanned out into several <Job> elements,
+// so the per-element results can be recombined once they have all come back
+type JobManifest struct {
+	JobID          string   `json:"job_id"`
+	TaskType       string   `json:"task_type"`
+	Symbols        []string `json:"symbols"`
+	Timeframes     []string `json:"timeframes"`
+	InitialCapital float64  `json:"initial_capital"`
+	CreatedAt      string   `json:"created_at"`
+	Status         string   `json:"status"`
+	CompletedAt    string   `json:"completed_at,omitempty"`
+	OutputFile     string   `json:"output_file,omitempty"`
+}
+
+var jobElementPattern = regexp.MustCompile(`(?s)<Job>(.*?)</Job>`)
+
+// newJobManifest builds a manifest from the expanded (root-wrapped) job XML.
+// Symbols and timeframes are listed in the order they first appear.
+func newJobManifest(jobID, taskType, expandedXML string) (*JobManifest, error) {
+	elements := jobElementPattern.FindAllStringSubmatch(expandedXML, -1)
+	if len(elements) == 0 {
+		return nil, fmt.Errorf("no <Job> elements found")
+	}
+
+	m := &JobManifest{
+		JobID:          jobID,
+		TaskType:       taskType,
+		InitialCapital: initialCapitalFromJobXML(elements[0][1]),
+		CreatedAt:      time.Now().UTC().Format(time.RFC3339),
+		Status:         ManifestPending,
+	}
+	seenSymbols := make(map[string]bool)
+	seenTimeframes := make(map[string]bool)
+	for _, element := range elements {
+		if symbol, err := extractXMLTagValue(element[1], "Symbol"); err == nil && symbol != "" && !seenSymbols[symbol] {
+			seenSymbols[symbol] = true
+			m.Symbols = append(m.Symbols, symbol)
+		}
+		if timeframe, err := extractXMLTagValue(element[1], "Timeframe"); err == nil && timeframe != "" && !seenTimeframes[timeframe] {
+			seenTimeframes[timeframe] = true
+			m.Timeframes = append(m.Timeframes, timeframe)
+		}
+	}
+	if len(m.Symbols) == 0 {
+		return nil, fmt.Errorf("no <Symbol> values found")
+	}
+	return m, nil
+}
+
+// jobManifestPath returns the manifest location for a job
+func jobManifestPath(dir, jobID string) string {
+	return filepath.Join(dir, fmt.Sprintf("%s_manifest.json", jobID))
+}
+
+// saveJobManifest writes the manifest as indented JSON
+func saveJobManifest(dir string, m *JobManifest) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal manifest: %w", err)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("create manifest directory: %w", err)
+	}
+	if err := writeFileAtomic(jobManifestPath(dir, m.JobID), data, 0644); err != nil {
+		return fmt.Errorf("write manifest: %w", err)
+	}
+	return nil
+}
+
+// loadJobManifests reads all manifests in dir, sorted by job ID. Unreadable files are skipped.
+func loadJobManifests(dir string) ([]*JobManifest, error) {
+	matches, err := filepath.Glob(filepath.Join(dir, "*_manifest.json"))
+	if err != nil {
+		return nil, fmt.Errorf("search manifests: %w", err)
+	}
+	sort.Strings(matches)
+
+	var manifests []*JobManifest
+	for _, path := range matches {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		var m JobManifest
+		if err := json.Unmarshal(data, &m); err != nil || m.JobID == "" {
+			continue
+		}
+		manifests = append(manifests, &m)
+	}
+	return manifests, nil
+}
+
+// recordJobManifest writes a manifest for MM jobs expanded into one <Job> per symbol and MTF jobs
+// expanded into one <Job> per timeframe. Other jobs are left alone.
+func (dm *DownloadManager) recordJobManifest(job Job, expandedXML string) {
+	taskType := job.TaskType
+	if value, err := extractXMLTagValue(expandedXML, "task_type"); err == nil && value != "" {
+		taskType = value
+	}
+	taskType = strings.ToUpper(taskType)
+	if taskType != "MM" && taskType != "MTF" {
+		return
+	}
+
+	m, err := newJobManifest(job.ID, taskType, expandedXML)
+	if err != nil {
+		fmt.Printf("Warning: Could not build manifest for job %s: %v\n", job.ID, err)
+		return
+	}
+	if (taskType == "MM" && len(m.Symbols) < 2) || (taskType == "MTF" && len(m.Timeframes) < 2) {
+		return
+	}
+	if err := saveJobManifest(dm.config.Folders.Files.Jobs.Manifests, m); err != nil {
+		fmt.Printf("Warning: Could not save manifest for job %s: %v\n", job.ID, err)
+		return
+	}
+	fmt.Printf("📋 Recorded %s manifest for job %s (%d symbols, %d timeframes)\n", m.TaskType, job.ID, len(m.Symbols), len(m.Timeframes))
+}
@@ -34,9 +34,9 @@ func (l *Logger) Log(level, message string) error {
 		return fmt.Errorf("failed to create log directory: %w", err)
 	}
 
-	// Format the log entry
+	// Format the log entry; credentials never reach the file
 	timestamp := time.Now().Format("2006-01-02 15:04:05")
-	logEntry := fmt.Sprintf("[%s] %s: %s\n", timestamp, level, message)
+	logEntry := fmt.Sprintf("[%s] %s: %s\n", timestamp, level, redact(message))
 
 	// Append to log file
 	file, err := os.OpenFile(logFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"runtime"
+	"time"
+)
+
+// Headers identifying a registered machine on every request, so job status reports show which
+// machine claimed and ran a job
+const (
+	machineIDHeader   = "X-Machine-Id"
+	machineNameHeader = "X-Machine-Name"
+)
+
+// defaultDeviceCodeInterval is used when the server does not say how often to poll
+const defaultDeviceCodeInterval = 5 * time.Second
+
+// DeviceCode is the pending registration shown to the user: they open VerificationURI in a
+// browser, sign in and enter UserCode to approve the machine
+type DeviceCode struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete,omitempty"`
+	ExpiresIn               int    `json:"expires_in"`
+	Interval                int    `json:"interval"`
+}
+
+// machineCredentialResponse is returned once a registration is approved
+type machineCredentialResponse struct {
+	MachineID   string `json:"machine_id"`
+	MachineName string `json:"machine_name"`
+	APIKey      string `json:"api_key"`
+	Error       string `json:"error,omitempty"`
+}
+
+// postFunction calls an edge function (with the anon key unless bearer is given) and decodes the
+// JSON response into out. Error responses are decoded too, so callers can read their error code.
+func (am *AuthManager) postFunction(name string, bearer string, payload interface{}, out interface{}) (int, error) {
+	url := fmt.Sprintf("%s/functions/v1/%s", am.config.Supabase.URL, name)
+	body, _ := json.Marshal(payload)
+	req, err := http.NewRequest("POST", url, bytes.NewBuffer(body))
+	if err != nil {
+		return 0, fmt.Errorf("create %s request: %w", name, err)
+	}
+	if bearer == "" {
+		bearer = am.config.Supabase.AnonKey
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("apikey", am.config.Supabase.AnonKey)
+	req.Header.Set("Authorization", "Bearer "+bearer)
+
+	resp, err := am.httpClient.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("%s request failed: %w", name, err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	if out != nil && len(data) > 0 {
+		if err := json.Unmarshal(data, out); err != nil && resp.StatusCode == 200 {
+			return resp.StatusCode, fmt.Errorf("parse %s response: %w", name, err)
+		}
+	}
+	return resp.StatusCode, nil
+}
+
+// requestMachineToken exchanges a machine API key for a short-lived JWT scoped to that machine
+func (am *AuthManager) requestMachineToken(machine *StoredSession) (authResponse, error) {
+	var ar authResponse
+	status, err := am.postFunction("machine-token", "", map[string]string{
+		"machine_id": machine.MachineID,
+		"api_key":    machine.APIKey,
+	}, &ar)
+	if err != nil {
+		return ar, err
+	}
+	if status == 401 || status == 403 {
+		return ar, fmt.Errorf("machine token failed: http %d (credential revoked?): %w", status, errSessionRejected)
+	}
+	if status != 200 || ar.AccessToken == "" {
+		return ar, fmt.Errorf("machine token failed: http %d", status)
+	}
+	// Refreshes exchange the API key again, so a refresh token is never kept for a machine
+	logRedactor.AddSecret(ar.RefreshToken)
+	ar.RefreshToken = ""
+	return ar, nil
+}
+
+// AuthenticateMachine signs in with a machine credential. Refreshes exchange the API key again.
+func (am *AuthManager) AuthenticateMachine(machine *StoredSession) error {
+	logRedactor.AddSecret(machine.APIKey)
+	am.mu.Lock()
+	am.generation++
+	am.clearTokensLocked()
+	am.machine = machine
+	am.email = ""
+	am.mu.Unlock()
+
+	if err := am.RefreshToken(); err != nil {
+		return fmt.Errorf("machine sign-in: %w", err)
+	}
+	am.notify(AuthEvent{Type: AuthSignedIn})
+	return nil
+}
+
+// ResumeMachine signs in with the credential saved at registration
+func (am *AuthManager) ResumeMachine() error {
+	machine, err := am.machines.Load()
+	if err != nil {
+		return err
+	}
+	if machine.MachineID == "" || machine.APIKey == "" {
+		return fmt.Errorf("stored machine credential is incomplete")
+	}
+	return am.AuthenticateMachine(machine)
+}
+
+// MachineIdentity returns the ID and name of the signed-in machine ("" for a user session)
+func (am *AuthManager) MachineIdentity() (string, string) {
+	am.mu.RLock()
+	defer am.mu.RUnlock()
+	if am.machine == nil {
+		return "", ""
+	}
+	return am.machine.MachineID, am.machine.MachineName
+}
+
+// RequestDeviceCode starts a device-code registration for this machine
+func (am *AuthManager) RequestDeviceCode(name string) (*DeviceCode, error) {
+	var dc DeviceCode
+	status, err := am.postFunction("machine-device-code", "", map[string]string{
+		"machine_name": name,
+		"os":           runtime.GOOS,
+	}, &dc)
+	if err != nil {
+		return nil, err
+	}
+	if status != 200 || dc.DeviceCode == "" {
+		return nil, fmt.Errorf("device code request failed: http %d", status)
+	}
+	return &dc, nil
+}
+
+// CompleteDeviceCode waits until the user approves (or denies) the registration, then saves the
+// machine credential and signs in with it
+func (am *AuthManager) CompleteDeviceCode(dc *DeviceCode, stop <-chan struct{}) error {
+	interval := time.Duration(dc.Interval) * time.Second
+	if interval <= 0 {
+		interval = defaultDeviceCodeInterval
+	}
+	deadline := time.Now().Add(time.Duration(dc.ExpiresIn) * time.Second)
+
+	for {
+		select {
+		case <-stop:
+			return fmt.Errorf("registration cancelled")
+		case <-time.After(interval):
+		}
+
+		var cr machineCredentialResponse
+		status, err := am.postFunction("machine-device-token", "", map[string]string{"device_code": dc.DeviceCode}, &cr)
+		switch {
+		case err != nil:
+			// Transient network errors should not lose a code the user may be entering right now
+			fmt.Printf("Warning: Device code poll failed: %v\n", err)
+		case status == 200 && cr.MachineID != "" && cr.APIKey != "":
+			return am.saveMachineCredential(&StoredSession{MachineID: cr.MachineID, MachineName: cr.MachineName, APIKey: cr.APIKey})
+		case cr.Error == "authorization_pending":
+		case cr.Error == "slow_down":
+			interval += defaultDeviceCodeInterval
+		case cr.Error == "access_denied":
+			return fmt.Errorf("registration was denied")
+		case cr.Error == "expired_token":
+			return fmt.Errorf("device code expired, run register again")
+		default:
+			return fmt.Errorf("device code poll failed: http %d %s", status, cr.Error)
+		}
+		if dc.ExpiresIn > 0 && time.Now().After(deadline) {
+			return fmt.Errorf("device code expired, run register again")
+		}
+	}
+}
+
+// RegisterMachineKey signs in with an API key provisioned in the web app and saves it
+func (am *AuthManager) RegisterMachineKey(machineID, apiKey, name string) error {
+	return am.saveMachineCredential(&StoredSession{MachineID: machineID, MachineName: name, APIKey: apiKey})
+}
+
+// saveMachineCredential verifies the credential by signing in before it replaces the stored one
+func (am *AuthManager) saveMachineCredential(machine *StoredSession) error {
+	if machine.MachineName == "" {
+		machine.MachineName = am.config.Auth.MachineName
+	}
+	machine.SavedAt = time.Now().UTC()
+	if err := am.AuthenticateMachine(machine); err != nil {
+		return err
+	}
+	if err := am.machines.Save(machine); err != nil {
+		return fmt.Errorf("save machine credential: %w", err)
+	}
+	return nil
+}
+
+// UnregisterMachine revokes the machine's API key on the server and removes it from this machine.
+// The local copy is removed even when the server cannot be reached.
+func (am *AuthManager) UnregisterMachine() error {
+	var err error
+	if id, _ := am.MachineIdentity(); id == "" {
+		err = am.ResumeMachine()
+	}
+	if err == nil {
+		var status int
+		status, err = am.postFunction("machine-revoke", am.AccessToken(), struct{}{}, nil)
+		if err == nil && status != 200 && status != 204 {
+			err = fmt.Errorf("machine revoke failed: http %d", status)
+		}
+	}
+	// Nothing to revoke when the server already rejects the key or none is stored
+	if errors.Is(err, errSessionRejected) || errors.Is(err, errNoStoredSession) {
+		err = nil
+	}
+	am.signOut()
+	return errors.Join(err, am.machines.Delete())
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// machineAuthServer implements the machine registration edge functions
+type machineAuthServer struct {
+	mu          sync.Mutex
+	polls       int    // device token polls
+	approveOn   int    // poll on which the device code is approved
+	revoked     bool   // API key revoked in the web app
+	revokes     int    // machine-revoke calls
+	pollMachine string // machine_id sent to poll-jobs
+	pollHeader  string // X-Machine-Id sent to poll-jobs
+}
+
+func (s *machineAuthServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var body map[string]interface{}
+	json.NewDecoder(r.Body).Decode(&body)
+
+	switch r.URL.Path {
+	case "/functions/v1/machine-device-code":
+		fmt.Fprint(w, `{"device_code":"dev-1","user_code":"ABCD-EFGH","verification_uri":"https://example.com/device","expires_in":600,"interval":1}`)
+	case "/functions/v1/machine-device-token":
+		if s.polls++; s.polls < s.approveOn {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"error":"authorization_pending"}`)
+			return
+		}
+		fmt.Fprint(w, `{"machine_id":"m-1","machine_name":"render-01","api_key":"key-1"}`)
+	case "/functions/v1/machine-token":
+		if s.revoked || body["machine_id"] != "m-1" || body["api_key"] != "key-1" {
+			http.Error(w, `{"error":"invalid_credential"}`, http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, `{"access_token":"machine-jwt","refresh_token":"machine-refresh","expires_in":3600}`)
+	case "/functions/v1/machine-revoke":
+		if r.Header.Get("Authorization") != "Bearer machine-jwt" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		s.revokes++
+		s.revoked = true
+		w.WriteHeader(http.StatusNoContent)
+	case "/functions/v1/poll-jobs":
+		s.pollMachine, _ = body["machine_id"].(string)
+		s.pollHeader = r.Header.Get(machineIDHeader)
+		fmt.Fprint(w, `{"jobs":[]}`)
+	default:
+		http.Error(w, "not found", http.StatusNotFound)
+	}
+}
+
+func newMachineTestAuthManager(url, credentialFile string) *AuthManager {
+	cfg := &Config{}
+	cfg.Supabase.URL = url
+	cfg.Auth.MachineName = "fallback-name"
+	am := NewAuthManager(cfg)
+	am.machines = &fileSessionStore{path: credentialFile, key: make([]byte, 32)}
+	return am
+}
+
+func TestMachineDeviceCodeRegistration(t *testing.T) {
+	srv := &machineAuthServer{approveOn: 2}
+	server := httptest.NewServer(srv)
+	defer server.Close()
+	credentialFile := filepath.Join(t.TempDir(), "machine.dat")
+
+	am := newMachineTestAuthManager(server.URL, credentialFile)
+	dc, err := am.RequestDeviceCode("render-01")
+	if err != nil || dc.UserCode != "ABCD-EFGH" {
+		t.Fatalf("RequestDeviceCode: %+v (err %v)", dc, err)
+	}
+	if err := am.CompleteDeviceCode(dc, nil); err != nil {
+		t.Fatalf("CompleteDeviceCode failed: %v", err)
+	}
+	if srv.polls != 2 || am.AccessToken() != "machine-jwt" {
+		t.Fatalf("Expected approval on the second poll and a machine token (polls %d)", srv.polls)
+	}
+
+	// A restarted daemon signs in headlessly and reports its identity when claiming jobs
+	daemon := newMachineTestAuthManager(server.URL, credentialFile)
+	if err := daemon.ResumeMachine(); err != nil {
+		t.Fatalf("ResumeMachine failed: %v", err)
+	}
+	if id, name := daemon.MachineIdentity(); id != "m-1" || name != "render-01" {
+		t.Fatalf("Unexpected machine identity %s/%s", id, name)
+	}
+	if _, err := NewAPIClient(daemon.config, daemon).PollJobs(5); err != nil {
+		t.Fatalf("PollJobs failed: %v", err)
+	}
+	if srv.pollMachine != "m-1" || srv.pollHeader != "m-1" {
+		t.Fatalf("Expected the machine identity in poll-jobs, got body %q header %q", srv.pollMachine, srv.pollHeader)
+	}
+
+	if err := daemon.UnregisterMachine(); err != nil {
+		t.Fatalf("UnregisterMachine failed: %v", err)
+	}
+	if srv.revokes != 1 || daemon.AccessToken() != "" {
+		t.Fatalf("Expected the key to be revoked and the daemon signed out (revokes %d)", srv.revokes)
+	}
+	if err := daemon.ResumeMachine(); !errors.Is(err, errNoStoredSession) {
+		t.Fatalf("Expected no machine credential after unregistering, got %v", err)
+	}
+}
+
+func TestMachineCredentialRevoked(t *testing.T) {
+	srv := &machineAuthServer{}
+	server := httptest.NewServer(srv)
+	defer server.Close()
+	credentialFile := filepath.Join(t.TempDir(), "machine.dat")
+
+	am := newMachineTestAuthManager(server.URL, credentialFile)
+	if err := am.RegisterMachineKey("m-1", "wrong-key", ""); !errors.Is(err, errSessionRejected) {
+		t.Fatalf("Expected a wrong key to be rejected, got %v", err)
+	}
+	if _, err := am.machines.Load(); !errors.Is(err, errNoStoredSession) {
+		t.Fatalf("A rejected key must not be saved, got %v", err)
+	}
+	if err := am.RegisterMachineKey("m-1", "key-1", ""); err != nil {
+		t.Fatalf("RegisterMachineKey failed: %v", err)
+	}
+	if _, name := am.MachineIdentity(); name != "fallback-name" {
+		t.Fatalf("Expected the configured machine name, got %q", name)
+	}
+
+	// Revoking the key in the web app signs the machine out on its next refresh
+	lost := make(chan error, 1)
+	am.Subscribe(func(ev AuthEvent) {
+		if ev.Type == AuthLost {
+			lost <- ev.Err
+		}
+	})
+	srv.mu.Lock()
+	srv.revoked = true
+	srv.mu.Unlock()
+	if err := am.RefreshToken(); !errors.Is(err, errSessionRejected) {
+		t.Fatalf("Expected errSessionRejected, got %v", err)
+	}
+	if err := <-lost; !errors.Is(err, errSessionRejected) {
+		t.Fatalf("Expected an AuthLost event, got %v", err)
+	}
+	if id, _ := am.MachineIdentity(); id != "" || am.EnsureValidToken() == nil {
+		t.Fatalf("Expected the machine to be signed out")
+	}
+}
+
+func TestMachineRefreshLeavesUserSession(t *testing.T) {
+	server := httptest.NewServer(&machineAuthServer{})
+	defer server.Close()
+	dir := t.TempDir()
+
+	am := newMachineTestAuthManager(server.URL, filepath.Join(dir, "machine.dat"))
+	am.store = &fileSessionStore{path: filepath.Join(dir, "session.dat"), key: make([]byte, 32)}
+	user := &StoredSession{Email: "user@example.com", RefreshToken: "user-refresh", SavedAt: time.Now().UTC().Truncate(time.Second)}
+	if err := am.store.Save(user); err != nil {
+		t.Fatalf("save user session: %v", err)
+	}
+
+	if err := am.RegisterMachineKey("m-1", "key-1", "render-01"); err != nil {
+		t.Fatalf("RegisterMachineKey failed: %v", err)
+	}
+	if err := am.RefreshToken(); err != nil {
+		t.Fatalf("RefreshToken failed: %v", err)
+	}
+	am.mu.RLock()
+	refreshToken := am.refreshToken
+	am.mu.RUnlock()
+	if refreshToken != "" {
+		t.Fatalf("Expected no refresh token for a machine session, got %q", refreshToken)
+	}
+	stored, err := am.store.Load()
+	if err != nil || stored.Email != user.Email || stored.RefreshToken != user.RefreshToken {
+		t.Fatalf("Expected the user session untouched, got %+v (err %v)", stored, err)
+	}
+}
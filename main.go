@@ -6,6 +6,11 @@ import (
 )
 
 func main() {
+	// Command-line subcommands run without the GUI
+	if len(os.Args) > 1 {
+		os.Exit(runCLI(os.Args[1:]))
+	}
+
 	// Create and run the GUI application
 	gui := NewGUI()
 
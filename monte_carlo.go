@@ -0,0 +1,212 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+)
+
+// distributionPercentiles are the percentiles reported for every DistributionSummary
+var distributionPercentiles = []float64{5, 25, 50, 75, 95}
+
+// PercentileValue is a single point of a distribution
+type PercentileValue struct {
+	Percentile float64 `json:"percentile"`
+	Value      float64 `json:"value"`
+}
+
+// DistributionSummary summarizes a set of values (simulation results, trade excursions, ...)
+type DistributionSummary struct {
+	Mean        float64           `json:"mean"`
+	Min         float64           `json:"min"`
+	Max         float64           `json:"max"`
+	Percentiles []PercentileValue `json:"percentiles"`
+}
+
+// MonteCarloPathBand is the equity at one percentile after each simulated trade
+type MonteCarloPathBand struct {
+	Percentile float64   `json:"percentile"`
+	Equity     []float64 `json:"equity"`
+}
+
+// MonteCarloResult holds the simulation settings and the resulting distributions
+type MonteCarloResult struct {
+	TestType          string               `json:"test_type"`
+	Mode              string               `json:"mode"`
+	Iterations        int                  `json:"iterations"`
+	Seed              int64                `json:"seed"`
+	Trades            int                  `json:"trades"`
+	SkipProbability   float64              `json:"skip_probability"`
+	SlippageJitter    float64              `json:"slippage_jitter"`
+	RuinDrawdownPct   float64              `json:"ruin_drawdown_pct"`
+	InitialCapital    float64              `json:"initial_capital"`
+	EndingEquity      DistributionSummary  `json:"ending_equity"`
+	MaxDrawdown       DistributionSummary  `json:"max_drawdown"`
+	MaxDrawdownPct    DistributionSummary  `json:"max_drawdown_pct"`
+	ProbabilityOfRuin float64              `json:"probability_of_ruin"`
+	EquityBands       []MonteCarloPathBand `json:"equity_bands"`
+}
+
+// runMonteCarlo simulates alternative trade sequences from the given trades.
+// "resample" draws trades with replacement (bootstrap), "shuffle" reorders the original trades.
+// Each simulated trade may be skipped and may pay extra slippage drawn uniformly from
+// [0, SlippageJitter] per contract. Results are reproducible for a given seed.
+func runMonteCarlo(trades []TradeRecord, initialCapital float64, cfg MonteCarloConfig) (*MonteCarloResult, error) {
+	if len(trades) == 0 {
+		return nil, fmt.Errorf("no trades to simulate")
+	}
+	if cfg.Iterations <= 0 {
+		return nil, fmt.Errorf("invalid iteration count: %d", cfg.Iterations)
+	}
+	mode := cfg.Mode
+	if mode == "" {
+		mode = "resample"
+	}
+	if mode != "resample" && mode != "shuffle" {
+		return nil, fmt.Errorf("unknown Monte Carlo mode: %s", mode)
+	}
+
+	// Original trade order (by exit time) is the basis for both modes
+	ordered := make([]TradeRecord, len(trades))
+	copy(ordered, trades)
+	sort.SliceStable(ordered, func(i, j int) bool { return ordered[i].Timestamp.Before(ordered[j].Timestamp) })
+	pnls := make([]float64, len(ordered))
+	contracts := make([]float64, len(ordered))
+	for i, trade := range ordered {
+		pnls[i] = tradeNetPnL(trade)
+		contracts[i] = math.Max(1, math.Abs(float64(trade.Quantity)))
+	}
+
+	rng := rand.New(rand.NewSource(cfg.Seed))
+	n := len(pnls)
+	endings := make([]float64, cfg.Iterations)
+	drawdowns := make([]float64, cfg.Iterations)
+	drawdownPcts := make([]float64, cfg.Iterations)
+	paths := make([][]float64, n) // paths[step][iteration]
+	for step := range paths {
+		paths[step] = make([]float64, cfg.Iterations)
+	}
+	ruined := 0
+	order := make([]int, n)
+
+	for iter := 0; iter < cfg.Iterations; iter++ {
+		if mode == "shuffle" {
+			for i := range order {
+				order[i] = i
+			}
+			rng.Shuffle(n, func(i, j int) { order[i], order[j] = order[j], order[i] })
+		} else {
+			for i := range order {
+				order[i] = rng.Intn(n)
+			}
+		}
+
+		equity := initialCapital
+		peak := initialCapital
+		maxDD, maxDDPct := 0.0, 0.0
+		isRuined := false
+		for step, idx := range order {
+			if cfg.SkipProbability <= 0 || rng.Float64() >= cfg.SkipProbability {
+				pnl := pnls[idx]
+				if cfg.SlippageJitter > 0 {
+					pnl -= rng.Float64() * cfg.SlippageJitter * contracts[idx]
+				}
+				equity += pnl
+			}
+
+			if equity > peak {
+				peak = equity
+			}
+			if dd := peak - equity; dd > maxDD {
+				maxDD = dd
+			}
+			if peak > 0 {
+				if ddPct := (peak - equity) / peak; ddPct > maxDDPct {
+					maxDDPct = ddPct
+				}
+			}
+			if equity <= 0 || (cfg.RuinDrawdownPct > 0 && maxDDPct >= cfg.RuinDrawdownPct) {
+				isRuined = true
+			}
+			paths[step][iter] = equity
+		}
+
+		endings[iter] = equity
+		drawdowns[iter] = maxDD
+		drawdownPcts[iter] = maxDDPct
+		if isRuined {
+			ruined++
+		}
+	}
+
+	result := &MonteCarloResult{
+		Mode:              mode,
+		Iterations:        cfg.Iterations,
+		Seed:              cfg.Seed,
+		Trades:            n,
+		SkipProbability:   cfg.SkipProbability,
+		SlippageJitter:    cfg.SlippageJitter,
+		RuinDrawdownPct:   cfg.RuinDrawdownPct,
+		InitialCapital:    initialCapital,
+		EndingEquity:      summarizeDistribution(endings),
+		MaxDrawdown:       summarizeDistribution(drawdowns),
+		MaxDrawdownPct:    summarizeDistribution(drawdownPcts),
+		ProbabilityOfRuin: float64(ruined) / float64(cfg.Iterations),
+	}
+
+	for _, p := range distributionPercentiles {
+		result.EquityBands = append(result.EquityBands, MonteCarloPathBand{Percentile: p, Equity: make([]float64, n)})
+	}
+	for step := range paths {
+		sort.Float64s(paths[step])
+		for i, p := range distributionPercentiles {
+			result.EquityBands[i].Equity[step] = percentileOfSorted(paths[step], p)
+		}
+	}
+
+	return result, nil
+}
+
+// summarizeDistribution sorts the values and reports mean, min, max and the standard percentiles
+func summarizeDistribution(values []float64) DistributionSummary {
+	sorted := make([]float64, len(values))
+	copy(sorted, values)
+	sort.Float64s(sorted)
+
+	var dist DistributionSummary
+	if len(sorted) == 0 {
+		return dist
+	}
+	for _, v := range sorted {
+		dist.Mean += v
+	}
+	dist.Mean /= float64(len(sorted))
+	dist.Min = sorted[0]
+	dist.Max = sorted[len(sorted)-1]
+	for _, p := range distributionPercentiles {
+		dist.Percentiles = append(dist.Percentiles, PercentileValue{Percentile: p, Value: percentileOfSorted(sorted, p)})
+	}
+	return dist
+}
+
+// percentileOfSorted returns the p-th percentile (0-100) of sorted values using linear interpolation
+func percentileOfSorted(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	if len(sorted) == 1 {
+		return sorted[0]
+	}
+	rank := p / 100 * float64(len(sorted)-1)
+	lo := int(math.Floor(rank))
+	hi := int(math.Ceil(rank))
+	if lo < 0 {
+		lo = 0
+	}
+	if hi >= len(sorted) {
+		hi = len(sorted) - 1
+	}
+	frac := rank - float64(lo)
+	return sorted[lo] + (sorted[hi]-sorted[lo])*frac
+}
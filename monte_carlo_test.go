@@ -0,0 +1,143 @@
+package main
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// monteCarloTrades builds trades one day apart with the given net results and one contract each
+func monteCarloTrades(pnls ...float64) []TradeRecord {
+	trades := make([]TradeRecord, len(pnls))
+	for i, pnl := range pnls {
+		trades[i] = TradeRecord{PnL: pnl, Quantity: 1, Timestamp: time.Date(2020, 1, 1+i, 16, 0, 0, 0, time.UTC)}
+	}
+	return trades
+}
+
+func TestMonteCarloShuffleKeepsFinalEquity(t *testing.T) {
+	trades := monteCarloTrades(300, -200, 150, -400, 500, -100)
+	trades[0].Commission = 10 // Net of commission, like the equity curve
+	result, err := runMonteCarlo(trades, 10000, MonteCarloConfig{Iterations: 200, Seed: 42, Mode: "shuffle"})
+	if err != nil {
+		t.Fatalf("runMonteCarlo failed: %v", err)
+	}
+	want := 10000.0 + 250 - 10
+	if result.EndingEquity.Min != want || result.EndingEquity.Max != want {
+		t.Fatalf("Expected every shuffle to end at %v, got %+v", want, result.EndingEquity)
+	}
+	// Drawdowns do depend on the order
+	if result.MaxDrawdown.Min >= result.MaxDrawdown.Max {
+		t.Fatalf("Expected drawdowns to vary between orders, got %+v", result.MaxDrawdown)
+	}
+	if len(result.EquityBands) != len(distributionPercentiles) || len(result.EquityBands[0].Equity) != len(trades) {
+		t.Fatalf("Unexpected equity bands %+v", result.EquityBands)
+	}
+}
+
+func TestMonteCarloRuin(t *testing.T) {
+	tests := []struct {
+		name    string
+		pnls    []float64
+		ruinPct float64
+		want    float64
+	}{
+		{"losses exhaust the capital", []float64{-100, -100, -100, -100, -100, -100}, 0, 1},
+		{"losses breach the ruin drawdown", []float64{-100, -100, -100}, 0.25, 1},
+		{"losses stay above the ruin drawdown", []float64{-100, -100, -100}, 0.7, 0},
+		{"only winners", []float64{100, 200, 50}, 0.1, 0},
+	}
+	for _, tt := range tests {
+		result, err := runMonteCarlo(monteCarloTrades(tt.pnls...), 500, MonteCarloConfig{
+			Iterations: 100, Seed: 7, Mode: "shuffle", RuinDrawdownPct: tt.ruinPct,
+		})
+		if err != nil {
+			t.Fatalf("%s: runMonteCarlo failed: %v", tt.name, err)
+		}
+		if result.ProbabilityOfRuin != tt.want {
+			t.Fatalf("%s: expected probability of ruin %v, got %v", tt.name, tt.want, result.ProbabilityOfRuin)
+		}
+	}
+}
+
+func TestMonteCarloResample(t *testing.T) {
+	trades := monteCarloTrades(400, -250, 120, -80, 310, -500, 90, 60)
+	cfg := MonteCarloConfig{Iterations: 500, Seed: 42, Mode: "resample"}
+	result, err := runMonteCarlo(trades, 10000, cfg)
+	if err != nil {
+		t.Fatalf("runMonteCarlo failed: %v", err)
+	}
+
+	// The same seed reproduces the same simulation
+	again, _ := runMonteCarlo(trades, 10000, cfg)
+	if !reflect.DeepEqual(result, again) {
+		t.Fatalf("Expected identical results for the same seed")
+	}
+
+	for _, dist := range []DistributionSummary{result.EndingEquity, result.MaxDrawdown, result.MaxDrawdownPct} {
+		prev := dist.Min
+		for _, p := range dist.Percentiles {
+			if p.Value < prev {
+				t.Fatalf("Percentiles out of order: %+v", dist)
+			}
+			prev = p.Value
+		}
+		if prev > dist.Max || dist.Mean < dist.Min || dist.Mean > dist.Max {
+			t.Fatalf("Inconsistent distribution %+v", dist)
+		}
+	}
+	for step := range trades {
+		for i := 1; i < len(result.EquityBands); i++ {
+			if result.EquityBands[i].Equity[step] < result.EquityBands[i-1].Equity[step] {
+				t.Fatalf("Equity bands out of order at step %d", step)
+			}
+		}
+	}
+	if result.EndingEquity.Min == result.EndingEquity.Max {
+		t.Fatalf("Expected resampling to vary the ending equity")
+	}
+}
+
+func TestMonteCarloSkipAndJitter(t *testing.T) {
+	trades := monteCarloTrades(100, 100, 100, 100)
+	trades[2].Quantity = -3 // Jitter is per contract, for short positions too
+
+	result, err := runMonteCarlo(trades, 1000, MonteCarloConfig{Iterations: 50, Seed: 1, Mode: "shuffle", SkipProbability: 1})
+	if err != nil {
+		t.Fatalf("runMonteCarlo failed: %v", err)
+	}
+	if result.EndingEquity.Min != 1000 || result.EndingEquity.Max != 1000 {
+		t.Fatalf("Expected all trades skipped, got %+v", result.EndingEquity)
+	}
+
+	result, err = runMonteCarlo(trades, 1000, MonteCarloConfig{Iterations: 200, Seed: 1, Mode: "shuffle", SlippageJitter: 10})
+	if err != nil {
+		t.Fatalf("runMonteCarlo failed: %v", err)
+	}
+	// At most 10 per contract on 1+1+3+1 contracts
+	if result.EndingEquity.Max > 1400 || result.EndingEquity.Min < 1400-60 || result.EndingEquity.Mean >= 1400 {
+		t.Fatalf("Unexpected jittered ending equity %+v", result.EndingEquity)
+	}
+}
+
+func TestMonteCarloInvalidInput(t *testing.T) {
+	if _, err := runMonteCarlo(nil, 1000, MonteCarloConfig{Iterations: 10}); err == nil {
+		t.Fatalf("Expected an error without trades")
+	}
+	if _, err := runMonteCarlo(monteCarloTrades(1), 1000, MonteCarloConfig{Iterations: 0}); err == nil {
+		t.Fatalf("Expected an error for zero iterations")
+	}
+	if _, err := runMonteCarlo(monteCarloTrades(1), 1000, MonteCarloConfig{Iterations: 10, Mode: "bootstrap"}); err == nil {
+		t.Fatalf("Expected an error for an unknown mode")
+	}
+}
+
+func TestPercentileOfSorted(t *testing.T) {
+	sorted := []float64{0, 10, 20, 30, 40}
+	for p, want := range map[float64]float64{0: 0, 25: 10, 50: 20, 90: 36, 100: 40} {
+		if got := percentileOfSorted(sorted, p); math.Abs(got-want) > 1e-9 {
+			t.Fatalf("percentile %v: expected %v, got %v", p, want, got)
+		}
+	}
+}
@@ -0,0 +1,385 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TimeframeResult is one timeframe's performance on the metric set used for ranking
+type TimeframeResult struct {
+	Timeframe         string  `json:"timeframe"`
+	Source            string  `json:"source"` // trades CSV or daily summary file used
+	Trades            int     `json:"trades"`
+	NetProfit         float64 `json:"net_profit"`
+	MaxDrawdown       float64 `json:"max_drawdown"`       // currency (>= 0)
+	NetProfitDrawdown float64 `json:"netprofit_drawdown"` // NP/DD, 0 without a drawdown
+	Sharpe            float64 `json:"sharpe"`
+	Sortino           float64 `json:"sortino"`
+	Calmar            float64 `json:"calmar"`
+	ProfitFactor      float64 `json:"profit_factor"` // 0 when built from a daily summary
+	WinRate           float64 `json:"win_rate"`
+	AverageRank       float64 `json:"average_rank"` // mean rank over the ranking metrics (1 = best)
+	Rank              int     `json:"rank"`
+}
+
+// TimeframeRobustness measures how consistently the strategy performs across timeframes
+type TimeframeRobustness struct {
+	Timeframes         int     `json:"timeframes"`
+	ProfitableShare    float64 `json:"profitable_share"` // fraction of timeframes with a positive net profit
+	NPDDMean           float64 `json:"npdd_mean"`
+	NPDDStdDev         float64 `json:"npdd_std_dev"`
+	NPDDDispersion     float64 `json:"npdd_dispersion"` // coefficient of variation: std / |mean|
+	SharpeRange        float64 `json:"sharpe_range"`    // best minus worst Sharpe
+	AverageCorrelation float64 `json:"average_correlation"`
+	Score              float64 `json:"score"` // 0-100, see timeframeRobustness
+}
+
+// MTFConsolidatedReport is the single report emitted per MTF job
+type MTFConsolidatedReport struct {
+	JobID          string                     `json:"job_id"`
+	Symbol         string                     `json:"symbol"`
+	GeneratedAt    string                     `json:"generated_at"`
+	InitialCapital float64                    `json:"initial_capital"`
+	RankingMetrics []string                   `json:"ranking_metrics"`
+	BestTimeframe  string                     `json:"best_timeframe"`
+	Timeframes     []TimeframeResult          `json:"timeframes"` // best first
+	Robustness     TimeframeRobustness        `json:"robustness"`
+	EquityCurves   map[string]EquityCurveData `json:"equity_curves"`
+}
+
+// timeframeRankingMetrics are the metrics every timeframe is ranked on (higher is better)
+var timeframeRankingMetrics = []struct {
+	name  string
+	value func(TimeframeResult) float64
+}{
+	{"net_profit", func(r TimeframeResult) float64 { return r.NetProfit }},
+	{"netprofit_drawdown", func(r TimeframeResult) float64 { return r.NetProfitDrawdown }},
+	{"sharpe", func(r TimeframeResult) float64 { return r.Sharpe }},
+	{"sortino", func(r TimeframeResult) float64 { return r.Sortino }},
+	{"calmar", func(r TimeframeResult) float64 { return r.Calmar }},
+}
+
+// consolidateTimeframes builds an equity curve per timeframe, ranks the timeframes and scores robustness
+func (ac *APIClient) consolidateTimeframes(jobID, symbol string, series []symbolDailyPnL, initialCapital float64) (*MTFConsolidatedReport, error) {
+	if len(series) == 0 {
+		return nil, fmt.Errorf("no timeframe results to consolidate")
+	}
+	if initialCapital <= 0 {
+		initialCapital = defaultInitialCapital
+	}
+
+	report := &MTFConsolidatedReport{
+		JobID:          jobID,
+		Symbol:         symbol,
+		GeneratedAt:    time.Now().UTC().Format(time.RFC3339),
+		InitialCapital: initialCapital,
+		EquityCurves:   make(map[string]EquityCurveData),
+	}
+	for _, metric := range timeframeRankingMetrics {
+		report.RankingMetrics = append(report.RankingMetrics, metric.name)
+	}
+
+	dailyByTimeframe := make(map[string]map[string]float64, len(series))
+	for _, s := range series {
+		dates := make([]string, 0, len(s.Daily))
+		for date := range s.Daily {
+			dates = append(dates, date)
+		}
+		sort.Strings(dates)
+		dailyPnL := make([]float64, len(dates))
+		for i, date := range dates {
+			dailyPnL[i] = s.Daily[date]
+		}
+
+		curve := EquityCurveData{
+			TaskType:       "MTF",
+			TestType:       "MTF",
+			Symbol:         symbol,
+			Timeframe:      s.Timeframe,
+			Run:            "Combined",
+			ProjectID:      ac.projectID(),
+			JobID:          jobID,
+			InitialCapital: initialCapital,
+		}
+		if len(dates) > 0 {
+			curve.StartDate = dates[0]
+			curve.EndDate = dates[len(dates)-1]
+		}
+		ac.populateEquityCurve(&curve, dates, dailyPnL, s.Trades, initialCapital)
+		report.EquityCurves[fmt.Sprintf("%s-%s", symbol, s.Timeframe)] = curve
+		dailyByTimeframe[s.Timeframe] = s.Daily
+
+		m := curve.Metrics
+		result := TimeframeResult{
+			Timeframe:    s.Timeframe,
+			Source:       s.Source,
+			Trades:       len(s.Trades),
+			MaxDrawdown:  m.MaxDrawdown,
+			Sharpe:       m.Sharpe,
+			Sortino:      m.Sortino,
+			Calmar:       m.Calmar,
+			ProfitFactor: m.ProfitFactor,
+			WinRate:      m.WinRate,
+		}
+		for _, v := range dailyPnL {
+			result.NetProfit += v
+		}
+		if result.MaxDrawdown > 0 {
+			result.NetProfitDrawdown = result.NetProfit / result.MaxDrawdown
+		}
+		report.Timeframes = append(report.Timeframes, result)
+	}
+
+	rankTimeframes(report.Timeframes)
+	report.BestTimeframe = report.Timeframes[0].Timeframe
+	report.Robustness = timeframeRobustness(report.Timeframes, dailyByTimeframe)
+	return report, nil
+}
+
+// rankTimeframes ranks the timeframes on each metric (ties share the better rank), averages the
+// ranks and sorts best first. Equal average ranks are broken by NP/DD.
+func rankTimeframes(results []TimeframeResult) {
+	n := len(results)
+	rankSums := make([]float64, n)
+	for _, metric := range timeframeRankingMetrics {
+		for i := range results {
+			better := 0
+			for j := range results {
+				if metric.value(results[j]) > metric.value(results[i]) {
+					better++
+				}
+			}
+			rankSums[i] += float64(better + 1)
+		}
+	}
+	for i := range results {
+		results[i].AverageRank = rankSums[i] / float64(len(timeframeRankingMetrics))
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].AverageRank != results[j].AverageRank {
+			return results[i].AverageRank < results[j].AverageRank
+		}
+		return results[i].NetProfitDrawdown > results[j].NetProfitDrawdown
+	})
+	for i := range results {
+		results[i].Rank = i + 1
+	}
+}
+
+// timeframeRobustness scores consistency across timeframes:
+// score = 100 * profitable share / (1 + NP/DD dispersion), and 0 when the mean NP/DD is not positive.
+// A strategy that is profitable on every timeframe with similar NP/DD scores close to 100.
+func timeframeRobustness(results []TimeframeResult, dailyByTimeframe map[string]map[string]float64) TimeframeRobustness {
+	r := TimeframeRobustness{Timeframes: len(results)}
+	if len(results) == 0 {
+		return r
+	}
+
+	profitable := 0
+	npdd := make([]float64, len(results))
+	minSharpe, maxSharpe := results[0].Sharpe, results[0].Sharpe
+	for i, result := range results {
+		if result.NetProfit > 0 {
+			profitable++
+		}
+		npdd[i] = result.NetProfitDrawdown
+		r.NPDDMean += npdd[i]
+		minSharpe = math.Min(minSharpe, result.Sharpe)
+		maxSharpe = math.Max(maxSharpe, result.Sharpe)
+	}
+	r.ProfitableShare = float64(profitable) / float64(len(results))
+	r.NPDDMean /= float64(len(results))
+	r.NPDDStdDev = sampleStdDev(npdd)
+	if r.NPDDMean != 0 {
+		r.NPDDDispersion = r.NPDDStdDev / math.Abs(r.NPDDMean)
+	}
+	r.SharpeRange = maxSharpe - minSharpe
+
+	// Correlation of daily P&L between timeframes, aligned on the union of dates
+	dateSet := make(map[string]bool)
+	for _, daily := range dailyByTimeframe {
+		for date := range daily {
+			dateSet[date] = true
+		}
+	}
+	dates := make([]string, 0, len(dateSet))
+	for date := range dateSet {
+		dates = append(dates, date)
+	}
+	sort.Strings(dates)
+	aligned := make([][]float64, len(results))
+	for i, result := range results {
+		aligned[i] = make([]float64, len(dates))
+		for j, date := range dates {
+			aligned[i][j] = dailyByTimeframe[result.Timeframe][date]
+		}
+	}
+	pairSum, pairs := 0.0, 0
+	for i := range aligned {
+		for j := i + 1; j < len(aligned); j++ {
+			pairSum += pearsonCorrelation(aligned[i], aligned[j])
+			pairs++
+		}
+	}
+	if pairs > 0 {
+		r.AverageCorrelation = pairSum / float64(pairs)
+	}
+
+	if r.NPDDMean > 0 {
+		r.Score = 100 * r.ProfitableShare / (1 + r.NPDDDispersion)
+	}
+	return r
+}
+
+// MTFConsolidator waits for all timeframes of expanded MTF jobs to report back and uploads one consolidated report
+type MTFConsolidator struct {
+	config    *Config
+	api       *APIClient
+	mutex     sync.Mutex
+	isRunning bool
+	stopCh    chan struct{}
+	logf      func(string)
+}
+
+// NewMTFConsolidator creates a new MTFConsolidator
+func NewMTFConsolidator(config *Config, api *APIClient) *MTFConsolidator {
+	return &MTFConsolidator{
+		config: config,
+		api:    api,
+		logf:   func(s string) {}, // default no-op logger
+	}
+}
+
+// SetLogger sets the logging function
+func (mc *MTFConsolidator) SetLogger(fn func(string)) {
+	if fn != nil {
+		mc.logf = fn
+	}
+}
+
+// Start begins checking pending MTF manifests
+func (mc *MTFConsolidator) Start() error {
+	mc.mutex.Lock()
+	defer mc.mutex.Unlock()
+
+	if mc.isRunning {
+		return nil
+	}
+
+	mc.isRunning = true
+	mc.stopCh = make(chan struct{})
+	mc.logf("MTF consolidation started")
+
+	go mc.monitorManifests()
+	return nil
+}
+
+// Stop stops checking manifests
+func (mc *MTFConsolidator) Stop() {
+	mc.mutex.Lock()
+	defer mc.mutex.Unlock()
+
+	if !mc.isRunning {
+		return
+	}
+	mc.isRunning = false
+	close(mc.stopCh)
+	mc.logf("MTF consolidation stopped")
+}
+
+// monitorManifests periodically consolidates MTF jobs whose timeframes have all reported
+func (mc *MTFConsolidator) monitorManifests() {
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-mc.stopCh:
+			return
+		case <-ticker.C:
+			if err := mc.processManifests(); err != nil {
+				mc.logf(fmt.Sprintf("Error processing MTF manifests: %v", err))
+			}
+		}
+	}
+}
+
+// processManifests consolidates every pending MTF manifest that is complete
+func (mc *MTFConsolidator) processManifests() error {
+	manifests, err := loadJobManifests(mc.config.Folders.Files.Jobs.Manifests)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range manifests {
+		if m.Status != ManifestPending || m.TaskType != "MTF" || len(m.Symbols) == 0 {
+			continue
+		}
+		series, complete := mc.collectTimeframeResults(m)
+		if !complete {
+			continue // still waiting for results
+		}
+		if err := mc.consolidate(m, series); err != nil {
+			mc.logf(fmt.Sprintf("MTF consolidation failed for job %s: %v", m.JobID, err))
+		}
+	}
+	return nil
+}
+
+// collectTimeframeResults reads each timeframe's daily P&L; complete is false while any is missing
+func (mc *MTFConsolidator) collectTimeframeResults(m *JobManifest) ([]symbolDailyPnL, bool) {
+	var series []symbolDailyPnL
+	for _, timeframe := range m.Timeframes {
+		s, ok := loadResultSeries(mc.config, m.JobID, m.Symbols[0], timeframe, mc.logf)
+		if !ok {
+			return nil, false
+		}
+		series = append(series, *s)
+	}
+	return series, true
+}
+
+// consolidate builds, saves and uploads the report for a complete manifest, then marks it done
+func (mc *MTFConsolidator) consolidate(m *JobManifest, series []symbolDailyPnL) error {
+	symbol := m.Symbols[0]
+	report, err := mc.api.consolidateTimeframes(m.JobID, symbol, series, m.InitialCapital)
+	if err != nil {
+		return fmt.Errorf("consolidate timeframes: %w", err)
+	}
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal MTF report: %w", err)
+	}
+	fileName := fmt.Sprintf("%s_%s_%s_MTF_CONSOLIDATED_Daily.rep", m.JobID, symbol, strings.Join(m.Timeframes, "-"))
+	path := filepath.Join(mc.config.Folders.Files.Results.Consolidated, fileName)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("create consolidated directory: %w", err)
+	}
+	if err := writeFileAtomic(path, data, 0644); err != nil {
+		return fmt.Errorf("write MTF report: %w", err)
+	}
+
+	mc.logf(fmt.Sprintf("Uploading MTF consolidated report for job %s (%d timeframes)", m.JobID, len(series)))
+	if _, err := mc.api.UploadDailySummary(path, m.JobID); err != nil {
+		return fmt.Errorf("upload MTF report: %w", err)
+	}
+
+	m.Status = ManifestAggregated
+	m.CompletedAt = time.Now().UTC().Format(time.RFC3339)
+	m.OutputFile = fileName
+	if err := saveJobManifest(mc.config.Folders.Files.Jobs.Manifests, m); err != nil {
+		return fmt.Errorf("update manifest: %w", err)
+	}
+	mc.logf(fmt.Sprintf("MTF report for job %s uploaded: best timeframe %s, robustness score %.1f",
+		m.JobID, report.BestTimeframe, report.Robustness.Score))
+	return nil
+}
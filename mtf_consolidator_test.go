@@ -0,0 +1,66 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestConsolidateTimeframes(t *testing.T) {
+	series := []symbolDailyPnL{
+		// 60: steady gains with a small drawdown
+		{Timeframe: "60", Daily: map[string]float64{"2020-01-02": 300, "2020-01-03": -100, "2020-01-06": 400}},
+		// 120: smaller gains, deeper drawdown
+		{Timeframe: "120", Daily: map[string]float64{"2020-01-02": 200, "2020-01-03": -300, "2020-01-06": 300}},
+		// 240: losing
+		{Timeframe: "240", Daily: map[string]float64{"2020-01-02": -200, "2020-01-03": 100, "2020-01-06": -100}},
+	}
+
+	ac := &APIClient{}
+	report, err := ac.consolidateTimeframes("job1", "@ES", series, 10000)
+	if err != nil {
+		t.Fatalf("consolidateTimeframes failed: %v", err)
+	}
+
+	if report.BestTimeframe != "60" {
+		t.Fatalf("Expected 60 to rank best, got %s (%+v)", report.BestTimeframe, report.Timeframes)
+	}
+	if last := report.Timeframes[len(report.Timeframes)-1]; last.Timeframe != "240" || last.Rank != 3 {
+		t.Fatalf("Expected 240 to rank last, got %+v", last)
+	}
+	if len(report.EquityCurves) != 3 {
+		t.Fatalf("Expected one curve per timeframe, got %d", len(report.EquityCurves))
+	}
+	if npdd := report.Timeframes[0].NetProfitDrawdown; math.Abs(npdd-6) > 1e-9 {
+		t.Fatalf("Expected NP/DD 6 for 60, got %v", npdd)
+	}
+
+	r := report.Robustness
+	if math.Abs(r.ProfitableShare-2.0/3.0) > 1e-9 {
+		t.Fatalf("Expected 2/3 profitable timeframes, got %v", r.ProfitableShare)
+	}
+	if r.Score <= 0 || r.Score >= 100*r.ProfitableShare {
+		t.Fatalf("Expected a score between 0 and %v, got %v", 100*r.ProfitableShare, r.Score)
+	}
+}
+
+func TestRankTimeframesTies(t *testing.T) {
+	results := []TimeframeResult{
+		{Timeframe: "60", NetProfit: 100, NetProfitDrawdown: 1},
+		{Timeframe: "120", NetProfit: 100, NetProfitDrawdown: 2},
+	}
+	rankTimeframes(results)
+	if results[0].Timeframe != "120" || results[0].Rank != 1 || results[1].Rank != 2 {
+		t.Fatalf("Expected 120 first on NP/DD, got %+v", results)
+	}
+}
+
+func TestTimeframeRobustnessAllLosing(t *testing.T) {
+	results := []TimeframeResult{
+		{Timeframe: "60", NetProfit: -100, NetProfitDrawdown: -0.5},
+		{Timeframe: "120", NetProfit: -50, NetProfitDrawdown: -0.2},
+	}
+	r := timeframeRobustness(results, nil)
+	if r.ProfitableShare != 0 || r.Score != 0 {
+		t.Fatalf("Expected zero robustness for losing timeframes, got %+v", r)
+	}
+}
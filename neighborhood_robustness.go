@@ -0,0 +1,468 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Neighborhood sampling modes
+const (
+	NeighborhoodSteps = "steps" // one parameter at a time, ±1 and ±2 steps
+	NeighborhoodLHS   = "lhs"   // Latin hypercube sample within ±2 steps of every parameter
+)
+
+// neighborhoodMaxSteps is how far (in OptRange steps) variants move away from the center
+const neighborhoodMaxSteps = 2
+
+// defaultLHSSamples is the number of Latin hypercube variants generated when none is given
+const defaultLHSSamples = 20
+
+// RobustnessVariant is one perturbed parameter set. Run matches the <run> of its job element.
+type RobustnessVariant struct {
+	Run        int                `json:"run"`
+	Offsets    map[string]int     `json:"offsets"` // steps away from the center per parameter
+	Parameters map[string]float64 `json:"parameters"`
+	Metric     *float64           `json:"metric,omitempty"` // filled in by the report
+}
+
+// RobustnessPlan records the variants written to a robustness job so their results can be aggregated later
+type RobustnessPlan struct {
+	JobID     string              `json:"job_id"`
+	Symbol    string              `json:"symbol"`
+	Timeframe string              `json:"timeframe"`
+	Mode      string              `json:"mode"`
+	Seed      int64               `json:"seed,omitempty"`
+	TaskType  string              `json:"task_type"`
+	JobFile   string              `json:"job_file"`
+	Center    map[string]float64  `json:"center"`
+	Steps     map[string]float64  `json:"steps"`
+	Variants  []RobustnessVariant `json:"variants"`
+}
+
+// ParameterNames returns the perturbed parameters in sorted order
+func (p *RobustnessPlan) ParameterNames() []string {
+	names := make([]string, 0, len(p.Center))
+	for name := range p.Center {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ParameterSensitivity is the robustness of one parameter around the center
+type ParameterSensitivity struct {
+	Name        string  `json:"name"`
+	Center      float64 `json:"center"`
+	Step        float64 `json:"step"`
+	Sensitivity float64 `json:"sensitivity"` // fraction of the center metric lost per step away (negative: improves)
+	Score       float64 `json:"score"`       // 0-100, share of the center metric kept two steps away
+}
+
+// RobustnessReport aggregates the results of a robustness job into a surface around the center
+type RobustnessReport struct {
+	JobID           string                 `json:"job_id"`
+	Mode            string                 `json:"mode"`
+	Metric          string                 `json:"metric"`
+	Variants        int                    `json:"variants"`
+	Matched         int                    `json:"matched"`
+	CenterMetric    float64                `json:"center_metric"`
+	ProfitableShare float64                `json:"profitable_share"` // variants with a positive metric
+	WorstRetention  float64                `json:"worst_retention"`  // lowest variant metric / center metric
+	Score           float64                `json:"score"`            // 0-100, average retention of the center metric
+	Parameters      []ParameterSensitivity `json:"parameters"`
+	Surface         []RobustnessVariant    `json:"surface"`
+}
+
+// newRobustnessPlan builds the variants around center (falling back to each OptRange <value>) for the
+// OptRange parameters with a step. samples is only used by NeighborhoodLHS.
+func newRobustnessPlan(jobXML string, center map[string]interface{}, mode string, samples int, seed int64) (*RobustnessPlan, error) {
+	defs, err := parameterDefinitionsFromJobXML(jobXML)
+	if err != nil {
+		return nil, fmt.Errorf("parse parameter definitions: %w", err)
+	}
+
+	plan := &RobustnessPlan{Mode: mode, Center: make(map[string]float64), Steps: make(map[string]float64)}
+	var names []string
+	bounds := make(map[string][2]float64)
+	for _, def := range defs {
+		if !def.IsOptRange() || def.Step <= 0 {
+			continue
+		}
+		value, ok := parameterValueAsFloat(center[def.Name])
+		if !ok {
+			if value, ok = parameterValueAsFloat(def.Value); !ok {
+				return nil, fmt.Errorf("no center value for %s", def.Name)
+			}
+		}
+		names = append(names, def.Name)
+		plan.Center[def.Name] = value
+		plan.Steps[def.Name] = def.Step
+		bounds[def.Name] = [2]float64{math.Min(def.Start, def.End), math.Max(def.Start, def.End)}
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no OptRange parameters with a step to perturb")
+	}
+	sort.Strings(names)
+
+	var offsets []map[string]int
+	switch mode {
+	case NeighborhoodSteps:
+		offsets = stepOffsets(names)
+	case NeighborhoodLHS:
+		if samples <= 0 {
+			samples = defaultLHSSamples
+		}
+		plan.Seed = seed
+		offsets = latinHypercubeOffsets(names, samples, rand.New(rand.NewSource(seed)))
+	default:
+		return nil, fmt.Errorf("unknown neighborhood mode: %s", mode)
+	}
+
+	seen := make(map[string]bool)
+	for _, offset := range offsets {
+		params := make(map[string]float64, len(names))
+		inRange := true
+		for _, name := range names {
+			v := plan.Center[name] + float64(offset[name])*plan.Steps[name]
+			// Round away float noise from the step arithmetic
+			v = math.Round(v*1e9) / 1e9
+			if b := bounds[name]; v < b[0]-1e-9 || v > b[1]+1e-9 {
+				inRange = false
+				break
+			}
+			params[name] = v
+		}
+		key := fmt.Sprint(offset)
+		if !inRange || seen[key] {
+			continue
+		}
+		seen[key] = true
+		plan.Variants = append(plan.Variants, RobustnessVariant{Run: len(plan.Variants) + 1, Offsets: offset, Parameters: params})
+	}
+	return plan, nil
+}
+
+// generateRobustnessJob writes the variants of a job file (.job or .xml, named <job>_<symbol>_<tf>_...)
+// as one robustness job to Jobs.ToDo, submits it and saves its plan next to the fan-out manifests
+func generateRobustnessJob(cfg *Config, ac *APIClient, jobPath string, center map[string]interface{}, mode string, samples int, seed int64, taskType string) (*RobustnessPlan, error) {
+	var originalXML string
+	var err error
+	if strings.EqualFold(filepath.Ext(jobPath), ".job") {
+		originalXML, err = decompressJobFile(jobPath)
+	} else {
+		var data []byte
+		data, err = os.ReadFile(jobPath)
+		originalXML = string(data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read job file: %w", err)
+	}
+
+	parts := strings.Split(strings.TrimSuffix(filepath.Base(jobPath), filepath.Ext(jobPath)), "_")
+	if len(parts) < 3 {
+		return nil, fmt.Errorf("job filename does not contain expected parts: %s", filepath.Base(jobPath))
+	}
+
+	plan, err := newRobustnessPlan(originalXML, center, mode, samples, seed)
+	if err != nil {
+		return nil, err
+	}
+	plan.JobID, plan.Symbol, plan.Timeframe, plan.TaskType = parts[0], parts[1], parts[2], taskType
+	baseName := fmt.Sprintf("%s_%s_%s_ROBUST-%d", plan.JobID, plan.Symbol, plan.Timeframe, len(plan.Variants))
+	plan.JobFile = baseName + ".job"
+
+	xmlContent, err := buildRobustnessJobXML(originalXML, plan)
+	if err != nil {
+		return nil, fmt.Errorf("build robustness XML: %w", err)
+	}
+	jobFilePath, err := saveDerivedJobXML(cfg.Folders.Files.Jobs.ToDo, baseName, xmlContent)
+	if err != nil {
+		return nil, fmt.Errorf("save robustness job: %w", err)
+	}
+	if err := saveRobustnessPlan(robustnessPlanPath(cfg, plan.JobFile), plan); err != nil {
+		return nil, err
+	}
+	if err := ac.submitDerivedJob(jobFilePath, plan.JobID, taskType); err != nil {
+		return nil, fmt.Errorf("submit robustness job: %w", err)
+	}
+	return plan, nil
+}
+
+// stepOffsets returns the center followed by ±1 and ±2 steps of each parameter, one at a time
+func stepOffsets(names []string) []map[string]int {
+	offsets := []map[string]int{zeroOffsets(names)}
+	for _, name := range names {
+		for _, d := range []int{-2, -1, 1, 2} {
+			offset := zeroOffsets(names)
+			offset[name] = d
+			offsets = append(offsets, offset)
+		}
+	}
+	return offsets
+}
+
+// latinHypercubeOffsets returns the center followed by samples points: every parameter's ±2 step
+// interval is cut into samples strata and each stratum is used exactly once, rounded to whole steps
+func latinHypercubeOffsets(names []string, samples int, rng *rand.Rand) []map[string]int {
+	offsets := []map[string]int{zeroOffsets(names)}
+	perms := make(map[string][]int, len(names))
+	for _, name := range names {
+		perms[name] = rng.Perm(samples)
+	}
+	width := float64(2 * neighborhoodMaxSteps)
+	for i := 0; i < samples; i++ {
+		offset := make(map[string]int, len(names))
+		for _, name := range names {
+			u := (float64(perms[name][i]) + rng.Float64()) / float64(samples)
+			offset[name] = int(math.Round(-neighborhoodMaxSteps + u*width))
+		}
+		offsets = append(offsets, offset)
+	}
+	return offsets
+}
+
+// zeroOffsets returns the center point
+func zeroOffsets(names []string) map[string]int {
+	offset := make(map[string]int, len(names))
+	for _, name := range names {
+		offset[name] = 0
+	}
+	return offset
+}
+
+// buildRobustnessJobXML writes one job element per variant from the first <Job> of the original job
+func buildRobustnessJobXML(originalXML string, plan *RobustnessPlan) (string, error) {
+	match := jobElementPattern.FindStringSubmatch(originalXML)
+	if match == nil {
+		return "", fmt.Errorf("no <Job> element in original job XML")
+	}
+	template := fmt.Sprintf("<Job>%s</Job>", match[1])
+
+	elements := make([]string, 0, len(plan.Variants))
+	for _, variant := range plan.Variants {
+		values := make(map[string]interface{}, len(variant.Parameters))
+		for name, v := range variant.Parameters {
+			values[name] = strconv.FormatFloat(v, 'f', -1, 64)
+		}
+		jobXML, err := fixedJobElement(template, plan.TaskType, plan.JobFile, "", "", variant.Run, values)
+		if err != nil {
+			return "", fmt.Errorf("variant %d: %w", variant.Run, err)
+		}
+		jobXML = addXMLTag(jobXML, "parameter_selection", "neighborhood_"+plan.Mode)
+		jobXML = addXMLTag(jobXML, "parameter_selection_rationale", escapeXMLText(describeOffsets(variant.Offsets)))
+		elements = append(elements, jobXML)
+	}
+	return fmt.Sprintf("<root>\n%s\n</root>", strings.Join(elements, "\n")), nil
+}
+
+// describeOffsets renders offsets as "iFast +1, iSlow -2" ("center" when all are zero)
+func describeOffsets(offsets map[string]int) string {
+	var parts []string
+	for name, d := range offsets {
+		if d != 0 {
+			parts = append(parts, fmt.Sprintf("%s %+d", name, d))
+		}
+	}
+	if len(parts) == 0 {
+		return "center"
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ", ") + " steps"
+}
+
+// robustnessPlanPath returns where the plan of a robustness job is kept
+func robustnessPlanPath(cfg *Config, jobFile string) string {
+	return filepath.Join(cfg.Folders.Files.Jobs.Manifests, strings.TrimSuffix(jobFile, filepath.Ext(jobFile))+"_plan.json")
+}
+
+// saveRobustnessPlan writes the plan as indented JSON
+func saveRobustnessPlan(path string, plan *RobustnessPlan) error {
+	data, err := json.MarshalIndent(plan, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal robustness plan: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("create plan directory: %w", err)
+	}
+	return writeFileAtomic(path, data, 0644)
+}
+
+// loadRobustnessPlan reads a plan written by saveRobustnessPlan
+func loadRobustnessPlan(path string) (*RobustnessPlan, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read robustness plan: %w", err)
+	}
+	var plan RobustnessPlan
+	if err := json.Unmarshal(data, &plan); err != nil {
+		return nil, fmt.Errorf("parse robustness plan: %w", err)
+	}
+	return &plan, nil
+}
+
+// buildRobustnessReport matches result rows to variants (by run number, else by parameter values)
+// and fits each parameter's sensitivity: the relative loss of the metric is regressed on the absolute
+// step offsets of all parameters at once, through the origin.
+func buildRobustnessReport(plan *RobustnessPlan, results *OptimizationResults, metric string) (*RobustnessReport, error) {
+	name, err := results.resolveMetric(metric, optFitnessColumns)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &RobustnessReport{JobID: plan.JobID, Mode: plan.Mode, Metric: name, Variants: len(plan.Variants)}
+	byRun := make(map[int]float64)
+	for _, test := range results.Tests {
+		if v, ok := test.Metrics[name]; ok && test.Run > 0 {
+			byRun[test.Run] = v
+		}
+	}
+
+	var center *float64
+	for _, variant := range plan.Variants {
+		value, ok := byRun[variant.Run]
+		if !ok {
+			value, ok = metricByParameters(results.Tests, variant.Parameters, name)
+		}
+		if ok {
+			v := value
+			variant.Metric = &v
+			report.Matched++
+			if describeOffsets(variant.Offsets) == "center" {
+				center = &v
+			}
+		}
+		report.Surface = append(report.Surface, variant)
+	}
+	if center == nil {
+		return nil, fmt.Errorf("no result for the center parameters (%d of %d variants matched)", report.Matched, len(plan.Variants))
+	}
+	report.CenterMetric = *center
+
+	names := plan.ParameterNames()
+
+	// Relative loss per variant; the scale falls back to 1 when the center metric is zero
+	scale := math.Abs(report.CenterMetric)
+	if scale == 0 {
+		scale = 1
+	}
+	var rows [][]float64
+	var losses []float64
+	var retentionSum float64
+	report.WorstRetention = math.Inf(1)
+	for _, variant := range report.Surface {
+		if variant.Metric == nil {
+			continue
+		}
+		m := *variant.Metric
+		if m > 0 {
+			report.ProfitableShare++
+		}
+		retention := m / scale
+		report.WorstRetention = math.Min(report.WorstRetention, retention)
+		retentionSum += math.Max(0, math.Min(1, retention))
+
+		row := make([]float64, len(names))
+		for i, n := range names {
+			row[i] = math.Abs(float64(variant.Offsets[n]))
+		}
+		rows = append(rows, row)
+		losses = append(losses, (report.CenterMetric-m)/scale)
+	}
+	report.ProfitableShare /= float64(report.Matched)
+	if report.CenterMetric > 0 {
+		report.Score = 100 * retentionSum / float64(report.Matched)
+	}
+
+	coefficients := leastSquaresThroughOrigin(rows, losses, len(names))
+	for i, n := range names {
+		s := coefficients[i]
+		report.Parameters = append(report.Parameters, ParameterSensitivity{
+			Name:        n,
+			Center:      plan.Center[n],
+			Step:        plan.Steps[n],
+			Sensitivity: s,
+			Score:       100 * math.Max(0, math.Min(1, 1-neighborhoodMaxSteps*s)),
+		})
+	}
+	return report, nil
+}
+
+// metricByParameters finds a test whose parameters equal the variant's
+func metricByParameters(tests []OptimizationTest, params map[string]float64, metric string) (float64, bool) {
+	for _, test := range tests {
+		match := true
+		for name, want := range params {
+			if got, ok := test.ParameterValue(name); !ok || math.Abs(got-want) > 1e-9 {
+				match = false
+				break
+			}
+		}
+		if v, ok := test.Metrics[metric]; match && ok {
+			return v, true
+		}
+	}
+	return 0, false
+}
+
+// leastSquaresThroughOrigin solves min |X b - y| for b with the normal equations. Columns that
+// never vary get a zero coefficient.
+func leastSquaresThroughOrigin(x [][]float64, y []float64, k int) []float64 {
+	// Normal equations A b = c with A = X'X, c = X'y
+	a := make([][]float64, k)
+	c := make([]float64, k)
+	for i := range a {
+		a[i] = make([]float64, k)
+	}
+	for r, row := range x {
+		for i := 0; i < k; i++ {
+			c[i] += row[i] * y[r]
+			for j := 0; j < k; j++ {
+				a[i][j] += row[i] * row[j]
+			}
+		}
+	}
+
+	// Gaussian elimination with partial pivoting; singular columns are skipped
+	b := make([]float64, k)
+	pivotRow := make([]int, k)
+	for i := range pivotRow {
+		pivotRow[i] = -1
+	}
+	used := make([]bool, k)
+	for col := 0; col < k; col++ {
+		best := -1
+		for r := 0; r < k; r++ {
+			if !used[r] && math.Abs(a[r][col]) > 1e-12 && (best < 0 || math.Abs(a[r][col]) > math.Abs(a[best][col])) {
+				best = r
+			}
+		}
+		if best < 0 {
+			continue
+		}
+		used[best] = true
+		pivotRow[col] = best
+		for r := 0; r < k; r++ {
+			if r == best || a[r][col] == 0 {
+				continue
+			}
+			f := a[r][col] / a[best][col]
+			for j := col; j < k; j++ {
+				a[r][j] -= f * a[best][j]
+			}
+			c[r] -= f * c[best]
+		}
+	}
+	for col := 0; col < k; col++ {
+		if r := pivotRow[col]; r >= 0 {
+			b[col] = c[r] / a[r][col]
+		}
+	}
+	return b
+}
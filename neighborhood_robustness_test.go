@@ -0,0 +1,186 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+)
+
+const testRobustnessJobXML = `<root><Job>
+  <Id>opt-job</Id>
+  <task_type>OPT</task_type>
+  <filename>opt-job_@ES_60_OPT.job</filename>
+  <parameters>
+  <iFast>
+    <start>5</start>
+    <end>20</end>
+    <step>5</step>
+    <value>10</value>
+    <param_type>OptRange</param_type>
+    <optimizable_ind>true</optimizable_ind>
+  </iFast>
+  <iSlow>
+    <start>40</start>
+    <end>80</end>
+    <step>10</step>
+    <value>40</value>
+    <param_type>OptRange</param_type>
+    <optimizable_ind>true</optimizable_ind>
+  </iSlow>
+  <sMode>
+    <value>fast</value>
+    <param_type>FixedString</param_type>
+  </sMode>
+  </parameters>
+</Job></root>`
+
+func TestNewRobustnessPlanSteps(t *testing.T) {
+	plan, err := newRobustnessPlan(testRobustnessJobXML, map[string]interface{}{"iSlow": 60.0}, NeighborhoodSteps, 0, 0)
+	if err != nil {
+		t.Fatalf("newRobustnessPlan failed: %v", err)
+	}
+	if plan.Center["iFast"] != 10 || plan.Center["iSlow"] != 60 {
+		t.Fatalf("Expected center iFast=10 iSlow=60, got %v", plan.Center)
+	}
+
+	// iFast -2 steps (0) is below the range start and is skipped
+	want := []string{"center", "iFast -1 steps", "iFast +1 steps", "iFast +2 steps",
+		"iSlow -2 steps", "iSlow -1 steps", "iSlow +1 steps", "iSlow +2 steps"}
+	if len(plan.Variants) != len(want) {
+		t.Fatalf("Expected %d variants, got %d: %+v", len(want), len(plan.Variants), plan.Variants)
+	}
+	for i, variant := range plan.Variants {
+		if variant.Run != i+1 || describeOffsets(variant.Offsets) != want[i] {
+			t.Fatalf("Variant %d: expected run %d %q, got run %d %q", i, i+1, want[i], variant.Run, describeOffsets(variant.Offsets))
+		}
+	}
+	if got := plan.Variants[7].Parameters; got["iSlow"] != 80 || got["iFast"] != 10 {
+		t.Fatalf("Expected iSlow +2 steps at 80 with iFast 10, got %v", got)
+	}
+
+	if _, err := newRobustnessPlan(testRobustnessJobXML, nil, "grid", 0, 0); err == nil {
+		t.Fatalf("Expected an error for an unknown mode")
+	}
+}
+
+func TestNewRobustnessPlanLHS(t *testing.T) {
+	plan, err := newRobustnessPlan(testRobustnessJobXML, map[string]interface{}{"iSlow": "60"}, NeighborhoodLHS, 12, 7)
+	if err != nil {
+		t.Fatalf("newRobustnessPlan failed: %v", err)
+	}
+	if len(plan.Variants) < 2 || len(plan.Variants) > 13 {
+		t.Fatalf("Expected between 2 and 13 variants, got %d", len(plan.Variants))
+	}
+	if describeOffsets(plan.Variants[0].Offsets) != "center" {
+		t.Fatalf("Expected the center first, got %v", plan.Variants[0].Offsets)
+	}
+	for _, variant := range plan.Variants {
+		for name, d := range variant.Offsets {
+			if d < -neighborhoodMaxSteps || d > neighborhoodMaxSteps {
+				t.Fatalf("Run %d: %s offset %d outside ±%d steps", variant.Run, name, d, neighborhoodMaxSteps)
+			}
+		}
+		if v := variant.Parameters["iFast"]; v < 5 || v > 20 {
+			t.Fatalf("Run %d: iFast %v outside its range", variant.Run, v)
+		}
+	}
+
+	again, _ := newRobustnessPlan(testRobustnessJobXML, map[string]interface{}{"iSlow": "60"}, NeighborhoodLHS, 12, 7)
+	if fmt.Sprint(again.Variants) != fmt.Sprint(plan.Variants) {
+		t.Fatalf("Expected the same sample for the same seed")
+	}
+}
+
+func TestBuildRobustnessJobXML(t *testing.T) {
+	plan, err := newRobustnessPlan(testRobustnessJobXML, map[string]interface{}{"iSlow": 60.0}, NeighborhoodSteps, 0, 0)
+	if err != nil {
+		t.Fatalf("newRobustnessPlan failed: %v", err)
+	}
+	plan.TaskType = FollowUpRetest
+	plan.JobFile = "opt-job_@ES_60_ROBUST-8.job"
+
+	xmlContent, err := buildRobustnessJobXML(testRobustnessJobXML, plan)
+	if err != nil {
+		t.Fatalf("buildRobustnessJobXML failed: %v", err)
+	}
+	jobs := jobElementPattern.FindAllString(xmlContent, -1)
+	if len(jobs) != len(plan.Variants) {
+		t.Fatalf("Expected %d job elements, got %d", len(plan.Variants), len(jobs))
+	}
+	job := jobs[1] // iFast -1 step
+	for _, tag := range []struct{ name, value string }{
+		{"task_type", "RETEST"},
+		{"filename", plan.JobFile},
+		{"run", "2"},
+		{"parameter_selection", "neighborhood_steps"},
+		{"parameter_selection_rationale", "iFast -1 steps"},
+	} {
+		if got, err := extractXMLTagValue(job, tag.name); err != nil || got != tag.value {
+			t.Fatalf("Expected <%s> %q, got %q (%v)\n%s", tag.name, tag.value, got, err, job)
+		}
+	}
+	if !strings.Contains(job, "<value>5</value>") || !strings.Contains(job, "<value>60</value>") {
+		t.Fatalf("Expected iFast fixed to 5 and iSlow to 60:\n%s", job)
+	}
+}
+
+func TestBuildRobustnessReport(t *testing.T) {
+	plan, err := newRobustnessPlan(testRobustnessJobXML, map[string]interface{}{"iSlow": 60.0}, NeighborhoodSteps, 0, 0)
+	if err != nil {
+		t.Fatalf("newRobustnessPlan failed: %v", err)
+	}
+
+	// Fitness drops 10% of the center per iFast step and does not depend on iSlow. The last
+	// variant has no run number and is matched by its parameters; the iSlow -2 variant is missing.
+	var csvContent strings.Builder
+	csvContent.WriteString("run,parameters_json,Fitness\n")
+	for i, variant := range plan.Variants {
+		if describeOffsets(variant.Offsets) == "iSlow -2 steps" {
+			continue
+		}
+		params, _ := json.Marshal(variant.Parameters)
+		fitness := 100 - 10*math.Abs(float64(variant.Offsets["iFast"]))
+		run := fmt.Sprint(variant.Run)
+		if i == len(plan.Variants)-1 {
+			run = ""
+		}
+		fmt.Fprintf(&csvContent, "%s,%s,%g\n", run, params, fitness)
+	}
+	results, err := readOptimizationResults(mustOPTReader(t, csvContent.String()))
+	if err != nil {
+		t.Fatalf("readOptimizationResults failed: %v", err)
+	}
+
+	report, err := buildRobustnessReport(plan, results, "")
+	if err != nil {
+		t.Fatalf("buildRobustnessReport failed: %v", err)
+	}
+	if report.Matched != len(plan.Variants)-1 || report.CenterMetric != 100 || report.Metric != "fitness" {
+		t.Fatalf("Unexpected report header: %+v", report)
+	}
+	if math.Abs(report.WorstRetention-0.8) > 1e-9 || report.ProfitableShare != 1 {
+		t.Fatalf("Expected worst retention 0.8 and all variants profitable, got %v and %v", report.WorstRetention, report.ProfitableShare)
+	}
+
+	want := map[string][2]float64{"iFast": {0.1, 80}, "iSlow": {0, 100}}
+	for _, p := range report.Parameters {
+		w := want[p.Name]
+		if math.Abs(p.Sensitivity-w[0]) > 1e-9 || math.Abs(p.Score-w[1]) > 1e-9 {
+			t.Fatalf("%s: expected sensitivity %v score %v, got %v %v", p.Name, w[0], w[1], p.Sensitivity, p.Score)
+		}
+	}
+
+	if _, err := buildRobustnessReport(plan, &OptimizationResults{Columns: results.Columns, Metrics: results.Metrics}, ""); err == nil {
+		t.Fatalf("Expected an error when the center has no result")
+	}
+}
+
+func TestLeastSquaresThroughOriginSingular(t *testing.T) {
+	// The second column never varies and gets a zero coefficient
+	b := leastSquaresThroughOrigin([][]float64{{1, 0}, {2, 0}}, []float64{0.5, 1}, 2)
+	if math.Abs(b[0]-0.5) > 1e-9 || b[1] != 0 {
+		t.Fatalf("Expected [0.5 0], got %v", b)
+	}
+}
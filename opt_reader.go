@@ -0,0 +1,416 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// OPTSchema describes the columns found in an OPT header
+type OPTSchema struct {
+	Columns []string // normalized names: lower case, spaces replaced by underscores
+	index   map[string]int
+
+	RunColumn        int // -1 when absent
+	ParametersColumn int // parameters_json, -1 when absent
+	ISStartColumn    int
+	ISEndColumn      int
+	OSStartColumn    int
+	OSEndColumn      int
+}
+
+// optColumnAliases maps alternative header spellings to the normalized name
+var optColumnAliases = map[string]string{
+	"run_number":      "run",
+	"parameters":      "parameters_json",
+	"parameters_json": "parameters_json",
+}
+
+// normalizeOPTColumn lower-cases a header name and replaces spaces/dashes with underscores
+func normalizeOPTColumn(name string) string {
+	name = strings.ToLower(strings.TrimSpace(strings.Trim(strings.TrimSpace(name), `"`)))
+	name = strings.NewReplacer(" ", "_", "-", "_").Replace(name)
+	if alias, ok := optColumnAliases[name]; ok {
+		return alias
+	}
+	return name
+}
+
+// newOPTSchema builds the schema from a header record. A header made only of numbers is rejected.
+func newOPTSchema(header []string) (*OPTSchema, error) {
+	if len(header) == 0 {
+		return nil, fmt.Errorf("empty header")
+	}
+	numeric := 0
+	s := &OPTSchema{index: make(map[string]int, len(header))}
+	for i, col := range header {
+		name := normalizeOPTColumn(col)
+		if _, err := strconv.ParseFloat(name, 64); err == nil {
+			numeric++
+		}
+		s.Columns = append(s.Columns, name)
+		if _, dup := s.index[name]; !dup && name != "" {
+			s.index[name] = i
+		}
+	}
+	if numeric == len(header) {
+		return nil, fmt.Errorf("header row missing (first row is numeric)")
+	}
+
+	s.RunColumn = s.Column("run")
+	s.ParametersColumn = s.Column("parameters_json")
+	s.ISStartColumn = s.Column("is_start_date")
+	s.ISEndColumn = s.Column("is_end_date")
+	s.OSStartColumn = s.Column("os_start_date")
+	s.OSEndColumn = s.Column("os_end_date")
+	return s, nil
+}
+
+// Column returns the index of a (normalized) column, or -1
+func (s *OPTSchema) Column(name string) int {
+	if i, ok := s.index[normalizeOPTColumn(name)]; ok {
+		return i
+	}
+	return -1
+}
+
+// IsWFO reports whether the file has the per-run columns of a walk-forward OPT file
+func (s *OPTSchema) IsWFO() bool {
+	return s.RunColumn >= 0 && s.ParametersColumn >= 0
+}
+
+// OPTRow is one parsed data row
+type OPTRow struct {
+	Line           int       // 1-based line number the record started on
+	Fields         []string  // raw field values, one per header column
+	Values         []float64 // numeric value per column, NaN when the field is not a number
+	Run            int       // 0 when the file has no run column
+	ParametersJSON string    // cleaned (doubled quotes removed), "" when absent
+	ISStartDate    string
+	ISEndDate      string
+	OSStartDate    string
+	OSEndDate      string
+}
+
+// Field returns a field by column name ("" when missing)
+func (r *OPTRow) Field(s *OPTSchema, name string) string {
+	if i := s.Column(name); i >= 0 && i < len(r.Fields) {
+		return r.Fields[i]
+	}
+	return ""
+}
+
+// Metric returns a numeric field by column name
+func (r *OPTRow) Metric(s *OPTSchema, name string) (float64, bool) {
+	if i := s.Column(name); i >= 0 && i < len(r.Values) && !math.IsNaN(r.Values[i]) {
+		return r.Values[i], true
+	}
+	return 0, false
+}
+
+// OPTReader streams typed rows from OPT CSV content.
+// Besides RFC 4180 quoting it accepts TSClient's unquoted JSON fields (commas inside {...} or [...]
+// don't split, JSON strings may contain braces) including the doubled-quote form {""a"":1}, and
+// unquoted key=value,key=value parameter lists when a row has more fields than the header.
+type OPTReader struct {
+	r      *bufio.Reader
+	schema *OPTSchema
+	line   int
+	field  bytes.Buffer
+}
+
+// NewOPTReader reads the header from r and detects the schema
+func NewOPTReader(r io.Reader) (*OPTReader, error) {
+	or := &OPTReader{r: bufio.NewReaderSize(r, 64*1024), line: 1}
+	// Skip a UTF-8 byte order mark
+	if bom, err := or.r.Peek(3); err == nil && bytes.Equal(bom, []byte{0xEF, 0xBB, 0xBF}) {
+		or.r.Discard(3)
+	}
+
+	for {
+		header, err := or.readRecord()
+		if err == io.EOF {
+			return nil, fmt.Errorf("no header row")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read header: %w", err)
+		}
+		if isBlankRecord(header) {
+			continue
+		}
+		schema, err := newOPTSchema(header)
+		if err != nil {
+			return nil, err
+		}
+		or.schema = schema
+		return or, nil
+	}
+}
+
+// Schema returns the detected schema
+func (or *OPTReader) Schema() *OPTSchema {
+	return or.schema
+}
+
+// Next returns the next data row, or io.EOF. Blank lines are skipped.
+func (or *OPTReader) Next() (*OPTRow, error) {
+	for {
+		line := or.line
+		fields, err := or.readRecord()
+		if err != nil {
+			return nil, err
+		}
+		if isBlankRecord(fields) {
+			continue
+		}
+		if len(fields) > len(or.schema.Columns) {
+			fields = mergeKeyValueFields(fields, len(or.schema.Columns))
+		}
+		return or.newRow(line, fields), nil
+	}
+}
+
+// newRow converts fields to a typed row
+func (or *OPTReader) newRow(line int, fields []string) *OPTRow {
+	s := or.schema
+	row := &OPTRow{Line: line, Fields: fields, Values: make([]float64, len(fields))}
+	for i, f := range fields {
+		if v, err := strconv.ParseFloat(f, 64); err == nil {
+			row.Values[i] = v
+		} else {
+			row.Values[i] = math.NaN()
+		}
+	}
+	get := func(i int) string {
+		if i >= 0 && i < len(fields) {
+			return fields[i]
+		}
+		return ""
+	}
+	if run, err := strconv.Atoi(strings.TrimSpace(get(s.RunColumn))); err == nil {
+		row.Run = run
+	}
+	if p := get(s.ParametersColumn); p != "" {
+		row.ParametersJSON = cleanParametersJSON(p)
+	}
+	row.ISStartDate = get(s.ISStartColumn)
+	row.ISEndDate = get(s.ISEndColumn)
+	row.OSStartDate = get(s.OSStartColumn)
+	row.OSEndDate = get(s.OSEndColumn)
+	return row
+}
+
+// readRecord reads one record. Newlines end the record except inside a quoted field.
+func (or *OPTReader) readRecord() ([]string, error) {
+	var fields []string
+	or.field.Reset()
+
+	const (
+		fieldStart = iota
+		unquoted
+		quoted
+		quotedEnd // closing quote seen, waiting for , or newline
+	)
+	state := fieldStart
+	depth := 0             // JSON nesting in an unquoted field
+	inString := false      // inside a JSON string in an unquoted field
+	doubledQuotes := false // the unquoted JSON uses "" for "
+	sawAny := false
+
+	endField := func() {
+		value := or.field.String()
+		if state != quoted && state != quotedEnd {
+			value = strings.TrimSpace(value)
+		}
+		fields = append(fields, value)
+		or.field.Reset()
+		state, depth, inString, doubledQuotes = fieldStart, 0, false, false
+	}
+
+	for {
+		c, err := or.r.ReadByte()
+		if err == io.EOF {
+			if state == quoted {
+				return nil, fmt.Errorf("line %d: unterminated quoted field", or.line)
+			}
+			if !sawAny {
+				return nil, io.EOF
+			}
+			endField()
+			return fields, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		sawAny = true
+
+		switch state {
+		case fieldStart, unquoted:
+			if state == fieldStart && c == '"' {
+				state = quoted
+				continue
+			}
+			state = unquoted
+			switch {
+			case c == '\n':
+				or.line++
+				endField()
+				return fields, nil
+			case c == ',' && depth == 0:
+				endField()
+				continue
+			case depth > 0 && c == '"':
+				if doubledQuotes {
+					if next, _ := or.r.Peek(1); len(next) == 1 && next[0] == '"' {
+						or.r.ReadByte()
+						or.field.WriteString(`""`)
+						inString = !inString
+						continue
+					}
+				} else if !inString || !endsWithEscape(or.field.Bytes()) {
+					inString = !inString
+				}
+			case !inString && (c == '{' || c == '['):
+				if depth == 0 {
+					if next, _ := or.r.Peek(2); string(next) == `""` {
+						doubledQuotes = true
+					}
+				}
+				depth++
+			case !inString && depth > 0 && (c == '}' || c == ']'):
+				depth--
+			}
+			or.field.WriteByte(c)
+
+		case quoted:
+			if c == '"' {
+				if next, _ := or.r.Peek(1); len(next) == 1 && next[0] == '"' {
+					or.r.ReadByte()
+					or.field.WriteByte('"')
+					continue
+				}
+				state = quotedEnd
+				continue
+			}
+			if c == '\n' {
+				or.line++
+			}
+			or.field.WriteByte(c)
+
+		case quotedEnd:
+			switch c {
+			case ',':
+				endField()
+			case '\n':
+				or.line++
+				endField()
+				return fields, nil
+			case '\r', ' ', '\t':
+			default:
+				// Stray text after a closing quote: keep it, as encoding/csv does with LazyQuotes
+				or.field.WriteByte(c)
+			}
+		}
+	}
+}
+
+// endsWithEscape reports whether the buffer ends in an odd number of backslashes
+func endsWithEscape(b []byte) bool {
+	n := 0
+	for i := len(b) - 1; i >= 0 && b[i] == '\\'; i-- {
+		n++
+	}
+	return n%2 == 1
+}
+
+// isBlankRecord reports whether a record is an empty line
+func isBlankRecord(fields []string) bool {
+	return len(fields) == 0 || (len(fields) == 1 && strings.TrimSpace(fields[0]) == "")
+}
+
+// mergeKeyValueFields joins runs of unquoted key=value fields that were split on their commas,
+// leftmost first, until the record has the expected number of fields
+func mergeKeyValueFields(fields []string, want int) []string {
+	isPair := func(f string) bool { return strings.Contains(f, "=") && !strings.Contains(f, "{") }
+	merged := make([]string, 0, len(fields))
+	extra := len(fields) - want
+	for i := 0; i < len(fields); i++ {
+		current := fields[i]
+		for extra > 0 && isPair(current) && i+1 < len(fields) && isPair(fields[i+1]) {
+			i++
+			current += "," + fields[i]
+			extra--
+		}
+		merged = append(merged, current)
+	}
+	return merged
+}
+
+// openOPTFile opens an OPT file for streaming. OPT files are zlib compressed, or gzip/zstd once archived;
+// plain CSV is read as is.
+// Archived OPT files may also be encrypted, they are decrypted before the codec check, and container
+// files are verified against their checksum as they are read.
+// When dump is not nil the decompressed content is copied to it as it is read.
+// The returned closer releases the file and the decompressor.
+func openOPTFile(path string, dump io.Writer) (*OPTReader, io.Closer, error) {
+	file, err := openAtRestFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("open OPT file: %w", err)
+	}
+
+	buffered := bufio.NewReader(file)
+	var source io.Reader = buffered
+	closers := multiCloser{file}
+	if magic, _ := buffered.Peek(len(containerMagic)); isContainerHeader(magic) {
+		_, _, payload, err := openContainerPayload(buffered)
+		if err != nil {
+			file.Close()
+			return nil, nil, fmt.Errorf("read OPT container: %w", err)
+		}
+		source = payload
+		closers = multiCloser{payload, file}
+	} else if header, _ := buffered.Peek(codecDetectSize); detectCodec(header) != nil {
+		cr, _, err := NewDecompressReader(buffered)
+		if err != nil {
+			file.Close()
+			return nil, nil, err
+		}
+		source = cr
+		closers = multiCloser{cr, file}
+	}
+
+	if dump != nil {
+		source = io.TeeReader(source, dump)
+	}
+
+	reader, err := NewOPTReader(source)
+	if err != nil {
+		closers.Close()
+		return nil, nil, err
+	}
+	return reader, closers, nil
+}
+
+// isZlibHeader checks the two-byte zlib stream header (deflate method, valid check bits)
+func isZlibHeader(b []byte) bool {
+	return len(b) >= 2 && b[0]&0x0F == 8 && (uint16(b[0])<<8|uint16(b[1]))%31 == 0
+}
+
+// multiCloser closes several closers in order and returns the first error
+type multiCloser []io.Closer
+
+func (mc multiCloser) Close() error {
+	var first error
+	for _, c := range mc {
+		if err := c.Close(); err != nil && first == nil && !errors.Is(err, os.ErrClosed) {
+			first = err
+		}
+	}
+	return first
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func readAllOPTRows(t testing.TB, content string) (*OPTSchema, []*OPTRow) {
+	reader, err := NewOPTReader(strings.NewReader(content))
+	if err != nil {
+		t.Fatalf("NewOPTReader failed: %v", err)
+	}
+	var rows []*OPTRow
+	for {
+		row, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Next failed: %v", err)
+		}
+		rows = append(rows, row)
+	}
+	return reader.Schema(), rows
+}
+
+func TestOPTReaderFields(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		want []string
+	}{
+		{"plain", `1,abc,2.5`, []string{"1", "abc", "2.5"}},
+		{"quoted comma", `1,"a,b",2`, []string{"1", "a,b", "2"}},
+		{"escaped quote", `1,"say ""hi""",2`, []string{"1", `say "hi"`, "2"}},
+		{"unquoted JSON", `1,{"a":1,"b":[1,2]},2`, []string{"1", `{"a":1,"b":[1,2]}`, "2"}},
+		{"nested JSON", `1,{"a":{"b":{"c":1,"d":2}}},2`, []string{"1", `{"a":{"b":{"c":1,"d":2}}}`, "2"}},
+		{"braces in JSON string", `1,{"a":"}{,","b":1},2`, []string{"1", `{"a":"}{,","b":1}`, "2"}},
+		{"escaped quote in JSON string", `1,{"a":"x\",}","b":1},2`, []string{"1", `{"a":"x\",}","b":1}`, "2"}},
+		{"doubled-quote JSON", `1,{""a"":1,""b"":""x,}""},2`, []string{"1", `{""a"":1,""b"":""x,}""}`, "2"}},
+		{"quoted doubled-quote JSON", `1,"{""a"":1,""b"":2}",2`, []string{"1", `{"a":1,"b":2}`, "2"}},
+		{"key=value list", `1,a=1,b=2,c=3,2`, []string{"1", "a=1,b=2,c=3", "2"}},
+		{"empty fields", `1,,`, []string{"1", "", ""}},
+		{"CRLF", "1,\"x\",2\r", []string{"1", "x", "2"}},
+	}
+
+	for _, tt := range tests {
+		_, rows := readAllOPTRows(t, "run,parameters_json,value\n"+tt.line+"\n")
+		if len(rows) != 1 {
+			t.Fatalf("%s: expected 1 row, got %d", tt.name, len(rows))
+		}
+		got := rows[0].Fields
+		if len(got) != len(tt.want) {
+			t.Fatalf("%s: expected %q, got %q", tt.name, tt.want, got)
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Fatalf("%s: field %d: expected %q, got %q", tt.name, i, tt.want[i], got[i])
+			}
+		}
+	}
+}
+
+func TestOPTReaderSchemaAndTypedRows(t *testing.T) {
+	content := "\xEF\xBB\xBFRun,Parameters JSON,IS_Start_Date,IS_End_Date,OS_Start_Date,OS_End_Date,All Net Profit\r\n" +
+		"1,\"{\"\"iFast\"\":10}\",2010-01-01,2011-01-01,2011-01-02,2011-06-30,1500.5\r\n" +
+		"\r\n" +
+		"2,{\"iFast\":12},2010-07-01,2011-07-01,2011-07-02,2011-12-31,-200\r\n"
+
+	schema, rows := readAllOPTRows(t, content)
+	if !schema.IsWFO() || schema.Column("all_net_profit") != 6 {
+		t.Fatalf("Unexpected schema: %+v", schema)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("Expected 2 rows, got %d", len(rows))
+	}
+	if rows[0].Run != 1 || rows[0].ParametersJSON != `{"iFast":10}` || rows[0].OSEndDate != "2011-06-30" {
+		t.Fatalf("Unexpected first row: %+v", rows[0])
+	}
+	if rows[1].Line != 4 {
+		t.Fatalf("Expected the second row on line 4, got %d", rows[1].Line)
+	}
+	if v, ok := rows[1].Metric(schema, "All Net Profit"); !ok || v != -200 {
+		t.Fatalf("Expected net profit -200, got %v (%v)", v, ok)
+	}
+	if _, ok := rows[1].Metric(schema, "is_start_date"); ok {
+		t.Fatalf("Dates should not be numeric metrics")
+	}
+
+	results, err := readWFOResults(mustOPTReader(t, content), ParameterSelectionConfig{})
+	if err != nil || len(results) != 2 || results[0].AllNetProfit != 1500.5 {
+		t.Fatalf("Unexpected WFO results: %+v (err %v)", results, err)
+	}
+}
+
+func TestOPTReaderErrors(t *testing.T) {
+	if _, err := NewOPTReader(strings.NewReader("")); err == nil {
+		t.Fatalf("Expected an error for empty content")
+	}
+	if _, err := NewOPTReader(strings.NewReader("1,2,3\n4,5,6\n")); err == nil {
+		t.Fatalf("Expected an error for a missing header")
+	}
+	reader := mustOPTReader(t, "a,b\n1,\"unterminated\n")
+	if _, err := reader.Next(); err == nil || err == io.EOF {
+		t.Fatalf("Expected an unterminated quote error, got %v", err)
+	}
+}
+
+func TestOpenOPTFileZlib(t *testing.T) {
+	content := "run,parameters_json\n1,{\"a\":1}\n"
+	path := filepath.Join(t.TempDir(), "job.opt")
+	if err := os.WriteFile(path, zlibCompress(t, []byte(content)), 0644); err != nil {
+		t.Fatalf("write OPT file: %v", err)
+	}
+
+	var dump bytes.Buffer
+	reader, closer, err := openOPTFile(path, &dump)
+	if err != nil {
+		t.Fatalf("openOPTFile failed: %v", err)
+	}
+	defer closer.Close()
+	row, err := reader.Next()
+	if err != nil || row.ParametersJSON != `{"a":1}` {
+		t.Fatalf("Unexpected row %+v (err %v)", row, err)
+	}
+	if _, err := reader.Next(); err != io.EOF {
+		t.Fatalf("Expected EOF, got %v", err)
+	}
+	if dump.String() != content {
+		t.Fatalf("Expected the dump to hold the decompressed content, got %q", dump.String())
+	}
+}
+
+func mustOPTReader(t testing.TB, content string) *OPTReader {
+	reader, err := NewOPTReader(strings.NewReader(content))
+	if err != nil {
+		t.Fatalf("NewOPTReader failed: %v", err)
+	}
+	return reader
+}
+
+func zlibCompress(t testing.TB, data []byte) []byte {
+	var buf bytes.Buffer
+	w := zlib.NewWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		t.Fatalf("compress: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("compress: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// FuzzOPTReader checks that arbitrary input never panics and rows stay consistent
+func FuzzOPTReader(f *testing.F) {
+	f.Add([]byte("run,parameters_json\n1,{\"a\":1}\n"))
+	f.Add([]byte("a,b\n\"x\"\"y\",{\"\"k\"\":\"\"}\"\"}\n"))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		reader, err := NewOPTReader(bytes.NewReader(data))
+		if err != nil {
+			return
+		}
+		for i := 0; i < len(data)+1; i++ {
+			row, err := reader.Next()
+			if err != nil {
+				return
+			}
+			if len(row.Values) != len(row.Fields) || row.Line < 2 {
+				t.Fatalf("Inconsistent row: %+v", row)
+			}
+		}
+		t.Fatalf("Reader did not terminate")
+	})
+}
+
+// FuzzOPTReaderRoundTrip checks that RFC 4180 output of encoding/csv reads back unchanged
+func FuzzOPTReaderRoundTrip(f *testing.F) {
+	f.Add("plain", "a,b")
+	f.Add(`say "hi"`, "line\nbreak")
+	f.Fuzz(func(t *testing.T, a, b string) {
+		for _, s := range []string{a, b} {
+			// Unquoted braces start JSON and surrounding spaces are trimmed: both are intended quirks
+			if strings.ContainsAny(s, "{[\r") || strings.TrimSpace(s) != s || s == "" {
+				return
+			}
+		}
+		var buf bytes.Buffer
+		w := csv.NewWriter(&buf)
+		w.Write([]string{"x", "y"})
+		w.Write([]string{a, b})
+		w.Flush()
+
+		_, rows := readAllOPTRows(t, buf.String())
+		if len(rows) != 1 || len(rows[0].Fields) != 2 || rows[0].Fields[0] != a || rows[0].Fields[1] != b {
+			t.Fatalf("Round trip of %q, %q gave %+v", a, b, rows)
+		}
+	})
+}
+
+var (
+	benchOPTOnce       sync.Once
+	benchOPTContent    []byte
+	benchOPTCompressed []byte
+)
+
+// benchmarkOPTData builds a ~100 MB OPT file in TSClient's layout (unquoted JSON parameters)
+func benchmarkOPTData(b *testing.B) ([]byte, []byte) {
+	benchOPTOnce.Do(func() {
+		var buf bytes.Buffer
+		buf.WriteString("run,parameters_json,is_start_date,is_end_date,os_start_date,os_end_date,all_net_profit,all_max_drawdown,all_trades,fitness\n")
+		for i := 0; buf.Len() < 100<<20; i++ {
+			fmt.Fprintf(&buf, "%d,{\"iFastMAPeriod\":%d,\"iSlowMAPeriod\":%d,\"iStoploss\":%d,\"sComment\":\"run, %d\"},2010-01-01,2012-12-31,2013-01-01,2013-06-30,%.2f,%.2f,%d,%.4f\n",
+				i%20+1, 5+i%30, 50+i%100, 1000+i%5000, i, float64(i%9000)-2000.5, float64(i%3000)+100.25, 50+i%400, float64(i%1000)/997)
+		}
+		benchOPTContent = buf.Bytes()
+		benchOPTCompressed = zlibCompress(b, benchOPTContent)
+	})
+	return benchOPTContent, benchOPTCompressed
+}
+
+func BenchmarkOPTReader100MB(b *testing.B) {
+	content, _ := benchmarkOPTData(b)
+	b.SetBytes(int64(len(content)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		reader, err := NewOPTReader(bytes.NewReader(content))
+		if err != nil {
+			b.Fatalf("NewOPTReader failed: %v", err)
+		}
+		for {
+			if _, err := reader.Next(); err != nil {
+				if err != io.EOF {
+					b.Fatalf("Next failed: %v", err)
+				}
+				break
+			}
+		}
+	}
+}
+
+func BenchmarkOPTReader100MBZlib(b *testing.B) {
+	content, compressed := benchmarkOPTData(b)
+	b.SetBytes(int64(len(content)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		zr, err := zlib.NewReader(bytes.NewReader(compressed))
+		if err != nil {
+			b.Fatalf("zlib reader: %v", err)
+		}
+		reader, err := NewOPTReader(zr)
+		if err != nil {
+			b.Fatalf("NewOPTReader failed: %v", err)
+		}
+		for {
+			if _, err := reader.Next(); err != nil {
+				if err != io.EOF {
+					b.Fatalf("Next failed: %v", err)
+				}
+				break
+			}
+		}
+		zr.Close()
+	}
+}
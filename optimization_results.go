@@ -0,0 +1,449 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Metric columns looked up by the queries, first match wins. TradeStation reports drawdowns as
+// negative numbers, so drawdowns are compared by absolute value.
+var (
+	optFitnessColumns   = []string{"fitness", "all_net_profit", "net_profit"}
+	optNetProfitColumns = []string{"all_net_profit", "net_profit"}
+	optDrawdownColumns  = []string{"all_max_drawdown", "all_max_strategy_drawdown", "max_drawdown", "max_strategy_drawdown"}
+	optTradesColumns    = []string{"all_trades", "all_total_trades", "total_trades", "trades"}
+)
+
+// optParameterPrefixes mark parameter columns in OPT files that don't carry a parameters_json column
+var optParameterPrefixes = []string{"param_", "input_"}
+
+// optNonMetricColumns are numeric-looking columns that are not metrics
+var optNonMetricColumns = map[string]bool{"run": true, "parameters_json": true}
+
+// OptimizationTest is one test (row) of an optimization
+type OptimizationTest struct {
+	Line        int                    `json:"line"`
+	Run         int                    `json:"run,omitempty"`
+	Parameters  map[string]interface{} `json:"parameters"`
+	Metrics     map[string]float64     `json:"metrics"`
+	Text        map[string]string      `json:"text,omitempty"` // other non-numeric columns
+	ISStartDate string                 `json:"is_start_date,omitempty"`
+	ISEndDate   string                 `json:"is_end_date,omitempty"`
+	OSStartDate string                 `json:"os_start_date,omitempty"`
+	OSEndDate   string                 `json:"os_end_date,omitempty"`
+}
+
+// ParameterValue returns a parameter as a number (booleans count as 0/1)
+func (t OptimizationTest) ParameterValue(name string) (float64, bool) {
+	switch v := t.Parameters[name].(type) {
+	case float64:
+		return v, true
+	case bool:
+		if v {
+			return 1, true
+		}
+		return 0, true
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// metric returns the first of the named metrics the test has
+func (t OptimizationTest) metric(names []string) (float64, bool) {
+	for _, name := range names {
+		if v, ok := t.Metrics[name]; ok {
+			return v, true
+		}
+	}
+	return 0, false
+}
+
+// OptimizationResults holds every test of an OPT file with all of its metrics and parameters
+type OptimizationResults struct {
+	Source     string             `json:"source,omitempty"`
+	Columns    []string           `json:"columns"`
+	Metrics    []string           `json:"metrics"`    // metric names in column order
+	Parameters []string           `json:"parameters"` // parameter names, sorted
+	Tests      []OptimizationTest `json:"tests"`
+}
+
+// loadOptimizationResults reads an OPT file (zlib compressed or plain CSV)
+func loadOptimizationResults(path string) (*OptimizationResults, error) {
+	reader, closer, err := openOPTFile(path, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer closer.Close()
+
+	results, err := readOptimizationResults(reader)
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", path, err)
+	}
+	results.Source = path
+	return results, nil
+}
+
+// readOptimizationResults collects every row of an OPT stream. Parameters come from the
+// parameters_json column (JSON or a key=value list) and from param_/input_ prefixed columns; every
+// other numeric column is a metric.
+func readOptimizationResults(reader *OPTReader) (*OptimizationResults, error) {
+	schema := reader.Schema()
+	results := &OptimizationResults{Columns: schema.Columns}
+
+	parameterColumns := make(map[int]string)
+	for i, col := range schema.Columns {
+		for _, prefix := range optParameterPrefixes {
+			if strings.HasPrefix(col, prefix) && len(col) > len(prefix) {
+				parameterColumns[i] = strings.TrimPrefix(col, prefix)
+			}
+		}
+	}
+	dateColumns := map[int]bool{schema.ISStartColumn: true, schema.ISEndColumn: true, schema.OSStartColumn: true, schema.OSEndColumn: true}
+
+	isMetric := make([]bool, len(schema.Columns))
+	parameterNames := make(map[string]bool)
+	for {
+		row, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		test := OptimizationTest{
+			Line:        row.Line,
+			Run:         row.Run,
+			Parameters:  make(map[string]interface{}),
+			Metrics:     make(map[string]float64),
+			ISStartDate: row.ISStartDate,
+			ISEndDate:   row.ISEndDate,
+			OSStartDate: row.OSStartDate,
+			OSEndDate:   row.OSEndDate,
+		}
+		if row.ParametersJSON != "" {
+			// Keep unparseable parameters as text rather than dropping the test
+			if err := json.Unmarshal([]byte(row.ParametersJSON), &test.Parameters); err != nil {
+				if params, ok := parseKeyValueParameters(row.ParametersJSON); ok {
+					test.Parameters = params
+				} else {
+					test.Parameters = make(map[string]interface{})
+					test.Text = map[string]string{"parameters_json": row.ParametersJSON}
+				}
+			}
+		}
+
+		for i, field := range row.Fields {
+			if i >= len(schema.Columns) || schema.Columns[i] == "" || optNonMetricColumns[schema.Columns[i]] {
+				continue
+			}
+			name := schema.Columns[i]
+			if param, ok := parameterColumns[i]; ok {
+				if v := row.Values[i]; !math.IsNaN(v) {
+					test.Parameters[param] = v
+				} else if field != "" {
+					test.Parameters[param] = field
+				}
+				continue
+			}
+			if v := row.Values[i]; !math.IsNaN(v) && !dateColumns[i] {
+				test.Metrics[name] = v
+				isMetric[i] = true
+			} else if field != "" && !dateColumns[i] {
+				if test.Text == nil {
+					test.Text = make(map[string]string)
+				}
+				test.Text[name] = field
+			}
+		}
+
+		for name := range test.Parameters {
+			parameterNames[name] = true
+		}
+		results.Tests = append(results.Tests, test)
+	}
+
+	for i, ok := range isMetric {
+		if ok {
+			results.Metrics = append(results.Metrics, schema.Columns[i])
+		}
+	}
+	for name := range parameterNames {
+		results.Parameters = append(results.Parameters, name)
+	}
+	sort.Strings(results.Parameters)
+	return results, nil
+}
+
+// parseKeyValueParameters parses an unquoted key=value,key=value parameter list. Values are typed
+// like their JSON counterparts: numbers as float64, true/false as bool, anything else as a string.
+func parseKeyValueParameters(s string) (map[string]interface{}, bool) {
+	params := make(map[string]interface{})
+	for _, pair := range strings.Split(s, ",") {
+		key, value, ok := strings.Cut(pair, "=")
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if !ok || key == "" {
+			return nil, false
+		}
+		if v, err := strconv.ParseFloat(value, 64); err == nil {
+			params[key] = v
+		} else if value == "true" || value == "false" {
+			params[key] = value == "true"
+		} else {
+			params[key] = value
+		}
+	}
+	return params, true
+}
+
+// resolveMetric returns the metric column to use: the requested one if present, else the first
+// available candidate
+func (r *OptimizationResults) resolveMetric(requested string, candidates []string) (string, error) {
+	has := make(map[string]bool, len(r.Metrics))
+	for _, m := range r.Metrics {
+		has[m] = true
+	}
+	if requested != "" {
+		name := normalizeOPTColumn(requested)
+		if !has[name] {
+			return "", fmt.Errorf("unknown metric %q (available: %s)", requested, strings.Join(r.Metrics, ", "))
+		}
+		return name, nil
+	}
+	for _, c := range candidates {
+		if has[c] {
+			return c, nil
+		}
+	}
+	return "", fmt.Errorf("none of the metrics %s found", strings.Join(candidates, ", "))
+}
+
+// FilterMinTrades returns the tests with at least minTrades trades. Tests without a trades column are dropped.
+func (r *OptimizationResults) FilterMinTrades(minTrades int) (*OptimizationResults, error) {
+	if minTrades <= 0 {
+		return r, nil
+	}
+	if _, err := r.resolveMetric("", optTradesColumns); err != nil {
+		return nil, err
+	}
+	filtered := *r
+	filtered.Tests = nil
+	for _, test := range r.Tests {
+		if trades, ok := test.metric(optTradesColumns); ok && trades >= float64(minTrades) {
+			filtered.Tests = append(filtered.Tests, test)
+		}
+	}
+	return &filtered, nil
+}
+
+// TopN returns the n tests with the highest value of metric (fitness by default), best first.
+// n <= 0 returns all tests sorted.
+func (r *OptimizationResults) TopN(n int, metric string) ([]OptimizationTest, error) {
+	name, err := r.resolveMetric(metric, optFitnessColumns)
+	if err != nil {
+		return nil, err
+	}
+
+	var ranked []OptimizationTest
+	for _, test := range r.Tests {
+		if _, ok := test.Metrics[name]; ok {
+			ranked = append(ranked, test)
+		}
+	}
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return ranked[i].Metrics[name] > ranked[j].Metrics[name]
+	})
+	if n > 0 && len(ranked) > n {
+		ranked = ranked[:n]
+	}
+	return ranked, nil
+}
+
+// ParetoFront returns the tests no other test beats on both net profit (higher) and max drawdown
+// (smaller in absolute value), ordered by drawdown
+func (r *OptimizationResults) ParetoFront() ([]OptimizationTest, error) {
+	profitName, err := r.resolveMetric("", optNetProfitColumns)
+	if err != nil {
+		return nil, err
+	}
+	drawdownName, err := r.resolveMetric("", optDrawdownColumns)
+	if err != nil {
+		return nil, err
+	}
+
+	var candidates []OptimizationTest
+	for _, test := range r.Tests {
+		_, hasProfit := test.Metrics[profitName]
+		_, hasDrawdown := test.Metrics[drawdownName]
+		if hasProfit && hasDrawdown {
+			candidates = append(candidates, test)
+		}
+	}
+	// Sort by drawdown ascending, then profit descending; a test is on the front when its
+	// profit beats every test with a smaller or equal drawdown seen before it
+	sort.SliceStable(candidates, func(i, j int) bool {
+		di, dj := math.Abs(candidates[i].Metrics[drawdownName]), math.Abs(candidates[j].Metrics[drawdownName])
+		if di != dj {
+			return di < dj
+		}
+		return candidates[i].Metrics[profitName] > candidates[j].Metrics[profitName]
+	})
+
+	var front []OptimizationTest
+	bestProfit := math.Inf(-1)
+	for _, test := range candidates {
+		if profit := test.Metrics[profitName]; profit > bestProfit {
+			front = append(front, test)
+			bestProfit = profit
+		}
+	}
+	return front, nil
+}
+
+// HeatmapData is a 2D parameter surface of one metric. Z[y][x] is the best metric value among the
+// tests at that grid point (other parameters vary freely), nil where no test ran.
+type HeatmapData struct {
+	XParameter string       `json:"x_parameter"`
+	YParameter string       `json:"y_parameter"`
+	Metric     string       `json:"metric"`
+	XValues    []float64    `json:"x_values"`
+	YValues    []float64    `json:"y_values"`
+	Z          [][]*float64 `json:"z"`
+	Counts     [][]int      `json:"counts"` // tests per grid point
+}
+
+// Heatmap builds the surface of metric (fitness by default) over two parameters
+func (r *OptimizationResults) Heatmap(xParam, yParam, metric string) (*HeatmapData, error) {
+	if xParam == yParam {
+		return nil, fmt.Errorf("heatmap needs two different parameters")
+	}
+	name, err := r.resolveMetric(metric, optFitnessColumns)
+	if err != nil {
+		return nil, err
+	}
+
+	type point struct{ x, y, z float64 }
+	var points []point
+	xSet, ySet := make(map[float64]bool), make(map[float64]bool)
+	for _, test := range r.Tests {
+		x, okX := test.ParameterValue(xParam)
+		y, okY := test.ParameterValue(yParam)
+		z, okZ := test.Metrics[name]
+		if !okX || !okY || !okZ {
+			continue
+		}
+		points = append(points, point{x, y, z})
+		xSet[x] = true
+		ySet[y] = true
+	}
+	if len(points) == 0 {
+		return nil, fmt.Errorf("no tests have numeric %s and %s parameters (available: %s)",
+			xParam, yParam, strings.Join(r.Parameters, ", "))
+	}
+
+	heatmap := &HeatmapData{XParameter: xParam, YParameter: yParam, Metric: name,
+		XValues: sortedKeys(xSet), YValues: sortedKeys(ySet)}
+	xIndex, yIndex := indexOf(heatmap.XValues), indexOf(heatmap.YValues)
+	heatmap.Z = make([][]*float64, len(heatmap.YValues))
+	heatmap.Counts = make([][]int, len(heatmap.YValues))
+	for i := range heatmap.Z {
+		heatmap.Z[i] = make([]*float64, len(heatmap.XValues))
+		heatmap.Counts[i] = make([]int, len(heatmap.XValues))
+	}
+	for _, p := range points {
+		yi, xi := yIndex[p.y], xIndex[p.x]
+		if cell := heatmap.Z[yi][xi]; cell == nil || p.z > *cell {
+			z := p.z
+			heatmap.Z[yi][xi] = &z
+		}
+		heatmap.Counts[yi][xi]++
+	}
+	return heatmap, nil
+}
+
+// sortedKeys returns the keys of a float set in ascending order
+func sortedKeys(set map[float64]bool) []float64 {
+	keys := make([]float64, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Float64s(keys)
+	return keys
+}
+
+// indexOf maps each value to its position
+func indexOf(values []float64) map[float64]int {
+	index := make(map[float64]int, len(values))
+	for i, v := range values {
+		index[v] = i
+	}
+	return index
+}
+
+// WriteJSON writes the given tests (all tests when nil) with the column lists as JSON
+func (r *OptimizationResults) WriteJSON(w io.Writer, tests []OptimizationTest) error {
+	out := *r
+	if tests != nil {
+		out.Tests = tests
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
+
+// WriteCSV writes the given tests (all tests when nil) as a flat table: run, dates, one column per
+// parameter and one per metric
+func (r *OptimizationResults) WriteCSV(w io.Writer, tests []OptimizationTest) error {
+	if tests == nil {
+		tests = r.Tests
+	}
+	cw := csv.NewWriter(w)
+	header := []string{"run", "is_start_date", "is_end_date", "os_start_date", "os_end_date"}
+	header = append(header, r.Parameters...)
+	header = append(header, r.Metrics...)
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+
+	for _, test := range tests {
+		record := []string{strconv.Itoa(test.Run), test.ISStartDate, test.ISEndDate, test.OSStartDate, test.OSEndDate}
+		for _, name := range r.Parameters {
+			record = append(record, formatParameterValue(test.Parameters[name]))
+		}
+		for _, name := range r.Metrics {
+			value := ""
+			if v, ok := test.Metrics[name]; ok {
+				value = strconv.FormatFloat(v, 'f', -1, 64)
+			}
+			record = append(record, value)
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// formatParameterValue renders a JSON parameter value for CSV output
+func formatParameterValue(v interface{}) string {
+	switch value := v.(type) {
+	case nil:
+		return ""
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	case string:
+		return value
+	default:
+		data, _ := json.Marshal(value)
+		return string(data)
+	}
+}
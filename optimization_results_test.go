@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testOptimizationCSV = "run,parameters_json,All Net Profit,All Max Drawdown,All Trades,Fitness,Comment\n" +
+	"1,{\"iFast\":5,\"iSlow\":50,\"bLong\":true},1000,-500,40,2.0,a\n" +
+	"2,{\"iFast\":5,\"iSlow\":60,\"bLong\":true},1500,-900,35,1.7,b\n" +
+	"3,{\"iFast\":10,\"iSlow\":50,\"bLong\":false},800,-300,12,2.7,c\n" +
+	"4,{\"iFast\":10,\"iSlow\":60,\"bLong\":false},700,-600,50,1.2,d\n" +
+	"5,{\"iFast\":10,\"iSlow\":60,\"bLong\":true},1200,-600,45,2.0,e\n"
+
+func loadTestOptimizationResults(t *testing.T) *OptimizationResults {
+	results, err := readOptimizationResults(mustOPTReader(t, testOptimizationCSV))
+	if err != nil {
+		t.Fatalf("readOptimizationResults failed: %v", err)
+	}
+	return results
+}
+
+func testRuns(tests []OptimizationTest) []int {
+	runs := make([]int, len(tests))
+	for i, test := range tests {
+		runs[i] = test.Run
+	}
+	return runs
+}
+
+func TestReadOptimizationResults(t *testing.T) {
+	results := loadTestOptimizationResults(t)
+
+	if len(results.Tests) != 5 {
+		t.Fatalf("Expected 5 tests, got %d", len(results.Tests))
+	}
+	if strings.Join(results.Metrics, ",") != "all_net_profit,all_max_drawdown,all_trades,fitness" {
+		t.Fatalf("Unexpected metrics: %v", results.Metrics)
+	}
+	if strings.Join(results.Parameters, ",") != "bLong,iFast,iSlow" {
+		t.Fatalf("Unexpected parameters: %v", results.Parameters)
+	}
+	test := results.Tests[2]
+	if v, ok := test.ParameterValue("iFast"); !ok || v != 10 {
+		t.Fatalf("Expected iFast 10, got %v (%v)", v, ok)
+	}
+	if v, ok := test.ParameterValue("bLong"); !ok || v != 0 {
+		t.Fatalf("Expected bLong 0, got %v (%v)", v, ok)
+	}
+	if test.Text["comment"] != "c" {
+		t.Fatalf("Expected the comment column as text, got %v", test.Text)
+	}
+}
+
+func TestOptimizationResultsParameterColumns(t *testing.T) {
+	content := "Param_Length,Input_Mode,Net Profit,Trades\n14,fast,100,10\n20,slow,200,5\n"
+	results, err := readOptimizationResults(mustOPTReader(t, content))
+	if err != nil {
+		t.Fatalf("readOptimizationResults failed: %v", err)
+	}
+	if strings.Join(results.Parameters, ",") != "length,mode" || strings.Join(results.Metrics, ",") != "net_profit,trades" {
+		t.Fatalf("Unexpected columns: parameters %v, metrics %v", results.Parameters, results.Metrics)
+	}
+	if results.Tests[1].Parameters["mode"] != "slow" {
+		t.Fatalf("Expected text parameter value, got %v", results.Tests[1].Parameters)
+	}
+}
+
+func TestOptimizationResultsKeyValueParameters(t *testing.T) {
+	content := "run,parameters_json,Net Profit\n" +
+		"1,iFast=5,iSlow=50,bLong=true,sMode=fast,100\n" +
+		"2,\"iFast=10,iSlow=60,bLong=false,sMode=slow\",200\n" +
+		"3,not parameters,300\n"
+	results, err := readOptimizationResults(mustOPTReader(t, content))
+	if err != nil {
+		t.Fatalf("readOptimizationResults failed: %v", err)
+	}
+	if strings.Join(results.Parameters, ",") != "bLong,iFast,iSlow,sMode" || strings.Join(results.Metrics, ",") != "net_profit" {
+		t.Fatalf("Unexpected columns: parameters %v, metrics %v", results.Parameters, results.Metrics)
+	}
+	want := []map[string]interface{}{
+		{"iFast": 5.0, "iSlow": 50.0, "bLong": true, "sMode": "fast"},
+		{"iFast": 10.0, "iSlow": 60.0, "bLong": false, "sMode": "slow"},
+	}
+	for i, params := range want {
+		test := results.Tests[i]
+		if !reflect.DeepEqual(test.Parameters, params) || test.Text != nil {
+			t.Fatalf("Test %d: expected parameters %v, got %v (text %v)", i+1, params, test.Parameters, test.Text)
+		}
+	}
+	if test := results.Tests[2]; len(test.Parameters) != 0 || test.Text["parameters_json"] != "not parameters" {
+		t.Fatalf("Expected unparseable parameters kept as text, got %v / %v", test.Parameters, test.Text)
+	}
+}
+
+func TestOptimizationResultsQueries(t *testing.T) {
+	results := loadTestOptimizationResults(t)
+
+	top, err := results.TopN(3, "")
+	if err != nil {
+		t.Fatalf("TopN failed: %v", err)
+	}
+	if got := testRuns(top); len(got) != 3 || got[0] != 3 || got[1] != 1 || got[2] != 5 {
+		t.Fatalf("Expected runs [3 1 5] by fitness, got %v", got)
+	}
+	if top, _ := results.TopN(1, "All Net Profit"); top[0].Run != 2 {
+		t.Fatalf("Expected run 2 best by net profit, got %d", top[0].Run)
+	}
+	if _, err := results.TopN(1, "sharpe"); err == nil {
+		t.Fatalf("Expected an error for an unknown metric")
+	}
+
+	front, err := results.ParetoFront()
+	if err != nil {
+		t.Fatalf("ParetoFront failed: %v", err)
+	}
+	// Run 4 is beaten by run 5 (same drawdown, more profit)
+	if got := testRuns(front); len(got) != 4 || got[0] != 3 || got[1] != 1 || got[2] != 5 || got[3] != 2 {
+		t.Fatalf("Expected Pareto front [3 1 5 2], got %v", got)
+	}
+
+	filtered, err := results.FilterMinTrades(40)
+	if err != nil {
+		t.Fatalf("FilterMinTrades failed: %v", err)
+	}
+	if got := testRuns(filtered.Tests); len(got) != 3 || got[0] != 1 || got[1] != 4 || got[2] != 5 {
+		t.Fatalf("Expected runs [1 4 5] with >= 40 trades, got %v", got)
+	}
+}
+
+func TestOptimizationResultsHeatmap(t *testing.T) {
+	results := loadTestOptimizationResults(t)
+
+	heatmap, err := results.Heatmap("iFast", "iSlow", "all_net_profit")
+	if err != nil {
+		t.Fatalf("Heatmap failed: %v", err)
+	}
+	if len(heatmap.XValues) != 2 || len(heatmap.YValues) != 2 {
+		t.Fatalf("Expected a 2x2 grid, got %v x %v", heatmap.XValues, heatmap.YValues)
+	}
+	// iFast=10, iSlow=60 has runs 4 and 5: the best value is kept
+	if cell := heatmap.Z[1][1]; cell == nil || *cell != 1200 || heatmap.Counts[1][1] != 2 {
+		t.Fatalf("Expected 1200 from 2 tests at (10, 60), got %v (%d)", cell, heatmap.Counts[1][1])
+	}
+	if _, err := results.Heatmap("iFast", "iMissing", ""); err == nil {
+		t.Fatalf("Expected an error for a missing parameter")
+	}
+}
+
+func TestOptimizationResultsOutput(t *testing.T) {
+	results := loadTestOptimizationResults(t)
+
+	var buf bytes.Buffer
+	if err := results.WriteCSV(&buf, results.Tests[:2]); err != nil {
+		t.Fatalf("WriteCSV failed: %v", err)
+	}
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("read CSV output: %v", err)
+	}
+	if len(records) != 3 || len(records[0]) != 5+3+4 || records[1][5] != "true" || records[2][7] != "60" {
+		t.Fatalf("Unexpected CSV output: %v", records)
+	}
+
+	buf.Reset()
+	if err := results.WriteJSON(&buf, nil); err != nil {
+		t.Fatalf("WriteJSON failed: %v", err)
+	}
+	var decoded OptimizationResults
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("decode JSON output: %v", err)
+	}
+	if len(decoded.Tests) != 5 || decoded.Tests[4].Metrics["fitness"] != 2.0 {
+		t.Fatalf("Unexpected JSON output: %+v", decoded)
+	}
+}
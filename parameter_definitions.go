@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ParameterDefinition describes a single strategy parameter from the job XML <parameters> section
+type ParameterDefinition struct {
+	Name        string  `json:"name"`
+	ParamType   string  `json:"param_type"` // OptRange, Fixed, FixedString, FixedBool
+	DataType    string  `json:"data_type"`
+	Value       string  `json:"value"`
+	Optimizable bool    `json:"optimizable"`
+	Start       float64 `json:"start"`
+	End         float64 `json:"end"`
+	Step        float64 `json:"step"`
+	HasRange    bool    `json:"has_range"` // true when start/end were present and numeric
+}
+
+// IsOptRange reports whether the parameter is an optimizable range with usable bounds
+func (pd ParameterDefinition) IsOptRange() bool {
+	return pd.ParamType == "OptRange" && pd.HasRange
+}
+
+// StepCount returns the number of steps between start and end (0 if the step is unknown)
+func (pd ParameterDefinition) StepCount() float64 {
+	if !pd.HasRange || pd.Step <= 0 {
+		return 0
+	}
+	return (pd.End - pd.Start) / pd.Step
+}
+
+// extractParametersSection returns the inner content of the first <parameters> section in the XML
+func extractParametersSection(xmlStr string) (string, error) {
+	parametersRegex := regexp.MustCompile(`(?s)<parameters>(.*?)</parameters>`)
+	match := parametersRegex.FindStringSubmatch(xmlStr)
+	if len(match) < 2 {
+		return "", fmt.Errorf("parameters section not found in XML")
+	}
+	return match[1], nil
+}
+
+// parseParameterDefinitions parses the top-level parameter blocks under <parameters>
+// It uses the same block layout as transformParametersToFixed (one element per parameter with
+// value/param_type/data_type/optimizable_ind/start/end/step children).
+func parseParameterDefinitions(parametersXML string) ([]ParameterDefinition, error) {
+	wrapped := "<parameters>" + parametersXML + "</parameters>"
+	dec := xml.NewDecoder(strings.NewReader(wrapped))
+
+	var (
+		defs        []ParameterDefinition
+		depth       int
+		currentName string
+		children    map[string]string
+		childName   string
+		childValue  strings.Builder
+	)
+
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("XML decode parameters: %w", err)
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if t.Name.Local == "parameters" && depth == 0 {
+				continue
+			}
+			depth++
+			if depth == 1 {
+				currentName = t.Name.Local
+				children = make(map[string]string)
+			} else if depth == 2 {
+				childName = t.Name.Local
+				childValue.Reset()
+			}
+
+		case xml.CharData:
+			if depth == 2 && childName != "" {
+				childValue.Write([]byte(t))
+			}
+
+		case xml.EndElement:
+			if t.Name.Local == "parameters" && depth == 0 {
+				continue
+			}
+			if depth == 2 && childName != "" {
+				children[childName] = strings.TrimSpace(childValue.String())
+				childName = ""
+			}
+			if depth == 1 && currentName != "" {
+				defs = append(defs, newParameterDefinition(currentName, children))
+				currentName = ""
+			}
+			depth--
+		}
+	}
+
+	return defs, nil
+}
+
+// newParameterDefinition builds a ParameterDefinition from the parsed child values of a parameter block
+func newParameterDefinition(name string, children map[string]string) ParameterDefinition {
+	pd := ParameterDefinition{
+		Name:        name,
+		ParamType:   children["param_type"],
+		DataType:    children["data_type"],
+		Value:       children["value"],
+		Optimizable: strings.EqualFold(children["optimizable_ind"], "true"),
+	}
+
+	start, startErr := strconv.ParseFloat(children["start"], 64)
+	end, endErr := strconv.ParseFloat(children["end"], 64)
+	if startErr == nil && endErr == nil {
+		pd.Start = start
+		pd.End = end
+		pd.HasRange = true
+		if end < start {
+			pd.Start, pd.End = end, start
+		}
+	}
+	if step, err := strconv.ParseFloat(children["step"], 64); err == nil && step > 0 {
+		pd.Step = step
+	}
+
+	return pd
+}
+
+// parameterDefinitionsFromJobXML locates the <parameters> section of a job XML and parses it
+func parameterDefinitionsFromJobXML(jobXML string) ([]ParameterDefinition, error) {
+	section, err := extractParametersSection(jobXML)
+	if err != nil {
+		return nil, err
+	}
+	return parseParameterDefinitions(section)
+}
+
+// parameterValueAsFloat converts an optimized parameter value (number or numeric string) to float64
+func parameterValueAsFloat(v interface{}) (float64, bool) {
+	switch val := v.(type) {
+	case float64:
+		return val, true
+	case int:
+		return float64(val), true
+	case json.Number:
+		f, err := val.Float64()
+		return f, err == nil
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(val), 64)
+		return f, err == nil
+	case bool:
+		if val {
+			return 1, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
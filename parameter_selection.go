@@ -0,0 +1,273 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// Parameter selection strategies for WFO_RETEST jobs
+const (
+	SelectionBest    = "best"    // the highest fitness test of the run
+	SelectionPlateau = "plateau" // the tested point closest to the centroid of the densest cluster in the top K
+	SelectionMedian  = "median"  // the per-parameter median of the top K tests
+)
+
+// defaultSelectionTopK is the number of best tests the plateau and median strategies look at
+const defaultSelectionTopK = 10
+
+// plateauRadius is the normalized distance (fraction of each parameter's tested range) within which
+// top-K tests count as neighbours of the same plateau
+const plateauRadius = 0.2
+
+// ParameterSelectionConfig configures how the parameters of each WFO run are chosen
+type ParameterSelectionConfig struct {
+	Strategy string `json:"strategy"` // best, plateau or median
+	TopK     int    `json:"top_k"`    // tests considered by plateau and median
+	Metric   string `json:"metric"`   // fitness column, empty for fitness/all_net_profit
+}
+
+// ParameterSelection records which parameters were chosen for a run and why
+type ParameterSelection struct {
+	Run         int                    `json:"run"`
+	Strategy    string                 `json:"strategy"`
+	Metric      string                 `json:"metric,omitempty"`
+	Candidates  int                    `json:"candidates"` // tests of the run in the OPT file
+	TopK        int                    `json:"top_k"`      // tests the strategy looked at
+	Fitness     float64                `json:"fitness"`    // fitness of the chosen test
+	BestFitness float64                `json:"best_fitness"`
+	ClusterSize int                    `json:"cluster_size,omitempty"` // plateau only
+	Parameters  map[string]interface{} `json:"parameters"`
+	Rationale   string                 `json:"rationale"`
+}
+
+// normalized validates the strategy name and fills in defaults
+func (c ParameterSelectionConfig) normalized() (ParameterSelectionConfig, error) {
+	c.Strategy = strings.ToLower(strings.TrimSpace(c.Strategy))
+	switch c.Strategy {
+	case "":
+		c.Strategy = SelectionBest
+	case SelectionBest, SelectionPlateau, SelectionMedian:
+	default:
+		return c, fmt.Errorf("unknown parameter selection strategy: %s", c.Strategy)
+	}
+	if c.TopK <= 0 {
+		c.TopK = defaultSelectionTopK
+	}
+	return c, nil
+}
+
+// selectWFOParameters picks one parameter set per run from the full OPT results and returns the
+// runs in ascending order. Rows without a run number or parameters are ignored.
+func selectWFOParameters(results *OptimizationResults, cfg ParameterSelectionConfig) ([]OPTResult, error) {
+	cfg, err := cfg.normalized()
+	if err != nil {
+		return nil, err
+	}
+	// Files without a fitness column (one row per run) keep file order
+	metric, _ := results.resolveMetric(cfg.Metric, optFitnessColumns)
+	if cfg.Metric != "" && metric == "" {
+		return nil, fmt.Errorf("fitness metric %q not found", cfg.Metric)
+	}
+
+	byRun := make(map[int][]OptimizationTest)
+	var runs []int
+	for _, test := range results.Tests {
+		if test.Run <= 0 || len(test.Parameters) == 0 {
+			fmt.Printf("[WARN] Parameter Selection: Skipping line %d - missing run number or parameters\n", test.Line)
+			continue
+		}
+		if _, seen := byRun[test.Run]; !seen {
+			runs = append(runs, test.Run)
+		}
+		byRun[test.Run] = append(byRun[test.Run], test)
+	}
+	sort.Ints(runs)
+
+	optResults := make([]OPTResult, 0, len(runs))
+	for _, run := range runs {
+		tests := byRun[run]
+		if metric != "" {
+			sort.SliceStable(tests, func(i, j int) bool { return tests[i].Metrics[metric] > tests[j].Metrics[metric] })
+		}
+		chosen, selection := selectRunParameters(tests, cfg, metric)
+		selection.Run = run
+
+		parametersJSON, err := json.Marshal(selection.Parameters)
+		if err != nil {
+			return nil, fmt.Errorf("encode parameters for run %d: %w", run, err)
+		}
+		result := OPTResult{
+			Run:            run,
+			ParametersJSON: string(parametersJSON),
+			ISStartDate:    chosen.ISStartDate,
+			ISEndDate:      chosen.ISEndDate,
+			OSStartDate:    chosen.OSStartDate,
+			OSEndDate:      chosen.OSEndDate,
+			Parameters:     selection.Parameters,
+			Selection:      &selection,
+		}
+		if netProfit, ok := chosen.metric(optNetProfitColumns); ok {
+			result.AllNetProfit = netProfit
+		}
+		optResults = append(optResults, result)
+	}
+	return optResults, nil
+}
+
+// selectRunParameters applies the strategy to the tests of one run, sorted best first
+func selectRunParameters(tests []OptimizationTest, cfg ParameterSelectionConfig, metric string) (OptimizationTest, ParameterSelection) {
+	top := tests
+	if len(top) > cfg.TopK {
+		top = top[:cfg.TopK]
+	}
+	selection := ParameterSelection{Strategy: cfg.Strategy, Metric: metric, Candidates: len(tests), TopK: len(top)}
+	fitness := func(t OptimizationTest) float64 { return t.Metrics[metric] }
+	selection.BestFitness = fitness(tests[0])
+
+	chosen := tests[0]
+	switch {
+	case len(tests) == 1:
+		selection.Rationale = "only one test for this run"
+	case metric == "":
+		selection.Rationale = "no fitness column, first test of the run in file order"
+	case cfg.Strategy == SelectionBest:
+		selection.TopK = 1
+		selection.Rationale = fmt.Sprintf("highest %s of %d tests", metric, len(tests))
+	case cfg.Strategy == SelectionMedian:
+		selection.Parameters = medianParameters(top)
+		chosen = nearestTest(tests, numericParameters(OptimizationTest{Parameters: selection.Parameters}), numericRanges(tests))
+		// The median point may not have been tested; report the nearest tested fitness
+		selection.Rationale = fmt.Sprintf("per-parameter median of the top %d of %d tests by %s, nearest tested fitness %.4g (best %.4g)",
+			len(top), len(tests), metric, fitness(chosen), selection.BestFitness)
+	case cfg.Strategy == SelectionPlateau:
+		ranges := numericRanges(tests)
+		centroid, cluster := plateauCentroid(top, ranges)
+		chosen = nearestTest(tests, centroid, ranges)
+		selection.ClusterSize = cluster
+		selection.Rationale = fmt.Sprintf("tested point nearest the centroid of a %d-test plateau in the top %d of %d tests by %s",
+			cluster, len(top), len(tests), metric)
+	}
+
+	if selection.Parameters == nil {
+		selection.Parameters = chosen.Parameters
+	}
+	selection.Fitness = fitness(chosen)
+	if cfg.Strategy == SelectionPlateau && chosen.Line != tests[0].Line {
+		selection.Rationale += fmt.Sprintf(", fitness %.4g (best %.4g)", selection.Fitness, selection.BestFitness)
+	}
+	return chosen, selection
+}
+
+// numericRanges returns min and max of every numeric parameter across the tests
+func numericRanges(tests []OptimizationTest) map[string][2]float64 {
+	ranges := make(map[string][2]float64)
+	for _, test := range tests {
+		for name := range test.Parameters {
+			v, ok := test.ParameterValue(name)
+			if !ok {
+				continue
+			}
+			r, seen := ranges[name]
+			if !seen {
+				r = [2]float64{v, v}
+			}
+			r[0], r[1] = math.Min(r[0], v), math.Max(r[1], v)
+			ranges[name] = r
+		}
+	}
+	return ranges
+}
+
+// normalizedDistance is the Euclidean distance between two parameter sets with each parameter
+// scaled to its tested range. Parameters that never vary are ignored.
+func normalizedDistance(a, b map[string]float64, ranges map[string][2]float64) float64 {
+	var sum float64
+	for name, r := range ranges {
+		width := r[1] - r[0]
+		if width == 0 {
+			continue
+		}
+		d := (a[name] - b[name]) / width
+		sum += d * d
+	}
+	return math.Sqrt(sum)
+}
+
+// numericParameters returns the numeric parameters of a test
+func numericParameters(test OptimizationTest) map[string]float64 {
+	values := make(map[string]float64, len(test.Parameters))
+	for name := range test.Parameters {
+		if v, ok := test.ParameterValue(name); ok {
+			values[name] = v
+		}
+	}
+	return values
+}
+
+// plateauCentroid finds the top test with the most top neighbours within plateauRadius and returns
+// the mean of that cluster. Ties go to the better ranked seed.
+func plateauCentroid(top []OptimizationTest, ranges map[string][2]float64) (map[string]float64, int) {
+	points := make([]map[string]float64, len(top))
+	for i, test := range top {
+		points[i] = numericParameters(test)
+	}
+
+	var best []int
+	for i := range points {
+		var cluster []int
+		for j := range points {
+			if normalizedDistance(points[i], points[j], ranges) <= plateauRadius {
+				cluster = append(cluster, j)
+			}
+		}
+		if len(cluster) > len(best) {
+			best = cluster
+		}
+	}
+
+	centroid := make(map[string]float64)
+	for name := range ranges {
+		var sum float64
+		for _, j := range best {
+			sum += points[j][name]
+		}
+		centroid[name] = sum / float64(len(best))
+	}
+	return centroid, len(best)
+}
+
+// nearestTest returns the tested point closest to target; tests are sorted best first, so ties
+// keep the better one
+func nearestTest(tests []OptimizationTest, target map[string]float64, ranges map[string][2]float64) OptimizationTest {
+	best, bestDistance := tests[0], math.Inf(1)
+	for _, test := range tests {
+		if d := normalizedDistance(numericParameters(test), target, ranges); d < bestDistance {
+			best, bestDistance = test, d
+		}
+	}
+	return best
+}
+
+// medianParameters takes the lower median of each numeric parameter over the tests, so every value
+// is one that was tested. Non-numeric parameters come from the best test.
+func medianParameters(top []OptimizationTest) map[string]interface{} {
+	params := make(map[string]interface{}, len(top[0].Parameters))
+	for name, value := range top[0].Parameters {
+		params[name] = value
+		if _, isNumber := value.(float64); !isNumber {
+			continue
+		}
+		var values []float64
+		for _, test := range top {
+			if v, ok := test.Parameters[name].(float64); ok {
+				values = append(values, v)
+			}
+		}
+		sort.Float64s(values)
+		params[name] = values[(len(values)-1)/2]
+	}
+	return params
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// Run 1 has an isolated fitness spike at (50, 50) and a plateau around (11, 11); run 2 has a single test
+const testSelectionCSV = "run,parameters_json,is_start_date,is_end_date,os_start_date,os_end_date,all_net_profit,fitness\n" +
+	"1,{\"iA\":50,\"iB\":50,\"sMode\":\"x\"},2010-01-01,2011-01-01,2011-01-02,2011-06-30,5000,10\n" +
+	"1,{\"iA\":10,\"iB\":10,\"sMode\":\"x\"},2010-01-01,2011-01-01,2011-01-02,2011-06-30,4000,8\n" +
+	"1,{\"iA\":12,\"iB\":10,\"sMode\":\"x\"},2010-01-01,2011-01-01,2011-01-02,2011-06-30,3900,7.5\n" +
+	"1,{\"iA\":10,\"iB\":12,\"sMode\":\"x\"},2010-01-01,2011-01-01,2011-01-02,2011-06-30,3950,7.6\n" +
+	"1,{\"iA\":12,\"iB\":12,\"sMode\":\"x\"},2010-01-01,2011-01-01,2011-01-02,2011-06-30,3800,7.4\n" +
+	"1,{\"iA\":30,\"iB\":30,\"sMode\":\"x\"},2010-01-01,2011-01-01,2011-01-02,2011-06-30,1000,3\n" +
+	"1,{\"iA\":50,\"iB\":10,\"sMode\":\"x\"},2010-01-01,2011-01-01,2011-01-02,2011-06-30,100,1\n" +
+	"2,{\"iA\":20,\"iB\":20,\"sMode\":\"y\"},2010-07-01,2011-07-01,2011-07-02,2011-12-31,700,4\n"
+
+func TestSelectWFOParameters(t *testing.T) {
+	tests := []struct {
+		strategy    string
+		wantA       float64
+		wantB       float64
+		wantCheck   string
+		wantFitness float64
+	}{
+		{SelectionBest, 50, 50, "highest fitness of 7 tests", 10},
+		{SelectionPlateau, 10, 10, "4-test plateau in the top 5", 8},
+		{SelectionMedian, 12, 12, "median of the top 5", 7.4},
+	}
+
+	for _, tt := range tests {
+		results, err := readWFOResults(mustOPTReader(t, testSelectionCSV), ParameterSelectionConfig{Strategy: tt.strategy, TopK: 5})
+		if err != nil {
+			t.Fatalf("%s: readWFOResults failed: %v", tt.strategy, err)
+		}
+		if len(results) != 2 || results[0].Run != 1 || results[1].Run != 2 {
+			t.Fatalf("%s: expected one result per run, got %+v", tt.strategy, results)
+		}
+
+		params, err := parseOptimizedParameters(results[0].ParametersJSON)
+		if err != nil {
+			t.Fatalf("%s: parameters JSON %q: %v", tt.strategy, results[0].ParametersJSON, err)
+		}
+		if params["iA"] != tt.wantA || params["iB"] != tt.wantB || params["sMode"] != "x" {
+			t.Fatalf("%s: expected (%v, %v), got %v", tt.strategy, tt.wantA, tt.wantB, params)
+		}
+		s := results[0].Selection
+		if s == nil || s.Strategy != tt.strategy || s.Candidates != 7 || s.Fitness != tt.wantFitness || s.BestFitness != 10 {
+			t.Fatalf("%s: unexpected selection %+v", tt.strategy, s)
+		}
+		if !strings.Contains(s.Rationale, tt.wantCheck) {
+			t.Fatalf("%s: rationale %q does not mention %q", tt.strategy, s.Rationale, tt.wantCheck)
+		}
+		if results[0].OSEndDate != "2011-06-30" || results[1].Selection.Rationale != "only one test for this run" {
+			t.Fatalf("%s: unexpected run data %+v / %+v", tt.strategy, results[0], results[1].Selection)
+		}
+	}
+}
+
+func TestSelectWFOParametersErrors(t *testing.T) {
+	if _, err := readWFOResults(mustOPTReader(t, testSelectionCSV), ParameterSelectionConfig{Strategy: "random"}); err == nil {
+		t.Fatalf("Expected an error for an unknown strategy")
+	}
+	if _, err := readWFOResults(mustOPTReader(t, testSelectionCSV), ParameterSelectionConfig{Metric: "sharpe"}); err == nil {
+		t.Fatalf("Expected an error for an unknown metric")
+	}
+}
+
+func TestWFORetestJobElementRecordsSelection(t *testing.T) {
+	jobXML := "<Job><task_type>WFO</task_type><filename>a.job</filename><parameters><iA><value>1</value><param_type>OptRange</param_type></iA></parameters></Job>"
+	result := OPTResult{
+		Run:            1,
+		ParametersJSON: `{"iA":12}`,
+		Selection:      &ParameterSelection{Strategy: SelectionMedian, Rationale: "median of the top 5 <by fitness>"},
+	}
+	out, err := createWFORetestJobElement(jobXML, result, WFORetestDateRange{}, 1, "job", "@ES", "60", 1, 20)
+	if err != nil {
+		t.Fatalf("createWFORetestJobElement failed: %v", err)
+	}
+	if !strings.Contains(out, "<parameter_selection>median</parameter_selection>") ||
+		!strings.Contains(out, "<parameter_selection_rationale>median of the top 5 &lt;by fitness&gt;</parameter_selection_rationale>") {
+		t.Fatalf("Selection not recorded in job XML: %s", out)
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"strings"
+)
+
+// ParameterStability holds the run-to-run stability metrics for one optimized parameter
+type ParameterStability struct {
+	Name                   string    `json:"name"`
+	Start                  float64   `json:"start"`
+	End                    float64   `json:"end"`
+	Step                   float64   `json:"step"`
+	Runs                   int       `json:"runs"`
+	Values                 []float64 `json:"values"`
+	Mean                   float64   `json:"mean"`
+	StdDev                 float64   `json:"std_dev"`
+	CoefficientOfVariation float64   `json:"coefficient_of_variation"`
+	MeanStepDelta          float64   `json:"mean_step_delta"` // average |run-to-run change| in OptRange steps
+	MaxStepDelta           float64   `json:"max_step_delta"`
+	BoundaryHitRate        float64   `json:"boundary_hit_rate"` // fraction of runs at the start or end of the range
+	Score                  float64   `json:"score"`             // 0-100, higher is more stable
+}
+
+// ParameterStabilityReport summarizes parameter stability across all WFO runs of a job
+type ParameterStabilityReport struct {
+	Runs       int                  `json:"runs"`
+	Parameters []ParameterStability `json:"parameters"`
+	Score      float64              `json:"score"` // average of the per-parameter scores
+}
+
+// analyzeParameterStability measures how much each OptRange parameter moves between WFO runs.
+// Deltas are expressed in OptRange steps so parameters with different scales are comparable;
+// when a definition has no step the full range width is used as the unit instead.
+func analyzeParameterStability(optResults []OPTResult, defs []ParameterDefinition) ParameterStabilityReport {
+	results := make([]OPTResult, len(optResults))
+	copy(results, optResults)
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Run < results[j].Run })
+
+	runParams := make([]map[string]interface{}, 0, len(results))
+	for _, r := range results {
+		params := r.Parameters
+		if params == nil && r.ParametersJSON != "" {
+			parsed, err := parseOptimizedParameters(r.ParametersJSON)
+			if err == nil {
+				params = parsed
+			}
+		}
+		if params != nil {
+			runParams = append(runParams, params)
+		}
+	}
+
+	report := ParameterStabilityReport{Runs: len(runParams)}
+	for _, def := range defs {
+		if !def.IsOptRange() {
+			continue
+		}
+
+		var values []float64
+		for _, params := range runParams {
+			if v, ok := lookupParameterValue(params, def.Name); ok {
+				values = append(values, v)
+			}
+		}
+		if len(values) == 0 {
+			continue
+		}
+
+		report.Parameters = append(report.Parameters, computeParameterStability(def, values))
+	}
+
+	if len(report.Parameters) > 0 {
+		total := 0.0
+		for _, ps := range report.Parameters {
+			total += ps.Score
+		}
+		report.Score = total / float64(len(report.Parameters))
+	}
+
+	return report
+}
+
+// computeParameterStability calculates the stability metrics for one parameter's per-run values
+func computeParameterStability(def ParameterDefinition, values []float64) ParameterStability {
+	ps := ParameterStability{
+		Name:   def.Name,
+		Start:  def.Start,
+		End:    def.End,
+		Step:   def.Step,
+		Runs:   len(values),
+		Values: values,
+	}
+
+	for _, v := range values {
+		ps.Mean += v
+	}
+	ps.Mean /= float64(len(values))
+
+	if len(values) > 1 {
+		sumSq := 0.0
+		for _, v := range values {
+			sumSq += (v - ps.Mean) * (v - ps.Mean)
+		}
+		ps.StdDev = math.Sqrt(sumSq / float64(len(values)-1))
+	}
+	if ps.Mean != 0 {
+		ps.CoefficientOfVariation = ps.StdDev / math.Abs(ps.Mean)
+	}
+
+	unit := def.Step
+	if unit <= 0 {
+		unit = def.End - def.Start
+	}
+	if unit > 0 && len(values) > 1 {
+		total := 0.0
+		for i := 1; i < len(values); i++ {
+			delta := math.Abs(values[i]-values[i-1]) / unit
+			total += delta
+			if delta > ps.MaxStepDelta {
+				ps.MaxStepDelta = delta
+			}
+		}
+		ps.MeanStepDelta = total / float64(len(values)-1)
+	}
+
+	// A value counts as a boundary hit when it is within half a step of either end of the range
+	tolerance := def.Step / 2
+	if tolerance <= 0 {
+		tolerance = 1e-9
+	}
+	hits := 0
+	for _, v := range values {
+		if math.Abs(v-def.Start) <= tolerance || math.Abs(v-def.End) <= tolerance {
+			hits++
+		}
+	}
+	ps.BoundaryHitRate = float64(hits) / float64(len(values))
+
+	ps.Score = 100 * (1 / (1 + ps.MeanStepDelta)) * (1 - 0.5*ps.BoundaryHitRate)
+	return ps
+}
+
+// lookupParameterValue finds a parameter by name (case-insensitive fallback) and returns it as a number
+func lookupParameterValue(params map[string]interface{}, name string) (float64, bool) {
+	if v, ok := params[name]; ok {
+		return parameterValueAsFloat(v)
+	}
+	for key, v := range params {
+		if strings.EqualFold(key, name) {
+			return parameterValueAsFloat(v)
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestParameterStability(t *testing.T) {
+	jobXML := `<Job><parameters>
+		<Length><value>20</value><param_type>OptRange</param_type><data_type>Integer</data_type><optimizable_ind>true</optimizable_ind><start>10</start><end>50</end><step>5</step></Length>
+		<Mult><value>2</value><param_type>OptRange</param_type><data_type>Double</data_type><optimizable_ind>true</optimizable_ind><start>1</start><end>3</end><step>0.5</step></Mult>
+		<Mode><value>A</value><param_type>FixedString</param_type><data_type>String</data_type><optimizable_ind>false</optimizable_ind></Mode>
+	</parameters></Job>`
+
+	defs, err := parameterDefinitionsFromJobXML(jobXML)
+	if err != nil {
+		t.Fatalf("Failed to parse parameter definitions: %v", err)
+	}
+	if len(defs) != 3 {
+		t.Fatalf("Expected 3 parameter definitions, got %d", len(defs))
+	}
+	if !defs[0].IsOptRange() || defs[0].Step != 5 || defs[0].StepCount() != 8 {
+		t.Fatalf("Unexpected Length definition: %+v", defs[0])
+	}
+	if defs[2].IsOptRange() {
+		t.Fatalf("FixedString parameter should not be an OptRange: %+v", defs[2])
+	}
+
+	// Runs are deliberately out of order; Length moves one step per run, Mult sits on the upper bound
+	optResults := []OPTResult{
+		{Run: 2, ParametersJSON: `"{""Length"": 25, ""Mult"": 3}"`},
+		{Run: 1, Parameters: map[string]interface{}{"Length": 20.0, "Mult": 3.0}},
+		{Run: 3, ParametersJSON: `{"length": "30", "Mult": 2.9}`},
+	}
+
+	report := analyzeParameterStability(optResults, defs)
+	if report.Runs != 3 {
+		t.Fatalf("Expected 3 runs, got %d", report.Runs)
+	}
+	if len(report.Parameters) != 2 {
+		t.Fatalf("Expected 2 analyzed parameters, got %d", len(report.Parameters))
+	}
+
+	tests := []struct {
+		name          string
+		meanStepDelta float64
+		maxStepDelta  float64
+		boundaryRate  float64
+		score         float64
+	}{
+		{"Length", 1, 1, 0, 50},
+		{"Mult", 0.1, 0.2, 1, 100 / 1.1 * 0.5},
+	}
+	for i, tc := range tests {
+		ps := report.Parameters[i]
+		if ps.Name != tc.name {
+			t.Fatalf("Parameter %d: expected %s, got %s", i, tc.name, ps.Name)
+		}
+		if math.Abs(ps.MeanStepDelta-tc.meanStepDelta) > 1e-9 {
+			t.Fatalf("%s: expected mean step delta %v, got %v", tc.name, tc.meanStepDelta, ps.MeanStepDelta)
+		}
+		if math.Abs(ps.MaxStepDelta-tc.maxStepDelta) > 1e-9 {
+			t.Fatalf("%s: expected max step delta %v, got %v", tc.name, tc.maxStepDelta, ps.MaxStepDelta)
+		}
+		if math.Abs(ps.BoundaryHitRate-tc.boundaryRate) > 1e-9 {
+			t.Fatalf("%s: expected boundary hit rate %v, got %v", tc.name, tc.boundaryRate, ps.BoundaryHitRate)
+		}
+		if math.Abs(ps.Score-tc.score) > 1e-9 {
+			t.Fatalf("%s: expected score %v, got %v", tc.name, tc.score, ps.Score)
+		}
+	}
+
+	// Length values 20/25/30: mean 25, sample stddev 5
+	if cv := report.Parameters[0].CoefficientOfVariation; math.Abs(cv-0.2) > 1e-9 {
+		t.Fatalf("Expected Length CV 0.2, got %v", cv)
+	}
+	if want := (tests[0].score + tests[1].score) / 2; math.Abs(report.Score-want) > 1e-9 {
+		t.Fatalf("Expected overall score %v, got %v", want, report.Score)
+	}
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// defaultInitialCapital is used when the job XML does not specify <initialCapital>
+const defaultInitialCapital = 100000.0
+
+// tradingDaysPerYear annualizes daily return statistics
+const tradingDaysPerYear = 252.0
+
+// PerformanceMetrics holds the risk/return statistics for an equity curve
+type PerformanceMetrics struct {
+	InitialCapital float64 `json:"initial_capital"`
+	EndingEquity   float64 `json:"ending_equity"`
+	TotalReturn    float64 `json:"total_return"` // fraction of initial capital
+	CAGR           float64 `json:"cagr"`
+	Sharpe         float64 `json:"sharpe"`
+	Sortino        float64 `json:"sortino"`
+	Calmar         float64 `json:"calmar"`
+	UlcerIndex     float64 `json:"ulcer_index"` // percent
+
+	MaxDrawdown             float64 `json:"max_drawdown"`     // currency
+	MaxDrawdownPct          float64 `json:"max_drawdown_pct"` // fraction of the running peak
+	MaxDrawdownDurationDays int     `json:"max_drawdown_duration_days"`
+	RecoveryDays            int     `json:"recovery_days"` // trough to new high for the deepest drawdown
+	Recovered               bool    `json:"recovered"`
+
+	TotalTrades          int     `json:"total_trades"`
+	WinningTrades        int     `json:"winning_trades"`
+	LosingTrades         int     `json:"losing_trades"`
+	WinRate              float64 `json:"win_rate"`
+	ProfitFactor         float64 `json:"profit_factor"`
+	Expectancy           float64 `json:"expectancy"`
+	AverageWin           float64 `json:"average_win"`
+	AverageLoss          float64 `json:"average_loss"`
+	LargestWin           float64 `json:"largest_win"`
+	LargestLoss          float64 `json:"largest_loss"`
+	MaxConsecutiveLosses int     `json:"max_consecutive_losses"`
+	TimeInMarket         float64 `json:"time_in_market"` // fraction of the trading period with an open position
+}
+
+// tradeNetPnL returns the P&L a trade contributes to the equity curve
+func tradeNetPnL(trade TradeRecord) float64 {
+	return trade.PnL - trade.Commission
+}
+
+// initialCapitalFromJobXML reads <initialCapital> from a job XML, falling back to the default
+func initialCapitalFromJobXML(jobXML string) float64 {
+	value, err := extractXMLTagValue(jobXML, "initialCapital")
+	if err != nil {
+		return defaultInitialCapital
+	}
+	capital, err := strconv.ParseFloat(value, 64)
+	if err != nil || capital <= 0 {
+		fmt.Printf("[WARN] Metrics: Invalid initialCapital '%s', using default %.0f\n", value, defaultInitialCapital)
+		return defaultInitialCapital
+	}
+	return capital
+}
+
+// calculatePerformanceMetrics computes the metrics for a curve whose daily arrays are already populated.
+// Trades supply the per-trade statistics; the curve's Dates/CumulativePnL supply the return statistics.
+func calculatePerformanceMetrics(curve *EquityCurveData, trades []TradeRecord, initialCapital float64) *PerformanceMetrics {
+	m := &PerformanceMetrics{
+		InitialCapital: initialCapital,
+		EndingEquity:   initialCapital,
+	}
+
+	calculateTradeStatistics(m, trades)
+
+	if len(curve.CumulativePnL) == 0 {
+		return m
+	}
+
+	equity := curve.CumulativePnL
+	m.EndingEquity = equity[len(equity)-1]
+	if initialCapital > 0 {
+		m.TotalReturn = (m.EndingEquity - initialCapital) / initialCapital
+	}
+
+	// Daily returns against the previous day's equity, starting from the initial capital
+	returns := make([]float64, len(equity))
+	prev := initialCapital
+	for i, e := range equity {
+		if prev > 0 {
+			returns[i] = (e - prev) / prev
+		}
+		prev = e
+	}
+	m.Sharpe, m.Sortino = annualizedRatios(returns)
+
+	episodes, underwater := analyzeDrawdowns(curve.Dates, equity, initialCapital)
+	calculateDrawdownStatistics(m, episodes, underwater)
+
+	dates := parseEquityDates(curve.Dates)
+
+	start, end := tradingPeriod(curve, trades, dates)
+	if years := end.Sub(start).Hours() / 24 / 365.25; years > 0 && initialCapital > 0 && m.EndingEquity > 0 {
+		m.CAGR = math.Pow(m.EndingEquity/initialCapital, 1/years) - 1
+	}
+	if m.MaxDrawdownPct > 0 {
+		m.Calmar = m.CAGR / m.MaxDrawdownPct
+	}
+	m.TimeInMarket = timeInMarket(trades, start, end)
+
+	return m
+}
+
+// calculateTradeStatistics fills in the per-trade metrics (win rate, profit factor, streaks, ...).
+// Breakeven trades count towards the total but neither extend nor end a losing streak.
+func calculateTradeStatistics(m *PerformanceMetrics, trades []TradeRecord) {
+	sorted := make([]TradeRecord, len(trades))
+	copy(sorted, trades)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Timestamp.Before(sorted[j].Timestamp) })
+
+	grossWin, grossLoss := 0.0, 0.0
+	streak := 0
+	for _, trade := range sorted {
+		pnl := tradeNetPnL(trade)
+		m.TotalTrades++
+		if pnl > 0 {
+			m.WinningTrades++
+			grossWin += pnl
+			if pnl > m.LargestWin {
+				m.LargestWin = pnl
+			}
+			streak = 0
+		} else if pnl < 0 {
+			m.LosingTrades++
+			grossLoss += pnl
+			if pnl < m.LargestLoss {
+				m.LargestLoss = pnl
+			}
+			streak++
+			if streak > m.MaxConsecutiveLosses {
+				m.MaxConsecutiveLosses = streak
+			}
+		}
+	}
+
+	if m.TotalTrades > 0 {
+		m.WinRate = float64(m.WinningTrades) / float64(m.TotalTrades)
+		m.Expectancy = (grossWin + grossLoss) / float64(m.TotalTrades)
+	}
+	if m.WinningTrades > 0 {
+		m.AverageWin = grossWin / float64(m.WinningTrades)
+	}
+	if m.LosingTrades > 0 {
+		m.AverageLoss = grossLoss / float64(m.LosingTrades)
+	}
+	if grossLoss < 0 {
+		m.ProfitFactor = grossWin / -grossLoss
+	}
+}
+
+// annualizedRatios returns the annualized Sharpe and Sortino ratios (zero risk-free rate)
+func annualizedRatios(returns []float64) (float64, float64) {
+	if len(returns) < 2 {
+		return 0, 0
+	}
+
+	mean := 0.0
+	for _, r := range returns {
+		mean += r
+	}
+	mean /= float64(len(returns))
+
+	variance, downside := 0.0, 0.0
+	for _, r := range returns {
+		variance += (r - mean) * (r - mean)
+		if r < 0 {
+			downside += r * r
+		}
+	}
+	stdDev := math.Sqrt(variance / float64(len(returns)-1))
+	downsideDev := math.Sqrt(downside / float64(len(returns)))
+
+	sharpe, sortino := 0.0, 0.0
+	if stdDev > 0 {
+		sharpe = mean / stdDev * math.Sqrt(tradingDaysPerYear)
+	}
+	if downsideDev > 0 {
+		sortino = mean / downsideDev * math.Sqrt(tradingDaysPerYear)
+	}
+	return sharpe, sortino
+}
+
+// calculateDrawdownStatistics computes max drawdown (absolute and percent), ulcer index,
+// the longest peak-to-recovery duration and the recovery time of the deepest drawdown
+func calculateDrawdownStatistics(m *PerformanceMetrics, episodes []DrawdownEpisode, underwater []float64) {
+	m.Recovered = true
+	for _, ep := range episodes {
+		if ep.Depth > m.MaxDrawdown {
+			m.MaxDrawdown = ep.Depth
+		}
+		if ep.DepthPct > m.MaxDrawdownPct {
+			m.MaxDrawdownPct = ep.DepthPct
+			m.RecoveryDays = ep.RecoveryDays
+			m.Recovered = ep.Recovered
+		}
+		if ep.LengthDays > m.MaxDrawdownDurationDays {
+			m.MaxDrawdownDurationDays = ep.LengthDays
+		}
+	}
+
+	if len(underwater) > 0 {
+		sumSq := 0.0
+		for _, u := range underwater {
+			sumSq += (u * 100) * (u * 100)
+		}
+		m.UlcerIndex = math.Sqrt(sumSq / float64(len(underwater)))
+	}
+}
+
+// parseEquityDates parses the curve's YYYY-MM-DD dates (zero time for unparseable entries)
+func parseEquityDates(dates []string) []time.Time {
+	parsed := make([]time.Time, len(dates))
+	for i, d := range dates {
+		if t, err := time.Parse("2006-01-02", d); err == nil {
+			parsed[i] = t
+		}
+	}
+	return parsed
+}
+
+// tradingPeriod returns the period the metrics are annualized over: the curve's start/end dates when
+// set, otherwise the span from the first trade entry to the last equity date
+func tradingPeriod(curve *EquityCurveData, trades []TradeRecord, dates []time.Time) (time.Time, time.Time) {
+	var start, end time.Time
+	if t, err := time.Parse("20060102", curve.StartDate); err == nil {
+		start = t
+	}
+	if t, err := time.Parse("20060102", curve.EndDate); err == nil {
+		end = t
+	}
+
+	for _, trade := range trades {
+		first := trade.EntryTimestamp
+		if first.IsZero() {
+			first = trade.Timestamp
+		}
+		if !first.IsZero() && (start.IsZero() || first.Before(start)) {
+			start = first
+		}
+	}
+	if len(dates) > 0 && !dates[len(dates)-1].IsZero() && (end.IsZero() || dates[len(dates)-1].After(end)) {
+		end = dates[len(dates)-1]
+	}
+	return start, end
+}
+
+// timeInMarket returns the fraction of [start, end] covered by at least one open trade
+func timeInMarket(trades []TradeRecord, start, end time.Time) float64 {
+	total := end.Sub(start)
+	if total <= 0 {
+		return 0
+	}
+
+	type interval struct{ from, to time.Time }
+	var intervals []interval
+	for _, trade := range trades {
+		if trade.EntryTimestamp.IsZero() || trade.Timestamp.IsZero() || trade.Timestamp.Before(trade.EntryTimestamp) {
+			continue
+		}
+		intervals = append(intervals, interval{trade.EntryTimestamp, trade.Timestamp})
+	}
+	if len(intervals) == 0 {
+		return 0
+	}
+	sort.Slice(intervals, func(i, j int) bool { return intervals[i].from.Before(intervals[j].from) })
+
+	var covered time.Duration
+	cur := intervals[0]
+	for _, iv := range intervals[1:] {
+		if iv.from.After(cur.to) {
+			covered += cur.to.Sub(cur.from)
+			cur = iv
+		} else if iv.to.After(cur.to) {
+			cur.to = iv.to
+		}
+	}
+	covered += cur.to.Sub(cur.from)
+
+	fraction := covered.Seconds() / total.Seconds()
+	if fraction > 1 {
+		fraction = 1
+	}
+	return fraction
+}
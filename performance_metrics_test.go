@@ -0,0 +1,112 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestPerformanceMetrics(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2020, 1, d, 16, 0, 0, 0, time.UTC) }
+	trade := func(entry, exit int, pnl float64) TradeRecord {
+		return TradeRecord{
+			Date:           day(exit).Format("20060102"),
+			Time:           "1600",
+			PnL:            pnl,
+			Timestamp:      day(exit),
+			EntryTimestamp: day(entry),
+			TestType:       "OS",
+		}
+	}
+
+	// Equity: 10000 -> 11000 -> 10500 -> 10000 -> 11500
+	trades := []TradeRecord{
+		trade(1, 2, 1000),
+		trade(3, 4, -500),
+		trade(5, 6, -500),
+		trade(7, 8, 1500),
+	}
+
+	ac := &APIClient{}
+	curve := EquityCurveData{InitialCapital: 10000, StartDate: "20200101", EndDate: "20200109"}
+	if err := ac.calculateEquityProgression(&curve, trades); err != nil {
+		t.Fatalf("calculateEquityProgression failed: %v", err)
+	}
+	m := curve.Metrics
+	if m == nil {
+		t.Fatalf("Expected metrics to be populated")
+	}
+
+	near := func(name string, got, want float64) {
+		if math.Abs(got-want) > 1e-9 {
+			t.Fatalf("%s: expected %v, got %v", name, want, got)
+		}
+	}
+	near("ending equity", m.EndingEquity, 11500)
+	near("total return", m.TotalReturn, 0.15)
+	near("max drawdown", m.MaxDrawdown, 1000)
+	near("max drawdown pct", m.MaxDrawdownPct, 1000.0/11000.0)
+	near("win rate", m.WinRate, 0.5)
+	near("profit factor", m.ProfitFactor, 2.5)
+	near("expectancy", m.Expectancy, 375)
+	near("average win", m.AverageWin, 1250)
+	near("average loss", m.AverageLoss, -500)
+	near("largest win", m.LargestWin, 1500)
+	near("largest loss", m.LargestLoss, -500)
+	near("time in market", m.TimeInMarket, 0.5) // four 1-day trades over 8 days
+
+	if m.MaxConsecutiveLosses != 2 {
+		t.Fatalf("Expected 2 consecutive losses, got %d", m.MaxConsecutiveLosses)
+	}
+	if m.MaxDrawdownDurationDays != 6 || m.RecoveryDays != 2 || !m.Recovered {
+		t.Fatalf("Unexpected drawdown timing: duration=%d recovery=%d recovered=%t",
+			m.MaxDrawdownDurationDays, m.RecoveryDays, m.Recovered)
+	}
+	if m.Sharpe <= 0 || m.Sortino <= 0 || m.CAGR <= 0 || m.Calmar <= 0 || m.UlcerIndex <= 0 {
+		t.Fatalf("Expected positive ratios, got %+v", m)
+	}
+}
+
+func TestTradeStatisticsBreakeven(t *testing.T) {
+	trades := func(pnls ...float64) []TradeRecord {
+		records := make([]TradeRecord, len(pnls))
+		for i, pnl := range pnls {
+			records[i] = TradeRecord{PnL: pnl, Timestamp: time.Date(2020, 1, 1+i, 16, 0, 0, 0, time.UTC)}
+		}
+		return records
+	}
+	tests := []struct {
+		name          string
+		pnls          []float64
+		losing        int
+		maxLossStreak int
+	}{
+		{"only breakeven", []float64{0, 0, 0}, 0, 0},
+		{"breakeven inside a losing streak", []float64{-100, 0, -100, 0, -100, 200}, 3, 3},
+		{"breakeven after a win", []float64{-100, 200, 0, -100}, 2, 1},
+	}
+	for _, tt := range tests {
+		m := &PerformanceMetrics{}
+		calculateTradeStatistics(m, trades(tt.pnls...))
+		if m.LosingTrades != tt.losing || m.MaxConsecutiveLosses != tt.maxLossStreak || m.MaxConsecutiveLosses > m.LosingTrades {
+			t.Fatalf("%s: expected %d losing trades and %d consecutive losses, got %d and %d",
+				tt.name, tt.losing, tt.maxLossStreak, m.LosingTrades, m.MaxConsecutiveLosses)
+		}
+	}
+}
+
+func TestInitialCapitalFromJobXML(t *testing.T) {
+	tests := []struct {
+		xml  string
+		want float64
+	}{
+		{"<Job><initialCapital>50000</initialCapital></Job>", 50000},
+		{"<Job><initialCapital>abc</initialCapital></Job>", defaultInitialCapital},
+		{"<Job></Job>", defaultInitialCapital},
+	}
+	for _, tc := range tests {
+		if got := initialCapitalFromJobXML(tc.xml); got != tc.want {
+			t.Fatalf("initialCapitalFromJobXML(%q) = %v, want %v", tc.xml, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,549 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PortfolioContribution is one symbol's share of the combined MM portfolio
+type PortfolioContribution struct {
+	Symbol                 string  `json:"symbol"`
+	Source                 string  `json:"source"` // trades CSV or daily summary file used
+	Trades                 int     `json:"trades"` // 0 when built from a daily summary
+	NetProfit              float64 `json:"net_profit"`
+	ProfitShare            float64 `json:"profit_share"`     // NetProfit / portfolio net profit
+	DailyVolatility        float64 `json:"daily_volatility"` // standard deviation of daily P&L
+	MaxDrawdown            float64 `json:"max_drawdown"`     // standalone, currency (<= 0)
+	CorrelationToPortfolio float64 `json:"correlation_to_portfolio"`
+}
+
+// CorrelationMatrix holds the pairwise Pearson correlations of daily returns
+type CorrelationMatrix struct {
+	Symbols []string    `json:"symbols"`
+	Values  [][]float64 `json:"values"`
+}
+
+// PortfolioDiversification summarizes how much combining the symbols reduced risk
+type PortfolioDiversification struct {
+	DiversificationRatio float64 `json:"diversification_ratio"`  // sum of symbol volatilities / portfolio volatility
+	EffectiveSymbols     float64 `json:"effective_symbols"`      // DiversificationRatio squared
+	AverageCorrelation   float64 `json:"average_correlation"`    // mean of the off-diagonal correlations
+	SumOfMaxDrawdowns    float64 `json:"sum_of_max_drawdowns"`   // standalone drawdowns added up (<= 0)
+	PortfolioMaxDrawdown float64 `json:"portfolio_max_drawdown"` // drawdown of the combined curve (<= 0)
+	DrawdownReduction    float64 `json:"drawdown_reduction"`     // 1 - portfolio / sum of standalone drawdowns
+}
+
+// PortfolioSummary describes the combined result of an MM job
+type PortfolioSummary struct {
+	JobID           string                   `json:"job_id"`
+	Timeframe       string                   `json:"timeframe"`
+	Symbols         []string                 `json:"symbols"`
+	GeneratedAt     string                   `json:"generated_at"`
+	InitialCapital  float64                  `json:"initial_capital"`
+	NetProfit       float64                  `json:"net_profit"`
+	Contributions   []PortfolioContribution  `json:"contributions"`
+	Correlation     CorrelationMatrix        `json:"correlation"`
+	Diversification PortfolioDiversification `json:"diversification"`
+}
+
+// PortfolioResult is the uploaded file: the combined and per-symbol curves plus the summary
+type PortfolioResult struct {
+	EquityCurves map[string]EquityCurveData `json:"equity_curves"`
+	Portfolio    *PortfolioSummary          `json:"portfolio"`
+}
+
+// symbolDailyPnL is one symbol's (or timeframe's) daily P&L as read from its trades CSV or daily summary
+type symbolDailyPnL struct {
+	Symbol    string
+	Timeframe string
+	Source    string
+	Daily     map[string]float64 // YYYY-MM-DD -> P&L
+	Trades    []TradeRecord      // nil when read from a daily summary
+}
+
+// dailyPnLFromTrades sums net trade P&L per exit date
+func dailyPnLFromTrades(trades []TradeRecord) map[string]float64 {
+	daily := make(map[string]float64)
+	for _, trade := range trades {
+		daily[formatDateForEquity(trade.Date)] += tradeNetPnL(trade)
+	}
+	return daily
+}
+
+// dailyPnLFromSummary reads daily P&L for a symbol from a daily summary (.rep) file.
+// Both {"equity_curves": {...}} and a bare curve are accepted. The per-day net_profit array is
+// used when present, otherwise consecutive differences of cumulative_pnl.
+func dailyPnLFromSummary(path, symbol string) (map[string]float64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read daily summary: %w", err)
+	}
+
+	var curve *EquityCurveData
+	var wrapped struct {
+		EquityCurves map[string]EquityCurveData `json:"equity_curves"`
+	}
+	if err := json.Unmarshal(data, &wrapped); err == nil && len(wrapped.EquityCurves) > 0 {
+		keys := make([]string, 0, len(wrapped.EquityCurves))
+		for key := range wrapped.EquityCurves {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			c := wrapped.EquityCurves[key]
+			if curve == nil || c.Symbol == symbol {
+				curve = &c
+			}
+			if c.Symbol == symbol {
+				break
+			}
+		}
+	} else {
+		var bare EquityCurveData
+		if err := json.Unmarshal(data, &bare); err != nil {
+			return nil, fmt.Errorf("parse daily summary: %w", err)
+		}
+		curve = &bare
+	}
+	if curve == nil || len(curve.Dates) == 0 {
+		return nil, fmt.Errorf("daily summary has no dates")
+	}
+
+	daily := make(map[string]float64, len(curve.Dates))
+	switch {
+	case len(curve.NetProfit) == len(curve.Dates):
+		for i, date := range curve.Dates {
+			daily[formatDateForEquity(date)] += curve.NetProfit[i]
+		}
+	case len(curve.CumulativePnL) == len(curve.Dates):
+		prev := 0.0
+		for i, date := range curve.Dates {
+			daily[formatDateForEquity(date)] += curve.CumulativePnL[i] - prev
+			prev = curve.CumulativePnL[i]
+		}
+	default:
+		return nil, fmt.Errorf("daily summary has no per-day values")
+	}
+	return daily, nil
+}
+
+// buildPortfolio combines the symbols' daily P&L into one portfolio curve and computes
+// contributions, the correlation matrix of daily returns and diversification metrics.
+// Days on which a symbol had no result count as a zero return for that symbol.
+func (ac *APIClient) buildPortfolio(jobID, timeframe string, series []symbolDailyPnL, initialCapital float64) (*PortfolioResult, error) {
+	if len(series) == 0 {
+		return nil, fmt.Errorf("no symbol results to combine")
+	}
+	if initialCapital <= 0 {
+		initialCapital = defaultInitialCapital
+	}
+
+	dateSet := make(map[string]bool)
+	for _, s := range series {
+		for date := range s.Daily {
+			dateSet[date] = true
+		}
+	}
+	dates := make([]string, 0, len(dateSet))
+	for date := range dateSet {
+		dates = append(dates, date)
+	}
+	sort.Strings(dates)
+
+	// Aligned daily P&L per symbol and for the portfolio
+	aligned := make([][]float64, len(series))
+	portfolioPnL := make([]float64, len(dates))
+	var allTrades []TradeRecord
+	for i, s := range series {
+		aligned[i] = make([]float64, len(dates))
+		for j, date := range dates {
+			aligned[i][j] = s.Daily[date]
+			portfolioPnL[j] += s.Daily[date]
+		}
+		allTrades = append(allTrades, s.Trades...)
+	}
+	// Trade statistics only make sense if every symbol supplied its trades
+	for _, s := range series {
+		if s.Trades == nil {
+			allTrades = nil
+			break
+		}
+	}
+
+	result := &PortfolioResult{EquityCurves: make(map[string]EquityCurveData)}
+	portfolio := EquityCurveData{
+		TaskType:       "MM",
+		TestType:       "PORTFOLIO",
+		Symbol:         "PORTFOLIO",
+		Timeframe:      timeframe,
+		Run:            "Combined",
+		ProjectID:      ac.projectID(),
+		JobID:          jobID,
+		InitialCapital: initialCapital,
+	}
+	if len(dates) > 0 {
+		portfolio.StartDate = dates[0]
+		portfolio.EndDate = dates[len(dates)-1]
+	}
+	ac.populateEquityCurve(&portfolio, dates, portfolioPnL, allTrades, initialCapital)
+	result.EquityCurves[fmt.Sprintf("PORTFOLIO-%s", timeframe)] = portfolio
+
+	summary := &PortfolioSummary{
+		JobID:          jobID,
+		Timeframe:      timeframe,
+		GeneratedAt:    time.Now().UTC().Format(time.RFC3339),
+		InitialCapital: initialCapital,
+	}
+	for _, v := range portfolioPnL {
+		summary.NetProfit += v
+	}
+
+	// Per-symbol standalone curves (each on the full capital) and contributions
+	sumVol, sumDD := 0.0, 0.0
+	for i, s := range series {
+		curve := EquityCurveData{
+			TaskType:       "MM",
+			TestType:       "PORTFOLIO",
+			Symbol:         s.Symbol,
+			Timeframe:      timeframe,
+			Run:            "Combined",
+			ProjectID:      portfolio.ProjectID,
+			JobID:          jobID,
+			StartDate:      portfolio.StartDate,
+			EndDate:        portfolio.EndDate,
+			InitialCapital: initialCapital,
+		}
+		ac.populateEquityCurve(&curve, dates, aligned[i], s.Trades, initialCapital)
+		result.EquityCurves[fmt.Sprintf("%s-%s", s.Symbol, timeframe)] = curve
+
+		c := PortfolioContribution{
+			Symbol:                 s.Symbol,
+			Source:                 s.Source,
+			Trades:                 len(s.Trades),
+			DailyVolatility:        sampleStdDev(aligned[i]),
+			MaxDrawdown:            minValue(curve.Drawdown),
+			CorrelationToPortfolio: pearsonCorrelation(aligned[i], portfolioPnL),
+		}
+		for _, v := range aligned[i] {
+			c.NetProfit += v
+		}
+		if summary.NetProfit != 0 {
+			c.ProfitShare = c.NetProfit / summary.NetProfit
+		}
+		sumVol += c.DailyVolatility
+		sumDD += c.MaxDrawdown
+		summary.Symbols = append(summary.Symbols, s.Symbol)
+		summary.Contributions = append(summary.Contributions, c)
+	}
+
+	// Correlations of P&L equal those of returns on a common capital base
+	summary.Correlation = CorrelationMatrix{Symbols: summary.Symbols, Values: make([][]float64, len(series))}
+	pairSum, pairs := 0.0, 0
+	for i := range series {
+		summary.Correlation.Values[i] = make([]float64, len(series))
+		for j := range series {
+			if i == j {
+				summary.Correlation.Values[i][j] = 1
+				continue
+			}
+			corr := pearsonCorrelation(aligned[i], aligned[j])
+			summary.Correlation.Values[i][j] = corr
+			if j > i {
+				pairSum += corr
+				pairs++
+			}
+		}
+	}
+
+	d := &summary.Diversification
+	if pairs > 0 {
+		d.AverageCorrelation = pairSum / float64(pairs)
+	}
+	if portfolioVol := sampleStdDev(portfolioPnL); portfolioVol > 0 {
+		d.DiversificationRatio = sumVol / portfolioVol
+		d.EffectiveSymbols = d.DiversificationRatio * d.DiversificationRatio
+	}
+	d.SumOfMaxDrawdowns = sumDD
+	d.PortfolioMaxDrawdown = minValue(portfolio.Drawdown)
+	if sumDD < 0 {
+		d.DrawdownReduction = 1 - d.PortfolioMaxDrawdown/sumDD
+	}
+
+	result.Portfolio = summary
+	return result, nil
+}
+
+// projectID returns the configured project, tolerating a client without config
+func (ac *APIClient) projectID() string {
+	if ac.config != nil {
+		return ac.config.Supabase.ProjectID
+	}
+	return ""
+}
+
+// pearsonCorrelation returns the correlation of two equally long series (0 if either is constant)
+func pearsonCorrelation(a, b []float64) float64 {
+	n := len(a)
+	if n < 2 || len(b) != n {
+		return 0
+	}
+	meanA, meanB := 0.0, 0.0
+	for i := 0; i < n; i++ {
+		meanA += a[i]
+		meanB += b[i]
+	}
+	meanA /= float64(n)
+	meanB /= float64(n)
+
+	var cov, varA, varB float64
+	for i := 0; i < n; i++ {
+		da, db := a[i]-meanA, b[i]-meanB
+		cov += da * db
+		varA += da * da
+		varB += db * db
+	}
+	if varA == 0 || varB == 0 {
+		return 0
+	}
+	return cov / math.Sqrt(varA*varB)
+}
+
+// sampleStdDev returns the sample standard deviation (0 for fewer than two values)
+func sampleStdDev(values []float64) float64 {
+	if len(values) < 2 {
+		return 0
+	}
+	mean := 0.0
+	for _, v := range values {
+		mean += v
+	}
+	mean /= float64(len(values))
+	sumSq := 0.0
+	for _, v := range values {
+		sumSq += (v - mean) * (v - mean)
+	}
+	return math.Sqrt(sumSq / float64(len(values)-1))
+}
+
+// minValue returns the smallest value, or 0 for an empty slice
+func minValue(values []float64) float64 {
+	m := 0.0
+	for i, v := range values {
+		if i == 0 || v < m {
+			m = v
+		}
+	}
+	return m
+}
+
+// PortfolioAggregator waits for all symbols of expanded MM jobs to report back and uploads the combined portfolio
+type PortfolioAggregator struct {
+	config    *Config
+	api       *APIClient
+	mutex     sync.Mutex
+	isRunning bool
+	stopCh    chan struct{}
+	logf      func(string)
+}
+
+// NewPortfolioAggregator creates a new PortfolioAggregator
+func NewPortfolioAggregator(config *Config, api *APIClient) *PortfolioAggregator {
+	return &PortfolioAggregator{
+		config: config,
+		api:    api,
+		logf:   func(s string) {}, // default no-op logger
+	}
+}
+
+// SetLogger sets the logging function
+func (pa *PortfolioAggregator) SetLogger(fn func(string)) {
+	if fn != nil {
+		pa.logf = fn
+	}
+}
+
+// Start begins checking pending MM manifests
+func (pa *PortfolioAggregator) Start() error {
+	pa.mutex.Lock()
+	defer pa.mutex.Unlock()
+
+	if pa.isRunning {
+		return nil
+	}
+
+	pa.isRunning = true
+	pa.stopCh = make(chan struct{})
+	pa.logf("Portfolio aggregation started")
+
+	go pa.monitorManifests()
+	return nil
+}
+
+// Stop stops checking manifests
+func (pa *PortfolioAggregator) Stop() {
+	pa.mutex.Lock()
+	defer pa.mutex.Unlock()
+
+	if !pa.isRunning {
+		return
+	}
+	pa.isRunning = false
+	close(pa.stopCh)
+	pa.logf("Portfolio aggregation stopped")
+}
+
+// monitorManifests periodically aggregates MM jobs whose symbols have all reported
+func (pa *PortfolioAggregator) monitorManifests() {
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-pa.stopCh:
+			return
+		case <-ticker.C:
+			if err := pa.processManifests(); err != nil {
+				pa.logf(fmt.Sprintf("Error processing MM manifests: %v", err))
+			}
+		}
+	}
+}
+
+// processManifests aggregates every pending MM manifest that is complete
+func (pa *PortfolioAggregator) processManifests() error {
+	manifests, err := loadJobManifests(pa.config.Folders.Files.Jobs.Manifests)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range manifests {
+		if m.Status != ManifestPending || m.TaskType != "MM" {
+			continue
+		}
+		series, missing := pa.collectSymbolResults(m)
+		if len(missing) > 0 {
+			continue // still waiting for results
+		}
+		if err := pa.aggregate(m, series); err != nil {
+			pa.logf(fmt.Sprintf("Portfolio aggregation failed for job %s: %v", m.JobID, err))
+		}
+	}
+	return nil
+}
+
+// collectSymbolResults reads each symbol's daily P&L. Symbols without any result yet are returned in missing.
+func (pa *PortfolioAggregator) collectSymbolResults(m *JobManifest) ([]symbolDailyPnL, []string) {
+	var series []symbolDailyPnL
+	var missing []string
+	for _, symbol := range m.Symbols {
+		s, ok := loadResultSeries(pa.config, m.JobID, symbol, "", pa.logf)
+		if !ok {
+			missing = append(missing, symbol)
+			continue
+		}
+		series = append(series, *s)
+	}
+	return series, missing
+}
+
+// loadResultSeries reads the daily P&L of one fanned-out job element, preferring the trades CSV
+// over the daily summary. An empty timeframe matches any timeframe.
+func loadResultSeries(cfg *Config, jobID, symbol, timeframe string, logf func(string)) (*symbolDailyPnL, bool) {
+	if path := findResultFile(cfg.Folders.Files.Results.Trades, jobID, symbol, timeframe, "_trades.csv"); path != "" {
+		trades, err := readTradesCSVFile(path, nil) // Polled, so no per-record output
+		if err == nil {
+			return &symbolDailyPnL{Symbol: symbol, Timeframe: timeframe, Source: filepath.Base(path), Daily: dailyPnLFromTrades(trades), Trades: trades}, true
+		}
+		logf(fmt.Sprintf("Could not read trades for %s %s (job %s): %v", symbol, timeframe, jobID, err))
+	}
+
+	for _, dir := range []string{cfg.Folders.Files.Opt.Summary, cfg.Folders.Files.Opt.Done} {
+		path := findResultFile(dir, jobID, symbol, timeframe, "_Daily.rep")
+		if path == "" {
+			continue
+		}
+		daily, err := dailyPnLFromSummary(path, symbol)
+		if err != nil {
+			logf(fmt.Sprintf("Could not read daily summary for %s %s (job %s): %v", symbol, timeframe, jobID, err))
+			continue
+		}
+		return &symbolDailyPnL{Symbol: symbol, Timeframe: timeframe, Source: filepath.Base(path), Daily: daily}, true
+	}
+	return nil, false
+}
+
+// findResultFile returns the newest <job>_<symbol>_<timeframe>..<suffix> file in dir whose symbol
+// and timeframe parts match exactly (so a combined "@ES-@NQ" or "60-120" file is not mistaken for a
+// single element), or "" if there is none. An empty timeframe matches any. As for daily summary
+// names, the "@" prefix may be missing from the file name.
+func findResultFile(dir, jobID, symbol, timeframe, suffix string) string {
+	matches, err := filepath.Glob(filepath.Join(dir, fmt.Sprintf("%s_*%s", jobID, suffix)))
+	if err != nil {
+		return ""
+	}
+
+	newest := ""
+	var newestTime time.Time
+	for _, path := range matches {
+		parts := strings.Split(filepath.Base(path), "_")
+		if len(parts) < 3 || strings.TrimPrefix(parts[1], "@") != strings.TrimPrefix(symbol, "@") {
+			continue
+		}
+		if timeframe != "" && parts[2] != timeframe {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		if newest == "" || info.ModTime().After(newestTime) {
+			newest = path
+			newestTime = info.ModTime()
+		}
+	}
+	return newest
+}
+
+// aggregate builds, saves and uploads the portfolio for a complete manifest, then marks it done
+func (pa *PortfolioAggregator) aggregate(m *JobManifest, series []symbolDailyPnL) error {
+	timeframe := strings.Join(m.Timeframes, "-")
+	result, err := pa.api.buildPortfolio(m.JobID, timeframe, series, m.InitialCapital)
+	if err != nil {
+		return fmt.Errorf("build portfolio: %w", err)
+	}
+
+	data, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal portfolio: %w", err)
+	}
+	fileName := fmt.Sprintf("%s_PORTFOLIO_%s_MM_Daily.rep", m.JobID, timeframe)
+	path := filepath.Join(pa.config.Folders.Files.Results.Portfolio, fileName)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("create portfolio directory: %w", err)
+	}
+	if err := writeFileAtomic(path, data, 0644); err != nil {
+		return fmt.Errorf("write portfolio: %w", err)
+	}
+
+	pa.logf(fmt.Sprintf("Uploading MM portfolio summary for job %s (%d symbols)", m.JobID, len(series)))
+	if _, err := pa.api.UploadDailySummary(path, m.JobID); err != nil {
+		return fmt.Errorf("upload portfolio: %w", err)
+	}
+
+	m.Status = ManifestAggregated
+	m.CompletedAt = time.Now().UTC().Format(time.RFC3339)
+	m.OutputFile = fileName
+	if err := saveJobManifest(pa.config.Folders.Files.Jobs.Manifests, m); err != nil {
+		return fmt.Errorf("update manifest: %w", err)
+	}
+	pa.logf(fmt.Sprintf("MM portfolio for job %s uploaded: net profit %.2f, diversification ratio %.2f",
+		m.JobID, result.Portfolio.NetProfit, result.Portfolio.Diversification.DiversificationRatio))
+	return nil
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBuildPortfolio(t *testing.T) {
+	// ES and NQ move in opposite directions on the first three days
+	series := []symbolDailyPnL{
+		{Symbol: "@ES", Daily: map[string]float64{"2020-01-02": 100, "2020-01-03": -50, "2020-01-06": 200}},
+		{Symbol: "@NQ", Daily: map[string]float64{"2020-01-02": -100, "2020-01-03": 50, "2020-01-07": 300}},
+	}
+
+	ac := &APIClient{}
+	result, err := ac.buildPortfolio("job1", "60", series, 10000)
+	if err != nil {
+		t.Fatalf("buildPortfolio failed: %v", err)
+	}
+
+	curve, ok := result.EquityCurves["PORTFOLIO-60"]
+	if !ok {
+		t.Fatalf("Expected a PORTFOLIO-60 curve, got keys %v", result.EquityCurves)
+	}
+	wantEquity := []float64{10000, 10000, 10200, 10500}
+	if len(curve.CumulativePnL) != len(wantEquity) {
+		t.Fatalf("Expected %d days, got %d", len(wantEquity), len(curve.CumulativePnL))
+	}
+	for i, want := range wantEquity {
+		if curve.CumulativePnL[i] != want {
+			t.Fatalf("Day %d: expected equity %v, got %v", i, want, curve.CumulativePnL[i])
+		}
+	}
+
+	p := result.Portfolio
+	if p.NetProfit != 500 {
+		t.Fatalf("Expected net profit 500, got %v", p.NetProfit)
+	}
+	if len(p.Contributions) != 2 || p.Contributions[0].NetProfit != 250 || p.Contributions[1].NetProfit != 250 {
+		t.Fatalf("Unexpected contributions: %+v", p.Contributions)
+	}
+	if p.Contributions[0].ProfitShare != 0.5 {
+		t.Fatalf("Expected profit share 0.5, got %v", p.Contributions[0].ProfitShare)
+	}
+	if p.Correlation.Values[0][0] != 1 || p.Correlation.Values[0][1] != p.Correlation.Values[1][0] {
+		t.Fatalf("Correlation matrix not symmetric with unit diagonal: %v", p.Correlation.Values)
+	}
+	if p.Correlation.Values[0][1] >= 0 {
+		t.Fatalf("Expected negative correlation, got %v", p.Correlation.Values[0][1])
+	}
+	if p.Diversification.DiversificationRatio <= 1 {
+		t.Fatalf("Expected diversification ratio above 1, got %v", p.Diversification.DiversificationRatio)
+	}
+	if p.Diversification.PortfolioMaxDrawdown != 0 || p.Diversification.DrawdownReduction != 1 {
+		t.Fatalf("Expected the offsetting losses to remove the drawdown, got %+v", p.Diversification)
+	}
+}
+
+func TestPearsonCorrelation(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b []float64
+		want float64
+	}{
+		{"identical", []float64{1, 2, 3}, []float64{1, 2, 3}, 1},
+		{"opposite", []float64{1, 2, 3}, []float64{3, 2, 1}, -1},
+		{"constant", []float64{1, 1, 1}, []float64{1, 2, 3}, 0},
+		{"length mismatch", []float64{1, 2}, []float64{1, 2, 3}, 0},
+	}
+	for _, tt := range tests {
+		if got := pearsonCorrelation(tt.a, tt.b); math.Abs(got-tt.want) > 1e-12 {
+			t.Fatalf("%s: expected %v, got %v", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestJobManifestAndResultFiles(t *testing.T) {
+	expanded := "<root>\n<Job><Symbol>@ES</Symbol><Timeframe>60</Timeframe><initialCapital>50000</initialCapital></Job>\n" +
+		"<Job><Symbol>@NQ</Symbol><Timeframe>60</Timeframe><initialCapital>50000</initialCapital></Job>\n</root>"
+	m, err := newJobManifest("job1", "MM", expanded)
+	if err != nil {
+		t.Fatalf("newJobManifest failed: %v", err)
+	}
+	if len(m.Symbols) != 2 || m.Symbols[1] != "@NQ" || len(m.Timeframes) != 1 || m.InitialCapital != 50000 {
+		t.Fatalf("Unexpected manifest: %+v", m)
+	}
+
+	dir := t.TempDir()
+	if err := saveJobManifest(dir, m); err != nil {
+		t.Fatalf("saveJobManifest failed: %v", err)
+	}
+	loaded, err := loadJobManifests(dir)
+	if err != nil || len(loaded) != 1 || loaded[0].Status != ManifestPending {
+		t.Fatalf("Expected one pending manifest, got %v (err %v)", loaded, err)
+	}
+
+	// The combined MM summary must not be taken for a single symbol
+	for _, name := range []string{"job1_@ES-@NQ_60_MM_MM_Daily.rep", "job1_ES_60_MM_Daily.rep"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(`{"dates":["20200102"],"cumulative_pnl":[150]}`), 0644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+	if got := findResultFile(dir, "job1", "@ES", "", "_Daily.rep"); filepath.Base(got) != "job1_ES_60_MM_Daily.rep" {
+		t.Fatalf("Expected the @ES summary, got %q", got)
+	}
+	if got := findResultFile(dir, "job1", "@NQ", "", "_Daily.rep"); got != "" {
+		t.Fatalf("Expected no @NQ summary, got %q", got)
+	}
+
+	daily, err := dailyPnLFromSummary(filepath.Join(dir, "job1_ES_60_MM_Daily.rep"), "@ES")
+	if err != nil || daily["2020-01-02"] != 150 {
+		t.Fatalf("Expected 150 on 2020-01-02, got %v (err %v)", daily, err)
+	}
+}
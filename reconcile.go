@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// staleTempAge is how old a temporary file must be before the reconciler treats it as abandoned
+const staleTempAge = 5 * time.Minute
+
+// ReconcileSummary counts what the startup reconciler did
+type ReconcileSummary struct {
+	RemovedPartials int // Half-written files of CreateAtomic
+	ResumedJobs     int // Download temps turned into .job files
+	QuarantinedJobs int // Unusable download temps and corrupt .job files moved to Jobs.Error
+}
+
+// Reconcile cleans up after an interrupted run before monitoring starts: stale half-written files
+// are removed, downloads that stopped between the download and the compression are completed, and
+// download temps or .job files that cannot be used are moved to Jobs.Error.
+func (dm *DownloadManager) Reconcile() ReconcileSummary {
+	var summary ReconcileSummary
+	cutoff := time.Now().Add(-staleTempAge)
+	files := dm.config.Folders.Files
+
+	for _, folder := range dm.config.DataFolders() {
+		for _, name := range staleFiles(folder, cutoff, isAtomicTempFile) {
+			if err := os.Remove(filepath.Join(folder, name)); err != nil {
+				dm.logf(fmt.Sprintf("Reconcile: could not remove %s: %v", name, err))
+				continue
+			}
+			summary.RemovedPartials++
+		}
+	}
+
+	todo := files.Jobs.ToDo
+	isTemp := func(name string) bool { return strings.HasSuffix(name, "_temp.xml") }
+	for _, name := range staleFiles(todo, cutoff, isTemp) {
+		path := filepath.Join(todo, name)
+		if isRawDownloadCopy(path) {
+			continue
+		}
+		if err := checkWellFormedXML(path); err != nil {
+			dm.quarantineJobFile(path, err)
+			summary.QuarantinedJobs++
+			continue
+		}
+		job := Job{ID: strings.TrimSuffix(name, "_temp.xml")}
+		compressedPath, err := dm.completeDownload(job, path)
+		if err != nil {
+			dm.logf(fmt.Sprintf("Reconcile: could not resume download of job %s: %v", job.ID, err))
+			if _, statErr := os.Stat(path); statErr == nil {
+				dm.quarantineJobFile(path, err)
+				summary.QuarantinedJobs++
+			}
+			continue
+		}
+		dm.logf(fmt.Sprintf("Reconcile: resumed interrupted download of job %s as %s", job.ID, filepath.Base(compressedPath)))
+		summary.ResumedJobs++
+	}
+
+	isJob := func(name string) bool { return strings.EqualFold(filepath.Ext(name), ".job") }
+	for _, name := range staleFiles(todo, cutoff, isJob) {
+		path := filepath.Join(todo, name)
+		if check := verifyArtifact(path); check.Error != "" {
+			dm.quarantineJobFile(path, fmt.Errorf("%s", check.Error))
+			summary.QuarantinedJobs++
+		}
+	}
+
+	if summary != (ReconcileSummary{}) {
+		dm.logf(fmt.Sprintf("Reconcile: removed %d partial file(s), resumed %d download(s), moved %d unusable job file(s) to %s",
+			summary.RemovedPartials, summary.ResumedJobs, summary.QuarantinedJobs, files.Jobs.Error))
+	}
+	return summary
+}
+
+// quarantineJobFile moves a job file TSClient must not pick up to Jobs.Error
+func (dm *DownloadManager) quarantineJobFile(path string, reason error) {
+	target := filepath.Join(dm.config.Folders.Files.Jobs.Error, filepath.Base(path))
+	if err := moveFile(path, target); err != nil {
+		dm.logf(fmt.Sprintf("Reconcile: could not move %s to the error folder: %v", filepath.Base(path), err))
+		return
+	}
+	dm.logf(fmt.Sprintf("Reconcile: moved %s to the error folder: %v", filepath.Base(path), reason))
+}
+
+// staleFiles lists the regular files in dir matching keep that were last modified before cutoff
+func staleFiles(dir string, cutoff time.Time, keep func(name string) bool) []string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	var names []string
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || !keep(entry.Name()) {
+			continue
+		}
+		if info, err := entry.Info(); err == nil && info.ModTime().Before(cutoff) {
+			names = append(names, entry.Name())
+		}
+	}
+	return names
+}
+
+// isRawDownloadCopy reports whether a *_temp.xml file is the raw copy DownloadFile keeps next to
+// the job (named after the filename in the XML) rather than an unfinished download (named after the job ID)
+func isRawDownloadCopy(path string) bool {
+	name := filepath.Base(path)
+	if strings.HasSuffix(name, "_temp_temp.xml") {
+		return true
+	}
+	data, err := readAtRestFile(path)
+	if err != nil {
+		return false
+	}
+	filename, err := extractFilenameFromXML(string(data))
+	if err != nil {
+		return false
+	}
+	return name == strings.TrimSuffix(filename, filepath.Ext(filename))+"_temp.xml"
+}
+
+// checkWellFormedXML reads an XML file to the end, which catches files cut off mid-write
+func checkWellFormedXML(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	decoder := xml.NewDecoder(f)
+	depth, elements := 0, 0
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("invalid XML: %w", err)
+		}
+		switch token.(type) {
+		case xml.StartElement:
+			depth++
+			elements++
+		case xml.EndElement:
+			depth--
+		}
+	}
+	if elements == 0 || depth != 0 {
+		return fmt.Errorf("incomplete XML")
+	}
+	return nil
+}
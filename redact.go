@@ -0,0 +1,119 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// redactedMark replaces every redacted value
+const redactedMark = "[REDACTED]"
+
+// maxRedactedSecrets caps the literal secrets remembered; rotated tokens push out the oldest
+const maxRedactedSecrets = 64
+
+// Patterns for secrets that are recognisable without knowing their value
+var (
+	jwtPattern            = regexp.MustCompile(`eyJ[A-Za-z0-9_-]{8,}\.[A-Za-z0-9_-]{8,}\.[A-Za-z0-9_-]+`)
+	bearerPattern         = regexp.MustCompile(`(?i)(bearer\s+)[A-Za-z0-9._~+/=-]+`)
+	secretJSONPattern     = regexp.MustCompile(`(?i)("(?:access_token|refresh_token|api_key|apikey|anon_key|password|device_code|token)"\s*:\s*)"(?:[^"\\]|\\.)*"`)
+	secretQueryPattern    = regexp.MustCompile(`(?i)\b((?:access_token|refresh_token|api_key|apikey|password|token|sig|signature)=)[^&\s"']+`)
+	emailPattern          = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)
+	parametersXMLPattern  = regexp.MustCompile(`(?s)(<parameters>).*?(</parameters>)`)
+	parametersJSONPattern = regexp.MustCompile(`(?i)("parameters(?:_json)?"\s*:\s*)("(?:[^"\\]|\\.)*"|\{[^{}]*\})`)
+)
+
+// Redactor removes credentials, email addresses and optionally strategy parameters from text
+// before it reaches a log sink or an error message
+type Redactor struct {
+	mu               sync.RWMutex
+	secrets          []string // literal values such as refresh tokens and passwords
+	redactParameters bool
+}
+
+// logRedactor is applied by every log sink; configureLogPrivacy sets it up from the config
+var logRedactor = &Redactor{redactParameters: true}
+
+// AddSecret makes the redactor replace value wherever it appears. Short values are ignored,
+// they would mangle unrelated text.
+func (r *Redactor) AddSecret(value string) {
+	if len(value) < 6 {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, s := range r.secrets {
+		if s == value {
+			return
+		}
+	}
+	r.secrets = append(r.secrets, value)
+	if len(r.secrets) > maxRedactedSecrets {
+		r.secrets = r.secrets[len(r.secrets)-maxRedactedSecrets:]
+	}
+}
+
+// SetRedactParameters switches redaction of strategy parameters on or off
+func (r *Redactor) SetRedactParameters(on bool) {
+	r.mu.Lock()
+	r.redactParameters = on
+	r.mu.Unlock()
+}
+
+// RedactsParameters reports whether strategy parameters are hidden
+func (r *Redactor) RedactsParameters() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.redactParameters
+}
+
+// Redact returns s with every known and recognisable secret replaced
+func (r *Redactor) Redact(s string) string {
+	r.mu.RLock()
+	secrets, parameters := r.secrets, r.redactParameters
+	r.mu.RUnlock()
+
+	for _, secret := range secrets {
+		s = strings.ReplaceAll(s, secret, redactedMark)
+	}
+	s = jwtPattern.ReplaceAllString(s, redactedMark)
+	s = bearerPattern.ReplaceAllString(s, "${1}"+redactedMark)
+	s = secretJSONPattern.ReplaceAllString(s, `${1}"`+redactedMark+`"`)
+	s = secretQueryPattern.ReplaceAllString(s, "${1}"+redactedMark)
+	s = emailPattern.ReplaceAllString(s, "[EMAIL]")
+	if parameters {
+		s = parametersXMLPattern.ReplaceAllString(s, "${1}"+redactedMark+"${2}")
+		s = parametersJSONPattern.ReplaceAllString(s, `${1}"`+redactedMark+`"`)
+	}
+	return s
+}
+
+// RedactParameters returns a placeholder for raw strategy parameters (JSON or XML) when they are
+// hidden, and the credential-redacted value otherwise
+func (r *Redactor) RedactParameters(s string) string {
+	if r.RedactsParameters() {
+		return redactedMark
+	}
+	return r.Redact(s)
+}
+
+// redact applies the log redactor
+func redact(s string) string {
+	return logRedactor.Redact(s)
+}
+
+// responseSnippet returns a redacted, shortened server response body for error messages
+func responseSnippet(body []byte) string {
+	s := redact(strings.TrimSpace(string(body)))
+	if len(s) > 200 {
+		s = s[:200] + "..."
+	}
+	return s
+}
+
+// configureLogPrivacy applies the logging privacy settings: parameter redaction and debug dumps
+func configureLogPrivacy(cfg *Config) {
+	logRedactor.SetRedactParameters(cfg.Logging.RedactParameters)
+	logRedactor.AddSecret(cfg.Auth.Password)
+	debugDumps.Configure(cfg.Logging.DebugDumps, cfg.Logging.DebugDumpDir, cfg.Logging.DebugDumpRetention)
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// MonthlyReturn is one cell of the calendar returns grid
+type MonthlyReturn struct {
+	Year      int     `json:"year"`
+	Month     int     `json:"month"`
+	Label     string  `json:"label"` // YYYY-MM
+	PnL       float64 `json:"pnl"`
+	ReturnPct float64 `json:"return_pct"` // fraction of equity at the start of the month
+	Trades    int     `json:"trades"`
+}
+
+// YearlyReturn is one row total of the calendar returns grid
+type YearlyReturn struct {
+	Year      int     `json:"year"`
+	PnL       float64 `json:"pnl"`
+	ReturnPct float64 `json:"return_pct"` // fraction of equity at the start of the year
+	Trades    int     `json:"trades"`
+}
+
+// ReturnsCalendar holds monthly and yearly P&L tables plus summary statistics
+type ReturnsCalendar struct {
+	InitialCapital      float64         `json:"initial_capital"`
+	Monthly             []MonthlyReturn `json:"monthly"`
+	Yearly              []YearlyReturn  `json:"yearly"`
+	BestMonth           *MonthlyReturn  `json:"best_month,omitempty"`
+	WorstMonth          *MonthlyReturn  `json:"worst_month,omitempty"`
+	PositiveMonths      int             `json:"positive_months"`
+	TotalMonths         int             `json:"total_months"`
+	PositiveMonthsShare float64         `json:"positive_months_share"`
+}
+
+// calendarEvent is a dated P&L amount fed into the calendar aggregation
+type calendarEvent struct {
+	when   time.Time
+	pnl    float64
+	trades int
+}
+
+// buildReturnsCalendarFromTrades aggregates trade P&L by exit month
+func buildReturnsCalendarFromTrades(trades []TradeRecord, initialCapital float64) ReturnsCalendar {
+	events := make([]calendarEvent, 0, len(trades))
+	for _, trade := range trades {
+		if trade.Timestamp.IsZero() {
+			continue
+		}
+		events = append(events, calendarEvent{when: trade.Timestamp, pnl: tradeNetPnL(trade), trades: 1})
+	}
+	return buildReturnsCalendar(events, initialCapital)
+}
+
+// buildReturnsCalendarFromEquity aggregates a daily equity series (YYYY-MM-DD dates) by month
+func buildReturnsCalendarFromEquity(dates []string, equity []float64, initialCapital float64) ReturnsCalendar {
+	events := make([]calendarEvent, 0, len(dates))
+	prev := initialCapital
+	for i, d := range dates {
+		if i >= len(equity) {
+			break
+		}
+		when, err := time.Parse("2006-01-02", d)
+		if err != nil {
+			continue
+		}
+		events = append(events, calendarEvent{when: when, pnl: equity[i] - prev})
+		prev = equity[i]
+	}
+	return buildReturnsCalendar(events, initialCapital)
+}
+
+// buildReturnsCalendar builds the grid from dated P&L. Every month between the first and last
+// event is present (months without activity have zero P&L) so the grid has no gaps. Percent
+// returns compound: each period is measured against the equity at its start.
+func buildReturnsCalendar(events []calendarEvent, initialCapital float64) ReturnsCalendar {
+	cal := ReturnsCalendar{InitialCapital: initialCapital}
+	if len(events) == 0 {
+		return cal
+	}
+
+	sort.SliceStable(events, func(i, j int) bool { return events[i].when.Before(events[j].when) })
+
+	type monthKey struct{ year, month int }
+	byMonth := make(map[monthKey]*MonthlyReturn)
+	for _, ev := range events {
+		key := monthKey{ev.when.Year(), int(ev.when.Month())}
+		m, ok := byMonth[key]
+		if !ok {
+			m = &MonthlyReturn{Year: key.year, Month: key.month}
+			byMonth[key] = m
+		}
+		m.PnL += ev.pnl
+		m.Trades += ev.trades
+	}
+
+	first, last := events[0].when, events[len(events)-1].when
+	cursor := time.Date(first.Year(), first.Month(), 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(last.Year(), last.Month(), 1, 0, 0, 0, 0, time.UTC)
+
+	equity := initialCapital
+	var year *YearlyReturn
+	yearStartEquity := equity
+	for !cursor.After(end) {
+		key := monthKey{cursor.Year(), int(cursor.Month())}
+		m := MonthlyReturn{Year: key.year, Month: key.month}
+		if found, ok := byMonth[key]; ok {
+			m = *found
+		}
+		m.Label = fmt.Sprintf("%04d-%02d", m.Year, m.Month)
+		if equity > 0 {
+			m.ReturnPct = m.PnL / equity
+		}
+
+		if year == nil || year.Year != m.Year {
+			if year != nil {
+				cal.Yearly = append(cal.Yearly, *year)
+			}
+			year = &YearlyReturn{Year: m.Year}
+			yearStartEquity = equity
+		}
+		equity += m.PnL
+		year.PnL += m.PnL
+		year.Trades += m.Trades
+		if yearStartEquity > 0 {
+			year.ReturnPct = year.PnL / yearStartEquity
+		}
+
+		cal.Monthly = append(cal.Monthly, m)
+		cursor = cursor.AddDate(0, 1, 0)
+	}
+	if year != nil {
+		cal.Yearly = append(cal.Yearly, *year)
+	}
+
+	for i := range cal.Monthly {
+		m := &cal.Monthly[i]
+		if m.PnL > 0 {
+			cal.PositiveMonths++
+		}
+		if cal.BestMonth == nil || m.PnL > cal.BestMonth.PnL {
+			cal.BestMonth = m
+		}
+		if cal.WorstMonth == nil || m.PnL < cal.WorstMonth.PnL {
+			cal.WorstMonth = m
+		}
+	}
+	cal.TotalMonths = len(cal.Monthly)
+	cal.PositiveMonthsShare = float64(cal.PositiveMonths) / float64(cal.TotalMonths)
+
+	return cal
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestReturnsCalendarFromTrades(t *testing.T) {
+	exit := func(y int, m time.Month, d int, pnl float64) TradeRecord {
+		return TradeRecord{PnL: pnl, Timestamp: time.Date(y, m, d, 16, 0, 0, 0, time.UTC)}
+	}
+	trades := []TradeRecord{
+		exit(2021, time.February, 5, 1050),
+		exit(2020, time.November, 15, 1010),
+		exit(2021, time.January, 10, -500),
+		exit(2021, time.January, 20, 200),
+		{PnL: 999}, // No exit time, ignored
+	}
+	trades[1].Commission = 10 // Net of commission, like the equity curve
+
+	cal := buildReturnsCalendarFromTrades(trades, 10000)
+	want := []MonthlyReturn{
+		{Year: 2020, Month: 11, Label: "2020-11", PnL: 1000, ReturnPct: 0.1, Trades: 1},
+		{Year: 2020, Month: 12, Label: "2020-12"}, // Empty month keeps the grid continuous
+		{Year: 2021, Month: 1, Label: "2021-01", PnL: -300, ReturnPct: -300.0 / 11000, Trades: 2},
+		{Year: 2021, Month: 2, Label: "2021-02", PnL: 1050, ReturnPct: 1050.0 / 10700, Trades: 1},
+	}
+	if len(cal.Monthly) != len(want) {
+		t.Fatalf("Expected %d months, got %+v", len(want), cal.Monthly)
+	}
+	for i, m := range cal.Monthly {
+		if math.Abs(m.ReturnPct-want[i].ReturnPct) > 1e-12 {
+			t.Fatalf("%s: return %v, want %v", m.Label, m.ReturnPct, want[i].ReturnPct)
+		}
+		m.ReturnPct = want[i].ReturnPct
+		if m != want[i] {
+			t.Fatalf("month %d: got %+v, want %+v", i, m, want[i])
+		}
+	}
+
+	// Years compound: 2021 is measured against the equity at the end of 2020
+	wantYears := []YearlyReturn{
+		{Year: 2020, PnL: 1000, ReturnPct: 0.1, Trades: 1},
+		{Year: 2021, PnL: 750, ReturnPct: 750.0 / 11000, Trades: 3},
+	}
+	if len(cal.Yearly) != len(wantYears) {
+		t.Fatalf("Expected %d years, got %+v", len(wantYears), cal.Yearly)
+	}
+	for i, y := range cal.Yearly {
+		if y.Year != wantYears[i].Year || y.PnL != wantYears[i].PnL || y.Trades != wantYears[i].Trades ||
+			math.Abs(y.ReturnPct-wantYears[i].ReturnPct) > 1e-12 {
+			t.Fatalf("year %d: got %+v, want %+v", i, y, wantYears[i])
+		}
+	}
+
+	if cal.BestMonth == nil || cal.BestMonth.Label != "2021-02" || cal.WorstMonth == nil || cal.WorstMonth.Label != "2021-01" {
+		t.Fatalf("Unexpected best/worst months %+v / %+v", cal.BestMonth, cal.WorstMonth)
+	}
+	if cal.PositiveMonths != 2 || cal.TotalMonths != 4 || cal.PositiveMonthsShare != 0.5 {
+		t.Fatalf("Unexpected month counts %d/%d (%v)", cal.PositiveMonths, cal.TotalMonths, cal.PositiveMonthsShare)
+	}
+}
+
+func TestReturnsCalendarFromEquity(t *testing.T) {
+	dates := []string{"2020-12-30", "2020-12-31", "2021-01-04", "not a date"}
+	equity := []float64{10100, 10200, 10098, 99999}
+	cal := buildReturnsCalendarFromEquity(dates, equity, 10000)
+
+	wantMonths := map[string][2]float64{"2020-12": {200, 0.02}, "2021-01": {-102, -0.01}}
+	if len(cal.Monthly) != len(wantMonths) {
+		t.Fatalf("Expected %d months, got %+v", len(wantMonths), cal.Monthly)
+	}
+	for _, m := range cal.Monthly {
+		want := wantMonths[m.Label]
+		if math.Abs(m.PnL-want[0]) > 1e-9 || math.Abs(m.ReturnPct-want[1]) > 1e-12 {
+			t.Fatalf("%s: got %v (%v), want %v (%v)", m.Label, m.PnL, m.ReturnPct, want[0], want[1])
+		}
+	}
+	if len(cal.Yearly) != 2 || math.Abs(cal.Yearly[0].ReturnPct-0.02) > 1e-12 || math.Abs(cal.Yearly[1].ReturnPct+0.01) > 1e-12 {
+		t.Fatalf("Unexpected yearly returns %+v", cal.Yearly)
+	}
+}
+
+func TestReturnsCalendarEmpty(t *testing.T) {
+	cal := buildReturnsCalendarFromTrades(nil, 10000)
+	if len(cal.Monthly) != 0 || len(cal.Yearly) != 0 || cal.BestMonth != nil || cal.TotalMonths != 0 || cal.InitialCapital != 10000 {
+		t.Fatalf("Expected an empty calendar, got %+v", cal)
+	}
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/zalando/go-keyring"
+)
+
+// keyringService is the OS keyring service name sessions are stored under
+const keyringService = "AlphaWeaver"
+
+// sessionFileMagic starts every encrypted session file; it is also the AES-GCM additional data
+var sessionFileMagic = []byte("AWSESS1\n")
+
+// errNoStoredSession is returned by Load when nothing has been saved
+var errNoStoredSession = errors.New("no stored session")
+
+// StoredSession is what survives a restart: enough to resume with RefreshToken, or for a
+// registered machine its ID and API key
+type StoredSession struct {
+	Email        string    `json:"email,omitempty"`
+	RefreshToken string    `json:"refresh_token,omitempty"`
+	MachineID    string    `json:"machine_id,omitempty"`
+	MachineName  string    `json:"machine_name,omitempty"`
+	APIKey       string    `json:"api_key,omitempty"`
+	SavedAt      time.Time `json:"saved_at"`
+}
+
+// sessionStore persists the session between runs
+type sessionStore interface {
+	Name() string
+	Load() (*StoredSession, error) // errNoStoredSession when there is none
+	Save(s *StoredSession) error
+	Delete() error
+}
+
+// newSessionStore returns the configured store: the OS keyring with the encrypted file as fallback,
+// or only the file when the keyring is disabled. Nil when persistence is off.
+func newSessionStore(cfg *Config) sessionStore {
+	if !cfg.Auth.PersistSession {
+		return nil
+	}
+	return newCredentialStore(cfg.Auth.UseKeyring, cfg.Supabase.ProjectID, cfg.Auth.SessionFile)
+}
+
+// newCredentialStore returns a store for one keyring account, falling back to the encrypted file at path
+func newCredentialStore(useKeyring bool, account, path string) sessionStore {
+	file := &fileSessionStore{path: path, account: account}
+	if !useKeyring {
+		return file
+	}
+	return &layeredSessionStore{
+		primary:  &keyringSessionStore{service: keyringService, account: account},
+		fallback: file,
+	}
+}
+
+// keyringSessionStore keeps the session as JSON in the OS keyring (Windows Credential Manager,
+// macOS Keychain, Secret Service on Linux)
+type keyringSessionStore struct {
+	service string
+	account string
+}
+
+func (ks *keyringSessionStore) Name() string { return "OS keyring" }
+
+func (ks *keyringSessionStore) Load() (*StoredSession, error) {
+	data, err := keyring.Get(ks.service, ks.account)
+	if errors.Is(err, keyring.ErrNotFound) {
+		return nil, errNoStoredSession
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read keyring: %w", err)
+	}
+	var s StoredSession
+	if err := json.Unmarshal([]byte(data), &s); err != nil {
+		return nil, fmt.Errorf("parse keyring session: %w", err)
+	}
+	return &s, nil
+}
+
+func (ks *keyringSessionStore) Save(s *StoredSession) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return fmt.Errorf("marshal session: %w", err)
+	}
+	if err := keyring.Set(ks.service, ks.account, string(data)); err != nil {
+		return fmt.Errorf("write keyring: %w", err)
+	}
+	return nil
+}
+
+func (ks *keyringSessionStore) Delete() error {
+	if err := keyring.Delete(ks.service, ks.account); err != nil && !errors.Is(err, keyring.ErrNotFound) {
+		return fmt.Errorf("delete keyring session: %w", err)
+	}
+	return nil
+}
+
+// fileSessionStore keeps the session in a 0600 file encrypted with AES-256-GCM under a key derived
+// from the machine ID and the OS user, so a copied file cannot be used on another machine
+type fileSessionStore struct {
+	path    string
+	account string
+	key     []byte // derived on first use; set directly by tests
+}
+
+func (fs *fileSessionStore) Name() string { return "encrypted file" }
+
+// aead returns the cipher for the machine-bound key
+func (fs *fileSessionStore) aead() (cipher.AEAD, error) {
+	if fs.key == nil {
+		fs.key = machineBoundKey(fs.account)
+	}
+	block, err := aes.NewCipher(fs.key)
+	if err != nil {
+		return nil, fmt.Errorf("create cipher: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+func (fs *fileSessionStore) Load() (*StoredSession, error) {
+	info, err := os.Stat(fs.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, errNoStoredSession
+	}
+	if err != nil {
+		return nil, fmt.Errorf("stat session file: %w", err)
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm()&0077 != 0 {
+		return nil, fmt.Errorf("session file %s is accessible by other users (mode %v)", fs.path, info.Mode().Perm())
+	}
+	data, err := os.ReadFile(fs.path)
+	if err != nil {
+		return nil, fmt.Errorf("read session file: %w", err)
+	}
+
+	aead, err := fs.aead()
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(data, sessionFileMagic) || len(data) < len(sessionFileMagic)+aead.NonceSize() {
+		return nil, fmt.Errorf("session file %s is not an encrypted session", fs.path)
+	}
+	data = data[len(sessionFileMagic):]
+	plain, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], sessionFileMagic)
+	if err != nil {
+		return nil, fmt.Errorf("decrypt session file (created on another machine or user?): %w", err)
+	}
+	var s StoredSession
+	if err := json.Unmarshal(plain, &s); err != nil {
+		return nil, fmt.Errorf("parse session file: %w", err)
+	}
+	return &s, nil
+}
+
+func (fs *fileSessionStore) Save(s *StoredSession) error {
+	plain, err := json.Marshal(s)
+	if err != nil {
+		return fmt.Errorf("marshal session: %w", err)
+	}
+	aead, err := fs.aead()
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return fmt.Errorf("generate nonce: %w", err)
+	}
+	data := append(append([]byte{}, sessionFileMagic...), nonce...)
+	data = aead.Seal(data, nonce, plain, sessionFileMagic)
+
+	if err := os.MkdirAll(filepath.Dir(fs.path), 0700); err != nil {
+		return fmt.Errorf("create session directory: %w", err)
+	}
+	// Write a private temp file and rename it over the old session
+	tmp, err := os.CreateTemp(filepath.Dir(fs.path), ".session-*.tmp")
+	if err != nil {
+		return fmt.Errorf("create session file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if err := tmp.Chmod(0600); err != nil && runtime.GOOS != "windows" {
+		tmp.Close()
+		return fmt.Errorf("restrict session file: %w", err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write session file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("close session file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), fs.path); err != nil {
+		return fmt.Errorf("replace session file: %w", err)
+	}
+	return nil
+}
+
+func (fs *fileSessionStore) Delete() error {
+	if err := os.Remove(fs.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("delete session file: %w", err)
+	}
+	return nil
+}
+
+// layeredSessionStore uses the keyring when it works and the encrypted file otherwise.
+// Only one copy is kept: a successful keyring save removes the file.
+type layeredSessionStore struct {
+	primary  sessionStore
+	fallback sessionStore
+}
+
+func (ls *layeredSessionStore) Name() string {
+	return ls.primary.Name() + " or " + ls.fallback.Name()
+}
+
+func (ls *layeredSessionStore) Load() (*StoredSession, error) {
+	s, err := ls.primary.Load()
+	if err == nil {
+		return s, nil
+	}
+	if !errors.Is(err, errNoStoredSession) {
+		fmt.Printf("Warning: %s unavailable, trying %s: %v\n", ls.primary.Name(), ls.fallback.Name(), err)
+	}
+	return ls.fallback.Load()
+}
+
+func (ls *layeredSessionStore) Save(s *StoredSession) error {
+	err := ls.primary.Save(s)
+	if err == nil {
+		return ls.fallback.Delete()
+	}
+	fmt.Printf("Warning: %s unavailable, saving session to %s: %v\n", ls.primary.Name(), ls.fallback.Name(), err)
+	return ls.fallback.Save(s)
+}
+
+func (ls *layeredSessionStore) Delete() error {
+	return errors.Join(ls.primary.Delete(), ls.fallback.Delete())
+}
+
+// machineBoundKey derives the session file key from the machine ID, the OS user and the account
+func machineBoundKey(account string) []byte {
+	username := ""
+	if u, err := user.Current(); err == nil {
+		username = u.Username
+	}
+	sum := sha256.Sum256([]byte(strings.Join([]string{"alpha-weaver-session/v1", machineID(), username, account}, "\x00")))
+	return sum[:]
+}
+
+// machineIDPatterns extract the machine ID from the Windows registry and macOS ioreg output
+var (
+	windowsMachineGUIDPattern = regexp.MustCompile(`MachineGuid\s+REG_SZ\s+(\S+)`)
+	macPlatformUUIDPattern    = regexp.MustCompile(`"IOPlatformUUID"\s*=\s*"([^"]+)"`)
+)
+
+// machineID returns a stable per-installation identifier, falling back to the hostname
+func machineID() string {
+	switch runtime.GOOS {
+	case "windows":
+		out, err := exec.Command("reg", "query", `HKLM\SOFTWARE\Microsoft\Cryptography`, "/v", "MachineGuid").Output()
+		if m := windowsMachineGUIDPattern.FindSubmatch(out); err == nil && m != nil {
+			return string(m[1])
+		}
+	case "darwin":
+		out, err := exec.Command("ioreg", "-rd1", "-c", "IOPlatformExpertDevice").Output()
+		if m := macPlatformUUIDPattern.FindSubmatch(out); err == nil && m != nil {
+			return string(m[1])
+		}
+	default:
+		for _, path := range []string{"/etc/machine-id", "/var/lib/dbus/machine-id"} {
+			if data, err := os.ReadFile(path); err == nil && len(bytes.TrimSpace(data)) > 0 {
+				return string(bytes.TrimSpace(data))
+			}
+		}
+	}
+	hostname, _ := os.Hostname()
+	return hostname
+}
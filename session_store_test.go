@@ -0,0 +1,202 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/zalando/go-keyring"
+)
+
+func TestFileSessionStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nested", "session.dat")
+	store := &fileSessionStore{path: path, account: "project"}
+
+	if _, err := store.Load(); !errors.Is(err, errNoStoredSession) {
+		t.Fatalf("Expected errNoStoredSession before the first save, got %v", err)
+	}
+	if err := store.Save(&StoredSession{Email: "user@example.com", RefreshToken: "refresh-1"}); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read session file: %v", err)
+	}
+	if strings.Contains(string(data), "refresh-1") || strings.Contains(string(data), "user@example.com") {
+		t.Fatalf("Session file must not contain the token in clear text")
+	}
+	if info, _ := os.Stat(path); runtime.GOOS != "windows" && info.Mode().Perm() != 0600 {
+		t.Fatalf("Expected mode 0600, got %v", info.Mode().Perm())
+	}
+
+	s, err := store.Load()
+	if err != nil || s.RefreshToken != "refresh-1" || s.Email != "user@example.com" {
+		t.Fatalf("Expected the saved session, got %+v (err %v)", s, err)
+	}
+
+	// Another machine (key) cannot read it, and tampering is detected
+	other := &fileSessionStore{path: path, key: make([]byte, 32)}
+	if _, err := other.Load(); err == nil {
+		t.Fatalf("Expected a decryption error with another key")
+	}
+	data[len(data)-1] ^= 1
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatalf("write session file: %v", err)
+	}
+	if _, err := store.Load(); err == nil {
+		t.Fatalf("Expected a decryption error for a modified file")
+	}
+
+	if runtime.GOOS != "windows" {
+		os.Chmod(path, 0644)
+		if _, err := store.Load(); err == nil || !strings.Contains(err.Error(), "other users") {
+			t.Fatalf("Expected a world-readable session file to be refused, got %v", err)
+		}
+	}
+
+	if err := store.Delete(); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if err := store.Delete(); err != nil {
+		t.Fatalf("Deleting a missing session should succeed: %v", err)
+	}
+}
+
+func TestLayeredSessionStore(t *testing.T) {
+	defer keyring.MockInit()
+	path := filepath.Join(t.TempDir(), "session.dat")
+	newStore := func() *layeredSessionStore {
+		return &layeredSessionStore{
+			primary:  &keyringSessionStore{service: keyringService, account: "project"},
+			fallback: &fileSessionStore{path: path, account: "project"},
+		}
+	}
+
+	// Without a keyring the session goes to the file
+	keyring.MockInitWithError(fmt.Errorf("no secret service"))
+	store := newStore()
+	if err := store.Save(&StoredSession{RefreshToken: "from-file"}); err != nil {
+		t.Fatalf("Save with fallback failed: %v", err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("Expected the fallback file: %v", err)
+	}
+	if s, err := store.Load(); err != nil || s.RefreshToken != "from-file" {
+		t.Fatalf("Expected the file session, got %+v (err %v)", s, err)
+	}
+
+	// Once the keyring works it takes over and the file copy is removed
+	keyring.MockInit()
+	if err := store.Save(&StoredSession{RefreshToken: "from-keyring"}); err != nil {
+		t.Fatalf("Save to keyring failed: %v", err)
+	}
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("Expected the file copy to be removed, got %v", err)
+	}
+	if s, err := store.Load(); err != nil || s.RefreshToken != "from-keyring" {
+		t.Fatalf("Expected the keyring session, got %+v (err %v)", s, err)
+	}
+
+	if err := store.Delete(); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if _, err := store.Load(); !errors.Is(err, errNoStoredSession) {
+		t.Fatalf("Expected no session after Delete, got %v", err)
+	}
+}
+
+// newTestAuthServer serves the token and logout endpoints. Refresh tokens are single use.
+func newTestAuthServer(t *testing.T, valid map[string]bool, logouts *int) *httptest.Server {
+	next := 0
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/auth/v1/logout":
+			*logouts++
+			w.WriteHeader(http.StatusNoContent)
+		case r.URL.Query().Get("grant_type") == "refresh_token":
+			var body map[string]string
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil || !valid[body["refresh_token"]] {
+				http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+				return
+			}
+			delete(valid, body["refresh_token"])
+			next++
+			token := fmt.Sprintf("refresh-%d", next+1)
+			valid[token] = true
+			fmt.Fprintf(w, `{"access_token":"access-%d","refresh_token":"%s","expires_in":3600}`, next, token)
+		default:
+			t.Errorf("unexpected request %s", r.URL)
+		}
+	}))
+}
+
+func TestAuthManagerResumeAndForget(t *testing.T) {
+	valid := map[string]bool{"refresh-1": true}
+	logouts := 0
+	server := newTestAuthServer(t, valid, &logouts)
+	defer server.Close()
+
+	cfg := &Config{}
+	cfg.Supabase.URL = server.URL
+	cfg.Auth.PersistSession = true
+	cfg.Auth.SessionFile = filepath.Join(t.TempDir(), "session.dat")
+	store := &fileSessionStore{path: cfg.Auth.SessionFile, key: make([]byte, 32)}
+
+	if err := store.Save(&StoredSession{Email: "user@example.com", RefreshToken: "refresh-1"}); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	am := NewAuthManager(cfg)
+	am.store = store
+	if err := am.ResumeSession(); err != nil {
+		t.Fatalf("ResumeSession failed: %v", err)
+	}
+	if !am.IsTokenValid() || am.Email() != "user@example.com" {
+		t.Fatalf("Expected a valid session for user@example.com")
+	}
+	// The rotated refresh token replaces the used one on disk
+	if s, err := store.Load(); err != nil || s.RefreshToken != "refresh-2" {
+		t.Fatalf("Expected refresh-2 to be stored, got %+v (err %v)", s, err)
+	}
+
+	if err := am.ForgetDevice(); err != nil {
+		t.Fatalf("ForgetDevice failed: %v", err)
+	}
+	if logouts != 1 || am.IsTokenValid() || am.Email() != "" {
+		t.Fatalf("Expected the session to be revoked and cleared (logouts %d)", logouts)
+	}
+	if _, err := store.Load(); !errors.Is(err, errNoStoredSession) {
+		t.Fatalf("Expected no stored session after ForgetDevice, got %v", err)
+	}
+	if err := am.ResumeSession(); !errors.Is(err, errNoStoredSession) {
+		t.Fatalf("Expected nothing to resume, got %v", err)
+	}
+}
+
+func TestAuthManagerResumeRejected(t *testing.T) {
+	server := newTestAuthServer(t, map[string]bool{}, new(int))
+	defer server.Close()
+
+	cfg := &Config{}
+	cfg.Supabase.URL = server.URL
+	am := NewAuthManager(cfg)
+	am.store = &fileSessionStore{path: filepath.Join(t.TempDir(), "session.dat"), key: make([]byte, 32)}
+	if err := am.store.Save(&StoredSession{RefreshToken: "revoked"}); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	if err := am.ResumeSession(); !errors.Is(err, errSessionRejected) {
+		t.Fatalf("Expected errSessionRejected, got %v", err)
+	}
+	if _, err := am.store.Load(); !errors.Is(err, errNoStoredSession) {
+		t.Fatalf("Expected a rejected session to be removed, got %v", err)
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"math"
+	"sort"
+)
+
+// defaultStopPercentile is the winners' MAE percentile used for stop placement suggestions
+const defaultStopPercentile = 90.0
+
+// ExcursionDistributions holds MAE or MFE distributions for all trades, winners and losers
+type ExcursionDistributions struct {
+	All     DistributionSummary `json:"all"`
+	Winners DistributionSummary `json:"winners"`
+	Losers  DistributionSummary `json:"losers"`
+}
+
+// StopSuggestion is a stop distance derived from how far winning trades typically went against the position
+type StopSuggestion struct {
+	Percentile        float64 `json:"percentile"`          // winners' MAE percentile used
+	StopDistance      float64 `json:"stop_distance"`       // currency per trade
+	StopPerContract   float64 `json:"stop_per_contract"`   // currency per contract
+	StopATRMultiple   float64 `json:"stop_atr_multiple"`   // StopDistance in ATRs (0 if ATR unavailable)
+	WinnersStoppedOut int     `json:"winners_stopped_out"` // winners whose MAE exceeded the stop
+	LosersCut         int     `json:"losers_cut"`          // losers whose MAE exceeded the stop
+	LossReduction     float64 `json:"loss_reduction"`      // currency saved on cut losers
+	ProfitGivenUp     float64 `json:"profit_given_up"`     // winners' profit lost by stopping out
+	NetImpact         float64 `json:"net_impact"`          // LossReduction - ProfitGivenUp
+}
+
+// RMultipleStats summarizes trade results in multiples of initial risk (R = net profit / risk)
+type RMultipleStats struct {
+	Trades        int                 `json:"trades"` // trades with a positive risk value
+	Mean          float64             `json:"mean"`   // expectancy in R
+	StdDev        float64             `json:"std_dev"`
+	SQN           float64             `json:"sqn"` // mean / std * sqrt(n)
+	WinsAbove1R   float64             `json:"wins_above_1r"`
+	LossesBelow1R float64             `json:"losses_below_minus_1r"`
+	Distribution  DistributionSummary `json:"distribution"`
+}
+
+// TradeExcursionReport is the MAE/MFE and efficiency analysis for a set of trades
+type TradeExcursionReport struct {
+	Trades          int                    `json:"trades"`
+	Winners         int                    `json:"winners"`
+	Losers          int                    `json:"losers"`
+	MAE             ExcursionDistributions `json:"mae"` // absolute adverse excursion (currency)
+	MFE             ExcursionDistributions `json:"mfe"`
+	EntryEfficiency float64                `json:"entry_efficiency"` // MFE / (MFE + |MAE|)
+	ExitEfficiency  float64                `json:"exit_efficiency"`  // (gross P&L + |MAE|) / (MFE + |MAE|)
+	TotalEfficiency float64                `json:"total_efficiency"` // gross P&L / (MFE + |MAE|)
+	Stop            StopSuggestion         `json:"stop_suggestion"`
+	RMultiples      RMultipleStats         `json:"r_multiples"`
+}
+
+// tradeGrossPnL returns a trade's P&L before commission. TSClient's profit column is gross of
+// commission (see tradeNetPnL, which takes the round-trip commission off once), so price-based
+// measures like efficiency and point values use it as is and results in currency use the net P&L.
+func tradeGrossPnL(trade TradeRecord) float64 {
+	return trade.PnL
+}
+
+// analyzeTradeExcursions builds the excursion report. Efficiencies follow the usual
+// definitions on the trade's price range, expressed in currency via MAE/MFE, and are
+// averaged over trades with a non-zero range.
+func analyzeTradeExcursions(trades []TradeRecord, stopPercentile float64) TradeExcursionReport {
+	if stopPercentile <= 0 || stopPercentile > 100 {
+		stopPercentile = defaultStopPercentile
+	}
+	report := TradeExcursionReport{Trades: len(trades)}
+
+	var maeAll, maeWin, maeLoss, mfeAll, mfeWin, mfeLoss, rs []float64
+	var entrySum, exitSum, totalSum float64
+	efficiencyTrades := 0
+	for _, trade := range trades {
+		mae := math.Abs(trade.MAE)
+		mfe := math.Abs(trade.MFE)
+		pnl := tradeNetPnL(trade)
+
+		maeAll = append(maeAll, mae)
+		mfeAll = append(mfeAll, mfe)
+		if pnl > 0 {
+			report.Winners++
+			maeWin = append(maeWin, mae)
+			mfeWin = append(mfeWin, mfe)
+		} else if pnl < 0 {
+			report.Losers++
+			maeLoss = append(maeLoss, mae)
+			mfeLoss = append(mfeLoss, mfe)
+		}
+
+		if rangeSize := mfe + mae; rangeSize > 0 {
+			gross := tradeGrossPnL(trade)
+			entrySum += mfe / rangeSize
+			exitSum += (gross + mae) / rangeSize
+			totalSum += gross / rangeSize
+			efficiencyTrades++
+		}
+
+		if trade.Risk > 0 {
+			rs = append(rs, pnl/trade.Risk)
+		}
+	}
+
+	report.MAE = ExcursionDistributions{All: summarizeDistribution(maeAll), Winners: summarizeDistribution(maeWin), Losers: summarizeDistribution(maeLoss)}
+	report.MFE = ExcursionDistributions{All: summarizeDistribution(mfeAll), Winners: summarizeDistribution(mfeWin), Losers: summarizeDistribution(mfeLoss)}
+	if efficiencyTrades > 0 {
+		report.EntryEfficiency = entrySum / float64(efficiencyTrades)
+		report.ExitEfficiency = exitSum / float64(efficiencyTrades)
+		report.TotalEfficiency = totalSum / float64(efficiencyTrades)
+	}
+
+	report.Stop = suggestStop(trades, maeWin, stopPercentile)
+	report.RMultiples = summarizeRMultiples(rs)
+	return report
+}
+
+// suggestStop places a stop at the given percentile of winners' MAE and estimates its effect:
+// losers that went further against the position would have been cut at the stop, winners that
+// did would have been stopped out for a loss of the stop distance.
+func suggestStop(trades []TradeRecord, winnersMAE []float64, percentile float64) StopSuggestion {
+	s := StopSuggestion{Percentile: percentile}
+	if len(winnersMAE) == 0 {
+		return s
+	}
+
+	sorted := make([]float64, len(winnersMAE))
+	copy(sorted, winnersMAE)
+	sort.Float64s(sorted)
+	s.StopDistance = percentileOfSorted(sorted, percentile)
+
+	var contracts, atrs []float64
+	for _, trade := range trades {
+		mae := math.Abs(trade.MAE)
+		pnl := tradeNetPnL(trade)
+		if trade.Quantity != 0 {
+			contracts = append(contracts, math.Abs(float64(trade.Quantity)))
+		}
+		if trade.ATR > 0 && trade.EntryPrice != 0 && trade.Price != trade.EntryPrice && trade.Quantity != 0 {
+			// Currency value of one ATR: price move * big point value * size
+			pointValue := math.Abs(tradeGrossPnL(trade) / ((trade.Price - trade.EntryPrice) * float64(trade.Quantity)))
+			atrs = append(atrs, trade.ATR*pointValue*math.Abs(float64(trade.Quantity)))
+		}
+		if mae <= s.StopDistance {
+			continue
+		}
+		if pnl > 0 {
+			s.WinnersStoppedOut++
+			s.ProfitGivenUp += pnl + s.StopDistance
+		} else if pnl < 0 {
+			s.LosersCut++
+			s.LossReduction += -pnl - s.StopDistance
+		}
+	}
+	s.NetImpact = s.LossReduction - s.ProfitGivenUp
+
+	if len(contracts) > 0 {
+		sort.Float64s(contracts)
+		if median := percentileOfSorted(contracts, 50); median > 0 {
+			s.StopPerContract = s.StopDistance / median
+		}
+	}
+	if len(atrs) > 0 {
+		sort.Float64s(atrs)
+		if median := percentileOfSorted(atrs, 50); median > 0 {
+			s.StopATRMultiple = s.StopDistance / median
+		}
+	}
+	return s
+}
+
+// summarizeRMultiples computes expectancy, SQN and the distribution of R-multiples
+func summarizeRMultiples(rs []float64) RMultipleStats {
+	stats := RMultipleStats{Trades: len(rs), Distribution: summarizeDistribution(rs)}
+	if len(rs) == 0 {
+		return stats
+	}
+
+	stats.Mean = stats.Distribution.Mean
+	above, below := 0, 0
+	sumSq := 0.0
+	for _, r := range rs {
+		sumSq += (r - stats.Mean) * (r - stats.Mean)
+		if r >= 1 {
+			above++
+		}
+		if r <= -1 {
+			below++
+		}
+	}
+	stats.WinsAbove1R = float64(above) / float64(len(rs))
+	stats.LossesBelow1R = float64(below) / float64(len(rs))
+	if len(rs) > 1 {
+		stats.StdDev = math.Sqrt(sumSq / float64(len(rs)-1))
+		if stats.StdDev > 0 {
+			stats.SQN = stats.Mean / stats.StdDev * math.Sqrt(float64(len(rs)))
+		}
+	}
+	return stats
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+// excursionTrades are four trades with hand-computed excursion statistics
+func excursionTrades() []TradeRecord {
+	return []TradeRecord{
+		{PnL: 500, Commission: 10, MAE: -100, MFE: 600, Risk: 245, Quantity: 1, EntryPrice: 100, Price: 110, ATR: 2},
+		{PnL: 300, Commission: 10, MAE: -200, MFE: 400, Risk: 145, Quantity: 2},
+		{PnL: -400, Commission: 10, MAE: -450, MFE: 50, Risk: 205, Quantity: 1},
+		{PnL: 100, Commission: 10, MAE: -300, MFE: 200, Quantity: 1}, // No risk value: not in the R-multiples
+	}
+}
+
+func TestAnalyzeTradeExcursions(t *testing.T) {
+	report := analyzeTradeExcursions(excursionTrades(), 50)
+	near := func(name string, got, want float64) {
+		if math.Abs(got-want) > 1e-9 {
+			t.Fatalf("%s: expected %v, got %v", name, want, got)
+		}
+	}
+
+	if report.Trades != 4 || report.Winners != 3 || report.Losers != 1 {
+		t.Fatalf("Unexpected counts %d/%d/%d", report.Trades, report.Winners, report.Losers)
+	}
+	// MAE of all trades: 100, 200, 300, 450
+	near("MAE p5", report.MAE.All.Percentiles[0].Value, 115)
+	near("MAE median", report.MAE.All.Percentiles[2].Value, 250)
+	near("MAE max", report.MAE.All.Max, 450)
+	near("winners' MFE median", report.MFE.Winners.Percentiles[2].Value, 400)
+	near("losers' MAE mean", report.MAE.Losers.Mean, 450)
+
+	// Efficiencies use the P&L before commission over the MFE + MAE range
+	near("entry efficiency", report.EntryEfficiency, (600.0/700+400.0/600+50.0/500+200.0/500)/4)
+	near("exit efficiency", report.ExitEfficiency, (600.0/700+500.0/600+50.0/500+400.0/500)/4)
+	near("total efficiency", report.TotalEfficiency, (500.0/700+300.0/600-400.0/500+100.0/500)/4)
+
+	// Stop at the winners' MAE median (200): the loser is cut, the last winner stopped out
+	stop := report.Stop
+	near("stop distance", stop.StopDistance, 200)
+	near("stop per contract", stop.StopPerContract, 200)
+	near("stop ATR multiple", stop.StopATRMultiple, 2) // One ATR: 2 points * 50 per point
+	if stop.WinnersStoppedOut != 1 || stop.LosersCut != 1 {
+		t.Fatalf("Unexpected stop counts %+v", stop)
+	}
+	near("loss reduction", stop.LossReduction, 410-200)
+	near("profit given up", stop.ProfitGivenUp, 90+200)
+	near("net impact", stop.NetImpact, -80)
+
+	// R-multiples of the net P&L: 490/245, 290/145, -410/205
+	r := report.RMultiples
+	if r.Trades != 3 {
+		t.Fatalf("Expected 3 R-multiples, got %d", r.Trades)
+	}
+	near("mean R", r.Mean, 2.0/3)
+	near("R std dev", r.StdDev, math.Sqrt(48.0/9))
+	near("SQN", r.SQN, 2.0/3/math.Sqrt(48.0/9)*math.Sqrt(3))
+	near("wins above 1R", r.WinsAbove1R, 2.0/3)
+	near("losses below -1R", r.LossesBelow1R, 1.0/3)
+}
+
+func TestAnalyzeTradeExcursionsDefaults(t *testing.T) {
+	report := analyzeTradeExcursions(excursionTrades(), 0)
+	if report.Stop.Percentile != defaultStopPercentile {
+		t.Fatalf("Expected the default stop percentile, got %v", report.Stop.Percentile)
+	}
+	empty := analyzeTradeExcursions(nil, 90)
+	if empty.Trades != 0 || empty.Stop.StopDistance != 0 || empty.RMultiples.Trades != 0 {
+		t.Fatalf("Expected an empty report, got %+v", empty)
+	}
+}
+
+func TestParseTradeRecordAnalysisColumns(t *testing.T) {
+	record := strings.Split("Breakout,7,proj1,1/17/2007 10:00:00,1450.25,1/18/2007 16:00:00,1460.25,1440.5,1,500,487.5,2,@ES,12.5,1,100500,4.5,12.5,-250,750,3,OS,20060101,20061231,20070101,20071231", ",")
+	trade, err := parseTradeRecord(record, 1, nil)
+	if err != nil {
+		t.Fatalf("parseTradeRecord failed: %v", err)
+	}
+	want := TradeRecord{
+		EntryExit: "Exit", Symbol: "@ES", StrategyName: "Breakout", TaskNo: "7", ProjectID: "proj1",
+		EntryPrice: 1450.25, Price: 1460.25, StopPrice: 1440.5, Position: 1, PnL: 500, Risk: 487.5, Quantity: 2,
+		ATR: 12.5, CurrencyConv: 1, Equity: 100500, Commission: 4.5, Slippage: 12.5, MAE: -250, MFE: 750,
+		RunNumber: 3, TestType: "OS", Date: "20070118", Time: "1600",
+		ISStartDate: "20060101", ISEndDate: "20061231", OSStartDate: "20070101", OSEndDate: "20071231",
+	}
+	if trade.EntryTimestamp.IsZero() || trade.Timestamp.IsZero() {
+		t.Fatalf("Expected entry and exit times, got %+v", trade)
+	}
+	trade.EntryTimestamp, trade.Timestamp = want.EntryTimestamp, want.Timestamp
+	if trade != want {
+		t.Fatalf("Unexpected trade\n got %+v\nwant %+v", trade, want)
+	}
+
+	// A blank analysis column is left at zero
+	record[13] = ""
+	if trade, err := parseTradeRecord(record, 1, nil); err != nil || trade.ATR != 0 {
+		t.Fatalf("Expected a zero ATR for a blank column, got %v (err %v)", trade.ATR, err)
+	}
+	if _, err := parseTradeRecord(record[:20], 1, nil); err == nil {
+		t.Fatalf("Expected an error for a short record")
+	}
+}
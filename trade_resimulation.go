@@ -0,0 +1,268 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Sizing models supported by the re-simulation engine
+const (
+	SizingOriginal   = "original"   // keep the size from the trades CSV
+	SizingFixed      = "fixed"      // a fixed number of contracts
+	SizingFractional = "fractional" // risk a fixed fraction of equity per trade (stop distance)
+	SizingATR        = "atr"        // volatility targeting: a fixed fraction of equity per ATR
+)
+
+// ResimulationModel describes the sizing and cost assumptions applied to an existing trades list
+type ResimulationModel struct {
+	Sizing            string  `json:"sizing"`
+	Contracts         float64 `json:"contracts"`           // SizingFixed
+	RiskFraction      float64 `json:"risk_fraction"`       // SizingFractional / SizingATR, e.g. 0.01
+	UseOriginalCosts  bool    `json:"use_original_costs"`  // keep the CSV commission per contract
+	CommissionPerSide float64 `json:"commission_per_side"` // currency per contract per side
+	SlippageTicks     float64 `json:"slippage_ticks"`      // ticks per contract per side
+	TickSize          float64 `json:"tick_size"`           // price units per tick
+	PointValue        float64 `json:"point_value"`         // currency per point; 0 derives it from the trades
+}
+
+// ResimulationSummary records the model and the totals of a re-simulation run
+type ResimulationSummary struct {
+	Model             ResimulationModel  `json:"model"`
+	Trades            int                `json:"trades"`
+	SkippedTrades     int                `json:"skipped_trades"` // sized to zero contracts or missing inputs
+	OriginalNetProfit float64            `json:"original_net_profit"`
+	NetProfit         float64            `json:"net_profit"`
+	TotalCommission   float64            `json:"total_commission"`
+	TotalSlippage     float64            `json:"total_slippage"`
+	AverageContracts  float64            `json:"average_contracts"`
+	PointValues       map[string]float64 `json:"point_values"` // per symbol, derived or configured
+}
+
+// validate checks that the model has the inputs its sizing and cost settings need
+func (m ResimulationModel) validate() error {
+	switch m.Sizing {
+	case SizingOriginal, "":
+	case SizingFixed:
+		if m.Contracts <= 0 {
+			return fmt.Errorf("fixed sizing needs a positive contract count")
+		}
+	case SizingFractional, SizingATR:
+		if m.RiskFraction <= 0 || m.RiskFraction >= 1 {
+			return fmt.Errorf("%s sizing needs a risk fraction between 0 and 1", m.Sizing)
+		}
+	default:
+		return fmt.Errorf("unknown sizing model: %s", m.Sizing)
+	}
+	if m.SlippageTicks > 0 && m.TickSize <= 0 {
+		return fmt.Errorf("slippage in ticks needs a tick size")
+	}
+	return nil
+}
+
+// derivePointValues estimates the currency value of a one-point move per symbol from the CSV:
+// profit = (exit - entry) * direction * size * point value * currency conversion, where the
+// profit column is before commission (see tradeGrossPnL).
+// The median over a symbol's trades is used so a few odd records don't skew it.
+func derivePointValues(trades []TradeRecord) map[string]float64 {
+	samples := make(map[string][]float64)
+	for _, trade := range trades {
+		move := (trade.Price - trade.EntryPrice) * float64(tradeDirection(trade))
+		size := math.Abs(float64(trade.Quantity))
+		conv := trade.CurrencyConv
+		if conv <= 0 {
+			conv = 1
+		}
+		if move == 0 || size == 0 || trade.EntryPrice == 0 {
+			continue
+		}
+		if pv := trade.PnL / (move * size * conv); pv > 0 {
+			samples[trade.Symbol] = append(samples[trade.Symbol], pv)
+		}
+	}
+
+	values := make(map[string]float64, len(samples))
+	for symbol, s := range samples {
+		sort.Float64s(s)
+		values[symbol] = percentileOfSorted(s, 50)
+	}
+	return values
+}
+
+// tradeDirection returns 1 for long and -1 for short, falling back to the sign of the quantity
+func tradeDirection(trade TradeRecord) int {
+	if trade.Position < 0 {
+		return -1
+	}
+	if trade.Position > 0 {
+		return 1
+	}
+	if trade.Quantity < 0 {
+		return -1
+	}
+	return 1
+}
+
+// resimulateTrades recomputes every trade's P&L under the model. A trade's P&L scales with its
+// size, so each trade keeps its own profit per contract; the point value is only needed for
+// stop, ATR and tick based inputs. The original costs are the CSV commission, charged once per
+// round trip like the equity curve does, so original sizing with original costs reproduces it.
+// Trades are processed in exit order and equity-based sizing uses the equity after the previous
+// exit, which approximates overlapping positions. The returned trades carry the new net P&L
+// (commission folded in) and size.
+func resimulateTrades(trades []TradeRecord, model ResimulationModel, initialCapital float64) ([]TradeRecord, *ResimulationSummary, error) {
+	if err := model.validate(); err != nil {
+		return nil, nil, err
+	}
+	if model.Sizing == "" {
+		model.Sizing = SizingOriginal
+	}
+
+	ordered := make([]TradeRecord, len(trades))
+	copy(ordered, trades)
+	sort.SliceStable(ordered, func(i, j int) bool { return ordered[i].Timestamp.Before(ordered[j].Timestamp) })
+
+	summary := &ResimulationSummary{Model: model, PointValues: derivePointValues(ordered)}
+	if model.PointValue > 0 {
+		for symbol := range summary.PointValues {
+			summary.PointValues[symbol] = model.PointValue
+		}
+	}
+
+	equity := initialCapital
+	totalContracts := 0.0
+	var result []TradeRecord
+	for _, trade := range ordered {
+		summary.OriginalNetProfit += tradeNetPnL(trade)
+
+		pointValue := model.PointValue
+		if pointValue <= 0 {
+			pointValue = summary.PointValues[trade.Symbol]
+		}
+		conv := trade.CurrencyConv
+		if conv <= 0 {
+			conv = 1
+		}
+		originalSize := math.Abs(float64(trade.Quantity))
+
+		contracts, ok := resimulationContracts(trade, model, equity, pointValue*conv, originalSize)
+		if !ok || contracts < 1 {
+			summary.SkippedTrades++
+			continue
+		}
+
+		// P&L before costs in account currency
+		var gross float64
+		scale := 0.0
+		if originalSize > 0 {
+			scale = contracts / originalSize
+			gross = trade.PnL * scale
+		} else if pointValue > 0 && trade.EntryPrice != 0 {
+			gross = (trade.Price - trade.EntryPrice) * float64(tradeDirection(trade)) * pointValue * conv * contracts
+		} else {
+			summary.SkippedTrades++
+			continue
+		}
+
+		var commission, slippage, slippagePerSide float64
+		if model.UseOriginalCosts && originalSize > 0 {
+			commission = trade.Commission * scale
+			slippagePerSide = trade.Slippage / originalSize // Not charged on top of the profit, like the equity curve
+		} else {
+			slippagePerSide = model.SlippageTicks * model.TickSize * pointValue * conv
+			commission = 2 * model.CommissionPerSide * contracts
+			slippage = 2 * slippagePerSide * contracts
+		}
+		net := gross - commission - slippage
+
+		equity += net
+		totalContracts += contracts
+		summary.Trades++
+		summary.NetProfit += net
+		summary.TotalCommission += commission
+		summary.TotalSlippage += slippage
+
+		resim := trade
+		resim.Quantity = int(contracts)
+		resim.PnL = net
+		resim.Commission = 0 // already deducted from PnL
+		resim.Slippage = slippagePerSide * contracts
+		resim.Equity = equity
+		if trade.Risk > 0 && originalSize > 0 {
+			resim.Risk = trade.Risk / originalSize * contracts
+		}
+		result = append(result, resim)
+	}
+
+	if summary.Trades > 0 {
+		summary.AverageContracts = totalContracts / float64(summary.Trades)
+	}
+	return result, summary, nil
+}
+
+// resimulationContracts returns the (whole) contract count for a trade under the model.
+// currencyPerPoint is the point value already converted to account currency.
+func resimulationContracts(trade TradeRecord, model ResimulationModel, equity, currencyPerPoint, originalSize float64) (float64, bool) {
+	switch model.Sizing {
+	case SizingFixed:
+		return math.Floor(model.Contracts), true
+
+	case SizingFractional:
+		// Risk per contract from the stop distance, falling back to the CSV risk column
+		riskPerContract := 0.0
+		if trade.StopPrice != 0 && trade.EntryPrice != 0 && currencyPerPoint > 0 {
+			riskPerContract = math.Abs(trade.EntryPrice-trade.StopPrice) * currencyPerPoint
+		} else if trade.Risk > 0 && originalSize > 0 {
+			riskPerContract = trade.Risk / originalSize
+		}
+		if riskPerContract <= 0 || equity <= 0 {
+			return 0, false
+		}
+		return math.Floor(equity * model.RiskFraction / riskPerContract), true
+
+	case SizingATR:
+		if trade.ATR <= 0 || currencyPerPoint <= 0 || equity <= 0 {
+			return 0, false
+		}
+		return math.Floor(equity * model.RiskFraction / (trade.ATR * currencyPerPoint)), true
+
+	default:
+		return originalSize, originalSize > 0
+	}
+}
+
+// resimulateEquityCurve re-simulates trades and builds a comparison curve based on an existing one
+// (dates, symbol and job metadata are copied from base; the arrays and metrics are recomputed).
+func (ac *APIClient) resimulateEquityCurve(trades []TradeRecord, model ResimulationModel, base EquityCurveData) (EquityCurveData, error) {
+	initialCapital := base.InitialCapital
+	if initialCapital <= 0 {
+		initialCapital = defaultInitialCapital
+	}
+
+	resimTrades, summary, err := resimulateTrades(trades, model, initialCapital)
+	if err != nil {
+		return EquityCurveData{}, fmt.Errorf("re-simulate trades: %w", err)
+	}
+
+	curve := EquityCurveData{
+		StrategyName:   base.StrategyName,
+		TaskType:       "RESIM",
+		TestType:       base.TestType,
+		Symbol:         base.Symbol,
+		Timeframe:      base.Timeframe,
+		Run:            base.Run,
+		ProjectID:      base.ProjectID,
+		JobID:          base.JobID,
+		TaskID:         base.TaskID,
+		StartDate:      base.StartDate,
+		EndDate:        base.EndDate,
+		TotalRuns:      base.TotalRuns,
+		OSPercentage:   base.OSPercentage,
+		InitialCapital: initialCapital,
+		Resimulation:   summary,
+	}
+	if err := ac.calculateEquityProgression(&curve, resimTrades); err != nil {
+		return EquityCurveData{}, fmt.Errorf("calculate re-simulated equity: %w", err)
+	}
+	return curve, nil
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// resimulationTrades are @ES trades (50 per point) with stops and ATRs
+func resimulationTrades() []TradeRecord {
+	day := func(d int) time.Time { return time.Date(2020, 1, d, 16, 0, 0, 0, time.UTC) }
+	trade := func(d, position, qty int, entry, exit, stop, atr, pnl, commission float64) TradeRecord {
+		return TradeRecord{
+			Symbol: "@ES", Position: position, Quantity: qty, EntryPrice: entry, Price: exit, StopPrice: stop,
+			ATR: atr, PnL: pnl, Commission: commission, Slippage: 12.5 * float64(qty), CurrencyConv: 1,
+			Risk: math.Abs(entry-stop) * 50 * float64(qty), TestType: "OS",
+			Date: day(d).Format("20060102"), Time: "1600", Timestamp: day(d), EntryTimestamp: day(d).Add(-6 * time.Hour),
+		}
+	}
+	return []TradeRecord{
+		trade(3, 1, 1, 100, 103, 99, 5, 150, 5),
+		trade(1, 1, 1, 100, 110, 98, 4, 500, 5),
+		trade(2, -1, 2, 100, 104, 102, 2, -400, 10),
+	}
+}
+
+func TestResimulationIdentity(t *testing.T) {
+	trades := resimulationTrades()
+	ac := &APIClient{}
+	original := EquityCurveData{InitialCapital: 100000, StartDate: "20200101", EndDate: "20200103"}
+	if err := ac.calculateEquityProgression(&original, trades); err != nil {
+		t.Fatalf("calculateEquityProgression failed: %v", err)
+	}
+
+	resim, err := ac.resimulateEquityCurve(trades, ResimulationModel{Sizing: SizingOriginal, UseOriginalCosts: true}, original)
+	if err != nil {
+		t.Fatalf("resimulateEquityCurve failed: %v", err)
+	}
+	if resim.Resimulation.PointValues["@ES"] != 50 {
+		t.Fatalf("Expected a point value of 50, got %v", resim.Resimulation.PointValues)
+	}
+	if s := resim.Resimulation; s.NetProfit != s.OriginalNetProfit || s.NetProfit != 230 || s.TotalSlippage != 0 {
+		t.Fatalf("Expected the original net profit of 230, got %+v", s)
+	}
+	for name, pair := range map[string][2][]float64{
+		"cumulative P&L": {original.CumulativePnL, resim.CumulativePnL},
+		"net profit":     {original.NetProfit, resim.NetProfit},
+		"drawdown":       {original.Drawdown, resim.Drawdown},
+		"daily returns":  {original.DailyReturns, resim.DailyReturns},
+	} {
+		if !reflect.DeepEqual(pair[0], pair[1]) {
+			t.Fatalf("%s differs:\noriginal %v\n   resim %v", name, pair[0], pair[1])
+		}
+	}
+	if !reflect.DeepEqual(original.Dates, resim.Dates) || !reflect.DeepEqual(original.Metrics, resim.Metrics) {
+		t.Fatalf("Expected identical dates and metrics")
+	}
+}
+
+func TestResimulationSizing(t *testing.T) {
+	tests := []struct {
+		name       string
+		model      ResimulationModel
+		capital    float64
+		netProfit  float64
+		trades     int
+		skipped    int
+		commission float64
+		slippage   float64
+		contracts  []int
+	}{
+		{
+			name:    "fixed with modelled costs",
+			model:   ResimulationModel{Sizing: SizingFixed, Contracts: 3, CommissionPerSide: 2, SlippageTicks: 1, TickSize: 0.25},
+			capital: 100000,
+			// 1500 - 600 + 450, less 12 commission and 75 slippage per trade
+			netProfit: 1350 - 3*87, trades: 3, commission: 36, slippage: 225, contracts: []int{3, 3, 3},
+		},
+		{
+			name:    "fractional with original costs",
+			model:   ResimulationModel{Sizing: SizingFractional, RiskFraction: 0.01, UseOriginalCosts: true},
+			capital: 100000,
+			// 1000/100 -> 10, 1049.5/100 -> 10, 1029/50 -> 20 contracts
+			netProfit: 4950 - 2050 + 2900, trades: 3, commission: 50 + 50 + 100, contracts: []int{10, 10, 20},
+		},
+		{
+			name:    "ATR skips trades sized below one contract",
+			model:   ResimulationModel{Sizing: SizingATR, RiskFraction: 0.01},
+			capital: 10000,
+			// 100/(4*50) -> 0, 100/(2*50) -> 1, 98/(5*50) -> 0 contracts
+			netProfit: -200, trades: 1, skipped: 2, contracts: []int{1},
+		},
+	}
+
+	for _, tt := range tests {
+		resim, summary, err := resimulateTrades(resimulationTrades(), tt.model, tt.capital)
+		if err != nil {
+			t.Fatalf("%s: resimulateTrades failed: %v", tt.name, err)
+		}
+		if math.Abs(summary.NetProfit-tt.netProfit) > 1e-9 || summary.Trades != tt.trades || summary.SkippedTrades != tt.skipped ||
+			math.Abs(summary.TotalCommission-tt.commission) > 1e-9 || math.Abs(summary.TotalSlippage-tt.slippage) > 1e-9 {
+			t.Fatalf("%s: unexpected summary %+v", tt.name, summary)
+		}
+		if len(resim) != len(tt.contracts) {
+			t.Fatalf("%s: expected %d trades, got %d", tt.name, len(tt.contracts), len(resim))
+		}
+		equity := tt.capital
+		for i, trade := range resim {
+			equity += tradeNetPnL(trade)
+			if trade.Quantity != tt.contracts[i] || trade.Equity != equity {
+				t.Fatalf("%s: trade %d has %d contracts and equity %v, want %d and %v", tt.name, i, trade.Quantity, trade.Equity, tt.contracts[i], equity)
+			}
+		}
+	}
+}
+
+func TestResimulationModelValidation(t *testing.T) {
+	invalid := []ResimulationModel{
+		{Sizing: "kelly"},
+		{Sizing: SizingFixed},
+		{Sizing: SizingFractional, RiskFraction: 1.5},
+		{Sizing: SizingOriginal, SlippageTicks: 1},
+	}
+	for _, model := range invalid {
+		if _, _, err := resimulateTrades(resimulationTrades(), model, 10000); err == nil {
+			t.Fatalf("Expected an error for %+v", model)
+		}
+	}
+
+	_, summary, err := resimulateTrades(resimulationTrades(), ResimulationModel{PointValue: 20}, 10000)
+	if err != nil || summary.Model.Sizing != SizingOriginal || summary.PointValues["@ES"] != 20 {
+		t.Fatalf("Expected original sizing with the configured point value, got %+v (err %v)", summary, err)
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// WFOReport collects the analysis results for a WFO job that are not part of the equity curves
+type WFOReport struct {
+	JobID              string                          `json:"job_id"`
+	Symbol             string                          `json:"symbol"`
+	Timeframe          string                          `json:"timeframe"`
+	GeneratedAt        string                          `json:"generated_at"`
+	TotalRuns          int                             `json:"total_runs"`
+	ParameterStability *ParameterStabilityReport       `json:"parameter_stability,omitempty"`
+	TradeExcursion     map[string]TradeExcursionReport `json:"trade_excursion,omitempty"`     // keyed by test type (IS/OS)
+	ParameterSelection []ParameterSelection            `json:"parameter_selection,omitempty"` // one entry per run
+}
+
+// newWFOReport creates an empty report for a job/symbol/timeframe combination
+func newWFOReport(jobID, symbol, timeframe string, totalRuns int) *WFOReport {
+	return &WFOReport{
+		JobID:       jobID,
+		Symbol:      symbol,
+		Timeframe:   timeframe,
+		GeneratedAt: time.Now().UTC().Format(time.RFC3339),
+		TotalRuns:   totalRuns,
+	}
+}
+
+// wfoReportPath returns the location of the WFO report next to the combined equity curves
+func wfoReportPath(jobID, symbol, timeframe string) string {
+	fileName := fmt.Sprintf("%s_%s_%s_WFO_report.json", jobID, symbol, timeframe)
+	return filepath.Join("C:\\AlphaWeaver\\files\\results\\combined", fileName)
+}
+
+// saveWFOReport writes the report as indented JSON
+func saveWFOReport(report *WFOReport) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal WFO report: %w", err)
+	}
+
+	path := wfoReportPath(report.JobID, report.Symbol, report.Timeframe)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("create report directory: %w", err)
+	}
+	if err := writeFileAtomic(path, data, 0644); err != nil {
+		return fmt.Errorf("write WFO report: %w", err)
+	}
+	return nil
+}
+
+// loadWFOReport reads a previously saved report
+func loadWFOReport(jobID, symbol, timeframe string) (*WFOReport, error) {
+	data, err := os.ReadFile(wfoReportPath(jobID, symbol, timeframe))
+	if err != nil {
+		return nil, fmt.Errorf("read WFO report: %w", err)
+	}
+
+	var report WFOReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, fmt.Errorf("parse WFO report: %w", err)
+	}
+	return &report, nil
+}
+
+// buildParameterStabilityReport runs the stability analysis using the OptRange definitions in the original job XML
+func buildParameterStabilityReport(originalXML string, optResults []OPTResult) (*ParameterStabilityReport, error) {
+	defs, err := parameterDefinitionsFromJobXML(originalXML)
+	if err != nil {
+		return nil, fmt.Errorf("parse parameter definitions: %w", err)
+	}
+
+	report := analyzeParameterStability(optResults, defs)
+	return &report, nil
+}
@@ -193,17 +193,21 @@ func (ac *APIClient) saveWFORetestXML(jobID, symbol, timeframe, xmlContent strin
 	fmt.Printf("[INFO] XML File Save:   Total Runs: %d, OS Percentage: %d\n", totalRuns, osPercentage)
 	fmt.Printf("[INFO] XML File Save:   XML Content Size: %d bytes\n", len(xmlContent))
 
-	// Create temporary XML filename and final .job filename
-	tempXMLName := fmt.Sprintf("%s_%s_%s_WFO_RETEST_RUN-%d_OS-%d.xml",
-		jobID, symbol, timeframe, totalRuns, osPercentage)
-	jobFileName := fmt.Sprintf("%s_%s_%s_WFO_RETEST_RUN-%d_OS-%d.job",
-		jobID, symbol, timeframe, totalRuns, osPercentage)
+	baseName := fmt.Sprintf("%s_%s_%s_WFO_RETEST_RUN-%d_OS-%d", jobID, symbol, timeframe, totalRuns, osPercentage)
+
+	// Save to TSClient input directory
+	return saveDerivedJobXML("C:\\AlphaWeaver\\files\\jobs\\to_do", baseName, xmlContent)
+}
+
+// saveDerivedJobXML writes a job generated by the client (WFO_RETEST, follow-up OOS/RETEST) as
+// <baseName>.xml for review and compresses it to <baseName>.job in targetDir for TSClient
+func saveDerivedJobXML(targetDir, baseName, xmlContent string) (string, error) {
+	tempXMLName := baseName + ".xml"
+	jobFileName := baseName + ".job"
 
 	fmt.Printf("[INFO] XML File Save: Generated temp XML filename: %s\n", tempXMLName)
 	fmt.Printf("[INFO] XML File Save: Generated final job filename: %s\n", jobFileName)
 
-	// Save to TSClient input directory
-	targetDir := "C:\\AlphaWeaver\\files\\jobs\\to_do"
 	tempXMLPath := filepath.Join(targetDir, tempXMLName)
 	finalJobPath := filepath.Join(targetDir, jobFileName)
 
@@ -220,7 +224,7 @@ func (ac *APIClient) saveWFORetestXML(jobID, symbol, timeframe, xmlContent strin
 
 	// Write the temporary XML file
 	fmt.Printf("[INFO] XML File Save: Writing XML content to temporary file...\n")
-	if err := os.WriteFile(tempXMLPath, []byte(xmlContent), 0644); err != nil {
+	if err := writeFileAtomic(tempXMLPath, []byte(xmlContent), 0644); err != nil {
 		fmt.Printf("[ERROR] XML File Save: Failed to write XML file - %v\n", err)
 		return "", fmt.Errorf("write XML file '%s': %w", tempXMLPath, err)
 	}
@@ -238,7 +242,7 @@ func (ac *APIClient) saveWFORetestXML(jobID, symbol, timeframe, xmlContent strin
 	// Move compressed file to final location if needed (CompressXMLFile should create it in the right place)
 	if compressedPath != finalJobPath {
 		fmt.Printf("[INFO] XML File Save: Moving compressed file to final location...\n")
-		if err := os.Rename(compressedPath, finalJobPath); err != nil {
+		if err := moveFile(compressedPath, finalJobPath); err != nil {
 			fmt.Printf("[ERROR] XML File Save: Failed to move compressed file - %v\n", err)
 			os.Remove(compressedPath) // Clean up
 			return "", fmt.Errorf("move compressed file to final location: %w", err)
@@ -262,24 +266,29 @@ func (ac *APIClient) saveWFORetestXML(jobID, symbol, timeframe, xmlContent strin
 
 // submitWFORetestJob submits the WFO_RETEST job for TSClient processing
 func (ac *APIClient) submitWFORetestJob(xmlFilePath, originalJobID string) error {
+	return ac.submitDerivedJob(xmlFilePath, originalJobID, "WFO_RETEST")
+}
+
+// submitDerivedJob submits a job generated by the client for TSClient processing
+func (ac *APIClient) submitDerivedJob(jobFilePath, originalJobID, taskType string) error {
 	// Log the submission
-	fmt.Printf("[DEBUG] Job Submission: Submitting WFO_RETEST job for TSClient processing\n")
-	fmt.Printf("[DEBUG] Job Submission: XML file path: %s\n", xmlFilePath)
+	fmt.Printf("[DEBUG] Job Submission: Submitting %s job for TSClient processing\n", taskType)
+	fmt.Printf("[DEBUG] Job Submission: Job file path: %s\n", jobFilePath)
 	fmt.Printf("[DEBUG] Job Submission: Original job ID: %s\n", originalJobID)
 
 	// In a full implementation, this would:
-	// 1. Create job record in database with WFO_RETEST task type
+	// 1. Create job record in database with the derived task type
 	// 2. Set appropriate job status and metadata
 	// 3. Trigger TSClient processing pipeline
 	// 4. Set up monitoring for completion
 
 	// For now, just log the action
 	fmt.Printf("[DEBUG] Job Submission: Implementation steps for full deployment:\n")
-	fmt.Printf("[DEBUG] Job Submission: 1. Create database record with WFO_RETEST task type\n")
+	fmt.Printf("[DEBUG] Job Submission: 1. Create database record with %s task type\n", taskType)
 	fmt.Printf("[DEBUG] Job Submission: 2. Set job status and metadata\n")
 	fmt.Printf("[DEBUG] Job Submission: 3. Trigger TSClient processing pipeline\n")
 	fmt.Printf("[DEBUG] Job Submission: 4. Set up completion monitoring\n")
-	fmt.Printf("[INFO] WFO_RETEST job submitted successfully - TSClient will process: %s\n", filepath.Base(xmlFilePath))
+	fmt.Printf("[INFO] %s job submitted successfully - TSClient will process: %s\n", taskType, filepath.Base(jobFilePath))
 
 	return nil
 }
@@ -1,7 +1,6 @@
 package main
 
 import (
-	"compress/zlib"
 	"encoding/json"
 	"encoding/xml"
 	"fmt"
@@ -18,19 +17,12 @@ func decompressJobFile(filePath string) (string, error) {
 	fmt.Printf("[DEBUG] Job File Decompression: Starting zlib decompression of file: %s\n", filePath)
 	wfoLogger.Info(fmt.Sprintf("Job File Decompression: Starting zlib decompression of file: %s", filePath))
 
-	file, err := os.Open(filePath)
+	// Encrypted job files are decrypted first; plain ones are read as zlib directly
+	reader, err := openCompressedFile(filePath)
 	if err != nil {
-		fmt.Printf("[ERROR] Job File Decompression: Failed to open file: %v\n", err)
-		wfoLogger.Error(fmt.Sprintf("Job File Decompression: Failed to open file: %v", err))
-		return "", fmt.Errorf("open compressed job file: %w", err)
-	}
-	defer file.Close()
-
-	reader, err := zlib.NewReader(file)
-	if err != nil {
-		fmt.Printf("[ERROR] Job File Decompression: Failed to create zlib reader: %v\n", err)
-		wfoLogger.Error(fmt.Sprintf("Job File Decompression: Failed to create zlib reader: %v", err))
-		return "", fmt.Errorf("create zlib reader for job file (file may not be zlib compressed): %w", err)
+		fmt.Printf("[ERROR] Job File Decompression: Failed to open job file: %v\n", err)
+		wfoLogger.Error(fmt.Sprintf("Job File Decompression: Failed to open job file: %v", err))
+		return "", fmt.Errorf("open compressed job file (file may not be zlib compressed or encrypted with another key): %w", err)
 	}
 	defer reader.Close()
 
@@ -101,6 +93,30 @@ func generateWFORetestXML(jobID, symbol, timeframe string, optResults []OPTResul
 		}
 	}
 
+	// Step 4b: Analyze parameter stability across runs and save it to the WFO report together with
+	// how each run's parameters were selected.
+	// A failure here only loses the report, so it must not block the retest job
+	report := newWFOReport(jobID, symbol, timeframe, totalRuns)
+	stability, err := buildParameterStabilityReport(originalXML, optResults)
+	if err != nil {
+		fmt.Printf("[WARN] XML Generation: Parameter stability analysis failed: %v\n", err)
+		wfoLogger.Error(fmt.Sprintf("XML Generation: Parameter stability analysis failed: %v", err))
+	} else {
+		fmt.Printf("[DEBUG] XML Generation: Parameter stability score %.1f across %d parameters\n", stability.Score, len(stability.Parameters))
+		report.ParameterStability = stability
+	}
+	for _, result := range optResults {
+		if result.Selection != nil {
+			report.ParameterSelection = append(report.ParameterSelection, *result.Selection)
+		}
+	}
+	if report.ParameterStability != nil || len(report.ParameterSelection) > 0 {
+		if err := saveWFOReport(report); err != nil {
+			fmt.Printf("[WARN] XML Generation: Failed to save WFO report: %v\n", err)
+			wfoLogger.Error(fmt.Sprintf("XML Generation: Failed to save WFO report: %v", err))
+		}
+	}
+
 	// Step 5: Generate WFO_RETEST XML for all runs with filename metadata
 	fmt.Printf("[DEBUG] XML Generation Step 5: Building complete WFO_RETEST XML structure with filename metadata\n")
 	wfoRetestXML, err := buildWFORetestXML(originalXML, optResults, retestRanges, jobID, symbol, timeframe, totalRuns, osPercentage)
@@ -147,24 +163,18 @@ func locateWFOJobFile(jobID, symbol, timeframe, taskType string) (string, error)
 	fmt.Printf("[DEBUG] Job File Location: Decompressed %d bytes from job file\n", len(xmlStr))
 	wfoLogger.Info(fmt.Sprintf("Job File Location: Decompressed %d bytes from job file", len(xmlStr)))
 
-	// Save decompressed content to debug file for examination
-	debugDir := "C:\\AlphaWeaver\\debug"
-	os.MkdirAll(debugDir, 0755)
-	debugFile := filepath.Join(debugDir, fmt.Sprintf("job_decompressed_%s.xml", filepath.Base(jobFilePath)))
-	err = os.WriteFile(debugFile, []byte(xmlStr), 0644)
-	if err == nil {
+	// Save decompressed content for examination when debug dumps are enabled
+	if debugFile, err := debugDumps.Write("job_decompressed_"+filepath.Base(jobFilePath)+".xml", []byte(xmlStr)); err != nil {
+		fmt.Printf("[WARN] Job File Location: Failed to write debug dump: %v\n", err)
+	} else if debugFile != "" {
 		fmt.Printf("[DEBUG] Job File Location: Saved decompressed content to: %s\n", debugFile)
 		wfoLogger.Info(fmt.Sprintf("Job File Location: Saved decompressed content to: %s", debugFile))
 	}
 
-	// Log first 500 characters of decompressed content for debugging
-	if len(xmlStr) > 500 {
-		fmt.Printf("[DEBUG] Job File Location: First 500 chars of XML: %s\n", xmlStr[:500])
-		wfoLogger.Info(fmt.Sprintf("Job File Location: First 500 chars of XML: %s", xmlStr[:500]))
-	} else {
-		fmt.Printf("[DEBUG] Job File Location: Complete XML content: %s\n", xmlStr)
-		wfoLogger.Info(fmt.Sprintf("Job File Location: Complete XML content: %s", xmlStr))
-	}
+	// Log the start of the decompressed content (parameters are redacted unless allowed)
+	preview := redact(xmlStr[:min(500, len(xmlStr))])
+	fmt.Printf("[DEBUG] Job File Location: First %d chars of XML: %s\n", min(500, len(xmlStr)), preview)
+	wfoLogger.Info(fmt.Sprintf("Job File Location: First %d chars of XML: %s", min(500, len(xmlStr)), preview))
 
 	fmt.Printf("[DEBUG] Job File Location: Validating XML content structure\n")
 
@@ -283,17 +293,30 @@ func createWFORetestJobElement(originalXML string, result OPTResult, retestRange
 
 	// Step 6: Replace parameters section with fixed parameters
 	fmt.Printf("[DEBUG] Job Element Creation Step 6: Replacing parameters with fixed values\n")
-	fmt.Printf("[DEBUG] Job Element Creation: Parameters JSON for run %d: %s\n", runNumber, result.ParametersJSON)
+	fmt.Printf("[DEBUG] Job Element Creation: Parameters JSON for run %d: %s\n", runNumber, logRedactor.RedactParameters(result.ParametersJSON))
 	jobXML, err := replaceParametersWithFixed(jobXML, result.ParametersJSON)
 	if err != nil {
 		fmt.Printf("[ERROR] Job Element Creation: Failed to replace parameters for run %d - %v\n", runNumber, err)
 		return "", fmt.Errorf("replace parameters for run %d: %w", runNumber, err)
 	}
 
+	// Step 7: Record which parameter selection strategy picked these values and why
+	if result.Selection != nil {
+		jobXML = addXMLTag(jobXML, "parameter_selection", escapeXMLText(result.Selection.Strategy))
+		jobXML = addXMLTag(jobXML, "parameter_selection_rationale", escapeXMLText(result.Selection.Rationale))
+	}
+
 	fmt.Printf("[DEBUG] Job Element Creation: Successfully created job element for run %d with fixed parameters and updated filename\n", runNumber)
 	return jobXML, nil
 }
 
+// escapeXMLText escapes a value for use as XML character data
+func escapeXMLText(value string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(value))
+	return b.String()
+}
+
 // replaceParametersWithFixed replaces optimization parameters with fixed values from OPT results
 func replaceParametersWithFixed(xmlStr, parametersJSON string) (result string, err error) {
 	// Add crash protection
@@ -307,39 +330,31 @@ func replaceParametersWithFixed(xmlStr, parametersJSON string) (result string, e
 	}()
 
 	fmt.Printf("[DEBUG] Parameter Replacement: Starting parameter transformation\n")
-	fmt.Printf("[DEBUG] Parameter Replacement: Raw parameters JSON: %s\n", parametersJSON)
-	wfoLogger.Info(fmt.Sprintf("Parameter Replacement: Raw parameters JSON: %s", parametersJSON))
-
-	// Fix double-escaped quotes in the JSON string
-	// Convert "" to " (double quotes to single quotes)
-	cleanedJSON := strings.ReplaceAll(parametersJSON, `""`, `"`)
+	fmt.Printf("[DEBUG] Parameter Replacement: Raw parameters JSON: %s\n", logRedactor.RedactParameters(parametersJSON))
+	wfoLogger.Info(fmt.Sprintf("Parameter Replacement: Raw parameters JSON: %s", logRedactor.RedactParameters(parametersJSON)))
 
-	// Remove outer quotes if the entire string is wrapped in quotes
-	if len(cleanedJSON) >= 2 && cleanedJSON[0] == '"' && cleanedJSON[len(cleanedJSON)-1] == '"' {
-		cleanedJSON = cleanedJSON[1 : len(cleanedJSON)-1]
-		fmt.Printf("[DEBUG] Parameter Replacement: Removed outer quotes from JSON\n")
-		wfoLogger.Info(fmt.Sprintf("Parameter Replacement: Removed outer quotes from JSON"))
-	}
+	// Fix double-escaped quotes and outer quoting written by TSClient
+	cleanedJSON := cleanParametersJSON(parametersJSON)
 
-	fmt.Printf("[DEBUG] Parameter Replacement: Final cleaned JSON: %s\n", cleanedJSON)
-	wfoLogger.Info(fmt.Sprintf("Parameter Replacement: Final cleaned JSON: %s", cleanedJSON))
+	fmt.Printf("[DEBUG] Parameter Replacement: Final cleaned JSON: %s\n", logRedactor.RedactParameters(cleanedJSON))
+	wfoLogger.Info(fmt.Sprintf("Parameter Replacement: Final cleaned JSON: %s", logRedactor.RedactParameters(cleanedJSON)))
 
 	// Parse optimized parameters from JSON
 	fmt.Printf("[DEBUG] Parameter Replacement: About to parse JSON with Unmarshal\n")
-	var optimizedParams map[string]interface{}
-	if err := json.Unmarshal([]byte(cleanedJSON), &optimizedParams); err != nil {
+	optimizedParams, err := parseOptimizedParameters(parametersJSON)
+	if err != nil {
 		fmt.Printf("[ERROR] Parameter Replacement: Failed to parse parameters JSON - %v\n", err)
-		fmt.Printf("[ERROR] Parameter Replacement: Original JSON: %s\n", parametersJSON)
-		fmt.Printf("[ERROR] Parameter Replacement: Cleaned JSON: %s\n", cleanedJSON)
+		fmt.Printf("[ERROR] Parameter Replacement: Original JSON: %s\n", logRedactor.RedactParameters(parametersJSON))
+		fmt.Printf("[ERROR] Parameter Replacement: Cleaned JSON: %s\n", logRedactor.RedactParameters(cleanedJSON))
 		wfoLogger.Error(fmt.Sprintf("Parameter Replacement: Failed to parse parameters JSON - %v", err))
-		wfoLogger.Error(fmt.Sprintf("Parameter Replacement: Original JSON: %s", parametersJSON))
-		wfoLogger.Error(fmt.Sprintf("Parameter Replacement: Cleaned JSON: %s", cleanedJSON))
+		wfoLogger.Error(fmt.Sprintf("Parameter Replacement: Original JSON: %s", logRedactor.RedactParameters(parametersJSON)))
+		wfoLogger.Error(fmt.Sprintf("Parameter Replacement: Cleaned JSON: %s", logRedactor.RedactParameters(cleanedJSON)))
 		return "", fmt.Errorf("parse parameters JSON: %w", err)
 	}
 	fmt.Printf("[DEBUG] Parameter Replacement: JSON parsing successful\n")
 	fmt.Printf("[DEBUG] Parameter Replacement: Parsed %d optimized parameters\n", len(optimizedParams))
 	for key, value := range optimizedParams {
-		fmt.Printf("[DEBUG] Parameter Replacement: - %s = %v\n", key, value)
+		fmt.Printf("[DEBUG] Parameter Replacement: - %s = %s\n", key, logRedactor.RedactParameters(fmt.Sprint(value)))
 	}
 
 	// Find and replace the parameters section
@@ -356,7 +371,7 @@ func replaceParametersWithFixed(xmlStr, parametersJSON string) (result string, e
 		if len(xmlStr) < snippetLength {
 			snippetLength = len(xmlStr)
 		}
-		fmt.Printf("[DEBUG] Parameter Replacement: XML snippet (first %d chars): %s\n", snippetLength, xmlStr[:snippetLength])
+		fmt.Printf("[DEBUG] Parameter Replacement: XML snippet (first %d chars): %s\n", snippetLength, redact(xmlStr[:snippetLength]))
 		return "", fmt.Errorf("parameters section not found in XML")
 	}
 
@@ -379,6 +394,26 @@ func replaceParametersWithFixed(xmlStr, parametersJSON string) (result string, e
 	fmt.Printf("[DEBUG] Parameter Replacement: Final XML size: %d bytes\n", len(result))
 	return result, nil
 }
+
+// cleanParametersJSON undoes the CSV quoting TSClient applies to parameters_json values
+// Doubled quotes ("") become single quotes and a wrapping pair of quotes is removed.
+func cleanParametersJSON(parametersJSON string) string {
+	cleanedJSON := strings.ReplaceAll(strings.TrimSpace(parametersJSON), `""`, `"`)
+	if len(cleanedJSON) >= 2 && cleanedJSON[0] == '"' && cleanedJSON[len(cleanedJSON)-1] == '"' {
+		cleanedJSON = cleanedJSON[1 : len(cleanedJSON)-1]
+	}
+	return cleanedJSON
+}
+
+// parseOptimizedParameters parses a parameters_json value from an OPT file into a name -> value map
+func parseOptimizedParameters(parametersJSON string) (map[string]interface{}, error) {
+	var params map[string]interface{}
+	if err := json.Unmarshal([]byte(cleanParametersJSON(parametersJSON)), &params); err != nil {
+		return nil, err
+	}
+	return params, nil
+}
+
 // transformParametersToFixed converts OptRange parameters to Fixed parameters using optimized values
 // IMPORTANT: Only processes top-level parameter nodes under <parameters> and preserves their wrappers.
 func transformParametersToFixed(originalParams string, optimizedValues map[string]interface{}) (string, error) {
@@ -456,9 +491,9 @@ func transformParametersToFixed(originalParams string, optimizedValues map[strin
 			// Use optimized value if available; otherwise keep existing <value>
 			if ov, ok := optimizedValues[p.Name]; ok {
 				value = fmt.Sprintf("%v", ov)
-				fmt.Printf("[DEBUG] Parameter Transformation: Using optimized value for %s: %s\n", p.Name, value)
+				fmt.Printf("[DEBUG] Parameter Transformation: Using optimized value for %s: %s\n", p.Name, logRedactor.RedactParameters(value))
 			} else {
-				fmt.Printf("[DEBUG] Parameter Transformation: No optimized value for %s, keeping current value: %s\n", p.Name, value)
+				fmt.Printf("[DEBUG] Parameter Transformation: No optimized value for %s, keeping current value: %s\n", p.Name, logRedactor.RedactParameters(value))
 			}
 
 			// Determine Fixed vs FixedString vs FixedBool by data_type
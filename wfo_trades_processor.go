@@ -25,6 +25,26 @@ type TradeRecord struct {
 	PnL         float64 `json:"pnl"`          // Profit/Loss
 	TestType    string  `json:"test_type"`    // "IS" or "OS" from CSV
 	Timestamp   time.Time `json:"-"`          // Parsed datetime for sorting
+	EntryTimestamp time.Time `json:"-"`       // Parsed entry datetime (time in market)
+
+	// Remaining TSClient columns, kept for trade-level analysis
+	StrategyName string  `json:"strategy_name"`
+	TaskNo       string  `json:"task_no"`
+	ProjectID    string  `json:"project_id"`
+	EntryPrice   float64 `json:"entry_price"`
+	StopPrice    float64 `json:"stop_price"`
+	Position     int     `json:"position"` // 1 long, -1 short
+	Risk         float64 `json:"risk"`     // Initial risk in currency (1R)
+	ATR          float64 `json:"atr"`
+	CurrencyConv float64 `json:"currency_conv"`
+	Equity       float64 `json:"equity"`
+	Slippage     float64 `json:"slippage"` // Per side
+	MAE          float64 `json:"mae"`      // Maximum adverse excursion (currency)
+	MFE          float64 `json:"mfe"`      // Maximum favorable excursion (currency)
+	ISStartDate  string  `json:"is_start_date"`
+	ISEndDate    string  `json:"is_end_date"`
+	OSStartDate  string  `json:"os_start_date"`
+	OSEndDate    string  `json:"os_end_date"`
 }
 
 // EquityCurveData represents equity curve analysis for IS or OS period
@@ -51,11 +71,19 @@ type EquityCurveData struct {
 	Drawdown         []float64 `json:"drawdown"`
 	DailyReturns     []float64 `json:"daily_returns"`
 	NetProfit        []float64 `json:"net_profit"`
+	InitialCapital   float64   `json:"initial_capital"`
+	Metrics          *PerformanceMetrics `json:"metrics,omitempty"`
+	Underwater       []float64 `json:"underwater"`        // Drawdown from running peak as a fraction (<= 0)
+	DrawdownEpisodes []DrawdownEpisode `json:"drawdown_episodes"` // Deepest episodes first
+	ReturnsCalendar  *ReturnsCalendar `json:"returns_calendar,omitempty"`
+	Resimulation     *ResimulationSummary `json:"resimulation,omitempty"` // Set on re-simulated comparison curves
 }
 
 // DualEquityCurves represents the final JSON structure with IS and OS curves
 type DualEquityCurves struct {
 	EquityCurves map[string]EquityCurveData `json:"equity_curves"`
+	Report       *WFOReport                 `json:"wfo_report,omitempty"`
+	MonteCarlo   *MonteCarloResult          `json:"monte_carlo,omitempty"`
 }
 
 // processCombinedTradesList is the main function for Phase 3 - processes trades CSV and generates IS/OS equity curves
@@ -72,6 +100,15 @@ func (ac *APIClient) processCombinedTradesList(jobID, symbol, timeframe string,
 	}
 	fmt.Printf("✅ [WFO-PROCESSOR] Step 1 SUCCESS: Read %d trades, metadata: %+v\n", len(trades), metadata)
 
+	// Starting capital comes from the original WFO job so metrics match the strategy settings
+	initialCapital := defaultInitialCapital
+	if originalXML, err := locateWFOJobFile(jobID, symbol, timeframe, "WFO"); err != nil {
+		fmt.Printf("⚠️ [WFO-PROCESSOR] Could not read WFO job for initialCapital, using %.0f: %v\n", initialCapital, err)
+	} else {
+		initialCapital = initialCapitalFromJobXML(originalXML)
+	}
+	metadata["initial_capital"] = initialCapital
+
 	// Step 2: Filter trades by IS and OS periods
 	fmt.Printf("🔍 [WFO-PROCESSOR] Step 2: Filtering trades by IS/OS periods\n")
 	isTrades, osTrades, err := ac.filterTradesByPeriod(trades, retestRanges)
@@ -113,6 +150,35 @@ func (ac *APIClient) processCombinedTradesList(jobID, symbol, timeframe string,
 	}
 	fmt.Printf("✅ [WFO-PROCESSOR] Step 5 SUCCESS: Created dual curves with keys: %s, %s\n", isKey, osKey)
 
+	// Attach the WFO report (parameter stability etc.) written during retest XML generation
+	// and extend it with the trade excursion analysis
+	report, err := loadWFOReport(jobID, symbol, timeframe)
+	if err != nil {
+		fmt.Printf("⚠️ [WFO-PROCESSOR] No existing WFO report, starting a new one: %v\n", err)
+		report = newWFOReport(jobID, symbol, timeframe, isEquityCurve.TotalRuns)
+	}
+	report.TradeExcursion = map[string]TradeExcursionReport{
+		"IS": analyzeTradeExcursions(isTrades, ac.config.Analysis.StopPercentile),
+		"OS": analyzeTradeExcursions(osTrades, ac.config.Analysis.StopPercentile),
+	}
+	if err := saveWFOReport(report); err != nil {
+		fmt.Printf("⚠️ [WFO-PROCESSOR] Failed to update WFO report: %v\n", err)
+	}
+	dualCurves.Report = report
+
+	// Monte Carlo robustness simulation on the OS trades
+	if mcConfig := ac.config.Analysis.MonteCarlo; mcConfig.Enabled && len(osTrades) > 0 {
+		fmt.Printf("🎲 [WFO-PROCESSOR] Running Monte Carlo (%s, %d iterations) on %d OS trades\n", mcConfig.Mode, mcConfig.Iterations, len(osTrades))
+		mc, err := runMonteCarlo(osTrades, osEquityCurve.InitialCapital, mcConfig)
+		if err != nil {
+			fmt.Printf("⚠️ [WFO-PROCESSOR] Monte Carlo simulation skipped: %v\n", err)
+		} else {
+			mc.TestType = "OS"
+			dualCurves.MonteCarlo = mc
+			fmt.Printf("✅ [WFO-PROCESSOR] Monte Carlo: probability of ruin %.1f%%\n", mc.ProbabilityOfRuin*100)
+		}
+	}
+
 	// Step 6: Save and upload dual equity curves
 	fmt.Printf("💾 [WFO-PROCESSOR] Step 6: Saving and uploading dual equity curves\n")
 	if err := ac.saveDualEquityCurves(dualCurves, jobID, symbol, timeframe); err != nil {
@@ -125,6 +191,20 @@ func (ac *APIClient) processCombinedTradesList(jobID, symbol, timeframe string,
 	return nil
 }
 
+// tradeDebugFunc receives per-record debug output while a trades CSV is parsed; nil discards it
+type tradeDebugFunc func(format string, args ...interface{})
+
+func (f tradeDebugFunc) printf(format string, args ...interface{}) {
+	if f != nil {
+		f(format, args...)
+	}
+}
+
+// printTradeDebug is the tradeDebugFunc writing to stdout
+func printTradeDebug(format string, args ...interface{}) {
+	fmt.Printf(format, args...)
+}
+
 // readTradesCSV reads and parses the trades CSV file generated by TSClient
 func (ac *APIClient) readTradesCSV(jobID, symbol, timeframe string) ([]TradeRecord, map[string]interface{}, error) {
 	fmt.Printf("🔍 [CSV-READER] Searching for trades CSV file\n")
@@ -161,57 +241,67 @@ func (ac *APIClient) readTradesCSV(jobID, symbol, timeframe string) ([]TradeReco
 	metadata := extractMetadataFromFilename(filepath.Base(tradesFilePath))
 	fmt.Printf("📊 [CSV-READER] Extracted metadata: %+v\n", metadata)
 
+	trades, err := readTradesCSVFile(tradesFilePath, printTradeDebug)
+	if err != nil {
+		return nil, nil, err
+	}
+	return trades, metadata, nil
+}
+
+// readTradesCSVFile reads and parses a TSClient trades CSV, returning trades sorted by exit time.
+// Parsing details go to debugf; pass nil to parse quietly.
+func readTradesCSVFile(tradesFilePath string, debugf tradeDebugFunc) ([]TradeRecord, error) {
 	// Read and parse CSV file
-	fmt.Printf("📂 [CSV-READER] Opening CSV file for reading\n")
+	debugf.printf("📂 [CSV-READER] Opening CSV file for reading\n")
 	file, err := os.Open(tradesFilePath)
 	if err != nil {
-		fmt.Printf("❌ [CSV-READER] Failed to open file: %v\n", err)
-		return nil, nil, fmt.Errorf("open trades CSV file: %w", err)
+		debugf.printf("❌ [CSV-READER] Failed to open file: %v\n", err)
+		return nil, fmt.Errorf("open trades CSV file: %w", err)
 	}
 	defer file.Close()
 
 	reader := csv.NewReader(file)
 	records, err := reader.ReadAll()
 	if err != nil {
-		fmt.Printf("❌ [CSV-READER] Failed to read CSV: %v\n", err)
-		return nil, nil, fmt.Errorf("read trades CSV: %w", err)
+		debugf.printf("❌ [CSV-READER] Failed to read CSV: %v\n", err)
+		return nil, fmt.Errorf("read trades CSV: %w", err)
 	}
 
-	fmt.Printf("📊 [CSV-READER] Read %d total records from CSV\n", len(records))
+	debugf.printf("📊 [CSV-READER] Read %d total records from CSV\n", len(records))
 	if len(records) < 2 {
-		fmt.Printf("❌ [CSV-READER] Insufficient data: need at least 2 records (header + data)\n")
-		return nil, nil, fmt.Errorf("insufficient data in trades CSV file")
+		debugf.printf("❌ [CSV-READER] Insufficient data: need at least 2 records (header + data)\n")
+		return nil, fmt.Errorf("insufficient data in trades CSV file")
 	}
 
 	// Log header for format verification
 	if len(records) > 0 {
-		fmt.Printf("📋 [CSV-READER] CSV Header: %v\n", records[0])
-		fmt.Printf("📋 [CSV-READER] Header has %d columns\n", len(records[0]))
+		debugf.printf("📋 [CSV-READER] CSV Header: %v\n", records[0])
+		debugf.printf("📋 [CSV-READER] Header has %d columns\n", len(records[0]))
 	}
 
 	// Parse trades records
 	var trades []TradeRecord
-	fmt.Printf("🔄 [CSV-READER] Parsing %d data records\n", len(records)-1)
+	debugf.printf("🔄 [CSV-READER] Parsing %d data records\n", len(records)-1)
 	for i, record := range records[1:] { // Skip header
 		if i < 3 { // Log first few records for debugging
-			fmt.Printf("📄 [CSV-READER] Record %d: %v\n", i+1, record)
+			debugf.printf("📄 [CSV-READER] Record %d: %v\n", i+1, record)
 		}
-		trade, err := parseTradeRecord(record, i+1)
+		trade, err := parseTradeRecord(record, i+1, debugf)
 		if err != nil {
-			fmt.Printf("❌ [CSV-READER] Failed to parse record %d: %v\n", i+1, err)
-			return nil, nil, fmt.Errorf("parse trade record %d: %w", i+1, err)
+			debugf.printf("❌ [CSV-READER] Failed to parse record %d: %v\n", i+1, err)
+			return nil, fmt.Errorf("parse trade record %d: %w", i+1, err)
 		}
 		trades = append(trades, trade)
 	}
 
 	// Sort trades by timestamp for proper equity calculation
-	fmt.Printf("🔄 [CSV-READER] Sorting %d trades by timestamp\n", len(trades))
+	debugf.printf("🔄 [CSV-READER] Sorting %d trades by timestamp\n", len(trades))
 	sort.Slice(trades, func(i, j int) bool {
 		return trades[i].Timestamp.Before(trades[j].Timestamp)
 	})
 
-	fmt.Printf("✅ [CSV-READER] Successfully parsed %d trades from CSV file\n", len(trades))
-	return trades, metadata, nil
+	debugf.printf("✅ [CSV-READER] Successfully parsed %d trades from CSV file\n", len(trades))
+	return trades, nil
 }
 
 // extractMetadataFromFilename parses metadata from trades CSV filename
@@ -242,27 +332,53 @@ func extractMetadataFromFilename(filename string) map[string]interface{} {
 
 // parseTradeRecord parses a single trade record from CSV
 // TSClient format: Strategy Name,Task No,Project ID,entry_date,entry_price,exit_date,exit_price,stop_price,position,profit,risk,size,symbol,atr,currency_conv,equity,commission,slippage,mae,mfe,run_no,test_type,is_start_date,is_end_date,os_start_date,os_end_date
-func parseTradeRecord(record []string, recordNum int) (TradeRecord, error) {
-	fmt.Printf("🔧 [TRADE-PARSER] Parsing record %d with %d columns\n", recordNum, len(record))
+func parseTradeRecord(record []string, recordNum int, debugf tradeDebugFunc) (TradeRecord, error) {
+	debugf.printf("🔧 [TRADE-PARSER] Parsing record %d with %d columns\n", recordNum, len(record))
 
 	if len(record) < 26 {
-		fmt.Printf("❌ [TRADE-PARSER] Record %d has insufficient columns: expected 26, got %d\n", recordNum, len(record))
+		debugf.printf("❌ [TRADE-PARSER] Record %d has insufficient columns: expected 26, got %d\n", recordNum, len(record))
 		return TradeRecord{}, fmt.Errorf("insufficient columns in record %d: expected 26, got %d", recordNum, len(record))
 	}
 
 	// Parse TSClient trade record format
 	// Since this is a complete trade (entry + exit), we'll treat it as an "Exit" with PnL
 	trade := TradeRecord{
-		EntryExit: "Exit", // Each record represents a complete trade
-		Symbol:    strings.TrimSpace(record[12]), // symbol column
-	}
+		EntryExit:    "Exit",                        // Each record represents a complete trade
+		Symbol:       strings.TrimSpace(record[12]), // symbol column
+		StrategyName: strings.TrimSpace(record[0]),
+		TaskNo:       strings.TrimSpace(record[1]),
+		ProjectID:    strings.TrimSpace(record[2]),
+		ISStartDate:  strings.TrimSpace(record[22]),
+		ISEndDate:    strings.TrimSpace(record[23]),
+		OSStartDate:  strings.TrimSpace(record[24]),
+		OSEndDate:    strings.TrimSpace(record[25]),
+	}
+
+	// Analysis columns; a blank or malformed value is logged and left at zero
+	trade.EntryPrice = parseTradeFloat(record, 4, "entry_price", recordNum, debugf)
+	trade.StopPrice = parseTradeFloat(record, 7, "stop_price", recordNum, debugf)
+	trade.Position = int(parseTradeFloat(record, 8, "position", recordNum, debugf))
+	trade.Risk = parseTradeFloat(record, 10, "risk", recordNum, debugf)
+	trade.ATR = parseTradeFloat(record, 13, "atr", recordNum, debugf)
+	trade.CurrencyConv = parseTradeFloat(record, 14, "currency_conv", recordNum, debugf)
+	trade.Equity = parseTradeFloat(record, 15, "equity", recordNum, debugf)
+	trade.Slippage = parseTradeFloat(record, 17, "slippage", recordNum, debugf)
+	trade.MAE = parseTradeFloat(record, 18, "mae", recordNum, debugf)
+	trade.MFE = parseTradeFloat(record, 19, "mfe", recordNum, debugf)
 
 	// Parse run number from run_no column (index 20)
 	if runNum, err := strconv.Atoi(strings.TrimSpace(record[20])); err == nil {
 		trade.RunNumber = runNum
-		fmt.Printf("🔧 [TRADE-PARSER] Record %d: Run=%d\n", recordNum, runNum)
+		debugf.printf("🔧 [TRADE-PARSER] Record %d: Run=%d\n", recordNum, runNum)
 	} else {
-		fmt.Printf("⚠️ [TRADE-PARSER] Record %d: Failed to parse run number '%s': %v\n", recordNum, record[20], err)
+		debugf.printf("⚠️ [TRADE-PARSER] Record %d: Failed to parse run number '%s': %v\n", recordNum, record[20], err)
+	}
+
+	// Parse entry date from entry_date column (index 3)
+	if entryDate, err := parseTradeDateTime(strings.TrimSpace(record[3])); err == nil {
+		trade.EntryTimestamp = entryDate
+	} else {
+		debugf.printf("⚠️ [TRADE-PARSER] Record %d: Failed to parse entry date '%s': %v\n", recordNum, record[3], err)
 	}
 
 	// Parse exit date from exit_date column (index 5)
@@ -271,50 +387,64 @@ func parseTradeRecord(record []string, recordNum int) (TradeRecord, error) {
 		trade.Date = exitDate.Format("20060102")     // YYYYMMDD
 		trade.Time = exitDate.Format("1504")         // HHMM
 		trade.Timestamp = exitDate
-		fmt.Printf("🔧 [TRADE-PARSER] Record %d: Date=%s, Time=%s\n", recordNum, trade.Date, trade.Time)
+		debugf.printf("🔧 [TRADE-PARSER] Record %d: Date=%s, Time=%s\n", recordNum, trade.Date, trade.Time)
 	} else {
-		fmt.Printf("⚠️ [TRADE-PARSER] Record %d: Failed to parse exit date '%s': %v\n", recordNum, exitDateStr, err)
+		debugf.printf("⚠️ [TRADE-PARSER] Record %d: Failed to parse exit date '%s': %v\n", recordNum, exitDateStr, err)
 	}
 
 	// Parse position size from size column (index 11)
 	if size, err := strconv.Atoi(strings.TrimSpace(record[11])); err == nil {
 		trade.Quantity = size
 	} else {
-		fmt.Printf("⚠️ [TRADE-PARSER] Record %d: Failed to parse size '%s': %v\n", recordNum, record[11], err)
+		debugf.printf("⚠️ [TRADE-PARSER] Record %d: Failed to parse size '%s': %v\n", recordNum, record[11], err)
 	}
 
 	// Parse exit price from exit_price column (index 6)
 	if price, err := strconv.ParseFloat(strings.TrimSpace(record[6]), 64); err == nil {
 		trade.Price = price
 	} else {
-		fmt.Printf("⚠️ [TRADE-PARSER] Record %d: Failed to parse exit price '%s': %v\n", recordNum, record[6], err)
+		debugf.printf("⚠️ [TRADE-PARSER] Record %d: Failed to parse exit price '%s': %v\n", recordNum, record[6], err)
 	}
 
 	// Parse commission from commission column (index 16)
 	if commission, err := strconv.ParseFloat(strings.TrimSpace(record[16]), 64); err == nil {
 		trade.Commission = commission
 	} else {
-		fmt.Printf("⚠️ [TRADE-PARSER] Record %d: Failed to parse commission '%s': %v\n", recordNum, record[16], err)
+		debugf.printf("⚠️ [TRADE-PARSER] Record %d: Failed to parse commission '%s': %v\n", recordNum, record[16], err)
 	}
 
 	// Parse profit from profit column (index 9)
 	if profit, err := strconv.ParseFloat(strings.TrimSpace(record[9]), 64); err == nil {
 		trade.PnL = profit
-		fmt.Printf("🔧 [TRADE-PARSER] Record %d: PnL=%.2f\n", recordNum, profit)
+		debugf.printf("🔧 [TRADE-PARSER] Record %d: PnL=%.2f\n", recordNum, profit)
 	} else {
-		fmt.Printf("⚠️ [TRADE-PARSER] Record %d: Failed to parse profit '%s': %v\n", recordNum, record[9], err)
+		debugf.printf("⚠️ [TRADE-PARSER] Record %d: Failed to parse profit '%s': %v\n", recordNum, record[9], err)
 	}
 
 	// Parse test type from test_type column (index 21)
 	trade.TestType = strings.TrimSpace(record[21])
-	fmt.Printf("🔧 [TRADE-PARSER] Record %d: TestType=%s\n", recordNum, trade.TestType)
+	debugf.printf("🔧 [TRADE-PARSER] Record %d: TestType=%s\n", recordNum, trade.TestType)
 
-	fmt.Printf("✅ [TRADE-PARSER] Record %d parsed: Symbol=%s, Run=%d, PnL=%.2f, TestType=%s, Date=%s\n",
+	debugf.printf("✅ [TRADE-PARSER] Record %d parsed: Symbol=%s, Run=%d, PnL=%.2f, TestType=%s, Date=%s\n",
 		recordNum, trade.Symbol, trade.RunNumber, trade.PnL, trade.TestType, trade.Date)
 
 	return trade, nil
 }
 
+// parseTradeFloat parses a numeric trades CSV column, returning 0 for blank or invalid values
+func parseTradeFloat(record []string, index int, column string, recordNum int, debugf tradeDebugFunc) float64 {
+	value := strings.TrimSpace(record[index])
+	if value == "" {
+		return 0
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		debugf.printf("⚠️ [TRADE-PARSER] Record %d: Failed to parse %s '%s': %v\n", recordNum, column, value, err)
+		return 0
+	}
+	return f
+}
+
 // parseTradeDateTime converts TSClient datetime format to time.Time
 func parseTradeDateTime(datetimeStr string) (time.Time, error) {
 	// TSClient format: "1/17/2007 16:00:00"
@@ -407,6 +537,10 @@ func (ac *APIClient) generateEquityCurve(trades []TradeRecord, retestRanges []WF
 	if osPercent, ok := metadata["os_percentage"]; ok {
 		curve.OSPercentage = osPercent.(int)
 	}
+	curve.InitialCapital = defaultInitialCapital
+	if capital, ok := metadata["initial_capital"].(float64); ok && capital > 0 {
+		curve.InitialCapital = capital
+	}
 
 	// Calculate date range for this test type
 	if testType == "IS" {
@@ -428,13 +562,19 @@ func (ac *APIClient) generateEquityCurve(trades []TradeRecord, retestRanges []WF
 	return curve, nil
 }
 
-// calculateEquityProgression computes daily equity arrays from trades
+// calculateEquityProgression computes daily equity arrays and performance metrics from trades
 func (ac *APIClient) calculateEquityProgression(curve *EquityCurveData, trades []TradeRecord) error {
+	initialCapital := curve.InitialCapital
+	if initialCapital <= 0 {
+		initialCapital = defaultInitialCapital
+	}
+
 	if len(trades) == 0 {
 		// No trades for this period
 		curve.Profit = "0"
 		curve.MaxDrawdown = "0"
 		curve.NetProfitDrawdown = "0"
+		curve.Metrics = calculatePerformanceMetrics(curve, trades, initialCapital)
 		return nil
 	}
 
@@ -452,21 +592,29 @@ func (ac *APIClient) calculateEquityProgression(curve *EquityCurveData, trades [
 	}
 	sort.Strings(dates)
 
+	dailyPnL := make([]float64, len(dates))
+	for i, date := range dates {
+		// Sum PnL for all trades on this date
+		for _, trade := range tradesByDate[date] {
+			dailyPnL[i] += tradeNetPnL(trade)
+		}
+	}
+
+	ac.populateEquityCurve(curve, dates, dailyPnL, trades, initialCapital)
+	return nil
+}
+
+// populateEquityCurve fills the curve arrays, summary values and analysis from one P&L value per date.
+// trades may be nil when only daily results are known (e.g. daily summaries); trade statistics are then zero.
+func (ac *APIClient) populateEquityCurve(curve *EquityCurveData, dates []string, dailyPnL []float64, trades []TradeRecord, initialCapital float64) {
 	// Initialize equity calculation
-	initialCapital := 100000.0 // Default initial capital
 	currentEquity := initialCapital
 	runningPeak := initialCapital
 	totalProfit := 0.0
 
 	// Calculate daily equity progression
-	for _, date := range dates {
-		dayTrades := tradesByDate[date]
-		dayPnL := 0.0
-
-		// Sum PnL for all trades on this date
-		for _, trade := range dayTrades {
-			dayPnL += trade.PnL - trade.Commission
-		}
+	for i, date := range dates {
+		dayPnL := dailyPnL[i]
 
 		// Update equity
 		currentEquity += dayPnL
@@ -517,7 +665,28 @@ func (ac *APIClient) calculateEquityProgression(curve *EquityCurveData, trades [
 		curve.NetProfitDrawdown = "0.00"
 	}
 
-	return nil
+	// Drawdown episodes and underwater curve
+	episodes, underwater := analyzeDrawdowns(curve.Dates, curve.CumulativePnL, initialCapital)
+	curve.Underwater = underwater
+	curve.DrawdownEpisodes = topDrawdownEpisodes(episodes, ac.drawdownTopN())
+
+	var calendar ReturnsCalendar
+	if len(trades) > 0 {
+		calendar = buildReturnsCalendarFromTrades(trades, initialCapital)
+	} else {
+		calendar = buildReturnsCalendarFromEquity(curve.Dates, curve.CumulativePnL, initialCapital)
+	}
+	curve.ReturnsCalendar = &calendar
+
+	curve.Metrics = calculatePerformanceMetrics(curve, trades, initialCapital)
+}
+
+// drawdownTopN returns how many drawdown episodes to keep on each equity curve
+func (ac *APIClient) drawdownTopN() int {
+	if ac.config != nil && ac.config.Analysis.DrawdownTopN > 0 {
+		return ac.config.Analysis.DrawdownTopN
+	}
+	return defaultDrawdownTopN
 }
 
 // Helper functions for date range calculation
@@ -602,7 +771,7 @@ func (ac *APIClient) saveDualEquityCurves(curves DualEquityCurves, jobID, symbol
 	}
 	fmt.Printf("✅ [JSON-SAVER] Directory created/verified\n")
 
-	if err := os.WriteFile(localPath, jsonData, 0644); err != nil {
+	if err := writeFileAtomic(localPath, jsonData, 0644); err != nil {
 		fmt.Printf("❌ [JSON-SAVER] Failed to write file: %v\n", err)
 		return fmt.Errorf("write dual equity curves file: %w", err)
 	}